@@ -16,8 +16,10 @@ type Config struct {
 	Database      DatabaseConfig      `json:"database" yaml:"database" mapstructure:"database"`
 	UserService   UserServiceConfig   `json:"user_service" yaml:"user_service" mapstructure:"user_service"`
 	FileService   FileServiceConfig   `json:"file_service" yaml:"file_service" mapstructure:"file_service"`
+	Storage       StorageConfig       `json:"storage" yaml:"storage" mapstructure:"storage"`
 	Prometheus    PromConfig          `json:"prometheus" yaml:"prometheus"  mapstructure:"prometheus"`
 	Cache         CacheConfig         `json:"cache" yaml:"cache" mapstructure:"cache"`
+	Webhook       WebhookConfig       `json:"webhook" yaml:"webhook" mapstructure:"webhook"`
 	Email         EMailConfig         `json:"email" yaml:"email" mapstructure:"email"`
 	EmailTemplate EmailTemplateConfig `json:"email_template" yaml:"email_template" mapstructure:"email_template"`
 	Log           LogConfig           `json:"log" yaml:"log" mapstructure:"log"`
@@ -79,10 +81,131 @@ type UserServiceConfig struct {
 
 //FileServiceConfig 文件服务配置
 type FileServiceConfig struct {
+	BasePath     string          `json:"basepath" yaml:"basepath" mapstructure:"basepath"`
+	Upload       UploadConfig    `json:"upload" yaml:"upload" mapstructure:"upload"`
+	Trash        TrashConfig     `json:"trash" yaml:"trash" mapstructure:"trash"`
+	Version      VersionConfig   `json:"version" yaml:"version" mapstructure:"version"`
+	Blob         BlobConfig      `json:"blob" yaml:"blob" mapstructure:"blob"`
+	Share        ShareConfig     `json:"share" yaml:"share" mapstructure:"share"`
+	Thumbnail    ThumbnailConfig `json:"thumbnail" yaml:"thumbnail" mapstructure:"thumbnail"`
+	Copy         CopyConfig      `json:"copy" yaml:"copy" mapstructure:"copy"`
+	Fsck         FsckConfig      `json:"fsck" yaml:"fsck" mapstructure:"fsck"`
+	Extract      ExtractConfig   `json:"extract" yaml:"extract" mapstructure:"extract"`
+	DefaultQuota int64           `json:"default_quota" yaml:"default_quota" mapstructure:"default_quota"`
+	absolutePath string
+}
+
+//UploadConfig 断点续传上传配置
+type UploadConfig struct {
+	MaxSize       int64         `json:"max_size" yaml:"max_size" mapstructure:"max_size"`
+	Expiration    time.Duration `json:"expiration" yaml:"expiration" mapstructure:"expiration"`
+	PurgeInterval time.Duration `json:"purge_interval" yaml:"purge_interval" mapstructure:"purge_interval"`
+}
+
+//TrashConfig 回收站配置
+type TrashConfig struct {
+	Retention     time.Duration `json:"retention" yaml:"retention" mapstructure:"retention"`
+	PurgeInterval time.Duration `json:"purge_interval" yaml:"purge_interval" mapstructure:"purge_interval"`
+}
+
+//VersionConfig 文件历史版本配置，MaxCount和MaxAge为0时不限制
+type VersionConfig struct {
+	MaxCount      int           `json:"max_count" yaml:"max_count" mapstructure:"max_count"`
+	MaxAge        time.Duration `json:"max_age" yaml:"max_age" mapstructure:"max_age"`
+	PurgeInterval time.Duration `json:"purge_interval" yaml:"purge_interval" mapstructure:"purge_interval"`
+}
+
+//BlobConfig 文件内容配置，不再被引用的内容在释放时以及每隔PurgeInterval清理一次
+type BlobConfig struct {
+	PurgeInterval time.Duration `json:"purge_interval" yaml:"purge_interval" mapstructure:"purge_interval"`
+}
+
+//ShareConfig 文件分享配置，连续输错MaxPasswordAttempts次密码后分享被锁定LockoutDuration
+type ShareConfig struct {
+	MaxPasswordAttempts int           `json:"max_password_attempts" yaml:"max_password_attempts" mapstructure:"max_password_attempts"`
+	LockoutDuration     time.Duration `json:"lockout_duration" yaml:"lockout_duration" mapstructure:"lockout_duration"`
+}
+
+//ThumbnailConfig 缩略图配置，Workers为0时不在后台生成，只在请求缩略图时生成
+type ThumbnailConfig struct {
+	Workers       int   `json:"workers" yaml:"workers" mapstructure:"workers"`
+	QueueSize     int   `json:"queue_size" yaml:"queue_size" mapstructure:"queue_size"`
+	MaxSourceSize int64 `json:"max_source_size" yaml:"max_source_size" mapstructure:"max_source_size"`
+	MaxPixels     int64 `json:"max_pixels" yaml:"max_pixels" mapstructure:"max_pixels"`
+}
+
+//CopyConfig 复制配置，复制的文件数量超过AsyncThreshold时在后台复制
+type CopyConfig struct {
+	AsyncThreshold int `json:"async_threshold" yaml:"async_threshold" mapstructure:"async_threshold"`
+}
+
+//FsckConfig 存储一致性检查配置，Interval为0时不定期检查，Mode为report、repair或quarantine，
+//存储中修改时间在GracePeriod之内的对象不会被当作孤立对象，以免误删正在上传的内容
+type FsckConfig struct {
+	Interval    time.Duration `json:"interval" yaml:"interval" mapstructure:"interval"`
+	Mode        string        `json:"mode" yaml:"mode" mapstructure:"mode"`
+	GracePeriod time.Duration `json:"grace_period" yaml:"grace_period" mapstructure:"grace_period"`
+}
+
+//ExtractConfig 归档解压配置，项目数量超过AsyncThreshold时在后台解压，
+//项目数量超过MaxEntries、解压后的总大小超过MaxSize或者超过归档大小的MaxRatio倍时拒绝解压
+type ExtractConfig struct {
+	AsyncThreshold int   `json:"async_threshold" yaml:"async_threshold" mapstructure:"async_threshold"`
+	MaxEntries     int   `json:"max_entries" yaml:"max_entries" mapstructure:"max_entries"`
+	MaxSize        int64 `json:"max_size" yaml:"max_size" mapstructure:"max_size"`
+	MaxRatio       int64 `json:"max_ratio" yaml:"max_ratio" mapstructure:"max_ratio"`
+}
+
+//StorageConfig 文件内容存储配置
+type StorageConfig struct {
+	Engine      string             `json:"engine" yaml:"engine" mapstructure:"engine"`
+	Local       LocalStorageConfig `json:"local" yaml:"local" mapstructure:"local"`
+	S3          S3StorageConfig    `json:"s3" yaml:"s3" mapstructure:"s3"`
+	Encryption  EncryptionConfig   `json:"encryption" yaml:"encryption" mapstructure:"encryption"`
+	Compression CompressionConfig  `json:"compression" yaml:"compression" mapstructure:"compression"`
+}
+
+//CompressionConfig 压缩存储配置，内容的MIME类型或者扩展名匹配Rules中的规则时使用规则的Encoding(zstd或者gzip)压缩后存储，
+//小于MinSize的内容不压缩
+type CompressionConfig struct {
+	Enable  bool              `json:"enable" yaml:"enable" mapstructure:"enable"`
+	MinSize int64             `json:"min_size" yaml:"min_size" mapstructure:"min_size"`
+	Rules   []CompressionRule `json:"rules" yaml:"rules" mapstructure:"rules"`
+}
+
+//CompressionRule 压缩规则，Types中的MIME类型可以使用"text/*"匹配同一大类，Extensions包含开头的"."
+type CompressionRule struct {
+	Encoding   string   `json:"encoding" yaml:"encoding" mapstructure:"encoding"`
+	Types      []string `json:"types" yaml:"types" mapstructure:"types"`
+	Extensions []string `json:"extensions" yaml:"extensions" mapstructure:"extensions"`
+}
+
+//EncryptionConfig 静态加密配置，主密钥的格式为"id:base64编码的32字节密钥"，
+//MasterKeys和KeyFile(每行一个主密钥)中的密钥合并使用，KeyID为加密新数据密钥使用的主密钥，只有一个主密钥时可以为空
+type EncryptionConfig struct {
+	Enable     bool     `json:"enable" yaml:"enable" mapstructure:"enable"`
+	KeyID      string   `json:"key_id" yaml:"key_id" mapstructure:"key_id"`
+	MasterKeys []string `json:"master_keys" yaml:"master_keys" mapstructure:"master_keys"`
+	KeyFile    string   `json:"key_file" yaml:"key_file" mapstructure:"key_file"`
+}
+
+//LocalStorageConfig 本地文件系统存储配置，BasePath为空时使用file_service.basepath
+type LocalStorageConfig struct {
 	BasePath     string `json:"basepath" yaml:"basepath" mapstructure:"basepath"`
 	absolutePath string
 }
 
+//S3StorageConfig S3兼容存储配置
+type S3StorageConfig struct {
+	Endpoint        string `json:"endpoint" yaml:"endpoint" mapstructure:"endpoint"`
+	AccessKeyID     string `json:"access_key_id" yaml:"access_key_id" mapstructure:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key" yaml:"secret_access_key" mapstructure:"secret_access_key"`
+	Region          string `json:"region" yaml:"region" mapstructure:"region"`
+	Bucket          string `json:"bucket" yaml:"bucket" mapstructure:"bucket"`
+	Prefix          string `json:"prefix" yaml:"prefix" mapstructure:"prefix"`
+	SSL             bool   `json:"ssl" yaml:"ssl" mapstructure:"ssl"`
+}
+
 //CacheConfig 缓存配置
 type CacheConfig struct {
 	Engine       string   `json:"engine" yaml:"engine" mapstructure:"engine"`
@@ -91,6 +214,19 @@ type CacheConfig struct {
 	MaxCacheSize int64    `json:"max_cache_size" yaml:"max_cache_size" mapstructure:"max_cache_size"`
 }
 
+//WebhookConfig webhook投递配置，投递失败后等待RetryDelay*2^(n-1)后重试，最长等待MaxRetryDelay，
+//超过MaxAttempts次后放弃，投递记录保留Retention后删除；默认只能投递到公网地址，
+//AllowedNetworks为允许投递的内网网络(CIDR)
+type WebhookConfig struct {
+	Timeout         time.Duration `json:"timeout" yaml:"timeout" mapstructure:"timeout"`
+	MaxAttempts     int           `json:"max_attempts" yaml:"max_attempts" mapstructure:"max_attempts"`
+	RetryDelay      time.Duration `json:"retry_delay" yaml:"retry_delay" mapstructure:"retry_delay"`
+	MaxRetryDelay   time.Duration `json:"max_retry_delay" yaml:"max_retry_delay" mapstructure:"max_retry_delay"`
+	PollInterval    time.Duration `json:"poll_interval" yaml:"poll_interval" mapstructure:"poll_interval"`
+	Retention       time.Duration `json:"retention" yaml:"retention" mapstructure:"retention"`
+	AllowedNetworks []string      `json:"allowed_networks" yaml:"allowed_networks" mapstructure:"allowed_networks"`
+}
+
 //EMailConfig email配置
 type EMailConfig struct {
 	Host         string `json:"host" yaml:"host" mapstructure:"host"`
@@ -130,6 +266,11 @@ func (fs *FileServiceConfig) FileAbsolutePath() string {
 	return fs.absolutePath
 }
 
+//AbsolutePath 获取绝对路径
+func (ls *LocalStorageConfig) AbsolutePath() string {
+	return ls.absolutePath
+}
+
 //Load 加载配置信息
 func Load(configPaths []string, confName, confType string) *Config {
 	v := viper.New()
@@ -161,6 +302,101 @@ func initializeConfig(v *viper.Viper, conf *Config) *Config {
 
 	conf.FileService.absolutePath = filepath.Join(wd, conf.FileService.BasePath)
 
+	storageConf := &conf.Storage
+	if storageConf.Engine == "" {
+		storageConf.Engine = "local"
+	}
+	storageConf.Local.absolutePath = conf.FileService.absolutePath
+	if storageConf.Local.BasePath != "" {
+		storageConf.Local.absolutePath = filepath.Join(wd, storageConf.Local.BasePath)
+	}
+
+	uploadConf := &conf.FileService.Upload
+	if uploadConf.Expiration == time.Duration(0) {
+		uploadConf.Expiration = 24 * time.Hour
+	}
+	if uploadConf.PurgeInterval == time.Duration(0) {
+		uploadConf.PurgeInterval = time.Hour
+	}
+
+	trashConf := &conf.FileService.Trash
+	if trashConf.Retention == time.Duration(0) {
+		trashConf.Retention = 30 * 24 * time.Hour
+	}
+	if trashConf.PurgeInterval == time.Duration(0) {
+		trashConf.PurgeInterval = time.Hour
+	}
+
+	versionConf := &conf.FileService.Version
+	if versionConf.PurgeInterval == time.Duration(0) {
+		versionConf.PurgeInterval = time.Hour
+	}
+
+	blobConf := &conf.FileService.Blob
+	if blobConf.PurgeInterval == time.Duration(0) {
+		blobConf.PurgeInterval = time.Hour
+	}
+
+	shareConf := &conf.FileService.Share
+	if shareConf.MaxPasswordAttempts == 0 {
+		shareConf.MaxPasswordAttempts = 5
+	}
+	if shareConf.LockoutDuration == time.Duration(0) {
+		shareConf.LockoutDuration = 15 * time.Minute
+	}
+
+	thumbnailConf := &conf.FileService.Thumbnail
+	if thumbnailConf.QueueSize == 0 {
+		thumbnailConf.QueueSize = 1024
+	}
+	if thumbnailConf.MaxSourceSize == 0 {
+		thumbnailConf.MaxSourceSize = 50 << 20
+	}
+	if thumbnailConf.MaxPixels == 0 {
+		thumbnailConf.MaxPixels = 50000000
+	}
+
+	copyConf := &conf.FileService.Copy
+	if copyConf.AsyncThreshold == 0 {
+		copyConf.AsyncThreshold = 100
+	}
+
+	fsckConf := &conf.FileService.Fsck
+	if fsckConf.Mode == "" {
+		fsckConf.Mode = "report"
+	}
+	if fsckConf.GracePeriod == time.Duration(0) {
+		fsckConf.GracePeriod = time.Hour
+	}
+
+	extractConf := &conf.FileService.Extract
+	if extractConf.AsyncThreshold == 0 {
+		extractConf.AsyncThreshold = 100
+	}
+	if extractConf.MaxEntries == 0 {
+		extractConf.MaxEntries = 10000
+	}
+	if extractConf.MaxSize == 0 {
+		extractConf.MaxSize = 10 << 30
+	}
+	if extractConf.MaxRatio == 0 {
+		extractConf.MaxRatio = 100
+	}
+
+	compressionConf := &conf.Storage.Compression
+	if compressionConf.MinSize == 0 {
+		compressionConf.MinSize = 1024
+	}
+	if len(compressionConf.Rules) == 0 {
+		compressionConf.Rules = []CompressionRule{
+			{
+				Encoding:   "zstd",
+				Types:      []string{"text/*", "application/json", "application/xml", "application/javascript"},
+				Extensions: []string{".log", ".csv", ".tsv"},
+			},
+		}
+	}
+
 	if conf.UserService.JWT.Expire == time.Duration(0) {
 		conf.UserService.JWT.Expire = time.Duration(2) * time.Hour
 	}
@@ -182,6 +418,26 @@ func initializeConfig(v *viper.Viper, conf *Config) *Config {
 		verificationCodeConf.ResetPassword.Expiration = 2 * time.Hour
 	}
 
+	webhookConf := &conf.Webhook
+	if webhookConf.Timeout == time.Duration(0) {
+		webhookConf.Timeout = 10 * time.Second
+	}
+	if webhookConf.MaxAttempts == 0 {
+		webhookConf.MaxAttempts = 8
+	}
+	if webhookConf.RetryDelay == time.Duration(0) {
+		webhookConf.RetryDelay = 30 * time.Second
+	}
+	if webhookConf.MaxRetryDelay == time.Duration(0) {
+		webhookConf.MaxRetryDelay = 6 * time.Hour
+	}
+	if webhookConf.PollInterval == time.Duration(0) {
+		webhookConf.PollInterval = 5 * time.Second
+	}
+	if webhookConf.Retention == time.Duration(0) {
+		webhookConf.Retention = 7 * 24 * time.Hour
+	}
+
 	if conf.Email.MaxQueueSize == 0 {
 		conf.Email.MaxQueueSize = 1024
 	}
@@ -5,7 +5,9 @@ import "net/http"
 //CORS http CORS
 func CORS(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,DELETE")
+	w.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,PATCH,DELETE,HEAD,MKCOL")
 	w.Header().Set("Access-Control-Allow-Headers", "*")
-	w.Header().Set("Access-Control-Expose-Headers", "Content-Disposition")
+	w.Header().Set("Access-Control-Expose-Headers", "Content-Disposition,Content-Range,Accept-Ranges,ETag,Last-Modified,Location,"+
+		"Upload-Offset,Upload-Length,Upload-Metadata,Upload-Expires,"+
+		"Tus-Resumable,Tus-Version,Tus-Extension,Tus-Max-Size,X-File-ID")
 }
@@ -0,0 +1,52 @@
+package httputil
+
+import (
+	"strings"
+)
+
+//ContentDisposition 生成Content-Disposition，文件名包含非ASCII字符时附加RFC 5987编码的filename*
+func ContentDisposition(dispositionType string, filename string) string {
+	fallback := asciiFilename(filename)
+	disposition := dispositionType + `; filename="` + fallback + `"`
+	if fallback != filename {
+		disposition += "; filename*=UTF-8''" + encodeRFC5987(filename)
+	}
+	return disposition
+}
+
+//asciiFilename 将不能放入quoted-string的字符替换为'_'
+func asciiFilename(filename string) string {
+	var b strings.Builder
+	for _, r := range filename {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			b.WriteByte('_')
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func isAttrChar(c byte) bool {
+	if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", c) >= 0
+}
+
+//encodeRFC5987 按RFC 5987的ext-value对字符串进行百分号编码
+func encodeRFC5987(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isAttrChar(c) {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&0x0f])
+	}
+	return b.String()
+}
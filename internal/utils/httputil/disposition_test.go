@@ -0,0 +1,25 @@
+package httputil_test
+
+import (
+	"testing"
+
+	"github.com/phantom-atom/file-explorer/internal/utils/httputil"
+)
+
+func TestContentDisposition(t *testing.T) {
+	cases := []struct {
+		typ      string
+		filename string
+		expected string
+	}{
+		{"attachment", "report.pdf", `attachment; filename="report.pdf"`},
+		{"inline", "a \"b\".txt", `inline; filename="a _b_.txt"; filename*=UTF-8''a%20%22b%22.txt`},
+		{"attachment", "文件.txt", `attachment; filename="__.txt"; filename*=UTF-8''%E6%96%87%E4%BB%B6.txt`},
+	}
+
+	for _, c := range cases {
+		if actual := httputil.ContentDisposition(c.typ, c.filename); actual != c.expected {
+			t.Errorf("ContentDisposition(%q, %q) = %q, expected %q", c.typ, c.filename, actual, c.expected)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package httputil
+
+import (
+	"strconv"
+	"strings"
+)
+
+//AcceptsEncoding 判断Accept-Encoding请求头是否接受encoding，q=0表示不接受，
+//没有单独列出的编码由"*"决定
+func AcceptsEncoding(header string, encoding string) bool {
+	wildcard := false
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		name := strings.TrimSpace(params[0])
+		if name == "" {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				if err != nil {
+					q = 0
+				}
+				quality = q
+			}
+		}
+
+		if strings.EqualFold(name, encoding) {
+			return quality > 0
+		}
+
+		if name == "*" {
+			wildcard = quality > 0
+		}
+	}
+	return wildcard
+}
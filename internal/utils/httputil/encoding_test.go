@@ -0,0 +1,32 @@
+package httputil_test
+
+import (
+	"testing"
+
+	"github.com/phantom-atom/file-explorer/internal/utils/httputil"
+)
+
+func TestAcceptsEncoding(t *testing.T) {
+	cases := []struct {
+		header   string
+		encoding string
+		expected bool
+	}{
+		{"", "gzip", false},
+		{"gzip, deflate, br", "gzip", true},
+		{"gzip, deflate, br", "zstd", false},
+		{"GZIP", "gzip", true},
+		{"zstd;q=0.5, gzip;q=1.0", "zstd", true},
+		{"gzip;q=0", "gzip", false},
+		{"*", "zstd", true},
+		{"*;q=0, gzip", "zstd", false},
+		{"*, zstd;q=0", "zstd", false},
+		{"identity", "gzip", false},
+	}
+
+	for _, c := range cases {
+		if actual := httputil.AcceptsEncoding(c.header, c.encoding); actual != c.expected {
+			t.Errorf("AcceptsEncoding(%q, %q) = %v, expected %v", c.header, c.encoding, actual, c.expected)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package httputil
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+//SniffLength DetectContentType最多读取的字节数
+const SniffLength = 512
+
+//extensionTypes 系统MIME表中经常缺少的扩展名
+var extensionTypes = map[string]string{
+	".7z":   "application/x-7z-compressed",
+	".bz2":  "application/x-bzip2",
+	".doc":  "application/msword",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".flac": "audio/flac",
+	".gz":   "application/gzip",
+	".md":   "text/markdown; charset=utf-8",
+	".mkv":  "video/x-matroska",
+	".mov":  "video/quicktime",
+	".mp3":  "audio/mpeg",
+	".mp4":  "video/mp4",
+	".odp":  "application/vnd.oasis.opendocument.presentation",
+	".ods":  "application/vnd.oasis.opendocument.spreadsheet",
+	".odt":  "application/vnd.oasis.opendocument.text",
+	".ppt":  "application/vnd.ms-powerpoint",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".rar":  "application/vnd.rar",
+	".rtf":  "application/rtf",
+	".tar":  "application/x-tar",
+	".tgz":  "application/gzip",
+	".xls":  "application/vnd.ms-excel",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".xz":   "application/x-xz",
+	".zip":  "application/zip",
+}
+
+//genericTypes 内容检测只能得到笼统结果的类型，这时以扩展名为准，
+//例如docx检测为zip，svg检测为xml
+var genericTypes = map[string]bool{
+	"application/octet-stream":  true,
+	"application/zip":           true,
+	"application/x-gzip":        true,
+	"text/plain; charset=utf-8": true,
+	"text/xml; charset=utf-8":   true,
+}
+
+//DetectContentType 根据文件名以及内容的前SniffLength个字节判断MIME类型，
+//内容可以明确判断时以内容为准，否则使用扩展名对应的类型
+func DetectContentType(filename string, head []byte) string {
+	sniffed := http.DetectContentType(head)
+	byExtension := extensionType(filename)
+	if byExtension != "" && byExtension != "application/octet-stream" && genericTypes[sniffed] {
+		return byExtension
+	}
+	return sniffed
+}
+
+func extensionType(filename string) string {
+	ext := strings.ToLower(path.Ext(filename))
+	if ext == "" {
+		return ""
+	}
+
+	if contentType, ok := extensionTypes[ext]; ok {
+		return contentType
+	}
+	return mime.TypeByExtension(ext)
+}
+
+//InlineSafe 判断contentType的内容是否可以inline方式返回，
+//HTML、SVG、XML等可以执行脚本的类型只能以附件下载，以免在站点的源中执行上传的脚本
+func InlineSafe(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case mediaType == "image/svg+xml":
+		return false
+	case strings.HasPrefix(mediaType, "image/"),
+		strings.HasPrefix(mediaType, "video/"),
+		strings.HasPrefix(mediaType, "audio/"):
+		return true
+	}
+	return mediaType == "application/pdf" || mediaType == "text/plain"
+}
@@ -0,0 +1,63 @@
+package httputil_test
+
+import (
+	"testing"
+
+	"github.com/phantom-atom/file-explorer/internal/utils/httputil"
+)
+
+func TestDetectContentType(t *testing.T) {
+	png := []byte("\x89PNG\x0D\x0A\x1A\x0A\x00\x00\x00\x0DIHDR")
+	zip := []byte("PK\x03\x04\x14\x00\x00\x00")
+
+	cases := []struct {
+		filename string
+		head     []byte
+		expected string
+	}{
+		{"photo.png", png, "image/png"},
+		{"photo.jpg", png, "image/png"},
+		{"photo", png, "image/png"},
+		{"report.docx", zip, "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{"bundle.zip", zip, "application/zip"},
+		{"unknown.bin", zip, "application/zip"},
+		{"notes.md", []byte("# title"), "text/markdown; charset=utf-8"},
+		{"notes", []byte("plain text"), "text/plain; charset=utf-8"},
+		{"empty.pdf", nil, "application/pdf"},
+		{"data", []byte{0x00, 0x01, 0x02}, "application/octet-stream"},
+	}
+
+	for _, c := range cases {
+		if actual := httputil.DetectContentType(c.filename, c.head); actual != c.expected {
+			t.Errorf("DetectContentType(%q) = %q, expected %q", c.filename, actual, c.expected)
+		}
+	}
+}
+
+func TestInlineSafe(t *testing.T) {
+	cases := []struct {
+		contentType string
+		expected    bool
+	}{
+		{"image/png", true},
+		{"image/jpeg", true},
+		{"video/mp4", true},
+		{"audio/mpeg", true},
+		{"application/pdf", true},
+		{"text/plain; charset=utf-8", true},
+		{"image/svg+xml", false},
+		{"IMAGE/SVG+XML", false},
+		{"text/html; charset=utf-8", false},
+		{"text/xml; charset=utf-8", false},
+		{"application/xhtml+xml", false},
+		{"text/markdown; charset=utf-8", false},
+		{"application/octet-stream", false},
+		{"", false},
+	}
+
+	for _, c := range cases {
+		if actual := httputil.InlineSafe(c.contentType); actual != c.expected {
+			t.Errorf("InlineSafe(%q) = %v, expected %v", c.contentType, actual, c.expected)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package httputil
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+var (
+	//ErrInvalidTusMetadata Upload-Metadata格式错误
+	ErrInvalidTusMetadata = errors.New("invalid Upload-Metadata")
+)
+
+//ParseTusMetadata 解析tus协议的Upload-Metadata，格式为"key base64,key base64"
+func ParseTusMetadata(metadata string) (map[string]string, error) {
+	values := make(map[string]string)
+	if strings.TrimSpace(metadata) == "" {
+		return values, nil
+	}
+
+	for _, pair := range strings.Split(metadata, ",") {
+		kv := strings.Fields(pair)
+		if len(kv) == 0 || len(kv) > 2 {
+			return nil, ErrInvalidTusMetadata
+		}
+
+		value := ""
+		if len(kv) == 2 {
+			decoded, err := base64.StdEncoding.DecodeString(kv[1])
+			if err != nil {
+				return nil, ErrInvalidTusMetadata
+			}
+			value = string(decoded)
+		}
+
+		if _, ok := values[kv[0]]; ok {
+			return nil, ErrInvalidTusMetadata
+		}
+		values[kv[0]] = value
+	}
+	return values, nil
+}
@@ -0,0 +1,46 @@
+package httputil_test
+
+import (
+	"testing"
+
+	"github.com/phantom-atom/file-explorer/internal/utils/httputil"
+)
+
+func TestParseTusMetadata(t *testing.T) {
+	values, err := httputil.ParseTusMetadata("filename d29ybGRfZG9taW5hdGlvbl9wbGFuLnBkZg==,is_confidential")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if values["filename"] != "world_domination_plan.pdf" {
+		t.Errorf("filename = %q", values["filename"])
+	}
+
+	if v, ok := values["is_confidential"]; !ok || v != "" {
+		t.Errorf("is_confidential = %q, %v", v, ok)
+	}
+}
+
+func TestParseTusMetadataEmpty(t *testing.T) {
+	values, err := httputil.ParseTusMetadata("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(values) != 0 {
+		t.Errorf("values = %v", values)
+	}
+}
+
+func TestParseTusMetadataInvalid(t *testing.T) {
+	for _, metadata := range []string{
+		"filename !!!",
+		"filename YQ== YQ==",
+		"filename YQ==,filename Yg==",
+		"filename YQ==,,",
+	} {
+		if _, err := httputil.ParseTusMetadata(metadata); err == nil {
+			t.Errorf("metadata %q pass", metadata)
+		}
+	}
+}
@@ -17,6 +17,22 @@ func String(len int) string {
 	return string(byt)
 }
 
+const alphanumeric = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+//AlphanumericString 随机一个length长度的字母数字字符串
+func AlphanumericString(length int) string {
+	byt := make([]byte, length)
+	if _, err := rand.Read(byt); err != nil {
+		log.Warn("msg", "occur a error when random string", "err", err.Error())
+		return ""
+	}
+
+	for i, b := range byt {
+		byt[i] = alphanumeric[int(b)%len(alphanumeric)]
+	}
+	return string(byt)
+}
+
 //DigitString 随机一个len长度的数字字符串
 func DigitString(len int) string {
 	byt := make([]byte, len)
@@ -3,6 +3,8 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"net"
 	"net/http"
@@ -28,25 +30,46 @@ import (
 	"github.com/phantom-atom/file-explorer/models"
 	"github.com/phantom-atom/file-explorer/repository"
 	"github.com/phantom-atom/file-explorer/services"
+	"github.com/phantom-atom/file-explorer/storage"
+	"github.com/phantom-atom/file-explorer/storage/compressed"
+	"github.com/phantom-atom/file-explorer/storage/encrypted"
+	"github.com/phantom-atom/file-explorer/storage/local"
+	"github.com/phantom-atom/file-explorer/storage/s3"
 	v1 "github.com/phantom-atom/file-explorer/web/api/v1"
 	"github.com/phantom-atom/file-explorer/web/api/v1/register"
+	"github.com/phantom-atom/file-explorer/web/dav"
+	"github.com/phantom-atom/file-explorer/webhook"
 	"golang.org/x/crypto/acme/autocert"
 )
 
 var (
-	globalConfig  *config.Config
-	database      *gorm.DB
-	workDirectory string
-	fileService   *services.FileService
-	userService   *services.UserService
-	closeExecutor = &executor.Executor{}
-	namedLocker   locker.NamedLocker
-	asyncMailer   *mailer.Mailer
-	dataCache     cache.Cache
-	dataContext   repository.DataContext
+	globalConfig   *config.Config
+	database       *gorm.DB
+	workDirectory  string
+	fileService    *services.FileService
+	userService    *services.UserService
+	webhookService *services.WebhookService
+	closeExecutor  = &executor.Executor{}
+	namedLocker    locker.NamedLocker
+	asyncMailer    *mailer.Mailer
+	dataCache      cache.Cache
+	dataContext    repository.DataContext
+	storageBackend storage.Backend
+)
+
+//encryptedStorage 启用静态加密时为storageBackend中的加密层，用于加密已有内容以及轮换密钥
+var encryptedStorage *encrypted.Backend
+
+var (
+	backfillContentType = flag.Bool("backfill-content-type", false, "detect and save the content type of existing files, then exit")
+	fsckMode            = flag.String("fsck", "", "check storage consistency (report, repair or quarantine), print the report as JSON, then exit")
+	encryptBlobs        = flag.Bool("encrypt-blobs", false, "encrypt existing plaintext blobs in place, then exit")
+	rotateKeys          = flag.Bool("rotate-keys", false, "re-wrap data keys with the current master key, then exit")
 )
 
 func main() {
+	flag.Parse()
+
 	//退出前关闭所有添加的closer
 	defer closeExecutor.Execute(false, func(a executor.Action, err error) {
 		log.Warn("msg", "occur an error when "+a.Tag()+" close", "error", err.Error())
@@ -72,6 +95,9 @@ func main() {
 
 	namedLocker = locker.NewGLocker()
 
+	//初始化存储
+	initStorage()
+
 	//初始化仓库
 	initRepository()
 
@@ -81,6 +107,26 @@ func main() {
 	//初始化全局服务
 	initServices()
 
+	if *backfillContentType {
+		runBackfillContentType()
+		return
+	}
+
+	if *fsckMode != "" {
+		runFsck(*fsckMode)
+		return
+	}
+
+	if *encryptBlobs {
+		runEncryptBlobs()
+		return
+	}
+
+	if *rotateKeys {
+		runRotateKeys()
+		return
+	}
+
 	//运行http
 	runHTTPServer()
 }
@@ -130,10 +176,62 @@ func initCache() {
 	}
 }
 
+func initStorage() {
+	conf := &configFunc().Storage
+	var err error
+	switch conf.Engine {
+	case "local":
+		storageBackend, err = local.NewBackend(configFunc)
+	case "s3":
+		storageBackend, err = s3.NewBackend(configFunc)
+	default:
+		log.Panic("msg", "occur an error when initialize storage", "error", "storage engine is unsupported", "engine", conf.Engine)
+	}
+
+	if err != nil {
+		log.Panic("msg", "occur an error when initialize storage", "error", err.Error())
+	}
+
+	if conf.Encryption.Enable {
+		//数据密钥保存在数据库中，dataContext在initRepository中初始化
+		encryptedStorage, err = encrypted.NewBackend(configFunc, storageBackend, func() (encrypted.KeyStore, error) {
+			dataKeyRepository, err := dataContext.DataKey()
+			if err != nil {
+				return nil, err
+			}
+			return dataKeyRepository, nil
+		})
+		if err != nil {
+			log.Panic("msg", "occur an error when initialize storage encryption", "error", err.Error())
+		}
+		storageBackend = encryptedStorage
+	}
+
+	if conf.Compression.Enable {
+		for _, rule := range conf.Compression.Rules {
+			if !compressed.SupportedEncoding(rule.Encoding) {
+				log.Panic("msg", "occur an error when initialize storage compression", "error", "encoding is unsupported", "encoding", rule.Encoding)
+			}
+		}
+
+		//在加密之前压缩，压缩信息保存在数据库中
+		storageBackend, err = compressed.New(storageBackend, func() (compressed.MetadataStore, error) {
+			compressedObjectRepository, err := dataContext.CompressedObject()
+			if err != nil {
+				return nil, err
+			}
+			return compressedObjectRepository, nil
+		})
+		if err != nil {
+			log.Panic("msg", "occur an error when initialize storage compression", "error", err.Error())
+		}
+	}
+}
+
 func initRepository() {
 	var err error
 	dataContext, err = simple.NewContext(
-		database, dataCache, configFunc, time.Now,
+		database, dataCache, storageBackend, configFunc, time.Now,
 	)
 
 	if err != nil {
@@ -160,15 +258,33 @@ func initDatabase() {
 		log.Panic("msg", "occur an error when initialize database", "error", err.Error())
 	}
 
-	err = db.AutoMigrate(&models.File{}, &models.User{}).Error
+	err = db.AutoMigrate(&models.File{}, &models.User{}, &models.Share{}, &models.Upload{}, &models.TrashItem{}, &models.FileVersion{}, &models.Blob{}, &models.Job{}, &models.FileTag{}, &models.FileMetadata{}, &models.DataKey{}, &models.CompressedObject{}, &models.Webhook{}, &models.WebhookDelivery{}, &models.Activity{}).Error
 	if err != nil {
 		log.Panic("msg", "occur an error when initialize database", "error", err.Error())
 	}
 
+	initSearchIndex(db)
+
 	database = db
 	closeExecutor.AddFuncWithTag("Database", database.Close)
 }
 
+//initSearchIndex 为文件名和路径创建trigram索引以加速搜索，创建失败时搜索仍然可用，只是需要全表扫描
+func initSearchIndex(db *gorm.DB) {
+	statements := []string{
+		"CREATE EXTENSION IF NOT EXISTS pg_trgm",
+		"CREATE INDEX IF NOT EXISTS idx_files_filename_trgm ON files USING gin (filename gin_trgm_ops)",
+		"CREATE INDEX IF NOT EXISTS idx_files_directory_trgm ON files USING gin (directory gin_trgm_ops)",
+	}
+
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			log.Warn("msg", "occur an error when create search index", "error", err.Error())
+			return
+		}
+	}
+}
+
 func initWD() {
 	dir, err := os.Getwd()
 	if err != nil {
@@ -179,20 +295,55 @@ func initWD() {
 }
 
 func initServices() {
+	initWebhookService()
 	initFileService()
 	initUserService()
 }
 
+func initWebhookService() {
+	webhookConf := &globalConfig.Webhook
+	allowedNetworks, err := webhook.ParseNetworks(webhookConf.AllowedNetworks)
+	if err != nil {
+		log.Panic("msg", "occur an error when initialize webhook service", "error", err.Error())
+	}
+
+	ws := services.NewWebhookService(
+		configFunc,
+		func() string {
+			return uuid.New().String()
+		},
+		time.Now,
+		dataContext,
+		webhook.NewHTTPClient(webhookConf.Timeout, allowedNetworks),
+	)
+
+	webhookService = ws
+	closeExecutor.AddFuncWithTag("WebhookService", ws.Close)
+}
+
 func initFileService() {
 	fs := services.NewFileService(
 		configFunc,
 		func() string {
 			return uuid.New().String()
 		},
+		time.Now,
 		dataContext,
+		storageBackend,
 		namedLocker,
+		webhookService,
 	)
 
+	if err := fs.MigrateLegacyBlobs(); err != nil {
+		log.Panic("msg", "occur an error when migrate legacy files", "error", err.Error())
+	}
+
+	if count, err := fs.BackfillStoredSizes(); err != nil {
+		log.Panic("msg", "occur an error when backfill stored sizes", "error", err.Error())
+	} else if count > 0 {
+		log.Info("msg", "backfill stored sizes finished", "count", count)
+	}
+
 	fileService = fs
 	closeExecutor.AddFuncWithTag("FileService", fs.Close)
 }
@@ -207,15 +358,175 @@ func initUserService() {
 		dataContext,
 		asyncMailer,
 		namedLocker,
+		webhookService,
 	)
 
 	userService = us
 }
 
+//runBackfillContentType 为升级前上传的文件补充ContentType
+func runBackfillContentType() {
+	count, err := fileService.BackfillContentTypes()
+	if err != nil {
+		log.Error("msg", "occur an error when backfill content type", "count", count, "error", err.Error())
+		return
+	}
+	log.Info("msg", "backfill content type finished", "count", count)
+}
+
+//instanceLockKey 服务与离线维护命令共用的PostgreSQL advisory lock，运行中的服务持有共享锁，
+//会修改数据的fsck需要排他锁，命名锁只在一个进程中有效，不能防止离线修复与运行中的服务同时修改同一个文件
+const instanceLockKey int64 = 0x66696c652d6578
+
+//acquireInstanceLock 在独占的数据库连接上获取advisory lock，连接在退出时关闭，锁随之释放，
+//已经被其它进程以冲突的方式持有时返回false
+func acquireInstanceLock(exclusive bool) (bool, error) {
+	ctx := context.Background()
+	conn, err := database.DB().Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	query := "SELECT pg_try_advisory_lock_shared($1)"
+	if exclusive {
+		query = "SELECT pg_try_advisory_lock($1)"
+	}
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, query, instanceLockKey).Scan(&locked); err != nil || !locked {
+		if e := conn.Close(); e != nil {
+			log.Warn("msg", "occur an error when close database connection", "error", e.Error())
+		}
+		return false, err
+	}
+
+	closeExecutor.AddFuncWithTag("InstanceLock", conn.Close)
+	return true, nil
+}
+
+//runFsck 检查存储与数据库的一致性，将报告以JSON格式输出到标准输出，
+//repair和quarantine模式需要服务已经停止，运行中的服务可以使用report模式或者配置定期检查
+func runFsck(mode string) {
+	if mode != services.FsckModeReport {
+		locked, err := acquireInstanceLock(true)
+		if err != nil {
+			log.Error("msg", "occur an error when lock database for fsck", "error", err.Error())
+			return
+		}
+		if !locked {
+			log.Error("msg", "file-explorer is running, stop it before running fsck "+mode+" or use fsck report")
+			return
+		}
+	}
+
+	report, err := fileService.Fsck(mode)
+	if err != nil {
+		log.Error("msg", "occur an error when check storage consistency", "error", err.Error())
+		return
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Error("msg", "occur an error when print fsck report", "error", err.Error())
+	}
+}
+
+//runEncryptBlobs 将存储中已有的明文内容原地加密
+func runEncryptBlobs() {
+	if encryptedStorage == nil {
+		log.Error("msg", "storage encryption is disabled", "error", "set storage.encryption.enable to true")
+		return
+	}
+
+	count, err := encryptedStorage.EncryptObjects("blobs/")
+	if err != nil {
+		log.Error("msg", "occur an error when encrypt blobs", "count", count, "error", err.Error())
+		return
+	}
+	log.Info("msg", "encrypt blobs finished", "count", count)
+}
+
+//runRotateKeys 使用当前主密钥重新加密数据密钥
+func runRotateKeys() {
+	if encryptedStorage == nil {
+		log.Error("msg", "storage encryption is disabled", "error", "set storage.encryption.enable to true")
+		return
+	}
+
+	count, err := encryptedStorage.RotateKeys()
+	if err != nil {
+		log.Error("msg", "occur an error when rotate data keys", "count", count, "error", err.Error())
+		return
+	}
+	log.Info("msg", "rotate data keys finished", "count", count, "key_id", encryptedStorage.CurrentKeyID())
+}
+
+//acquireServerLock 获取服务的共享advisory lock，同时尝试获取排他锁，sole为true时没有其它实例在运行，
+//可以执行启动时的维护任务，完成后调用downgrade释放排他锁，其它实例才能启动。
+//离线fsck修复(或者其它实例的启动维护)期间返回locked为false
+func acquireServerLock() (locked bool, sole bool, downgrade func() error, err error) {
+	ctx := context.Background()
+	conn, err := database.DB().Conn(ctx)
+	if err != nil {
+		return false, false, nil, err
+	}
+
+	err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock_shared($1)", instanceLockKey).Scan(&locked)
+	if err == nil && locked {
+		//同一个连接持有的共享锁不与排他锁冲突，只有其它实例持有共享锁时获取失败
+		err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", instanceLockKey).Scan(&sole)
+	}
+
+	if err != nil || !locked {
+		if e := conn.Close(); e != nil {
+			log.Warn("msg", "occur an error when close database connection", "error", e.Error())
+		}
+		return false, false, nil, err
+	}
+
+	closeExecutor.AddFuncWithTag("InstanceLock", conn.Close)
+	downgrade = func() error {
+		_, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", instanceLockKey)
+		return err
+	}
+	return true, sole, downgrade, nil
+}
+
 func runHTTPServer() {
 	httpConf := &globalConfig.HTTP
 	promConf := &globalConfig.Prometheus
 
+	//离线fsck修复期间不启动服务
+	locked, sole, downgrade, err := acquireServerLock()
+	if err != nil {
+		log.Panic("msg", "occur an error when lock database", "error", err.Error())
+	}
+	if !locked {
+		log.Panic("msg", "fsck is repairing the storage or another instance is starting, try again after it finishes")
+	}
+
+	//只有没有其它实例运行时才能确定running状态的任务已经被中断，重新统计用量也不会覆盖并发的修改
+	if sole {
+		if err := fileService.RecountUsage(); err != nil {
+			log.Panic("msg", "occur an error when recount storage usage", "error", err.Error())
+		}
+
+		if err := fileService.FailInterruptedJobs(); err != nil {
+			log.Panic("msg", "occur an error when fail interrupted jobs", "error", err.Error())
+		}
+
+		if err := downgrade(); err != nil {
+			log.Panic("msg", "occur an error when unlock database", "error", err.Error())
+		}
+	} else {
+		log.Info("msg", "another instance is running, skip startup maintenance")
+	}
+
+	//后台任务只在服务中运行，离线命令不启动
+	webhookService.Start()
+	fileService.Start()
+
 	if globalConfig.Mode == "release" {
 		gin.SetMode(gin.ReleaseMode)
 	}
@@ -239,13 +550,13 @@ func runHTTPServer() {
 	}
 
 	apiGroup := engine.Group("/")
-	api := v1.NewAPI(configFunc, fileService, userService)
+	api := v1.NewAPI(configFunc, fileService, userService, webhookService)
 
 	authorization := middleware.NewAuthorization(userService, configFunc)
 	register.APIGINRegister(api, apiGroup, authorization)
+	register.DAVGINRegister(dav.NewHandler("/dav", fileService), apiGroup, authorization)
 
 	addr := net.JoinHostPort(httpConf.Host, httpConf.Port)
-	var err error
 	serv := &http.Server{
 		Addr:    addr,
 		Handler: engine,
@@ -2,12 +2,14 @@ package middleware
 
 import (
 	"errors"
+	"net/http"
 	"strings"
 
 	v1 "github.com/phantom-atom/file-explorer/web/api/v1"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/phantom-atom/file-explorer/config"
+	"github.com/phantom-atom/file-explorer/internal/log"
 	"github.com/phantom-atom/file-explorer/internal/security"
 
 	"github.com/gin-gonic/gin"
@@ -17,6 +19,7 @@ import (
 
 const (
 	authHeader = "X-REQUEST-TOKEN"
+	basicRealm = "file-explorer"
 )
 
 var (
@@ -60,6 +63,58 @@ func (a *Authorization) HandlerFunc(role string) v1.GinFunc {
 	}
 }
 
+//BasicHandlerFunc 支持HTTP Basic认证的认证中间件，用于WebDAV等只能使用用户名和密码的客户端，
+//请求带有token时使用token认证，认证失败时返回401以及WWW-Authenticate
+func (a *Authorization) BasicHandlerFunc(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, token, err := a.verifyAndTest(c, role)
+		if err == errUserNotAuthenticated {
+			user, err = a.verifyBasic(c, role)
+		}
+
+		switch err {
+		case nil:
+			a.setUserToContext(c, user, token)
+			c.Next()
+		case errUserNotAuthenticated:
+			c.Header("WWW-Authenticate", `Basic realm="`+basicRealm+`", charset="UTF-8"`)
+			c.AbortWithStatus(http.StatusUnauthorized)
+		case errPermissionDenied:
+			c.AbortWithStatus(http.StatusForbidden)
+		default:
+			log.Error("msg", "occur an error when authenticate", "error", err.Error())
+			c.AbortWithStatus(http.StatusInternalServerError)
+		}
+	}
+}
+
+func (a *Authorization) verifyBasic(c *gin.Context, role string) (*models.User, error) {
+	username, password, ok := c.Request.BasicAuth()
+	if !ok || username == "" || password == "" {
+		return nil, errUserNotAuthenticated
+	}
+
+	//以请求来源记录密码错误，WebDAV客户端猜测密码时也会出现在操作日志中
+	user, err := a.service.WithActor(&services.Actor{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}).AuthenticateUser(&services.UserLoginParams{
+		Identity:    username,
+		Certificate: password,
+	})
+	if err != nil {
+		if _, ok := err.(*services.UserError); ok {
+			return nil, errUserNotAuthenticated
+		}
+		return nil, err
+	}
+
+	if role != user.Role {
+		return nil, errPermissionDenied
+	}
+	return user, nil
+}
+
 func (a *Authorization) tokenFromBearer(c *gin.Context) string {
 	bearerToken := c.GetHeader("Authorization")
 	BTA := strings.Split(bearerToken, " ")
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+//操作类型，文件操作与webhook事件类型相同
+const (
+	ActivityFileCreated         = EventFileCreated
+	ActivityFileUpdated         = EventFileUpdated
+	ActivityFileDeleted         = EventFileDeleted
+	ActivityFileMoved           = EventFileMoved
+	ActivityFileRenamed         = EventFileRenamed
+	ActivityFileRestored        = EventFileRestored
+	ActivityFileCopied          = "file.copied"
+	ActivityFilePurged          = "file.purged"
+	ActivityFileTagsUpdated     = "file.tags_updated"
+	ActivityFileMetadataUpdated = "file.metadata_updated"
+	ActivityVersionDeleted      = "version.deleted"
+	ActivityShareCreated        = "share.created"
+	ActivityShareRevoked        = "share.revoked"
+	ActivityUserRegistered      = EventUserRegistered
+	ActivityUserLogin           = "user.login"
+	ActivityUserLoginFailed     = "user.login_failed"
+	ActivityUserPasswordReset   = "user.password_reset"
+)
+
+//Activity 操作日志，只追加不修改，Owner为文件或者账号所属的用户，Actor为执行操作的用户，
+//后台任务以及定时清理执行的操作没有Actor，OldValue和NewValue为操作修改的值，例如移动时的文件夹、重命名时的名称
+type Activity struct {
+	ID        uint      `gorm:"primary_key" json:"id"`
+	CreatedAt time.Time `gorm:"column:created_at;index" json:"created_at"`
+	Owner     string    `gorm:"column:owner;index" json:"owner"`
+	Actor     string    `gorm:"column:actor;index" json:"actor,omitempty"`
+	IP        string    `gorm:"column:ip" json:"ip,omitempty"`
+	UserAgent string    `gorm:"column:user_agent" json:"user_agent,omitempty"`
+	Action    string    `gorm:"column:action;index" json:"action"`
+	FID       string    `gorm:"column:fid;index" json:"file_id,omitempty"`
+	Path      string    `gorm:"column:path" json:"path,omitempty"`
+	OldValue  string    `gorm:"column:old_value" json:"old_value,omitempty"`
+	NewValue  string    `gorm:"column:new_value" json:"new_value,omitempty"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"path"
+	"time"
+)
+
+//Blob 以SHA-256寻址的文件内容，相同内容的文件共享同一个Blob，
+//Encoding不为空时内容压缩存储，StoredSize为压缩后的大小
+type Blob struct {
+	Hash       string    `gorm:"primary_key;column:hash" json:"hash"`
+	CreatedAt  time.Time `json:"created_at"`
+	MD5        string    `gorm:"column:md5" json:"md5,omitempty"`
+	Size       int64     `gorm:"column:size" json:"size"`
+	StoredSize int64     `gorm:"column:stored_size" json:"stored_size"`
+	Encoding   string    `gorm:"column:encoding" json:"encoding,omitempty"`
+	RefCount   int64     `gorm:"column:ref_count;index" json:"ref_count"`
+}
+
+//BlobKey 内容在存储目录中的名称，按照hash的前两位分目录
+func BlobKey(hash string) string {
+	return path.Join("blobs", hash[:2], hash)
+}
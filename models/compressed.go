@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+//CompressedObject 压缩存储的对象，Size为原始大小，StoredSize为压缩后的大小，
+//Frames为分帧表，每一帧依次为压缩后大小以及原始大小(各4字节，小端)，用于Range读取时只解压范围内的分帧
+type CompressedObject struct {
+	Key        string    `gorm:"primary_key;column:key" json:"key"`
+	CreatedAt  time.Time `json:"created_at"`
+	Encoding   string    `gorm:"column:encoding" json:"encoding"`
+	Size       int64     `gorm:"column:size" json:"size"`
+	StoredSize int64     `gorm:"column:stored_size" json:"stored_size"`
+	Frames     []byte    `gorm:"column:frames" json:"-"`
+}
@@ -0,0 +1,28 @@
+package models
+
+//ContentCategories MIME分类对应的ContentType匹配模式(SQL LIKE)
+var ContentCategories = map[string][]string{
+	"image": {"image/%"},
+	"video": {"video/%"},
+	"audio": {"audio/%"},
+	"text":  {"text/%"},
+	"document": {
+		"application/pdf",
+		"application/msword",
+		"application/rtf",
+		"application/vnd.ms-%",
+		"application/vnd.openxmlformats-officedocument.%",
+		"application/vnd.oasis.opendocument.%",
+	},
+	"archive": {
+		"application/zip",
+		"application/gzip",
+		"application/x-gzip",
+		"application/x-tar",
+		"application/x-bzip2",
+		"application/x-xz",
+		"application/x-7z-compressed",
+		"application/vnd.rar",
+		"application/x-rar-compressed",
+	},
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+//DataKey 存储对象的数据密钥，WrappedKey为使用KeyID对应的主密钥加密后的数据密钥，
+//轮换主密钥时只需要重新加密WrappedKey，不需要重新加密对象内容
+type DataKey struct {
+	Key        string    `gorm:"primary_key;column:key" json:"key"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	KeyID      string    `gorm:"column:key_id;index" json:"key_id"`
+	WrappedKey []byte    `gorm:"column:wrapped_key" json:"-"`
+}
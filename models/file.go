@@ -1,18 +1,43 @@
 package models
 
-import "time"
+import (
+	"strconv"
+	"time"
+)
 
-//File 文件结构体
+//File 文件结构体，Size为文件内容的大小，StoredSize为内容在存储中的大小，Encoding不为空时内容压缩存储
 type File struct {
-	ID        uint       `gorm:"primary_key" json:"-"`
-	CreatedAt time.Time  `json:"created_at,omitempty"`
-	UpdatedAt time.Time  `json:"updated_at,omitempty"`
-	DeletedAt *time.Time `sql:"index" json:"deleted_at,omitempty"`
-	FID       string     `gorm:"column:fid;unique_index" json:"file_id,omitempty"`
-	Owner     string     `gorm:"column:owner" json:"owner"`
-	IsDir     bool       `gorm:"column:isdir" json:"isdir"`
-	Directory string     `gorm:"column:directory;index" json:"directory"`
-	Filename  string     `gorm:"column:filename;index" json:"filename"`
-	Size      int64      `gorm:"column:size" json:"size"`
-	PFID      string     `gorm:"column:pfid" json:"parent_id"`
+	ID           uint       `gorm:"primary_key" json:"-"`
+	CreatedAt    time.Time  `json:"created_at,omitempty"`
+	UpdatedAt    time.Time  `json:"updated_at,omitempty"`
+	DeletedAt    *time.Time `sql:"index" json:"deleted_at,omitempty"`
+	FID          string     `gorm:"column:fid;unique_index" json:"file_id,omitempty"`
+	Owner        string     `gorm:"column:owner;index" json:"owner"`
+	IsDir        bool       `gorm:"column:isdir" json:"isdir"`
+	Directory    string     `gorm:"column:directory;index" json:"directory"`
+	Filename     string     `gorm:"column:filename;index" json:"filename"`
+	Size         int64      `gorm:"column:size" json:"size"`
+	StoredSize   int64      `gorm:"column:stored_size" json:"stored_size"`
+	Encoding     string     `gorm:"column:encoding" json:"encoding,omitempty"`
+	Hash         string     `gorm:"column:hash;index" json:"hash,omitempty"`
+	MD5          string     `gorm:"column:md5" json:"md5,omitempty"`
+	PFID         string     `gorm:"column:pfid" json:"parent_id"`
+	TrashID      string     `gorm:"column:trash_id;index" json:"-"`
+	ContentType  string     `gorm:"column:content_type;index" json:"content_type"`
+	HasThumbnail bool       `gorm:"column:has_thumbnail" json:"has_thumbnail"`
+}
+
+//BlobKey 文件内容在存储目录中的名称，没有Hash的旧文件以FID命名
+func (f *File) BlobKey() string {
+	if f.Hash == "" {
+		return f.FID
+	}
+	return BlobKey(f.Hash)
+}
+
+//ETag 文件内容不会原地修改，使用FID、修改时间以及大小作为强ETag
+func (f *File) ETag() string {
+	return `"` + f.FID + "-" +
+		strconv.FormatInt(f.UpdatedAt.UnixNano(), 36) + "-" +
+		strconv.FormatInt(f.Size, 36) + `"`
 }
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+//后台任务类型
+const (
+	JobTypeCopy    = "copy"
+	JobTypeExtract = "extract"
+)
+
+//后台任务状态
+const (
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+)
+
+//Job 后台任务，Total和Done为需要处理以及已经处理的文件数量，成功后FID为任务创建的文件，
+//Result为任务完成后的详细结果，例如解压任务每个项目的结果
+type Job struct {
+	ID        string          `gorm:"primary_key" json:"id"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	Owner     string          `gorm:"column:owner;index" json:"owner"`
+	Type      string          `gorm:"column:type" json:"type"`
+	Status    string          `gorm:"column:status;index" json:"status"`
+	Total     int64           `gorm:"column:total" json:"total"`
+	Done      int64           `gorm:"column:done" json:"done"`
+	FID       string          `gorm:"column:fid" json:"file_id,omitempty"`
+	Error     string          `gorm:"column:error" json:"error,omitempty"`
+	Result    json.RawMessage `gorm:"column:result" json:"result,omitempty"`
+}
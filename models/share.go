@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+//Share 文件分享
+type Share struct {
+	ID           uint       `gorm:"primary_key" json:"-"`
+	CreatedAt    time.Time  `json:"created_at,omitempty"`
+	UpdatedAt    time.Time  `json:"updated_at,omitempty"`
+	DeletedAt    *time.Time `sql:"index" json:"-"`
+	Code         string     `gorm:"column:code;unique_index" json:"code"`
+	Owner        string     `gorm:"column:owner;index" json:"owner"`
+	FID          string     `gorm:"column:fid;index" json:"file_id"`
+	Password     string     `gorm:"column:password" json:"-"`
+	HasPassword  bool       `gorm:"-" json:"has_password"`
+	ExpiresAt    *time.Time `gorm:"column:expires_at" json:"expires_at,omitempty"`
+	MaxDownloads int        `gorm:"column:max_downloads" json:"max_downloads"`
+	Downloads    int        `gorm:"column:downloads" json:"downloads"`
+	//连续输错密码的次数以及达到上限后锁定的截止时间
+	FailedAttempts int        `gorm:"column:failed_attempts" json:"-"`
+	LockedUntil    *time.Time `gorm:"column:locked_until" json:"-"`
+}
+
+//AfterFind 设置是否存在密码
+func (share *Share) AfterFind() error {
+	share.HasPassword = share.Password != ""
+	return nil
+}
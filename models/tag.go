@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+//FileTag 文件标签，文件移动、重命名时FID不变，标签随文件保留
+type FileTag struct {
+	ID        uint      `gorm:"primary_key" json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	Owner     string    `gorm:"column:owner;index" json:"-"`
+	FID       string    `gorm:"column:fid;unique_index:idx_file_tag" json:"file_id"`
+	Tag       string    `gorm:"column:tag;unique_index:idx_file_tag;index" json:"tag"`
+}
+
+//TagCount 标签以及使用该标签的文件数量
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int64  `json:"count"`
+}
+
+//FileMetadata 文件的自定义键值元数据
+type FileMetadata struct {
+	ID        uint      `gorm:"primary_key" json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Owner     string    `gorm:"column:owner;index" json:"-"`
+	FID       string    `gorm:"column:fid;unique_index:idx_file_metadata" json:"file_id"`
+	Key       string    `gorm:"column:key;unique_index:idx_file_metadata" json:"key"`
+	Value     string    `gorm:"column:value;type:text" json:"value"`
+}
@@ -0,0 +1,23 @@
+package models
+
+//缩略图尺寸
+const (
+	ThumbnailSmall  = "small"
+	ThumbnailMedium = "medium"
+	ThumbnailLarge  = "large"
+)
+
+//ThumbnailSizes 缩略图尺寸对应的最大边长，从大到小排列
+var ThumbnailSizes = []struct {
+	Name    string
+	MaxEdge int
+}{
+	{ThumbnailLarge, 512},
+	{ThumbnailMedium, 256},
+	{ThumbnailSmall, 128},
+}
+
+//ThumbnailKey 缩略图在存储目录中的名称，与内容的Blob放在一起
+func ThumbnailKey(hash string, size string) string {
+	return BlobKey(hash) + ".thumb-" + size + ".jpg"
+}
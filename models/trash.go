@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+//TrashItem 回收站项目，记录被删除文件的原始位置
+type TrashItem struct {
+	ID        string    `gorm:"primary_key" json:"id"`
+	TrashedAt time.Time `gorm:"column:trashed_at;index" json:"trashed_at"`
+	Owner     string    `gorm:"column:owner;index" json:"owner"`
+	FID       string    `gorm:"column:fid" json:"file_id"`
+	PFID      string    `gorm:"column:pfid" json:"parent_id"`
+	Directory string    `gorm:"column:directory" json:"directory"`
+	Filename  string    `gorm:"column:filename" json:"filename"`
+	IsDir     bool      `gorm:"column:isdir" json:"isdir"`
+	Size      int64     `gorm:"column:size" json:"size"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+//Upload 断点续传上传
+type Upload struct {
+	ID        string    `gorm:"primary_key" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	ExpiresAt time.Time `gorm:"column:expires_at;index" json:"expires_at"`
+	Owner     string    `gorm:"column:owner;index" json:"owner"`
+	PFID      string    `gorm:"column:pfid" json:"parent_id"`
+	Filename  string    `gorm:"column:filename" json:"filename"`
+	Length    int64     `gorm:"column:upload_length" json:"length"`
+	Offset    int64     `gorm:"column:upload_offset" json:"offset"`
+	Metadata  string    `gorm:"column:metadata" json:"metadata"`
+	FID       string    `gorm:"column:fid" json:"file_id,omitempty"`
+}
+
+//Finished 上传是否已经完成
+func (upload *Upload) Finished() bool {
+	return upload.FID != ""
+}
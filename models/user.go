@@ -26,6 +26,8 @@ type User struct {
 	Password  string     `gorm:"column:password" json:"-"`
 	Email     string     `gorm:"column:email;unique_index" json:"email"`
 	Role      string     `gorm:"column:role" json:"role"`
+	Quota     int64      `gorm:"column:quota" json:"quota"`
+	UsedBytes int64      `gorm:"column:used_bytes" json:"used_bytes"`
 }
 
 //BeforeCreate 添加UUID主键
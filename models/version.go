@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+//FileVersion 文件的历史版本，引用的Blob由Hash指定
+type FileVersion struct {
+	ID         string    `gorm:"primary_key" json:"id"`
+	CreatedAt  time.Time `gorm:"column:created_at;index" json:"created_at"`
+	Owner      string    `gorm:"column:owner" json:"owner"`
+	FID        string    `gorm:"column:fid;index" json:"file_id"`
+	Size       int64     `gorm:"column:size" json:"size"`
+	Hash       string    `gorm:"column:hash;index" json:"hash,omitempty"`
+	MD5        string    `gorm:"column:md5" json:"md5,omitempty"`
+	ModifiedAt time.Time `gorm:"column:modified_at" json:"modified_at"`
+}
+
+//BlobKey 版本内容在存储目录中的名称，没有Hash的旧版本以ID命名
+func (v *FileVersion) BlobKey() string {
+	if v.Hash == "" {
+		return v.ID
+	}
+	return BlobKey(v.Hash)
+}
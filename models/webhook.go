@@ -0,0 +1,97 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+//事件类型，订阅EventAll时接收所有事件
+const (
+	EventAll            = "*"
+	EventFileCreated    = "file.created"
+	EventFileUpdated    = "file.updated"
+	EventFileDeleted    = "file.deleted"
+	EventFileMoved      = "file.moved"
+	EventFileRenamed    = "file.renamed"
+	EventFileRestored   = "file.restored"
+	EventUserRegistered = "user.registered"
+)
+
+//EventTypes 所有可以订阅的事件类型
+var EventTypes = []string{
+	EventFileCreated,
+	EventFileUpdated,
+	EventFileDeleted,
+	EventFileMoved,
+	EventFileRenamed,
+	EventFileRestored,
+	EventUserRegistered,
+}
+
+//webhook投递状态
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusSucceeded = "succeeded"
+	DeliveryStatusFailed    = "failed"
+)
+
+//EventList 订阅的事件列表，在数据库中以","连接保存
+type EventList []string
+
+//Value driver.Valuer实现
+func (e EventList) Value() (driver.Value, error) {
+	return strings.Join(e, ","), nil
+}
+
+//Scan sql.Scanner实现
+func (e *EventList) Scan(value interface{}) error {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	case nil:
+	default:
+		return fmt.Errorf("models: cannot scan %T into EventList", value)
+	}
+
+	*e = EventList{}
+	if s != "" {
+		*e = strings.Split(s, ",")
+	}
+	return nil
+}
+
+//Webhook 事件订阅，Owner为空时是管理员创建的全局订阅，接收所有用户的事件
+type Webhook struct {
+	ID        string    `gorm:"primary_key" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Owner     string    `gorm:"column:owner;index" json:"owner,omitempty"`
+	URL       string    `gorm:"column:url" json:"url"`
+	Events    EventList `gorm:"column:events;type:text" json:"events"`
+	Secret    string    `gorm:"column:secret" json:"-"`
+	Enabled   bool      `gorm:"column:enabled" json:"enabled"`
+}
+
+//WebhookDelivery webhook投递记录，同时作为待投递队列，Status为pending且NextAttempt已到的记录会被投递，
+//Payload为发送的请求体
+type WebhookDelivery struct {
+	ID           string          `gorm:"primary_key" json:"id"`
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+	WebhookID    string          `gorm:"column:webhook_id;index" json:"webhook_id"`
+	EventID      string          `gorm:"column:event_id" json:"event_id"`
+	Event        string          `gorm:"column:event" json:"event"`
+	Payload      json.RawMessage `gorm:"column:payload" json:"payload"`
+	Status       string          `gorm:"column:status;index" json:"status"`
+	Attempts     int             `gorm:"column:attempts" json:"attempts"`
+	NextAttempt  time.Time       `gorm:"column:next_attempt;index" json:"next_attempt"`
+	ResponseCode int             `gorm:"column:response_code" json:"response_code,omitempty"`
+	Error        string          `gorm:"column:error" json:"error,omitempty"`
+	DeliveredAt  *time.Time      `gorm:"column:delivered_at" json:"delivered_at,omitempty"`
+}
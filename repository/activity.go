@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/phantom-atom/file-explorer/models"
+)
+
+//ActivityFilter 操作日志查询条件，为空的条件不限制，Before不为0时只查询ID小于Before的记录
+type ActivityFilter struct {
+	Owner   string
+	Actor   string
+	FID     string
+	Actions []string
+	Since   *time.Time
+	Until   *time.Time
+	Before  uint
+	Limit   int
+}
+
+//ActivityRepository 操作日志仓库接口，操作日志只能追加
+type ActivityRepository interface {
+	CreateActivity(*models.Activity) error
+	GetActivities(filter *ActivityFilter) ([]*models.Activity, error)
+}
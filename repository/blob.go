@@ -0,0 +1,20 @@
+package repository
+
+import "github.com/phantom-atom/file-explorer/models"
+
+//BlobRepository 内容寻址存储仓库接口
+type BlobRepository interface {
+	CreateBlob(*models.Blob) error
+	GetBlob(hash string) (*models.Blob, error)
+	AcquireBlob(hash string) (bool, error)
+	ReleaseBlob(hash string) error
+	GetReleasedBlobs(afterHash string, limit int) ([]*models.Blob, error)
+	DeleteReleasedBlob(hash string) (bool, error)
+	CountBlobReferences(hash string) (int64, error)
+	HasBlobReference(owner string, hash string) (bool, error)
+	GetUnhashedFiles(afterID uint, limit int) ([]*models.File, error)
+	GetUnhashedFileVersions(afterID string, limit int) ([]*models.FileVersion, error)
+	SetFileHash(f *models.File, hash string) error
+	SetFileVersionHash(v *models.FileVersion, hash string) error
+	BackfillStoredSizes() (int64, error)
+}
@@ -0,0 +1,12 @@
+package repository
+
+import (
+	"github.com/phantom-atom/file-explorer/models"
+)
+
+//CompressedObjectRepository 压缩对象信息仓库接口
+type CompressedObjectRepository interface {
+	GetCompressedObject(key string) (*models.CompressedObject, error)
+	SaveCompressedObject(*models.CompressedObject) error
+	DeleteCompressedObject(key string) error
+}
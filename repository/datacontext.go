@@ -5,13 +5,26 @@ type DataRepository interface {
 	File() (FileRepository, error)
 	User() (UserRepository, error)
 	VerificationCode() (VerificationCodeRepository, error)
+	Share() (ShareRepository, error)
+	Upload() (UploadRepository, error)
+	Trash() (TrashRepository, error)
+	Version() (VersionRepository, error)
+	Blob() (BlobRepository, error)
+	Job() (JobRepository, error)
+	Tag() (TagRepository, error)
+	DataKey() (DataKeyRepository, error)
+	CompressedObject() (CompressedObjectRepository, error)
+	Webhook() (WebhookRepository, error)
+	Activity() (ActivityRepository, error)
 }
 
-//UnitOfWork 单元工作
+//UnitOfWork 单元工作，Savepoint和RollbackToSavepoint用于只撤销事务中的一部分操作
 type UnitOfWork interface {
 	DataRepository
 	Commit() error
 	Rollback() error
+	Savepoint(name string) error
+	RollbackToSavepoint(name string) error
 }
 
 //DataContext 数据上下文
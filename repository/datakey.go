@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"github.com/phantom-atom/file-explorer/models"
+)
+
+//DataKeyRepository 存储对象数据密钥仓库接口
+type DataKeyRepository interface {
+	GetDataKey(key string) (*models.DataKey, error)
+	SaveDataKey(*models.DataKey) error
+	DeleteDataKey(key string) error
+	GetDataKeys(afterKey string, limit int) ([]*models.DataKey, error)
+}
@@ -1,9 +1,63 @@
 package repository
 
 import (
+	"time"
+
 	"github.com/phantom-atom/file-explorer/models"
 )
 
+//文件搜索的匹配方式
+const (
+	//FileMatchSubstring 包含关键字
+	FileMatchSubstring = "substring"
+	//FileMatchPrefix 以关键字开头
+	FileMatchPrefix = "prefix"
+	//FileMatchGlob 通配符匹配，*匹配任意个字符，?匹配一个字符
+	FileMatchGlob = "glob"
+)
+
+//文件搜索的排序字段
+const (
+	FileSortName      = "name"
+	FileSortSize      = "size"
+	FileSortCreatedAt = "created_at"
+	FileSortUpdatedAt = "updated_at"
+)
+
+//FileCursor 分页游标，表示上一页最后一个文件在排序中的位置，Value为排序字段的值
+type FileCursor struct {
+	IsDir bool
+	Value interface{}
+	ID    uint
+}
+
+//FileSearchOptions 文件搜索条件，零值的条件不生效，关键字同时匹配文件名和所在路径，不区分大小写，
+//Directory限定在该路径及其子路径中，PFID限定在该文件夹中，Category为models.ContentCategories中的分类，Tag为文件标签，
+//DirsFirst为true时文件夹排在文件之前，After不为空时只返回排在游标之后的文件
+type FileSearchOptions struct {
+	Owner         string
+	PFID          string
+	Keyword       string
+	Match         string
+	Directory     string
+	IsDir         *bool
+	MinSize       int64
+	MaxSize       int64
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+	Extension     string
+	Category      string
+	Tag           string
+	Sort          string
+	Desc          bool
+	DirsFirst     bool
+	After         *FileCursor
+	Limit         int
+	Offset        int
+}
+
 //FileRepository 文件仓库接口
 type FileRepository interface {
 	CreateFile(*models.File) error
@@ -11,7 +65,18 @@ type FileRepository interface {
 	UpdateFile(*models.File) error
 	GetFileList(limit int, offset int) ([]*models.File, error)
 	GetFileByPFIDAndName(owner string, pfid string, name string) (*models.File, error)
+	GetFileByPath(owner string, directory string, name string) (*models.File, error)
 	GetFilesByPFID(owner string, pfid string, limit int, offset int) ([]*models.File, error)
 	GetFileByID(owner string, fid string) (*models.File, error)
+	GetTrashedOrFileByID(owner string, fid string) (*models.File, error)
 	GetFileByOwner(owner string, isdir bool, limit int, offset int) ([]*models.File, error)
+	SearchFiles(opts *FileSearchOptions) ([]*models.File, error)
+	CountFiles(opts *FileSearchOptions) (int64, error)
+	SetFileThumbnail(*models.File) error
+	SetFileContentType(*models.File) error
+	GetFilesWithoutContentType(afterID uint, limit int) ([]*models.File, error)
+	GetFilesAfterID(afterID uint, limit int) ([]*models.File, error)
+	GetDanglingFiles(afterID uint, limit int) ([]*models.File, error)
+	GetMisplacedFiles(afterID uint, limit int) ([]*models.File, error)
+	SetFileSize(f *models.File, size int64) error
 }
@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"github.com/phantom-atom/file-explorer/models"
+)
+
+//JobRepository 后台任务仓库接口
+type JobRepository interface {
+	CreateJob(*models.Job) error
+	UpdateJob(*models.Job) error
+	GetJob(owner string, id string) (*models.Job, error)
+	FailRunningJobs(message string) error
+}
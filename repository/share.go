@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/phantom-atom/file-explorer/models"
+)
+
+//ShareRepository 文件分享仓库接口
+type ShareRepository interface {
+	CreateShare(*models.Share) error
+	DeleteShare(*models.Share) error
+	UpdateShare(*models.Share) error
+	GetShareByCode(code string) (*models.Share, error)
+	GetSharesByFID(owner string, fid string) ([]*models.Share, error)
+	AddShareFailedAttempt(code string) (int, error)
+	LockShare(code string, until time.Time) error
+	ResetShareFailedAttempts(code string) error
+}
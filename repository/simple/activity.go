@@ -0,0 +1,48 @@
+package simple
+
+import (
+	"github.com/jinzhu/gorm"
+
+	"github.com/phantom-atom/file-explorer/models"
+	"github.com/phantom-atom/file-explorer/repository"
+)
+
+func (r *dbRepository) CreateActivity(activity *models.Activity) error {
+	return r.db.Create(activity).Error
+}
+
+//GetActivities 按照条件查询操作日志，最新的在前
+func (r *dbRepository) GetActivities(filter *repository.ActivityFilter) ([]*models.Activity, error) {
+	activities := make([]*models.Activity, 0)
+	db := r.db
+	if filter.Owner != "" {
+		db = db.Where("owner = ?", filter.Owner)
+	}
+	if filter.Actor != "" {
+		db = db.Where("actor = ?", filter.Actor)
+	}
+	if filter.FID != "" {
+		db = db.Where("fid = ?", filter.FID)
+	}
+	if len(filter.Actions) > 0 {
+		db = db.Where("action IN (?)", filter.Actions)
+	}
+	if filter.Since != nil {
+		db = db.Where("created_at >= ?", *filter.Since)
+	}
+	if filter.Until != nil {
+		db = db.Where("created_at < ?", *filter.Until)
+	}
+	if filter.Before > 0 {
+		db = db.Where("id < ?", filter.Before)
+	}
+	if filter.Limit > 0 {
+		db = db.Limit(filter.Limit)
+	}
+
+	err := db.Order("id DESC").Find(&activities).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	return activities, err
+}
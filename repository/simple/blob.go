@@ -0,0 +1,183 @@
+package simple
+
+import (
+	"github.com/jinzhu/gorm"
+
+	"github.com/phantom-atom/file-explorer/internal/log"
+	"github.com/phantom-atom/file-explorer/models"
+)
+
+func (r *dbRepository) CreateBlob(b *models.Blob) error {
+	return r.db.Create(b).Error
+}
+
+func (r *dbRepository) GetBlob(hash string) (*models.Blob, error) {
+	blob := &models.Blob{}
+	err := r.db.Where("hash = ?", hash).First(blob).Error
+	if err == gorm.ErrRecordNotFound {
+		blob = nil
+		err = nil
+	}
+	return blob, err
+}
+
+//AcquireBlob 增加Blob的引用计数，Blob不存在时返回false
+func (r *dbRepository) AcquireBlob(hash string) (bool, error) {
+	db := r.db.Model(&models.Blob{}).
+		Where("hash = ?", hash).
+		UpdateColumn("ref_count", gorm.Expr("ref_count + 1"))
+	if err := db.Error; err != nil {
+		return false, err
+	}
+	return db.RowsAffected > 0, nil
+}
+
+//ReleaseBlob 减少Blob的引用计数，计数为0的Blob记录以及存储中的内容在事务提交之后另外清理，
+//以免事务回滚之后Blob记录还在而内容已经被删除
+func (r *dbRepository) ReleaseBlob(hash string) error {
+	return r.db.Model(&models.Blob{}).
+		Where("hash = ?", hash).
+		UpdateColumn("ref_count", gorm.Expr("ref_count - 1")).Error
+}
+
+//GetReleasedBlobs 获取hash大于afterHash并且引用计数为0的Blob
+func (r *dbRepository) GetReleasedBlobs(afterHash string, limit int) ([]*models.Blob, error) {
+	blobs := make([]*models.Blob, 0)
+	db := r.db.Where("hash > ? AND ref_count <= ?", afterHash, 0).Order("hash")
+
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+
+	err := db.Find(&blobs).Error
+	if err == gorm.ErrRecordNotFound {
+		blobs = nil
+		err = nil
+	}
+	return blobs, err
+}
+
+//DeleteReleasedBlob 删除引用计数为0的Blob记录，Blob已经被重新引用时返回false
+func (r *dbRepository) DeleteReleasedBlob(hash string) (bool, error) {
+	db := r.db.Where("hash = ? AND ref_count <= ?", hash, 0).Delete(&models.Blob{})
+	if err := db.Error; err != nil {
+		return false, err
+	}
+	return db.RowsAffected > 0, nil
+}
+
+//CountBlobReferences 统计引用Blob的文件(包括回收站中的文件)以及历史版本的数量
+func (r *dbRepository) CountBlobReferences(hash string) (int64, error) {
+	var result struct {
+		Count int64
+	}
+	err := r.db.Raw(`SELECT
+	(SELECT COUNT(*) FROM files WHERE hash = ?) +
+	(SELECT COUNT(*) FROM file_versions WHERE hash = ?) AS count`, hash, hash).Scan(&result).Error
+	return result.Count, err
+}
+
+//HasBlobReference 检查owner的文件(包括回收站中的文件)或者历史版本是否引用了Blob
+func (r *dbRepository) HasBlobReference(owner string, hash string) (bool, error) {
+	var result struct {
+		Count int64
+	}
+	err := r.db.Raw(`SELECT
+	(SELECT COUNT(*) FROM files WHERE owner = ? AND hash = ?) +
+	(SELECT COUNT(*) FROM file_versions WHERE owner = ? AND hash = ?) AS count`,
+		owner, hash, owner, hash).Scan(&result).Error
+	return result.Count > 0, err
+}
+
+//releaseContent 释放文件或者版本引用的内容，没有Hash的旧内容直接删除
+func (r *dbRepository) releaseContent(hash string, key string) error {
+	if hash != "" {
+		return r.ReleaseBlob(hash)
+	}
+
+	if err := r.storage.Delete(key); err != nil {
+		log.Error("msg", "occur a error when delete file", "error", err.Error())
+	}
+	return nil
+}
+
+func (r *dbRepository) GetUnhashedFiles(afterID uint, limit int) ([]*models.File, error) {
+	files := make([]*models.File, 0)
+	db := r.db.Unscoped()
+	db = db.Where("id > ? AND isdir = ? AND (hash IS NULL OR hash = ?)", afterID, false, "").Order("id")
+
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+
+	err := db.Find(&files).Error
+	if err == gorm.ErrRecordNotFound {
+		files = nil
+		err = nil
+	}
+	return files, err
+}
+
+func (r *dbRepository) GetUnhashedFileVersions(afterID string, limit int) ([]*models.FileVersion, error) {
+	versions := make([]*models.FileVersion, 0)
+	db := r.db
+	db = db.Where("id > ? AND (hash IS NULL OR hash = ?)", afterID, "").Order("id")
+
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+
+	err := db.Find(&versions).Error
+	if err == gorm.ErrRecordNotFound {
+		versions = nil
+		err = nil
+	}
+	return versions, err
+}
+
+//SetFileHash 设置文件引用的Blob，不修改文件的更新时间
+func (r *dbRepository) SetFileHash(f *models.File, hash string) error {
+	err := r.db.Unscoped().Model(&models.File{}).
+		Where("id = ?", f.ID).
+		UpdateColumn("hash", hash).Error
+	if err != nil {
+		return err
+	}
+	f.Hash = hash
+	return nil
+}
+
+//SetFileVersionHash 设置版本引用的Blob
+func (r *dbRepository) SetFileVersionHash(v *models.FileVersion, hash string) error {
+	err := r.db.Model(&models.FileVersion{}).
+		Where("id = ?", v.ID).
+		UpdateColumn("hash", hash).Error
+	if err != nil {
+		return err
+	}
+	v.Hash = hash
+	return nil
+}
+
+//BackfillStoredSizes 没有存储大小的Blob使用内容大小，文件(包括回收站中的文件)使用Blob的存储大小以及压缩方式，
+//没有Hash的旧文件使用内容大小
+func (r *dbRepository) BackfillStoredSizes() (int64, error) {
+	var updated int64
+	statements := []string{
+		`UPDATE blobs SET stored_size = size
+	WHERE stored_size = 0 AND size > 0 AND (encoding IS NULL OR encoding = '')`,
+		`UPDATE files SET stored_size = blobs.stored_size, encoding = blobs.encoding
+	FROM blobs WHERE files.hash = blobs.hash AND files.stored_size = 0 AND files.size > 0`,
+		`UPDATE files SET stored_size = size
+	WHERE stored_size = 0 AND size > 0 AND (hash IS NULL OR hash = '')`,
+	}
+
+	for _, statement := range statements {
+		db := r.db.Exec(statement)
+		if err := db.Error; err != nil {
+			return updated, err
+		}
+		updated += db.RowsAffected
+	}
+	return updated, nil
+}
@@ -0,0 +1,26 @@
+package simple
+
+import (
+	"github.com/jinzhu/gorm"
+
+	"github.com/phantom-atom/file-explorer/models"
+)
+
+func (r *dbRepository) GetCompressedObject(key string) (*models.CompressedObject, error) {
+	object := &models.CompressedObject{}
+	err := r.db.Where("key = ?", key).First(object).Error
+	if err == gorm.ErrRecordNotFound {
+		object = nil
+		err = nil
+	}
+	return object, err
+}
+
+//SaveCompressedObject 创建或者更新压缩对象信息
+func (r *dbRepository) SaveCompressedObject(object *models.CompressedObject) error {
+	return r.db.Save(object).Error
+}
+
+func (r *dbRepository) DeleteCompressedObject(key string) error {
+	return r.db.Where("key = ?", key).Delete(&models.CompressedObject{}).Error
+}
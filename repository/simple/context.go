@@ -7,6 +7,7 @@ import (
 	"github.com/phantom-atom/file-explorer/cache"
 	"github.com/phantom-atom/file-explorer/config"
 	"github.com/phantom-atom/file-explorer/repository"
+	"github.com/phantom-atom/file-explorer/storage"
 )
 
 type context struct {
@@ -17,6 +18,7 @@ type context struct {
 func NewContext(
 	db *gorm.DB,
 	cache cache.Cache,
+	backend storage.Backend,
 	configFun func() *config.Config,
 	now func() time.Time) (repository.DataContext, error) {
 
@@ -24,7 +26,7 @@ func NewContext(
 		cache, configFun, now,
 	)
 
-	dbRepo := newDBRepository(db, configFun)
+	dbRepo := newDBRepository(db, backend, configFun)
 
 	return &context{
 		&dataRepository{
@@ -0,0 +1,44 @@
+package simple
+
+import (
+	"github.com/jinzhu/gorm"
+
+	"github.com/phantom-atom/file-explorer/models"
+)
+
+func (r *dbRepository) GetDataKey(key string) (*models.DataKey, error) {
+	dataKey := &models.DataKey{}
+	err := r.db.Where("key = ?", key).First(dataKey).Error
+	if err == gorm.ErrRecordNotFound {
+		dataKey = nil
+		err = nil
+	}
+	return dataKey, err
+}
+
+//SaveDataKey 创建或者更新数据密钥
+func (r *dbRepository) SaveDataKey(dataKey *models.DataKey) error {
+	return r.db.Save(dataKey).Error
+}
+
+func (r *dbRepository) DeleteDataKey(key string) error {
+	return r.db.Where("key = ?", key).Delete(&models.DataKey{}).Error
+}
+
+//GetDataKeys 按照对象名称顺序获取数据密钥，用于轮换主密钥
+func (r *dbRepository) GetDataKeys(afterKey string, limit int) ([]*models.DataKey, error) {
+	dataKeys := make([]*models.DataKey, 0)
+	db := r.db
+	db = db.Where("key > ?", afterKey).Order("key")
+
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+
+	err := db.Find(&dataKeys).Error
+	if err == gorm.ErrRecordNotFound {
+		dataKeys = nil
+		err = nil
+	}
+	return dataKeys, err
+}
@@ -3,19 +3,22 @@ package simple
 import (
 	"github.com/jinzhu/gorm"
 	"github.com/phantom-atom/file-explorer/config"
+	"github.com/phantom-atom/file-explorer/storage"
 )
 
 //dbRepository 数据仓库
 type dbRepository struct {
-	db     *gorm.DB
-	config func() *config.Config
+	db      *gorm.DB
+	storage storage.Backend
+	config  func() *config.Config
 }
 
 //newDBRepository 创建数据仓库
-func newDBRepository(db *gorm.DB, configFunc func() *config.Config) *dbRepository {
+func newDBRepository(db *gorm.DB, backend storage.Backend, configFunc func() *config.Config) *dbRepository {
 	return &dbRepository{
-		db:     db,
-		config: configFunc,
+		db:      db,
+		storage: backend,
+		config:  configFunc,
 	}
 }
 
@@ -25,7 +28,7 @@ func (r *dbRepository) Begin() (*dbRepository, error) {
 	if err := tx.Error; err != nil {
 		return nil, err
 	}
-	return newDBRepository(tx, r.config), nil
+	return newDBRepository(tx, r.storage, r.config), nil
 }
 
 //Commit 提交事务
@@ -37,3 +40,13 @@ func (r *dbRepository) Commit() error {
 func (r *dbRepository) Rollback() error {
 	return r.db.Rollback().Error
 }
+
+//Savepoint 在事务中创建保存点
+func (r *dbRepository) Savepoint(name string) error {
+	return r.db.Exec("SAVEPOINT " + name).Error
+}
+
+//RollbackToSavepoint 回滚到保存点，事务可以继续使用
+func (r *dbRepository) RollbackToSavepoint(name string) error {
+	return r.db.Exec("ROLLBACK TO SAVEPOINT " + name).Error
+}
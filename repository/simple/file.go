@@ -1,19 +1,24 @@
 package simple
 
 import (
-	"os"
-	"path/filepath"
-
 	"github.com/jinzhu/gorm"
 
-	"github.com/phantom-atom/file-explorer/internal/log"
 	"github.com/phantom-atom/file-explorer/models"
 )
 
+//CreateFile 创建文件记录，并计入所有者已使用的存储空间
 func (r *dbRepository) CreateFile(f *models.File) error {
-	return r.db.Create(f).Error
+	if err := r.db.Create(f).Error; err != nil {
+		return err
+	}
+
+	if f.IsDir {
+		return nil
+	}
+	return r.AddUsedBytes(f.Owner, f.Size)
 }
 
+//DeleteFile 永久删除文件，文件夹会删除其所有子文件
 func (r *dbRepository) DeleteFile(f *models.File) error {
 	if f.IsDir {
 		files, err := r.GetFilesByPFID(f.Owner, f.FID, 0, 0)
@@ -22,24 +27,138 @@ func (r *dbRepository) DeleteFile(f *models.File) error {
 		}
 
 		for _, file := range files {
-			r.DeleteFile(file)
+			if err := r.DeleteFile(file); err != nil {
+				return err
+			}
 		}
+	}
+	return r.destroyFile(f)
+}
 
-		err = r.db.Delete(f).Error
-		if err != nil {
+//destroyFile 永久删除文件记录、文件的分享、标签和元数据、历史版本，释放文件引用的内容并扣除已使用的存储空间
+func (r *dbRepository) destroyFile(f *models.File) error {
+	err := r.db.Unscoped().Where("owner = ? AND fid = ?", f.Owner, f.FID).Delete(&models.File{}).Error
+	if err != nil {
+		return err
+	}
+
+	err = r.db.Where("owner = ? AND fid = ?", f.Owner, f.FID).Delete(&models.Share{}).Error
+	if err != nil {
+		return err
+	}
+
+	if err := r.destroyFileAnnotations(f); err != nil {
+		return err
+	}
+
+	if !f.IsDir {
+		if err := r.destroyFileVersions(f); err != nil {
 			return err
 		}
-	} else {
-		err := r.db.Delete(f).Error
-		if err != nil {
+
+		if err := r.AddUsedBytes(f.Owner, -f.Size); err != nil {
 			return err
 		}
+		return r.releaseContent(f.Hash, f.BlobKey())
+	}
+	return nil
+}
 
-		absolutePath := filepath.Join(r.config().FileService.FileAbsolutePath(), f.FID)
-		if err := os.Remove(absolutePath); err != nil {
-			log.Error("msg", "occur a error when delete file", "error", err.Error())
-		}
+//SetFileThumbnail 标记文件已经生成缩略图，文件内容已经改变时不做修改
+func (r *dbRepository) SetFileThumbnail(f *models.File) error {
+	return r.db.Model(&models.File{}).
+		Where("owner = ? AND fid = ? AND hash = ?", f.Owner, f.FID, f.Hash).
+		UpdateColumn("has_thumbnail", true).Error
+}
+
+//SetFileContentType 只修改文件的ContentType，回收站中的文件同样有效
+func (r *dbRepository) SetFileContentType(f *models.File) error {
+	return r.db.Unscoped().Model(&models.File{}).
+		Where("id = ?", f.ID).
+		UpdateColumn("content_type", f.ContentType).Error
+}
+
+//GetFilesWithoutContentType 获取ID大于afterID并且还没有ContentType的文件，包括回收站中的文件
+func (r *dbRepository) GetFilesWithoutContentType(afterID uint, limit int) ([]*models.File, error) {
+	files := make([]*models.File, 0)
+	db := r.db.Unscoped()
+	db = db.Where("id > ? AND isdir = ? AND (content_type IS NULL OR content_type = ?)", afterID, false, "").Order("id")
+
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+
+	err := db.Find(&files).Error
+	if err == gorm.ErrRecordNotFound {
+		files = nil
+		err = nil
+	}
+	return files, err
+}
+
+//GetFilesAfterID 按照ID顺序获取所有用户的文件(包括回收站中的文件)，用于遍历检查
+func (r *dbRepository) GetFilesAfterID(afterID uint, limit int) ([]*models.File, error) {
+	files := make([]*models.File, 0)
+	db := r.db.Unscoped()
+	db = db.Where("id > ?", afterID).Order("id")
+
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+
+	err := db.Find(&files).Error
+	if err == gorm.ErrRecordNotFound {
+		files = nil
+		err = nil
+	}
+	return files, err
+}
+
+//GetDanglingFiles 获取父文件夹不存在或者不是文件夹的文件，回收站中的文件不做检查
+func (r *dbRepository) GetDanglingFiles(afterID uint, limit int) ([]*models.File, error) {
+	files := make([]*models.File, 0)
+	err := r.db.Raw(`SELECT f.* FROM files f
+	WHERE f.deleted_at IS NULL AND f.id > ? AND f.pfid <> f.owner AND NOT EXISTS (
+		SELECT 1 FROM files p
+		WHERE p.owner = f.owner AND p.fid = f.pfid AND p.isdir AND p.deleted_at IS NULL)
+	ORDER BY f.id LIMIT ?`, afterID, limit).Scan(&files).Error
+	if err == gorm.ErrRecordNotFound {
+		files = nil
+		err = nil
+	}
+	return files, err
+}
+
+//GetMisplacedFiles 获取Directory与父文件夹路径不一致的文件，父文件夹不存在的文件由GetDanglingFiles获取
+func (r *dbRepository) GetMisplacedFiles(afterID uint, limit int) ([]*models.File, error) {
+	files := make([]*models.File, 0)
+	err := r.db.Raw(`SELECT f.* FROM files f
+	LEFT JOIN files p ON p.owner = f.owner AND p.fid = f.pfid AND p.deleted_at IS NULL
+	WHERE f.deleted_at IS NULL AND f.id > ? AND (
+		(f.pfid = f.owner AND f.directory <> '/') OR
+		(p.id IS NOT NULL AND f.directory <> CASE WHEN p.directory = '/'
+			THEN '/' || p.filename ELSE p.directory || '/' || p.filename END))
+	ORDER BY f.id LIMIT ?`, afterID, limit).Scan(&files).Error
+	if err == gorm.ErrRecordNotFound {
+		files = nil
+		err = nil
+	}
+	return files, err
+}
+
+//SetFileSize 修改文件大小并调整已使用的存储空间，不修改文件的更新时间
+func (r *dbRepository) SetFileSize(f *models.File, size int64) error {
+	err := r.db.Unscoped().Model(&models.File{}).
+		Where("id = ?", f.ID).
+		UpdateColumn("size", size).Error
+	if err != nil {
+		return err
+	}
+
+	if err := r.AddUsedBytes(f.Owner, size-f.Size); err != nil {
+		return err
 	}
+	f.Size = size
 	return nil
 }
 
@@ -80,10 +199,22 @@ func (r *dbRepository) GetFileByPFIDAndName(owner string, pfid string, name stri
 	return file, err
 }
 
+func (r *dbRepository) GetFileByPath(owner string, directory string, name string) (*models.File, error) {
+	file := &models.File{}
+	db := r.db
+	db = db.Where("owner = ? AND directory = ? AND filename = ?", owner, directory, name)
+	err := db.First(file).Error
+	if err == gorm.ErrRecordNotFound {
+		file = nil
+		err = nil
+	}
+	return file, err
+}
+
 func (r *dbRepository) GetFilesByPFID(owner string, pfid string, limit int, offset int) ([]*models.File, error) {
 	files := make([]*models.File, 0)
 	db := r.db
-	db = db.Where("owner = ? AND pfid = ?", owner, pfid)
+	db = db.Where("owner = ? AND pfid = ?", owner, pfid).Order("filename").Order("id")
 
 	if limit != 0 {
 		db = db.Limit(limit)
@@ -112,6 +243,17 @@ func (r *dbRepository) GetFileByID(owner string, fid string) (*models.File, erro
 	return file, err
 }
 
+//GetTrashedOrFileByID 获取文件，包括回收站中的文件
+func (r *dbRepository) GetTrashedOrFileByID(owner string, fid string) (*models.File, error) {
+	file := &models.File{}
+	err := r.db.Unscoped().Where("fid = ? AND owner = ?", fid, owner).First(file).Error
+	if err == gorm.ErrRecordNotFound {
+		file = nil
+		err = nil
+	}
+	return file, err
+}
+
 func (r *dbRepository) GetFileByOwner(owner string, isdir bool, limit int, offset int) ([]*models.File, error) {
 
 	files := make([]*models.File, 0)
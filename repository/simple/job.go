@@ -0,0 +1,35 @@
+package simple
+
+import (
+	"github.com/jinzhu/gorm"
+
+	"github.com/phantom-atom/file-explorer/models"
+)
+
+func (r *dbRepository) CreateJob(job *models.Job) error {
+	return r.db.Create(job).Error
+}
+
+func (r *dbRepository) UpdateJob(job *models.Job) error {
+	return r.db.Save(job).Error
+}
+
+func (r *dbRepository) GetJob(owner string, id string) (*models.Job, error) {
+	job := &models.Job{}
+	err := r.db.Where("id = ? AND owner = ?", id, owner).First(job).Error
+	if err == gorm.ErrRecordNotFound {
+		job = nil
+		err = nil
+	}
+	return job, err
+}
+
+//FailRunningJobs 将所有运行中的任务标记为失败，用于服务重启后处理被中断的任务
+func (r *dbRepository) FailRunningJobs(message string) error {
+	return r.db.Model(&models.Job{}).
+		Where("status = ?", models.JobStatusRunning).
+		UpdateColumns(map[string]interface{}{
+			"status": models.JobStatusFailed,
+			"error":  message,
+		}).Error
+}
@@ -16,6 +16,50 @@ func (d *dataRepository) User() (repository.UserRepository, error) {
 	return d.dbRepository, nil
 }
 
+func (d *dataRepository) Share() (repository.ShareRepository, error) {
+	return d.dbRepository, nil
+}
+
+func (d *dataRepository) Upload() (repository.UploadRepository, error) {
+	return d.dbRepository, nil
+}
+
+func (d *dataRepository) Trash() (repository.TrashRepository, error) {
+	return d.dbRepository, nil
+}
+
+func (d *dataRepository) Version() (repository.VersionRepository, error) {
+	return d.dbRepository, nil
+}
+
+func (d *dataRepository) Blob() (repository.BlobRepository, error) {
+	return d.dbRepository, nil
+}
+
+func (d *dataRepository) Job() (repository.JobRepository, error) {
+	return d.dbRepository, nil
+}
+
+func (d *dataRepository) Tag() (repository.TagRepository, error) {
+	return d.dbRepository, nil
+}
+
+func (d *dataRepository) DataKey() (repository.DataKeyRepository, error) {
+	return d.dbRepository, nil
+}
+
+func (d *dataRepository) CompressedObject() (repository.CompressedObjectRepository, error) {
+	return d.dbRepository, nil
+}
+
+func (d *dataRepository) Webhook() (repository.WebhookRepository, error) {
+	return d.dbRepository, nil
+}
+
+func (d *dataRepository) Activity() (repository.ActivityRepository, error) {
+	return d.dbRepository, nil
+}
+
 func (d *dataRepository) VerificationCode() (repository.VerificationCodeRepository, error) {
 	return d.verificationCode, nil
 }
@@ -0,0 +1,185 @@
+package simple
+
+import (
+	"strings"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/phantom-atom/file-explorer/models"
+	"github.com/phantom-atom/file-explorer/repository"
+)
+
+var fileSortColumns = map[string]string{
+	repository.FileSortName:      "filename",
+	repository.FileSortSize:      "size",
+	repository.FileSortCreatedAt: "created_at",
+	repository.FileSortUpdatedAt: "updated_at",
+}
+
+//SearchFiles 搜索文件，回收站中的文件不会被搜索到，
+//关键字使用ILIKE匹配，filename和directory上的trigram索引可以加速包含和通配符匹配，
+//After不为空时从游标之后开始(keyset分页)，排序字段相同时按照id排序保证顺序稳定
+func (r *dbRepository) SearchFiles(opts *repository.FileSearchOptions) ([]*models.File, error) {
+	files := make([]*models.File, 0)
+	db, ok := r.searchConditions(opts)
+	if !ok {
+		return files, nil
+	}
+
+	column, ok := fileSortColumns[opts.Sort]
+	if !ok {
+		column = "filename"
+	}
+
+	direction, comparison := "", ">"
+	if opts.Desc {
+		direction, comparison = " DESC", "<"
+	}
+
+	if opts.After != nil {
+		keyset := "(" + column + ", id) " + comparison + " (?, ?)"
+		if opts.DirsFirst {
+			db = db.Where("(isdir < ? OR (isdir = ? AND "+keyset+"))",
+				opts.After.IsDir, opts.After.IsDir, opts.After.Value, opts.After.ID)
+		} else {
+			db = db.Where(keyset, opts.After.Value, opts.After.ID)
+		}
+	}
+
+	if opts.DirsFirst {
+		db = db.Order("isdir DESC")
+	}
+	db = db.Order(column + direction).Order("id" + direction)
+
+	if opts.Limit > 0 {
+		db = db.Limit(opts.Limit)
+	}
+
+	if opts.Offset > 0 {
+		db = db.Offset(opts.Offset)
+	}
+
+	err := db.Find(&files).Error
+	if err == gorm.ErrRecordNotFound {
+		files = nil
+		err = nil
+	}
+	return files, err
+}
+
+//CountFiles 统计符合条件的文件数量，忽略排序、游标以及分页
+func (r *dbRepository) CountFiles(opts *repository.FileSearchOptions) (int64, error) {
+	db, ok := r.searchConditions(opts)
+	if !ok {
+		return 0, nil
+	}
+
+	var count int64
+	err := db.Model(&models.File{}).Count(&count).Error
+	return count, err
+}
+
+//searchConditions 根据搜索条件创建查询，条件不可能匹配任何文件时返回false
+func (r *dbRepository) searchConditions(opts *repository.FileSearchOptions) (*gorm.DB, bool) {
+	db := r.db
+	db = db.Where("owner = ?", opts.Owner)
+
+	if opts.PFID != "" {
+		db = db.Where("pfid = ?", opts.PFID)
+	}
+
+	if opts.Directory != "" {
+		db = db.Where("(directory = ? OR directory LIKE ?)",
+			opts.Directory, escapeLike(strings.TrimSuffix(opts.Directory, "/"))+"/%")
+	}
+
+	if opts.Keyword != "" {
+		var pattern string
+		switch opts.Match {
+		case repository.FileMatchPrefix:
+			pattern = escapeLike(opts.Keyword) + "%"
+		case repository.FileMatchGlob:
+			pattern = globToLike(opts.Keyword)
+		default:
+			pattern = "%" + escapeLike(opts.Keyword) + "%"
+		}
+		db = db.Where("(filename ILIKE ? OR directory ILIKE ?)", pattern, pattern)
+	}
+
+	if opts.Extension != "" {
+		db = db.Where("isdir = ? AND filename ILIKE ?", false,
+			"%."+escapeLike(strings.TrimPrefix(opts.Extension, ".")))
+	}
+
+	if opts.Category != "" {
+		patterns := models.ContentCategories[opts.Category]
+		if len(patterns) == 0 {
+			return nil, false
+		}
+
+		conditions := make([]string, 0, len(patterns))
+		arguments := make([]interface{}, 0, len(patterns))
+		for _, pattern := range patterns {
+			conditions = append(conditions, "content_type LIKE ?")
+			arguments = append(arguments, pattern)
+		}
+		db = db.Where("("+strings.Join(conditions, " OR ")+")", arguments...)
+	}
+
+	if opts.Tag != "" {
+		db = db.Where("fid IN (SELECT fid FROM file_tags WHERE owner = ? AND tag = ?)", opts.Owner, opts.Tag)
+	}
+
+	if opts.IsDir != nil {
+		db = db.Where("isdir = ?", *opts.IsDir)
+	}
+
+	if opts.MinSize > 0 {
+		db = db.Where("size >= ?", opts.MinSize)
+	}
+
+	if opts.MaxSize > 0 {
+		db = db.Where("size <= ?", opts.MaxSize)
+	}
+
+	if !opts.CreatedAfter.IsZero() {
+		db = db.Where("created_at >= ?", opts.CreatedAfter)
+	}
+
+	if !opts.CreatedBefore.IsZero() {
+		db = db.Where("created_at < ?", opts.CreatedBefore)
+	}
+
+	if !opts.UpdatedAfter.IsZero() {
+		db = db.Where("updated_at >= ?", opts.UpdatedAfter)
+	}
+
+	if !opts.UpdatedBefore.IsZero() {
+		db = db.Where("updated_at < ?", opts.UpdatedBefore)
+	}
+	return db, true
+}
+
+//escapeLike 转义LIKE模式中的特殊字符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+//globToLike 将通配符模式转换为LIKE模式，*转换为%，?转换为_
+func globToLike(glob string) string {
+	var b strings.Builder
+	for _, c := range glob {
+		switch c {
+		case '*':
+			b.WriteByte('%')
+		case '?':
+			b.WriteByte('_')
+		case '\\', '%', '_':
+			b.WriteByte('\\')
+			b.WriteRune(c)
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,24 @@
+package simple
+
+import "testing"
+
+func TestGlobToLike(t *testing.T) {
+	cases := map[string]string{
+		"*.txt":      "%.txt",
+		"report-?":   "report-_",
+		"100%_done*": `100\%\_done%`,
+		`a\b`:        `a\\b`,
+	}
+
+	for glob, expected := range cases {
+		if like := globToLike(glob); like != expected {
+			t.Errorf("globToLike(%q) = %q, expected %q", glob, like, expected)
+		}
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	if s := escapeLike(`50%_off\`); s != `50\%\_off\\` {
+		t.Errorf("escapeLike = %q", s)
+	}
+}
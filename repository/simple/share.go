@@ -0,0 +1,71 @@
+package simple
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/phantom-atom/file-explorer/models"
+)
+
+func (r *dbRepository) CreateShare(share *models.Share) error {
+	return r.db.Create(share).Error
+}
+
+func (r *dbRepository) DeleteShare(share *models.Share) error {
+	return r.db.Delete(share).Error
+}
+
+//UpdateShare 保存分享信息，输错密码的次数以及锁定时间只通过单独的方法修改，以免被并发的请求覆盖
+func (r *dbRepository) UpdateShare(share *models.Share) error {
+	return r.db.Omit("failed_attempts", "locked_until").Save(share).Error
+}
+
+func (r *dbRepository) GetShareByCode(code string) (*models.Share, error) {
+	share := &models.Share{}
+	err := r.db.Where("code = ?", code).First(share).Error
+	if err == gorm.ErrRecordNotFound {
+		share = nil
+		err = nil
+	}
+	return share, err
+}
+
+func (r *dbRepository) GetSharesByFID(owner string, fid string) ([]*models.Share, error) {
+	shares := make([]*models.Share, 0)
+	db := r.db
+	db = db.Where("owner = ? AND fid = ?", owner, fid)
+
+	err := db.Find(&shares).Error
+	if err == gorm.ErrRecordNotFound {
+		shares = nil
+		err = nil
+	}
+	return shares, err
+}
+
+//AddShareFailedAttempt 增加输错密码的次数，返回增加后的次数
+func (r *dbRepository) AddShareFailedAttempt(code string) (int, error) {
+	var result struct {
+		FailedAttempts int
+	}
+	err := r.db.Raw("UPDATE shares SET failed_attempts = failed_attempts + 1 WHERE code = ? RETURNING failed_attempts",
+		code).Scan(&result).Error
+	return result.FailedAttempts, err
+}
+
+//LockShare 锁定分享直到until，并清零输错密码的次数
+func (r *dbRepository) LockShare(code string, until time.Time) error {
+	return r.db.Model(&models.Share{}).
+		Where("code = ?", code).
+		UpdateColumns(map[string]interface{}{
+			"failed_attempts": 0,
+			"locked_until":    until,
+		}).Error
+}
+
+//ResetShareFailedAttempts 输入正确的密码后清零输错密码的次数
+func (r *dbRepository) ResetShareFailedAttempts(code string) error {
+	return r.db.Model(&models.Share{}).
+		Where("code = ? AND failed_attempts > ?", code, 0).
+		UpdateColumn("failed_attempts", 0).Error
+}
@@ -0,0 +1,128 @@
+package simple
+
+import (
+	"github.com/phantom-atom/file-explorer/models"
+)
+
+func (r *dbRepository) GetFileTags(owner string, fid string) ([]string, error) {
+	tags := make([]string, 0)
+	err := r.db.Model(&models.FileTag{}).
+		Where("owner = ? AND fid = ?", owner, fid).
+		Order("tag").
+		Pluck("tag", &tags).Error
+	return tags, err
+}
+
+//AddFileTags 添加文件标签，已经存在的标签不会重复添加
+func (r *dbRepository) AddFileTags(owner string, fid string, tags []string) error {
+	existing, err := r.GetFileTags(owner, fid)
+	if err != nil {
+		return err
+	}
+
+	existingTags := make(map[string]bool, len(existing))
+	for _, tag := range existing {
+		existingTags[tag] = true
+	}
+
+	for _, tag := range tags {
+		if existingTags[tag] {
+			continue
+		}
+
+		err := r.db.Create(&models.FileTag{
+			Owner: owner,
+			FID:   fid,
+			Tag:   tag,
+		}).Error
+		if err != nil {
+			return err
+		}
+		existingTags[tag] = true
+	}
+	return nil
+}
+
+func (r *dbRepository) RemoveFileTags(owner string, fid string, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	return r.db.Where("owner = ? AND fid = ? AND tag IN (?)", owner, fid, tags).
+		Delete(&models.FileTag{}).Error
+}
+
+func (r *dbRepository) ClearFileTags(owner string, fid string) error {
+	return r.db.Where("owner = ? AND fid = ?", owner, fid).Delete(&models.FileTag{}).Error
+}
+
+//GetTagCounts 获取owner的所有标签以及使用数量，回收站中的文件不计算在内
+func (r *dbRepository) GetTagCounts(owner string) ([]*models.TagCount, error) {
+	counts := make([]*models.TagCount, 0)
+	err := r.db.Raw(`SELECT file_tags.tag AS tag, COUNT(*) AS count FROM file_tags
+		JOIN files ON files.owner = file_tags.owner AND files.fid = file_tags.fid AND files.deleted_at IS NULL
+		WHERE file_tags.owner = ? GROUP BY file_tags.tag ORDER BY file_tags.tag`, owner).
+		Scan(&counts).Error
+	return counts, err
+}
+
+func (r *dbRepository) GetFileMetadata(owner string, fid string) ([]*models.FileMetadata, error) {
+	metadata := make([]*models.FileMetadata, 0)
+	err := r.db.Where("owner = ? AND fid = ?", owner, fid).Order("key").Find(&metadata).Error
+	return metadata, err
+}
+
+//SetFileMetadata 设置文件元数据，键已经存在时修改值
+func (r *dbRepository) SetFileMetadata(owner string, fid string, key string, value string) error {
+	metadata := &models.FileMetadata{}
+	return r.db.Where("owner = ? AND fid = ? AND key = ?", owner, fid, key).
+		Assign(models.FileMetadata{Value: value}).
+		FirstOrCreate(metadata, models.FileMetadata{
+			Owner: owner,
+			FID:   fid,
+			Key:   key,
+		}).Error
+}
+
+func (r *dbRepository) RemoveFileMetadata(owner string, fid string, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return r.db.Where("owner = ? AND fid = ? AND key IN (?)", owner, fid, keys).
+		Delete(&models.FileMetadata{}).Error
+}
+
+func (r *dbRepository) ClearFileMetadata(owner string, fid string) error {
+	return r.db.Where("owner = ? AND fid = ?", owner, fid).Delete(&models.FileMetadata{}).Error
+}
+
+//CopyFileAnnotations 复制文件的标签和元数据到另一个文件
+func (r *dbRepository) CopyFileAnnotations(owner string, fromFID string, toFID string) error {
+	tags, err := r.GetFileTags(owner, fromFID)
+	if err != nil {
+		return err
+	}
+
+	if err := r.AddFileTags(owner, toFID, tags); err != nil {
+		return err
+	}
+
+	metadata, err := r.GetFileMetadata(owner, fromFID)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range metadata {
+		if err := r.SetFileMetadata(owner, toFID, item.Key, item.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//destroyFileAnnotations 删除文件的标签和元数据，文件被永久删除时调用
+func (r *dbRepository) destroyFileAnnotations(f *models.File) error {
+	if err := r.ClearFileTags(f.Owner, f.FID); err != nil {
+		return err
+	}
+	return r.ClearFileMetadata(f.Owner, f.FID)
+}
@@ -0,0 +1,117 @@
+package simple
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/phantom-atom/file-explorer/models"
+)
+
+//TrashFile 将文件及其子文件移入回收站，文件记录被软删除并标记所属的回收站项目
+func (r *dbRepository) TrashFile(f *models.File, item *models.TrashItem) error {
+	if err := r.db.Create(item).Error; err != nil {
+		return err
+	}
+	return r.trashFile(f, item)
+}
+
+func (r *dbRepository) trashFile(f *models.File, item *models.TrashItem) error {
+	if f.IsDir {
+		files, err := r.GetFilesByPFID(f.Owner, f.FID, 0, 0)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			if err := r.trashFile(file, item); err != nil {
+				return err
+			}
+		}
+	}
+
+	return r.db.Model(&models.File{}).
+		Where("owner = ? AND fid = ?", f.Owner, f.FID).
+		UpdateColumns(map[string]interface{}{
+			"trash_id":   item.ID,
+			"deleted_at": item.TrashedAt,
+		}).Error
+}
+
+//RestoreTrashItem 恢复回收站项目中的所有文件记录，并删除回收站项目
+func (r *dbRepository) RestoreTrashItem(item *models.TrashItem) error {
+	err := r.db.Unscoped().Model(&models.File{}).
+		Where("owner = ? AND trash_id = ?", item.Owner, item.ID).
+		UpdateColumns(map[string]interface{}{
+			"trash_id":   "",
+			"deleted_at": nil,
+		}).Error
+	if err != nil {
+		return err
+	}
+	return r.db.Delete(item).Error
+}
+
+//DeleteTrashItem 永久删除回收站项目中的所有文件
+func (r *dbRepository) DeleteTrashItem(item *models.TrashItem) error {
+	files := make([]*models.File, 0)
+	err := r.db.Unscoped().
+		Where("owner = ? AND trash_id = ?", item.Owner, item.ID).
+		Find(&files).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return err
+	}
+
+	for _, file := range files {
+		if err := r.destroyFile(file); err != nil {
+			return err
+		}
+	}
+	return r.db.Delete(item).Error
+}
+
+func (r *dbRepository) GetTrashItem(owner string, id string) (*models.TrashItem, error) {
+	item := &models.TrashItem{}
+	err := r.db.Where("id = ? AND owner = ?", id, owner).First(item).Error
+	if err == gorm.ErrRecordNotFound {
+		item = nil
+		err = nil
+	}
+	return item, err
+}
+
+func (r *dbRepository) GetTrashItems(owner string, limit int, offset int) ([]*models.TrashItem, error) {
+	items := make([]*models.TrashItem, 0)
+	db := r.db
+	db = db.Where("owner = ?", owner).Order("trashed_at DESC")
+
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+	if offset != 0 {
+		db = db.Offset(offset)
+	}
+
+	err := db.Find(&items).Error
+	if err == gorm.ErrRecordNotFound {
+		items = nil
+		err = nil
+	}
+	return items, err
+}
+
+func (r *dbRepository) GetExpiredTrashItems(before time.Time, limit int) ([]*models.TrashItem, error) {
+	items := make([]*models.TrashItem, 0)
+	db := r.db
+	db = db.Where("trashed_at < ?", before)
+
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+
+	err := db.Find(&items).Error
+	if err == gorm.ErrRecordNotFound {
+		items = nil
+		err = nil
+	}
+	return items, err
+}
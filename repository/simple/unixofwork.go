@@ -28,3 +28,11 @@ func (u *unixOfWork) Commit() error {
 func (u *unixOfWork) Rollback() error {
 	return u.dbRepository.Rollback()
 }
+
+func (u *unixOfWork) Savepoint(name string) error {
+	return u.dbRepository.Savepoint(name)
+}
+
+func (u *unixOfWork) RollbackToSavepoint(name string) error {
+	return u.dbRepository.RollbackToSavepoint(name)
+}
@@ -0,0 +1,47 @@
+package simple
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/phantom-atom/file-explorer/models"
+)
+
+func (r *dbRepository) CreateUpload(upload *models.Upload) error {
+	return r.db.Create(upload).Error
+}
+
+func (r *dbRepository) DeleteUpload(upload *models.Upload) error {
+	return r.db.Delete(upload).Error
+}
+
+func (r *dbRepository) UpdateUpload(upload *models.Upload) error {
+	return r.db.Save(upload).Error
+}
+
+func (r *dbRepository) GetUpload(owner string, id string) (*models.Upload, error) {
+	upload := &models.Upload{}
+	err := r.db.Where("id = ? AND owner = ?", id, owner).First(upload).Error
+	if err == gorm.ErrRecordNotFound {
+		upload = nil
+		err = nil
+	}
+	return upload, err
+}
+
+func (r *dbRepository) GetExpiredUploads(before time.Time, limit int) ([]*models.Upload, error) {
+	uploads := make([]*models.Upload, 0)
+	db := r.db
+	db = db.Where("expires_at < ?", before)
+
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+
+	err := db.Find(&uploads).Error
+	if err == gorm.ErrRecordNotFound {
+		uploads = nil
+		err = nil
+	}
+	return uploads, err
+}
@@ -23,12 +23,25 @@ func (r *dbRepository) DeleteUser(id string) error {
 		if err != nil {
 			return err
 		}
+
+		items, err := r.GetTrashItems(id, 0, 0)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			if err := r.DeleteTrashItem(item); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
 
+//UpdateUser 保存用户信息，已使用的存储空间只通过AddUsedBytes和RecountUsedBytes修改，配额只在创建用户时设置，
+//这里不写入这两列，以免读取之后并发上传或者删除修改的值被覆盖
 func (r *dbRepository) UpdateUser(user *models.User) error {
-	return r.db.Save(user).Error
+	return r.db.Omit("used_bytes", "quota").Save(user).Error
 }
 
 func (r *dbRepository) GetUser(id string) (*models.User, error) {
@@ -108,3 +121,20 @@ func (r *dbRepository) CheckUserExists(user *models.User) (string, error) {
 	}
 	return "email", nil
 }
+
+//AddUsedBytes 原子地调整用户已使用的存储空间
+func (r *dbRepository) AddUsedBytes(id string, delta int64) error {
+	if delta == 0 {
+		return nil
+	}
+	return r.db.Model(&models.User{}).
+		Where("id = ?", id).
+		UpdateColumn("used_bytes", gorm.Expr("used_bytes + ?", delta)).Error
+}
+
+//RecountUsedBytes 根据文件(包括回收站中的文件)以及历史版本的大小重新统计所有用户已使用的存储空间
+func (r *dbRepository) RecountUsedBytes() error {
+	return r.db.Exec(`UPDATE users SET used_bytes =
+	(SELECT COALESCE(SUM(size), 0) FROM files WHERE files.owner = users.id AND NOT files.isdir) +
+	(SELECT COALESCE(SUM(size), 0) FROM file_versions WHERE file_versions.owner = users.id)`).Error
+}
@@ -0,0 +1,101 @@
+package simple
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/phantom-atom/file-explorer/models"
+)
+
+//CreateFileVersion 创建版本记录，并计入所有者已使用的存储空间
+func (r *dbRepository) CreateFileVersion(v *models.FileVersion) error {
+	if err := r.db.Create(v).Error; err != nil {
+		return err
+	}
+	return r.AddUsedBytes(v.Owner, v.Size)
+}
+
+//DeleteFileVersion 删除版本记录，释放版本引用的内容并扣除已使用的存储空间
+func (r *dbRepository) DeleteFileVersion(v *models.FileVersion) error {
+	if err := r.db.Delete(v).Error; err != nil {
+		return err
+	}
+
+	if err := r.AddUsedBytes(v.Owner, -v.Size); err != nil {
+		return err
+	}
+	return r.releaseContent(v.Hash, v.BlobKey())
+}
+
+func (r *dbRepository) GetFileVersion(owner string, fid string, id string) (*models.FileVersion, error) {
+	version := &models.FileVersion{}
+	err := r.db.Where("id = ? AND owner = ? AND fid = ?", id, owner, fid).First(version).Error
+	if err == gorm.ErrRecordNotFound {
+		version = nil
+		err = nil
+	}
+	return version, err
+}
+
+func (r *dbRepository) GetFileVersions(owner string, fid string) ([]*models.FileVersion, error) {
+	versions := make([]*models.FileVersion, 0)
+	err := r.db.Where("owner = ? AND fid = ?", owner, fid).
+		Order("created_at DESC").
+		Find(&versions).Error
+	if err == gorm.ErrRecordNotFound {
+		versions = nil
+		err = nil
+	}
+	return versions, err
+}
+
+func (r *dbRepository) GetExpiredFileVersions(before time.Time, limit int) ([]*models.FileVersion, error) {
+	versions := make([]*models.FileVersion, 0)
+	db := r.db
+	db = db.Where("created_at < ?", before)
+
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+
+	err := db.Find(&versions).Error
+	if err == gorm.ErrRecordNotFound {
+		versions = nil
+		err = nil
+	}
+	return versions, err
+}
+
+//GetFileVersionsAfterID 按照ID顺序获取所有用户的历史版本，用于遍历检查
+func (r *dbRepository) GetFileVersionsAfterID(afterID string, limit int) ([]*models.FileVersion, error) {
+	versions := make([]*models.FileVersion, 0)
+	db := r.db
+	db = db.Where("id > ?", afterID).Order("id")
+
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+
+	err := db.Find(&versions).Error
+	if err == gorm.ErrRecordNotFound {
+		versions = nil
+		err = nil
+	}
+	return versions, err
+}
+
+//destroyFileVersions 删除文件的所有历史版本
+func (r *dbRepository) destroyFileVersions(f *models.File) error {
+	versions, err := r.GetFileVersions(f.Owner, f.FID)
+	if err != nil {
+		return err
+	}
+
+	for _, version := range versions {
+		if err := r.DeleteFileVersion(version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
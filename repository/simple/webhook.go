@@ -0,0 +1,120 @@
+package simple
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/phantom-atom/file-explorer/models"
+)
+
+func (r *dbRepository) CreateWebhook(webhook *models.Webhook) error {
+	return r.db.Create(webhook).Error
+}
+
+func (r *dbRepository) UpdateWebhook(webhook *models.Webhook) error {
+	return r.db.Save(webhook).Error
+}
+
+//DeleteWebhook 删除订阅以及订阅的投递记录
+func (r *dbRepository) DeleteWebhook(webhook *models.Webhook) error {
+	err := r.db.Where("webhook_id = ?", webhook.ID).
+		Delete(&models.WebhookDelivery{}).Error
+	if err != nil {
+		return err
+	}
+	return r.db.Delete(webhook).Error
+}
+
+func (r *dbRepository) GetWebhook(owner string, id string) (*models.Webhook, error) {
+	webhook := &models.Webhook{}
+	err := r.db.Where("id = ? AND owner = ?", id, owner).First(webhook).Error
+	if err == gorm.ErrRecordNotFound {
+		webhook = nil
+		err = nil
+	}
+	return webhook, err
+}
+
+func (r *dbRepository) GetWebhookByID(id string) (*models.Webhook, error) {
+	webhook := &models.Webhook{}
+	err := r.db.Where("id = ?", id).First(webhook).Error
+	if err == gorm.ErrRecordNotFound {
+		webhook = nil
+		err = nil
+	}
+	return webhook, err
+}
+
+func (r *dbRepository) GetWebhooks(owner string) ([]*models.Webhook, error) {
+	webhooks := make([]*models.Webhook, 0)
+	err := r.db.Where("owner = ?", owner).
+		Order("created_at").
+		Find(&webhooks).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	return webhooks, err
+}
+
+//GetSubscribedWebhooks 获取owner的以及全局的订阅了event的已启用订阅
+func (r *dbRepository) GetSubscribedWebhooks(owner string, event string) ([]*models.Webhook, error) {
+	webhooks := make([]*models.Webhook, 0)
+	err := r.db.
+		Where("enabled = ? AND (owner = ? OR owner = '')", true, owner).
+		Where("(',' || events || ',') LIKE ? OR (',' || events || ',') LIKE ?",
+			"%,"+event+",%", "%,"+models.EventAll+",%").
+		Find(&webhooks).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	return webhooks, err
+}
+
+func (r *dbRepository) CreateWebhookDelivery(delivery *models.WebhookDelivery) error {
+	return r.db.Create(delivery).Error
+}
+
+func (r *dbRepository) UpdateWebhookDelivery(delivery *models.WebhookDelivery) error {
+	return r.db.Save(delivery).Error
+}
+
+//GetWebhookDeliveries 获取订阅的投递记录，最新的在前
+func (r *dbRepository) GetWebhookDeliveries(webhookID string, limit int, offset int) ([]*models.WebhookDelivery, error) {
+	deliveries := make([]*models.WebhookDelivery, 0)
+	db := r.db.Where("webhook_id = ?", webhookID).Order("created_at DESC")
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+	if offset > 0 {
+		db = db.Offset(offset)
+	}
+
+	err := db.Find(&deliveries).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	return deliveries, err
+}
+
+//GetDueWebhookDeliveries 获取等待投递并且已经到达投递时间的记录，按投递时间排序
+func (r *dbRepository) GetDueWebhookDeliveries(now time.Time, limit int) ([]*models.WebhookDelivery, error) {
+	deliveries := make([]*models.WebhookDelivery, 0)
+	err := r.db.
+		Where("status = ? AND next_attempt <= ?", models.DeliveryStatusPending, now).
+		Order("next_attempt").
+		Limit(limit).
+		Find(&deliveries).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	return deliveries, err
+}
+
+//DeleteWebhookDeliveries 删除before之前创建的已经结束的投递记录，返回删除的数量
+func (r *dbRepository) DeleteWebhookDeliveries(before time.Time) (int64, error) {
+	db := r.db.
+		Where("status <> ? AND created_at < ?", models.DeliveryStatusPending, before).
+		Delete(&models.WebhookDelivery{})
+	return db.RowsAffected, db.Error
+}
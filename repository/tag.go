@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"github.com/phantom-atom/file-explorer/models"
+)
+
+//TagRepository 文件标签和元数据仓库接口
+type TagRepository interface {
+	GetFileTags(owner string, fid string) ([]string, error)
+	AddFileTags(owner string, fid string, tags []string) error
+	RemoveFileTags(owner string, fid string, tags []string) error
+	ClearFileTags(owner string, fid string) error
+	GetTagCounts(owner string) ([]*models.TagCount, error)
+	GetFileMetadata(owner string, fid string) ([]*models.FileMetadata, error)
+	SetFileMetadata(owner string, fid string, key string, value string) error
+	RemoveFileMetadata(owner string, fid string, keys []string) error
+	ClearFileMetadata(owner string, fid string) error
+	CopyFileAnnotations(owner string, fromFID string, toFID string) error
+}
@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/phantom-atom/file-explorer/models"
+)
+
+//TrashRepository 回收站仓库接口
+type TrashRepository interface {
+	TrashFile(*models.File, *models.TrashItem) error
+	RestoreTrashItem(*models.TrashItem) error
+	DeleteTrashItem(*models.TrashItem) error
+	GetTrashItem(owner string, id string) (*models.TrashItem, error)
+	GetTrashItems(owner string, limit int, offset int) ([]*models.TrashItem, error)
+	GetExpiredTrashItems(before time.Time, limit int) ([]*models.TrashItem, error)
+}
@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/phantom-atom/file-explorer/models"
+)
+
+//UploadRepository 断点续传上传仓库接口
+type UploadRepository interface {
+	CreateUpload(*models.Upload) error
+	DeleteUpload(*models.Upload) error
+	UpdateUpload(*models.Upload) error
+	GetUpload(owner string, id string) (*models.Upload, error)
+	GetExpiredUploads(before time.Time, limit int) ([]*models.Upload, error)
+}
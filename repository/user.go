@@ -14,4 +14,6 @@ type UserRepository interface {
 	GetUserByEmail(email string) (*models.User, error)
 	GetUserList(limit int, offset int) ([]*models.User, error)
 	CheckUserExists(*models.User) (string, error)
+	AddUsedBytes(id string, delta int64) error
+	RecountUsedBytes() error
 }
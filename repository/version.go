@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/phantom-atom/file-explorer/models"
+)
+
+//VersionRepository 文件历史版本仓库接口
+type VersionRepository interface {
+	CreateFileVersion(*models.FileVersion) error
+	DeleteFileVersion(*models.FileVersion) error
+	GetFileVersion(owner string, fid string, id string) (*models.FileVersion, error)
+	GetFileVersions(owner string, fid string) ([]*models.FileVersion, error)
+	GetExpiredFileVersions(before time.Time, limit int) ([]*models.FileVersion, error)
+	GetFileVersionsAfterID(afterID string, limit int) ([]*models.FileVersion, error)
+}
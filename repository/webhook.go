@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/phantom-atom/file-explorer/models"
+)
+
+//WebhookRepository webhook订阅以及投递记录仓库接口，owner为空时表示全局订阅
+type WebhookRepository interface {
+	CreateWebhook(*models.Webhook) error
+	UpdateWebhook(*models.Webhook) error
+	DeleteWebhook(*models.Webhook) error
+	GetWebhook(owner string, id string) (*models.Webhook, error)
+	GetWebhookByID(id string) (*models.Webhook, error)
+	GetWebhooks(owner string) ([]*models.Webhook, error)
+	GetSubscribedWebhooks(owner string, event string) ([]*models.Webhook, error)
+	CreateWebhookDelivery(*models.WebhookDelivery) error
+	UpdateWebhookDelivery(*models.WebhookDelivery) error
+	GetWebhookDeliveries(webhookID string, limit int, offset int) ([]*models.WebhookDelivery, error)
+	GetDueWebhookDeliveries(now time.Time, limit int) ([]*models.WebhookDelivery, error)
+	DeleteWebhookDeliveries(before time.Time) (int64, error)
+}
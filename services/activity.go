@@ -0,0 +1,172 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/phantom-atom/file-explorer/models"
+	"github.com/phantom-atom/file-explorer/repository"
+)
+
+var (
+	//ErrActivityFilterInvalid 操作日志查询条件无效
+	ErrActivityFilterInvalid = errors.New("操作日志查询条件无效")
+)
+
+//Actor 执行操作的用户以及请求的来源
+type Actor struct {
+	UserID    string
+	IP        string
+	UserAgent string
+}
+
+//WithActor 返回以actor身份执行操作的FileService，操作日志中记录actor，其它状态与f共享
+func (f *FileService) WithActor(actor *Actor) *FileService {
+	service := *f
+	service.actor = actor
+	return &service
+}
+
+//WithActor 返回以actor身份执行操作的UserService，操作日志中记录actor，其它状态与us共享
+func (us *UserService) WithActor(actor *Actor) *UserService {
+	service := *us
+	service.actor = actor
+	return &service
+}
+
+//recordActivity 在repos所在的事务中追加操作日志，actor为空时为后台执行的操作
+func recordActivity(repos repository.DataRepository, actor *Actor, activity *models.Activity) error {
+	activityRepository, err := repos.Activity()
+	if err != nil {
+		return err
+	}
+
+	if actor != nil {
+		activity.Actor = actor.UserID
+		activity.IP = actor.IP
+		activity.UserAgent = actor.UserAgent
+	}
+	return activityRepository.CreateActivity(activity)
+}
+
+//recordFileActivity 记录对file的操作，oldValue和newValue为操作修改的值
+func (f *FileService) recordFileActivity(repos repository.DataRepository, action string,
+	file *models.File, oldValue string, newValue string) error {
+	return recordActivity(repos, f.actor, &models.Activity{
+		CreatedAt: f.now(),
+		Owner:     file.Owner,
+		Action:    action,
+		FID:       file.FID,
+		Path:      path.Join(file.Directory, file.Filename),
+		OldValue:  oldValue,
+		NewValue:  newValue,
+	})
+}
+
+//recordUserActivity 记录对user账号的操作
+func (us *UserService) recordUserActivity(repos repository.DataRepository, action string, user *models.User) error {
+	return recordActivity(repos, us.actor, &models.Activity{
+		CreatedAt: us.now(),
+		Owner:     user.ID,
+		Action:    action,
+	})
+}
+
+//ActivityParams 操作日志查询参数，Owner为空时查询所有用户的操作日志，
+//Cursor为上一页返回的NextCursor，Limit不大于0时使用defaultActivityLimit
+type ActivityParams struct {
+	Owner   string
+	Actor   string
+	FID     string
+	Actions []string
+	Since   *time.Time
+	Until   *time.Time
+	Cursor  string
+	Limit   int
+}
+
+//ActivityList 操作日志列表，NextCursor为空时没有下一页
+type ActivityList struct {
+	Activities []*models.Activity `json:"activities"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
+
+const defaultActivityLimit = 100
+
+//GetActivities 按照条件查询操作日志，最新的在前
+func (f *FileService) GetActivities(params *ActivityParams) (*ActivityList, error) {
+	if params == nil {
+		return nil, invalidArgument("FileService", "params", "GetActivities")
+	}
+
+	if params.Since != nil && params.Until != nil && !params.Since.Before(*params.Until) {
+		return nil, NewPathError("activity", "since", ErrActivityFilterInvalid)
+	}
+
+	filter := &repository.ActivityFilter{
+		Owner:   params.Owner,
+		Actor:   params.Actor,
+		FID:     params.FID,
+		Actions: params.Actions,
+		Since:   params.Since,
+		Until:   params.Until,
+		Limit:   params.Limit,
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = defaultActivityLimit
+	}
+
+	if params.Cursor != "" {
+		before, err := decodeActivityCursor(params.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		filter.Before = before
+	}
+
+	//多查询一条记录用于判断是否还有下一页
+	limit := filter.Limit
+	filter.Limit++
+
+	activityRepository, err := f.dataContext.Activity()
+	if err != nil {
+		return nil, err
+	}
+
+	activities, err := activityRepository.GetActivities(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &ActivityList{
+		Activities: activities,
+	}
+
+	if len(activities) > limit {
+		list.Activities = activities[:limit]
+		list.NextCursor = encodeActivityCursor(list.Activities[limit-1].ID)
+	}
+	return list, nil
+}
+
+//encodeActivityCursor 将最后一条记录的ID编码为不透明的游标
+func encodeActivityCursor(id uint) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(uint64(id), 10)))
+}
+
+func decodeActivityCursor(s string) (uint, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return 0, NewPathError("activity", s, ErrInvalidCursor)
+	}
+
+	id, err := strconv.ParseUint(string(data), 10, 64)
+	if err != nil || id == 0 {
+		return 0, NewPathError("activity", s, ErrInvalidCursor)
+	}
+	return uint(id), nil
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/phantom-atom/file-explorer/models"
+)
+
+//activityCount 操作日志中owner的action记录数
+func (env *testEnv) activityCount(owner string, action string) int {
+	return env.count(&models.Activity{}, "owner = ? AND action = ?", owner, action)
+}
+
+func TestActivityRecordedWithMutation(t *testing.T) {
+	env := newTestEnv(t)
+	owner := env.createUser("alice", 0).ID
+	file := env.upload(owner, "", "a.txt", "a")
+
+	files := env.files.WithActor(&Actor{UserID: owner, IP: "192.0.2.1", UserAgent: "test"})
+	if err := files.RenameFile(owner, file.FID, "b.txt"); err != nil {
+		t.Fatalf("RenameFile error: %v", err)
+	}
+
+	list, err := env.files.GetActivities(&ActivityParams{Owner: owner, FID: file.FID})
+	if err != nil {
+		t.Fatalf("GetActivities error: %v", err)
+	}
+	if len(list.Activities) != 2 {
+		t.Fatalf("activities = %d, expected created and renamed", len(list.Activities))
+	}
+
+	activity := list.Activities[0]
+	if activity.Action != models.ActivityFileRenamed || activity.Path != "/b.txt" ||
+		activity.OldValue != "a.txt" || activity.NewValue != "b.txt" {
+		t.Errorf("activity = %s %s %s -> %s", activity.Action, activity.Path, activity.OldValue, activity.NewValue)
+	}
+	if activity.Actor != owner || activity.IP != "192.0.2.1" || activity.UserAgent != "test" {
+		t.Errorf("activity actor = %s %s %s", activity.Actor, activity.IP, activity.UserAgent)
+	}
+}
+
+func TestActivityWriteFailureRollsBackMutation(t *testing.T) {
+	env := newTestEnv(t)
+	owner := env.createUser("alice", 0).ID
+	file := env.upload(owner, "", "a.txt", "a")
+
+	//操作日志与修改在同一个事务中，日志写入失败时修改也不生效
+	if err := env.db.DropTable(&models.Activity{}).Error; err != nil {
+		t.Fatalf("DropTable error: %v", err)
+	}
+
+	if err := env.files.RenameFile(owner, file.FID, "b.txt"); err == nil {
+		t.Fatalf("RenameFile succeeded without activity table")
+	}
+
+	current := &models.File{}
+	if err := env.db.Where("fid = ?", file.FID).First(current).Error; err != nil {
+		t.Fatalf("get file error: %v", err)
+	}
+	if current.Filename != "a.txt" {
+		t.Errorf("filename = %s, expected rename rolled back", current.Filename)
+	}
+}
+
+func TestActivityRollback(t *testing.T) {
+	cases := []struct {
+		atomic  bool
+		renamed int
+		moved   int
+	}{
+		{false, 1, 1},
+		{true, 0, 0},
+	}
+
+	for _, c := range cases {
+		fixture := newBatchFixture(t)
+		env := fixture.env
+
+		_, err := env.files.BatchFiles(fixture.owner, fixture.operations(), c.atomic)
+		if (err != nil) != c.atomic {
+			t.Fatalf("atomic %v: BatchFiles error: %v", c.atomic, err)
+		}
+
+		//回滚的操作不留下操作日志，失败的复制即使已经创建了文件夹也不记录
+		if n := env.activityCount(fixture.owner, models.ActivityFileRenamed); n != c.renamed {
+			t.Errorf("atomic %v: renamed activities = %d, expected %d", c.atomic, n, c.renamed)
+		}
+		if n := env.activityCount(fixture.owner, models.ActivityFileMoved); n != c.moved {
+			t.Errorf("atomic %v: moved activities = %d, expected %d", c.atomic, n, c.moved)
+		}
+		if n := env.activityCount(fixture.owner, models.ActivityFileCopied); n != 0 {
+			t.Errorf("atomic %v: copied activities = %d, expected 0", c.atomic, n)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io"
+	"path"
+
+	"github.com/phantom-atom/file-explorer/internal/log"
+	"github.com/phantom-atom/file-explorer/models"
+	"github.com/phantom-atom/file-explorer/repository"
+	"github.com/phantom-atom/file-explorer/storage"
+)
+
+const (
+	//ArchiveFormatZip zip格式
+	ArchiveFormatZip = "zip"
+	//ArchiveFormatTarGz tar.gz格式
+	ArchiveFormatTarGz = "tar.gz"
+)
+
+var (
+	//ErrArchiveFormatUnsupported 不支持的归档格式
+	ErrArchiveFormatUnsupported = errors.New("不支持的归档格式")
+)
+
+type archiveEntry struct {
+	file *models.File
+	name string
+}
+
+//Archive 文件归档，文件列表在创建时确定，调用Stream时才读取文件内容
+type Archive struct {
+	Name    string
+	Format  string
+	backend storage.Backend
+	entries []*archiveEntry
+}
+
+//ContentType 归档的MIME类型
+func (a *Archive) ContentType() string {
+	if a.Format == ArchiveFormatTarGz {
+		return "application/gzip"
+	}
+	return "application/zip"
+}
+
+//Stream 将归档以流的方式写入w
+func (a *Archive) Stream(w io.Writer) error {
+	switch a.Format {
+	case ArchiveFormatZip:
+		return a.streamZip(w)
+	case ArchiveFormatTarGz:
+		return a.streamTarGz(w)
+	default:
+		return NewPathError("archive", a.Format, ErrArchiveFormatUnsupported)
+	}
+}
+
+func (a *Archive) streamZip(w io.Writer) error {
+	zipWriter := zip.NewWriter(w)
+
+	for _, entry := range a.entries {
+		header := &zip.FileHeader{
+			Name:     entry.name,
+			Method:   zip.Deflate,
+			Modified: entry.file.UpdatedAt,
+		}
+
+		if entry.file.IsDir {
+			header.Name += "/"
+			header.Method = zip.Store
+			if _, err := zipWriter.CreateHeader(header); err != nil {
+				return err
+			}
+			continue
+		}
+
+		entryWriter, err := zipWriter.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+
+		if err := a.copyEntry(entryWriter, entry); err != nil {
+			return err
+		}
+	}
+	return zipWriter.Close()
+}
+
+func (a *Archive) streamTarGz(w io.Writer) error {
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	for _, entry := range a.entries {
+		header := &tar.Header{
+			Name:    entry.name,
+			ModTime: entry.file.UpdatedAt,
+			Mode:    0644,
+		}
+
+		if entry.file.IsDir {
+			header.Name += "/"
+			header.Typeflag = tar.TypeDir
+			header.Mode = 0755
+			if err := tarWriter.WriteHeader(header); err != nil {
+				return err
+			}
+			continue
+		}
+
+		//tar需要提前写入长度，使用存储中的实际长度
+		info, err := a.backend.Stat(entry.file.BlobKey())
+		if err != nil {
+			return err
+		}
+
+		header.Typeflag = tar.TypeReg
+		header.Size = info.Size
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if err := a.copyEntry(tarWriter, entry); err != nil {
+			return err
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	return gzipWriter.Close()
+}
+
+func (a *Archive) copyEntry(w io.Writer, entry *archiveEntry) error {
+	body, err := a.backend.Get(entry.file.BlobKey(), 0, -1)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := body.Close(); err != nil {
+			log.Error("msg", "occur a error when close file", "error", err.Error())
+		}
+	}()
+
+	_, err = io.Copy(w, body)
+	return err
+}
+
+//CreateArchive 创建文件归档，文件属于owner，fids中的文件夹会包含其所有子文件
+func (f *FileService) CreateArchive(owner string, fids []string, format string) (*Archive, error) {
+	if owner == "" {
+		return nil, invalidArgument("FileService", "owner", "CreateArchive")
+	}
+
+	if len(fids) == 0 {
+		return nil, invalidArgument("FileService", "fids", "CreateArchive")
+	}
+
+	if format == "" {
+		format = ArchiveFormatZip
+	}
+
+	if format != ArchiveFormatZip && format != ArchiveFormatTarGz {
+		return nil, NewPathError("archive", format, ErrArchiveFormatUnsupported)
+	}
+
+	fileRepository, err := f.dataContext.File()
+	if err != nil {
+		return nil, err
+	}
+
+	archive := &Archive{
+		Format:  format,
+		backend: f.storage,
+	}
+
+	usedNames := make(map[string]bool, len(fids))
+	for _, fid := range fids {
+		file, err := fileRepository.GetFileByID(owner, fid)
+		if err != nil {
+			return nil, err
+		}
+
+		if file == nil {
+			return nil, NewPathError("archive", fid, ErrFileNotFound)
+		}
+
+		name := uniqueArchiveName(file.Filename, usedNames)
+		if err := f.collectArchiveEntries(archive, file, name, fileRepository); err != nil {
+			return nil, err
+		}
+
+		if archive.Name == "" {
+			archive.Name = file.Filename
+		}
+	}
+
+	if len(fids) > 1 {
+		archive.Name = "archive"
+	}
+	archive.Name += "." + format
+	return archive, nil
+}
+
+func (f *FileService) collectArchiveEntries(archive *Archive, file *models.File, name string,
+	repos repository.FileRepository) error {
+	archive.entries = append(archive.entries, &archiveEntry{
+		file: file,
+		name: name,
+	})
+
+	if !file.IsDir {
+		return nil
+	}
+
+	subfiles, err := repos.GetFilesByPFID(file.Owner, file.FID, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	for _, subfile := range subfiles {
+		subname := path.Join(name, subfile.Filename)
+		if err := f.collectArchiveEntries(archive, subfile, subname, repos); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//uniqueArchiveName 多个选中的文件同名时添加序号
+func uniqueArchiveName(name string, usedNames map[string]bool) string {
+	uniqueName := name
+	for i := 1; usedNames[uniqueName]; i++ {
+		uniqueName = numberedFilename(name, i)
+	}
+	usedNames[uniqueName] = true
+	return uniqueName
+}
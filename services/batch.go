@@ -0,0 +1,142 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/phantom-atom/file-explorer/internal/log"
+	"github.com/phantom-atom/file-explorer/models"
+	"github.com/phantom-atom/file-explorer/repository"
+)
+
+//批量操作类型
+const (
+	BatchOpDelete = "delete"
+	BatchOpMove   = "move"
+	BatchOpRename = "rename"
+	BatchOpCopy   = "copy"
+)
+
+const batchSavepoint = "batch_operation"
+
+var (
+	//ErrBatchOperationInvalid 批量操作的类型或参数无效
+	ErrBatchOperationInvalid = errors.New("无效的批量操作")
+	//ErrBatchAborted 批量操作中有其他操作失败，所有操作已回滚
+	ErrBatchAborted = errors.New("批量操作中有其他操作失败，所有操作已回滚")
+)
+
+//BatchOperation 批量操作中的一项，DirectoryID用于move和copy，NewName用于rename
+type BatchOperation struct {
+	Op          string
+	FID         string
+	DirectoryID string
+	NewName     string
+}
+
+//BatchResult 批量操作中一项的结果，copy成功时File为复制得到的文件
+type BatchResult struct {
+	File *models.File
+	Err  error
+}
+
+//BatchFiles 在owner的锁和同一个事务中依次执行批量操作，结果与operations一一对应，
+//atomic为true时任何一项失败都会回滚所有操作并返回该项的错误，否则只回滚失败的操作，其余操作照常提交
+func (f *FileService) BatchFiles(owner string, operations []*BatchOperation, atomic bool) ([]*BatchResult, error) {
+	if owner == "" {
+		return nil, invalidArgument("FileService", "owner", "BatchFiles")
+	}
+
+	if len(operations) == 0 {
+		return nil, invalidArgument("FileService", "operations", "BatchFiles")
+	}
+
+	f.namedLocker.Lock(owner)
+	defer f.namedLocker.UnLock(owner)
+
+	var commited = false
+	UOW, err := f.dataContext.Unit()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if !commited {
+			if err := UOW.Rollback(); err != nil {
+				log.Warn("msg", "rollback failed in FileService.BatchFiles", "error", err.Error())
+			}
+		}
+	}()
+
+	results := make([]*BatchResult, len(operations))
+	var failed error
+	for i, operation := range operations {
+		if !atomic {
+			if err := UOW.Savepoint(batchSavepoint); err != nil {
+				return nil, err
+			}
+		}
+
+		file, err := f.batchOperation(owner, operation, UOW)
+		results[i] = &BatchResult{
+			File: file,
+			Err:  err,
+		}
+
+		if err == nil {
+			continue
+		}
+
+		if atomic {
+			failed = err
+			break
+		}
+
+		if err := UOW.RollbackToSavepoint(batchSavepoint); err != nil {
+			return nil, err
+		}
+	}
+
+	if failed != nil {
+		for i, result := range results {
+			if result == nil || result.Err == nil {
+				results[i] = &BatchResult{
+					Err: NewPathError("batch", operations[i].FID, ErrBatchAborted),
+				}
+			}
+		}
+		return results, failed
+	}
+
+	if err := UOW.Commit(); err != nil {
+		return nil, err
+	}
+	commited = true
+	return results, nil
+}
+
+func (f *FileService) batchOperation(owner string, operation *BatchOperation,
+	repos repository.DataRepository) (*models.File, error) {
+	if operation.FID == "" {
+		return nil, NewPathError(operation.Op, operation.FID, ErrBatchOperationInvalid)
+	}
+
+	directoryID := operation.DirectoryID
+	if directoryID == "" {
+		directoryID = owner
+	}
+
+	switch operation.Op {
+	case BatchOpDelete:
+		return nil, f.deleteFile(owner, operation.FID, repos)
+	case BatchOpMove:
+		return nil, f.moveFile(owner, operation.FID, directoryID, repos)
+	case BatchOpRename:
+		if operation.NewName == "" {
+			return nil, NewPathError(operation.Op, operation.FID, ErrBatchOperationInvalid)
+		}
+		return nil, f.renameFile(owner, operation.FID, operation.NewName, repos)
+	case BatchOpCopy:
+		return f.copyFile(owner, operation.FID, directoryID, repos)
+	default:
+		return nil, NewPathError(operation.Op, operation.FID, ErrBatchOperationInvalid)
+	}
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/phantom-atom/file-explorer/models"
+)
+
+type batchFixture struct {
+	env      *testEnv
+	owner    string
+	a        *models.File
+	b        *models.File
+	album    *models.File
+	photo    *models.File
+	target   *models.File
+	used     int64
+	photoRef int64
+}
+
+//newBatchFixture 创建批量操作的测试数据，album中broken.jpg的Blob记录被删除，复制album时会在创建文件夹之后失败
+func newBatchFixture(t *testing.T) *batchFixture {
+	env := newTestEnv(t)
+	fixture := &batchFixture{env: env}
+	fixture.owner = env.createUser("alice", 0).ID
+	fixture.a = env.upload(fixture.owner, "", "a.txt", "a")
+	fixture.b = env.upload(fixture.owner, "", "b.txt", "b")
+	fixture.album = env.mkdir(fixture.owner, "", "album")
+	fixture.photo = env.upload(fixture.owner, fixture.album.FID, "photo.jpg", "photo")
+	broken := env.upload(fixture.owner, fixture.album.FID, "broken.jpg", "broken")
+	fixture.target = env.mkdir(fixture.owner, "", "target")
+
+	if err := env.db.Where("hash = ?", broken.Hash).Delete(&models.Blob{}).Error; err != nil {
+		t.Fatalf("delete blob error: %v", err)
+	}
+	fixture.used = env.usedBytes(fixture.owner)
+	fixture.photoRef = env.refCount(fixture.photo.Hash)
+	return fixture
+}
+
+func (fixture *batchFixture) operations() []*BatchOperation {
+	return []*BatchOperation{
+		{Op: BatchOpRename, FID: fixture.a.FID, NewName: "a2.txt"},
+		{Op: BatchOpCopy, FID: fixture.album.FID, DirectoryID: fixture.target.FID},
+		{Op: BatchOpRename, FID: fixture.b.FID, NewName: "a2.txt"},
+		{Op: BatchOpMove, FID: fixture.b.FID, DirectoryID: fixture.target.FID},
+	}
+}
+
+func (fixture *batchFixture) filename(fid string) string {
+	file := &models.File{}
+	if err := fixture.env.db.Where("fid = ?", fid).First(file).Error; err != nil {
+		fixture.env.t.Fatalf("get file error: %v", err)
+	}
+	return file.Directory + "|" + file.Filename
+}
+
+func TestBatchFilesBestEffort(t *testing.T) {
+	fixture := newBatchFixture(t)
+	env := fixture.env
+
+	results, err := env.files.BatchFiles(fixture.owner, fixture.operations(), false)
+	if err != nil {
+		t.Fatalf("BatchFiles error: %v", err)
+	}
+
+	expected := []error{nil, ErrFileIsMissing, ErrFileAlreadyExists, nil}
+	for i, result := range results {
+		if causeOf(result.Err) != expected[i] {
+			t.Errorf("result %d error = %v, expected %v", i, result.Err, expected[i])
+		}
+	}
+
+	if name := fixture.filename(fixture.a.FID); name != "/|a2.txt" {
+		t.Errorf("a.txt = %s, expected renamed", name)
+	}
+	if name := fixture.filename(fixture.b.FID); name != "/target|b.txt" {
+		t.Errorf("b.txt = %s, expected moved", name)
+	}
+
+	//失败的复制回滚到保存点，已经创建的文件夹以及复制的文件都不会留下
+	if n := env.count(&models.File{}, "owner = ? AND directory LIKE ?", fixture.owner, "/target/album%"); n != 0 {
+		t.Errorf("files left by failed copy = %d, expected 0", n)
+	}
+	if n := env.count(&models.File{}, "owner = ? AND directory = ? AND filename = ?", fixture.owner, "/target", "album"); n != 0 {
+		t.Errorf("directory left by failed copy = %d, expected 0", n)
+	}
+	if refs := env.refCount(fixture.photo.Hash); refs != fixture.photoRef {
+		t.Errorf("photo ref_count = %d, expected %d", refs, fixture.photoRef)
+	}
+	if used := env.usedBytes(fixture.owner); used != fixture.used {
+		t.Errorf("used bytes = %d, expected %d", used, fixture.used)
+	}
+}
+
+func TestBatchFilesAtomic(t *testing.T) {
+	fixture := newBatchFixture(t)
+	env := fixture.env
+
+	results, err := env.files.BatchFiles(fixture.owner, fixture.operations(), true)
+	if causeOf(err) != ErrFileIsMissing {
+		t.Fatalf("BatchFiles error = %v, expected %v", err, ErrFileIsMissing)
+	}
+
+	expected := []error{ErrBatchAborted, ErrFileIsMissing, ErrBatchAborted, ErrBatchAborted}
+	for i, result := range results {
+		if causeOf(result.Err) != expected[i] {
+			t.Errorf("result %d error = %v, expected %v", i, result.Err, expected[i])
+		}
+		if result.File != nil {
+			t.Errorf("result %d file = %+v, expected nil", i, result.File)
+		}
+	}
+
+	//所有操作都没有提交
+	if name := fixture.filename(fixture.a.FID); name != "/|a.txt" {
+		t.Errorf("a.txt = %s, expected unchanged", name)
+	}
+	if name := fixture.filename(fixture.b.FID); name != "/|b.txt" {
+		t.Errorf("b.txt = %s, expected unchanged", name)
+	}
+	if n := env.count(&models.File{}, "owner = ? AND directory LIKE ?", fixture.owner, "/target%"); n != 0 {
+		t.Errorf("files in /target = %d, expected 0", n)
+	}
+	if n := env.count(&models.Activity{}, "owner = ? AND action = ?", fixture.owner, models.ActivityFileRenamed); n != 0 {
+		t.Errorf("rename activities = %d, expected 0", n)
+	}
+	if refs := env.refCount(fixture.photo.Hash); refs != fixture.photoRef {
+		t.Errorf("photo ref_count = %d, expected %d", refs, fixture.photoRef)
+	}
+}
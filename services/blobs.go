@@ -0,0 +1,521 @@
+package services
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/phantom-atom/file-explorer/internal/log"
+	"github.com/phantom-atom/file-explorer/models"
+	"github.com/phantom-atom/file-explorer/storage"
+)
+
+const (
+	blobTempDirectory = "tmp"
+	blobLockerScope   = "$file-explorer:blob$"
+	blobMigrateBatch  = 100
+	blobPurgeBatch    = 100
+)
+
+var (
+	//ErrBlobNotFound 文件内容不存在，需要上传
+	ErrBlobNotFound = errors.New("文件内容不存在，需要上传")
+	//ErrDigestMismatch 文件内容与客户端提供的摘要不一致
+	ErrDigestMismatch = errors.New("文件摘要不匹配")
+)
+
+//Digest 客户端提供的文件内容摘要，十六进制表示，为空的摘要不校验
+type Digest struct {
+	SHA256 string
+	MD5    string
+}
+
+//verify 检查计算得到的摘要，不一致时返回ErrDigestMismatch
+func (d *Digest) verify(name string, hash string, md5Hash string) error {
+	if d == nil {
+		return nil
+	}
+
+	if d.SHA256 != "" && !strings.EqualFold(d.SHA256, hash) {
+		return NewPathError("upload", name, ErrDigestMismatch)
+	}
+
+	if d.MD5 != "" && !strings.EqualFold(d.MD5, md5Hash) {
+		return NewPathError("upload", name, ErrDigestMismatch)
+	}
+	return nil
+}
+
+//CreateFileByHash 秒传文件，owner已经有内容为hash且大小为size的文件或者历史版本时直接创建文件，不需要上传内容，
+//newVersion为true时同名文件的原内容保存为历史版本
+func (f *FileService) CreateFileByHash(owner string,
+	directoryID string,
+	name string,
+	hash string,
+	size int64,
+	newVersion bool) (*models.File, error) {
+
+	if owner == "" {
+		return nil, invalidArgument("FileService", "owner", "CreateFileByHash")
+	}
+
+	if name == "" {
+		return nil, invalidArgument("FileService", "name", "CreateFileByHash")
+	}
+
+	hash = strings.ToLower(hash)
+	if len(hash) != sha256.Size*2 {
+		return nil, invalidArgument("FileService", "hash", "CreateFileByHash")
+	}
+
+	if directoryID == "" {
+		directoryID = owner
+	}
+
+	blobRepository, err := f.dataContext.Blob()
+	if err != nil {
+		return nil, err
+	}
+
+	//只有已经引用该内容的用户才能秒传，否则知道hash和大小就能获取其它用户的文件内容，也能借此判断文件是否存在
+	referenced, err := blobRepository.HasBlobReference(owner, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if !referenced {
+		return nil, NewPathError("upload", hash, ErrBlobNotFound)
+	}
+
+	if err := f.checkQuota("upload", owner, name, size); err != nil {
+		return nil, err
+	}
+
+	md5Hash, err := f.acquireBlob(hash, size)
+	if err != nil {
+		return nil, err
+	}
+	return f.createFileFromBlob(owner, directoryID, name, hash, md5Hash, size, newVersion)
+}
+
+//createFileFromBlob 使用已经获取引用的Blob创建文件，失败时释放引用，
+//写入内容前的配额检查没有加锁，这里再次检查以免并发上传超出配额
+func (f *FileService) createFileFromBlob(owner string, directoryID string, name string,
+	hash string, md5Hash string, size int64, newVersion bool) (*models.File, error) {
+	f.namedLocker.Lock(owner)
+	defer f.namedLocker.UnLock(owner)
+
+	var file *models.File
+	err := f.checkQuota("upload", owner, name, size)
+	if err == nil {
+		if newVersion {
+			file, err = f.replaceFileContent(owner, directoryID, name, hash, md5Hash, size)
+		} else {
+			file, err = f.createBlobFileModel(owner, directoryID, name, hash, md5Hash, size)
+		}
+	}
+
+	if err != nil {
+		f.releaseBlob(hash)
+		return nil, err
+	}
+
+	if newVersion {
+		if err := f.pruneFileVersions(file); err != nil {
+			log.Error("msg", "occur a error when prune file versions", "error", err.Error())
+		}
+	}
+
+	f.scheduleThumbnail(file)
+	return file, nil
+}
+
+func (f *FileService) createBlobFileModel(owner string, directoryID string, name string,
+	hash string, md5Hash string, size int64) (*models.File, error) {
+	fid := f.uuid()
+	if fid == "" {
+		return nil, errors.New("FileService: cannot create uuid in createBlobFileModel")
+	}
+
+	blobRepository, err := f.dataContext.Blob()
+	if err != nil {
+		return nil, err
+	}
+
+	file := &models.File{
+		Owner:       owner,
+		PFID:        directoryID,
+		Filename:    name,
+		IsDir:       false,
+		FID:         fid,
+		Size:        size,
+		Hash:        hash,
+		MD5:         md5Hash,
+		ContentType: f.contentTypeOf(name, models.BlobKey(hash), size),
+	}
+
+	if err := setStoredContent(file, blobRepository); err != nil {
+		return nil, err
+	}
+	return f.createFileModel(file)
+}
+
+//saveBlob 保存内容并计算SHA-256和MD5，返回的Blob已经获取引用，size为实际写入的字节数，
+//内容先写入本地临时文件，得到摘要并与expected校验之后再存入存储后端
+func (f *FileService) saveBlob(name string, r io.Reader, expected *Digest) (hash string, md5Hash string, size int64, err error) {
+	tempName := f.uuid()
+	if tempName == "" {
+		return "", "", 0, errors.New("FileService: cannot create uuid in saveBlob")
+	}
+
+	tempPath := filepath.Join(f.config().FileService.FileAbsolutePath(), blobTempDirectory)
+	if err := os.MkdirAll(tempPath, 0755); err != nil {
+		return "", "", 0, err
+	}
+
+	tempPath = filepath.Join(tempPath, tempName)
+	tempFile, err := os.Create(tempPath)
+	if err != nil {
+		return "", "", 0, err
+	}
+	defer func() {
+		if err := os.Remove(tempPath); err != nil {
+			log.Error("msg", "occur a error when delete file", "error", err.Error())
+		}
+	}()
+
+	sha256Hasher := sha256.New()
+	md5Hasher := md5.New()
+	size, err = io.Copy(io.MultiWriter(tempFile, sha256Hasher, md5Hasher), r)
+	if e := tempFile.Close(); e != nil && err == nil {
+		err = e
+	}
+
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	hash = hex.EncodeToString(sha256Hasher.Sum(nil))
+	md5Hash = hex.EncodeToString(md5Hasher.Sum(nil))
+	if err := expected.verify(name, hash, md5Hash); err != nil {
+		return "", "", 0, err
+	}
+
+	if err := f.storeBlob(name, tempPath, hash, md5Hash, size); err != nil {
+		return "", "", 0, err
+	}
+	return hash, md5Hash, size, nil
+}
+
+//storeBlob 获取Blob的引用，Blob不存在时将sourcePath的内容存入存储后端，sourcePath由调用者删除，
+//name用于选择压缩方式
+func (f *FileService) storeBlob(name string, sourcePath string, hash string, md5Hash string, size int64) error {
+	f.namedLocker.Lock(blobLockerScope + hash)
+	defer f.namedLocker.UnLock(blobLockerScope + hash)
+
+	blobRepository, err := f.dataContext.Blob()
+	if err != nil {
+		return err
+	}
+
+	exists, err := blobRepository.AcquireBlob(hash)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return nil
+	}
+
+	sourceFile, err := os.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := sourceFile.Close(); err != nil {
+			log.Error("msg", "occur a error when close file", "error", err.Error())
+		}
+	}()
+
+	encoding, err := f.compressionEncoding(name, sourceFile, size)
+	if err != nil {
+		return err
+	}
+
+	key := models.BlobKey(hash)
+	storedSize := size
+	if encoding != "" {
+		storedSize, err = f.storage.(storage.EncodedBackend).PutEncoded(key, sourceFile, size, encoding)
+	} else {
+		err = f.storage.Put(key, sourceFile, size)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = blobRepository.CreateBlob(&models.Blob{
+		Hash:       hash,
+		MD5:        md5Hash,
+		Size:       size,
+		StoredSize: storedSize,
+		Encoding:   encoding,
+		RefCount:   1,
+	})
+	if err != nil {
+		if e := f.storage.Delete(key); e != nil {
+			log.Error("msg", "occur a error when delete blob", "error", e.Error())
+		}
+		return err
+	}
+	return nil
+}
+
+//acquireBlob 获取已经存在的Blob的引用，返回Blob的MD5，Blob不存在或者大小不一致时返回ErrBlobNotFound
+func (f *FileService) acquireBlob(hash string, size int64) (string, error) {
+	f.namedLocker.Lock(blobLockerScope + hash)
+	defer f.namedLocker.UnLock(blobLockerScope + hash)
+
+	blobRepository, err := f.dataContext.Blob()
+	if err != nil {
+		return "", err
+	}
+
+	blob, err := blobRepository.GetBlob(hash)
+	if err != nil {
+		return "", err
+	}
+
+	if blob == nil || blob.Size != size {
+		return "", NewPathError("upload", hash, ErrBlobNotFound)
+	}
+
+	if _, err := f.storage.Stat(models.BlobKey(hash)); err != nil {
+		if err == storage.ErrNotFound {
+			return "", NewPathError("upload", hash, ErrBlobNotFound)
+		}
+		return "", err
+	}
+
+	exists, err := blobRepository.AcquireBlob(hash)
+	if err != nil {
+		return "", err
+	}
+
+	if !exists {
+		return "", NewPathError("upload", hash, ErrBlobNotFound)
+	}
+	return blob.MD5, nil
+}
+
+//releaseBlob 释放Blob的引用，用于撤销失败的操作
+func (f *FileService) releaseBlob(hash string) {
+	f.namedLocker.Lock(blobLockerScope + hash)
+	defer f.namedLocker.UnLock(blobLockerScope + hash)
+
+	blobRepository, err := f.dataContext.Blob()
+	if err == nil {
+		err = blobRepository.ReleaseBlob(hash)
+	}
+
+	if err != nil {
+		log.Error("msg", "occur a error when release blob", "hash", hash, "error", err.Error())
+		return
+	}
+	f.notifyBlobReleased()
+}
+
+//notifyBlobReleased 在释放Blob引用的事务提交之后调用，唤醒清理协程
+func (f *FileService) notifyBlobReleased() {
+	select {
+	case f.blobReleased <- struct{}{}:
+	default:
+	}
+}
+
+//purgeBlobs 清理引用计数为0的Blob，释放引用时以及定期执行
+func (f *FileService) purgeBlobs() {
+	for {
+		select {
+		case <-f.ctx.Done():
+			return
+		case <-f.blobReleased:
+		case <-time.After(f.config().FileService.Blob.PurgeInterval):
+		}
+
+		if err := f.purgeReleasedBlobs(); err != nil {
+			log.Error("msg", "occur a error when purge released blobs", "error", err.Error())
+		}
+	}
+}
+
+func (f *FileService) purgeReleasedBlobs() error {
+	blobRepository, err := f.dataContext.Blob()
+	if err != nil {
+		return err
+	}
+
+	var lastHash string
+	for {
+		blobs, err := blobRepository.GetReleasedBlobs(lastHash, blobPurgeBatch)
+		if err != nil {
+			return err
+		}
+
+		for _, blob := range blobs {
+			lastHash = blob.Hash
+			if err := f.purgeBlob(blob.Hash); err != nil {
+				return err
+			}
+		}
+
+		if len(blobs) < blobPurgeBatch {
+			return nil
+		}
+	}
+}
+
+//purgeBlob 在Blob的锁中再次确认没有被引用之后删除Blob记录、存储中的内容以及缩略图，
+//引用计数为0但是仍然被文件引用的Blob留给fsck处理
+func (f *FileService) purgeBlob(hash string) error {
+	f.namedLocker.Lock(blobLockerScope + hash)
+	defer f.namedLocker.UnLock(blobLockerScope + hash)
+
+	blobRepository, err := f.dataContext.Blob()
+	if err != nil {
+		return err
+	}
+
+	references, err := blobRepository.CountBlobReferences(hash)
+	if err != nil {
+		return err
+	}
+
+	if references > 0 {
+		log.Warn("msg", "released blob is still referenced", "hash", hash, "references", references)
+		return nil
+	}
+
+	deleted, err := blobRepository.DeleteReleasedBlob(hash)
+	if err != nil || !deleted {
+		return err
+	}
+
+	if err := f.storage.Delete(models.BlobKey(hash)); err != nil {
+		log.Error("msg", "occur a error when delete blob", "error", err.Error())
+	}
+
+	for _, size := range models.ThumbnailSizes {
+		if err := f.storage.Delete(models.ThumbnailKey(hash, size.Name)); err != nil {
+			log.Error("msg", "occur a error when delete thumbnail", "error", err.Error())
+		}
+	}
+	return nil
+}
+
+//hashFile 计算磁盘文件的SHA-256和MD5
+func hashFile(absolutePath string) (hash string, md5Hash string, size int64, err error) {
+	file, err := os.Open(absolutePath)
+	if err != nil {
+		return "", "", 0, err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Error("msg", "occur a error when close file", "error", err.Error())
+		}
+	}()
+
+	sha256Hasher := sha256.New()
+	md5Hasher := md5.New()
+	size, err = io.Copy(io.MultiWriter(sha256Hasher, md5Hasher), file)
+	if err != nil {
+		return "", "", 0, err
+	}
+	return hex.EncodeToString(sha256Hasher.Sum(nil)), hex.EncodeToString(md5Hasher.Sum(nil)), size, nil
+}
+
+//MigrateLegacyBlobs 将以FID或者版本ID命名的旧文件内容迁移到内容寻址存储中
+func (f *FileService) MigrateLegacyBlobs() error {
+	blobRepository, err := f.dataContext.Blob()
+	if err != nil {
+		return err
+	}
+
+	var lastFileID uint
+	for {
+		files, err := blobRepository.GetUnhashedFiles(lastFileID, blobMigrateBatch)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			lastFileID = file.ID
+			err := f.migrateLegacyBlob(file.FID, func(hash string) error {
+				return blobRepository.SetFileHash(file, hash)
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(files) < blobMigrateBatch {
+			break
+		}
+	}
+
+	var lastVersionID string
+	for {
+		versions, err := blobRepository.GetUnhashedFileVersions(lastVersionID, blobMigrateBatch)
+		if err != nil {
+			return err
+		}
+
+		for _, version := range versions {
+			lastVersionID = version.ID
+			err := f.migrateLegacyBlob(version.ID, func(hash string) error {
+				return blobRepository.SetFileVersionHash(version, hash)
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(versions) < blobMigrateBatch {
+			return nil
+		}
+	}
+}
+
+func (f *FileService) migrateLegacyBlob(legacyKey string, setHash func(hash string) error) error {
+	body, err := f.storage.Get(legacyKey, 0, -1)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			log.Warn("msg", "legacy file is missing", "key", legacyKey)
+			return nil
+		}
+		return err
+	}
+
+	hash, _, _, err := f.saveBlob(legacyKey, body, nil)
+	if e := body.Close(); e != nil {
+		log.Error("msg", "occur a error when close file", "error", e.Error())
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := setHash(hash); err != nil {
+		f.releaseBlob(hash)
+		return err
+	}
+
+	if err := f.storage.Delete(legacyKey); err != nil {
+		log.Error("msg", "occur a error when delete legacy file", "error", err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/phantom-atom/file-explorer/models"
+)
+
+func TestCreateFileByHash(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser("alice", 0).ID
+	bob := env.createUser("bob", 0).ID
+
+	secret := env.upload(alice, "", "secret.txt", "alice's secret")
+
+	//其它用户知道hash和大小也不能秒传，结果与内容不存在相同
+	_, err := env.files.CreateFileByHash(bob, "", "stolen.txt", secret.Hash, secret.Size, false)
+	if causeOf(err) != ErrBlobNotFound {
+		t.Fatalf("CreateFileByHash by another user error = %v, expected %v", err, ErrBlobNotFound)
+	}
+
+	if n := env.count(&models.File{}, "owner = ?", bob); n != 0 {
+		t.Errorf("files of bob = %d, expected 0", n)
+	}
+
+	_, err = env.files.CreateFileByHash(bob, "", "missing.txt", "0000000000000000000000000000000000000000000000000000000000000000", 1, false)
+	if causeOf(err) != ErrBlobNotFound {
+		t.Errorf("CreateFileByHash with unknown hash error = %v, expected %v", err, ErrBlobNotFound)
+	}
+
+	copied, err := env.files.CreateFileByHash(alice, "", "copy.txt", secret.Hash, secret.Size, false)
+	if err != nil {
+		t.Fatalf("CreateFileByHash by owner error: %v", err)
+	}
+	if copied.Hash != secret.Hash {
+		t.Errorf("copied hash = %q, expected %q", copied.Hash, secret.Hash)
+	}
+
+	blob := &models.Blob{}
+	if err := env.db.Where("hash = ?", secret.Hash).First(blob).Error; err != nil {
+		t.Fatalf("get blob error: %v", err)
+	}
+	if blob.RefCount != 2 {
+		t.Errorf("blob ref_count = %d, expected 2", blob.RefCount)
+	}
+}
+
+func TestCreateFileDigest(t *testing.T) {
+	const content = "digest content"
+	sum := md5.Sum([]byte(content))
+	md5Hash := hex.EncodeToString(sum[:])
+	wrongHash := hashOf("other content")
+
+	cases := []struct {
+		name     string
+		digest   *Digest
+		mismatch bool
+	}{
+		{"no digest", nil, false},
+		{"sha256", &Digest{SHA256: hashOf(content)}, false},
+		{"sha256 upper case", &Digest{SHA256: strings.ToUpper(hashOf(content))}, false},
+		{"md5", &Digest{MD5: md5Hash}, false},
+		{"both", &Digest{SHA256: hashOf(content), MD5: md5Hash}, false},
+		{"wrong sha256", &Digest{SHA256: wrongHash}, true},
+		{"wrong md5", &Digest{MD5: strings.Repeat("0", 32)}, true},
+		{"wrong md5 with sha256", &Digest{SHA256: hashOf(content), MD5: strings.Repeat("0", 32)}, true},
+	}
+
+	for _, c := range cases {
+		env := newTestEnv(t)
+		owner := env.createUser("alice", 0).ID
+
+		file, err := env.files.CreateFile(owner, "", "a.txt", int64(len(content)), strings.NewReader(content), c.digest)
+		if !c.mismatch {
+			if err != nil || file.Hash != hashOf(content) {
+				t.Errorf("%s: CreateFile = %v, %v", c.name, file, err)
+			}
+			continue
+		}
+
+		if causeOf(err) != ErrDigestMismatch {
+			t.Errorf("%s: CreateFile error = %v, expected %v", c.name, err, ErrDigestMismatch)
+			continue
+		}
+
+		//摘要不一致时不能留下文件记录、内容以及空间占用
+		if n := env.count(&models.File{}, "owner = ? AND isdir = ?", owner, false); n != 0 {
+			t.Errorf("%s: files = %d, expected 0", c.name, n)
+		}
+		if n := env.count(&models.Blob{}, "hash = ?", hashOf(content)); n != 0 {
+			t.Errorf("%s: blobs = %d, expected 0", c.name, n)
+		}
+		if env.objectExists(blobKeyOf(content)) {
+			t.Errorf("%s: content is stored", c.name)
+		}
+		if used := env.usedBytes(owner); used != 0 {
+			t.Errorf("%s: used_bytes = %d, expected 0", c.name, used)
+		}
+	}
+}
+
+func TestCreateFileVersionDigestMismatch(t *testing.T) {
+	env := newTestEnv(t)
+	owner := env.createUser("alice", 0).ID
+	file := env.upload(owner, "", "a.txt", "version 1")
+
+	_, err := env.files.CreateFileVersion(owner, "", "a.txt", 9, strings.NewReader("version 2"),
+		&Digest{SHA256: hashOf("version 3")})
+	if causeOf(err) != ErrDigestMismatch {
+		t.Fatalf("CreateFileVersion error = %v, expected %v", err, ErrDigestMismatch)
+	}
+
+	//当前内容保持不变，也不产生历史版本
+	current := &models.File{}
+	if err := env.db.Where("fid = ?", file.FID).First(current).Error; err != nil {
+		t.Fatalf("get file error: %v", err)
+	}
+	if current.Hash != hashOf("version 1") {
+		t.Errorf("file hash = %s, expected content of version 1", current.Hash)
+	}
+	if n := env.count(&models.FileVersion{}, "fid = ?", file.FID); n != 0 {
+		t.Errorf("versions = %d, expected 0", n)
+	}
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"io"
+	"path"
+	"strings"
+
+	"github.com/phantom-atom/file-explorer/internal/utils/httputil"
+	"github.com/phantom-atom/file-explorer/models"
+	"github.com/phantom-atom/file-explorer/repository"
+	"github.com/phantom-atom/file-explorer/storage"
+)
+
+//EncodedFile 压缩存储的文件内容，读取时自动解压，OpenEncoded打开压缩后的内容，
+//客户端支持Encoding时可以直接返回压缩后的内容
+type EncodedFile interface {
+	File
+	Encoding() string
+	OpenEncoded() (io.ReadCloser, int64, error)
+}
+
+type encodedFile struct {
+	*storage.Reader
+	backend  storage.EncodedBackend
+	key      string
+	encoding string
+}
+
+func (e *encodedFile) Encoding() string {
+	return e.encoding
+}
+
+func (e *encodedFile) OpenEncoded() (io.ReadCloser, int64, error) {
+	return e.backend.GetEncoded(e.key, e.encoding)
+}
+
+//compressionEncoding 根据压缩规则选择内容的压缩方式，source读取后会回到开头，
+//没有启用压缩、内容太小、没有匹配的规则或者存储不支持压缩时返回空
+func (f *FileService) compressionEncoding(name string, source io.ReadSeeker, size int64) (string, error) {
+	conf := &f.config().Storage.Compression
+	if !conf.Enable || size < conf.MinSize {
+		return "", nil
+	}
+
+	if _, ok := f.storage.(storage.EncodedBackend); !ok {
+		return "", nil
+	}
+
+	ext := strings.ToLower(path.Ext(name))
+	for _, rule := range conf.Rules {
+		for _, e := range rule.Extensions {
+			if ext != "" && strings.ToLower(e) == ext {
+				return rule.Encoding, nil
+			}
+		}
+	}
+
+	head := make([]byte, httputil.SniffLength)
+	n, err := io.ReadFull(source, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+
+	if _, err := source.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	contentType := httputil.DetectContentType(name, head[:n])
+	for _, rule := range conf.Rules {
+		for _, t := range rule.Types {
+			if matchContentType(t, contentType) {
+				return rule.Encoding, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+//matchContentType 判断contentType是否匹配pattern，pattern可以使用"text/*"匹配同一大类，忽略参数
+func matchContentType(pattern string, contentType string) bool {
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+
+	if strings.HasSuffix(pattern, "/*") {
+		return strings.HasPrefix(contentType, pattern[:len(pattern)-1])
+	}
+	return contentType == pattern
+}
+
+//setStoredContent 根据Blob设置文件内容在存储中的大小以及压缩方式
+func setStoredContent(file *models.File, blobRepository repository.BlobRepository) error {
+	blob, err := blobRepository.GetBlob(file.Hash)
+	if err != nil {
+		return err
+	}
+
+	if blob == nil || blob.StoredSize == 0 {
+		file.StoredSize = file.Size
+		file.Encoding = ""
+		return nil
+	}
+
+	file.StoredSize = blob.StoredSize
+	file.Encoding = blob.Encoding
+	return nil
+}
+
+//BackfillStoredSizes 为启用压缩之前保存的Blob以及文件补充存储大小，返回更新的记录数量
+func (f *FileService) BackfillStoredSizes() (int64, error) {
+	blobRepository, err := f.dataContext.Blob()
+	if err != nil {
+		return 0, err
+	}
+	return blobRepository.BackfillStoredSizes()
+}
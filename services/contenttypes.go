@@ -0,0 +1,78 @@
+package services
+
+import (
+	"io/ioutil"
+	"path"
+
+	"github.com/phantom-atom/file-explorer/internal/log"
+	"github.com/phantom-atom/file-explorer/internal/utils/httputil"
+	"github.com/phantom-atom/file-explorer/storage"
+)
+
+const contentTypeBackfillBatch = 100
+
+//contentTypeOf 根据文件名以及存储中key的前几个字节判断MIME类型，读取失败时只根据文件名判断
+func (f *FileService) contentTypeOf(name string, key string, size int64) string {
+	if size <= 0 {
+		return httputil.DetectContentType(name, nil)
+	}
+
+	length := int64(httputil.SniffLength)
+	if size < length {
+		length = size
+	}
+
+	body, err := f.storage.Get(key, 0, length)
+	if err != nil {
+		if err != storage.ErrNotFound {
+			log.Warn("msg", "occur a error when detect content type", "key", key, "error", err.Error())
+		}
+		return httputil.DetectContentType(name, nil)
+	}
+	defer func() {
+		if err := body.Close(); err != nil {
+			log.Error("msg", "occur a error when close file", "error", err.Error())
+		}
+	}()
+
+	head, err := ioutil.ReadAll(body)
+	if err != nil {
+		log.Warn("msg", "occur a error when detect content type", "key", key, "error", err.Error())
+	}
+	return httputil.DetectContentType(name, head)
+}
+
+//sameExtension 扩展名是否相同，扩展名改变时需要重新判断MIME类型
+func sameExtension(oldName string, newName string) bool {
+	return path.Ext(oldName) == path.Ext(newName)
+}
+
+//BackfillContentTypes 为还没有ContentType的文件判断并保存MIME类型，返回处理的文件数量
+func (f *FileService) BackfillContentTypes() (int, error) {
+	fileRepository, err := f.dataContext.File()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	var lastID uint
+	for {
+		files, err := fileRepository.GetFilesWithoutContentType(lastID, contentTypeBackfillBatch)
+		if err != nil {
+			return count, err
+		}
+
+		for _, file := range files {
+			lastID = file.ID
+			file.ContentType = f.contentTypeOf(file.Filename, file.BlobKey(), file.Size)
+			if err := fileRepository.SetFileContentType(file); err != nil {
+				return count, err
+			}
+			count++
+		}
+
+		if len(files) < contentTypeBackfillBatch {
+			return count, nil
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package services
+
+import (
+	"errors"
+	"path"
+	"strings"
+
+	"github.com/phantom-atom/file-explorer/internal/log"
+	"github.com/phantom-atom/file-explorer/models"
+	"github.com/phantom-atom/file-explorer/repository"
+)
+
+const copyProgressInterval = 100
+
+var (
+	//ErrCopyIntoItself 文件夹不能复制到自身或者子文件夹中
+	ErrCopyIntoItself = errors.New("不能复制到自身或子文件夹中")
+)
+
+//CopyResult 复制结果，同步复制时File为复制得到的文件，后台复制时Job为可以查询进度的任务
+type CopyResult struct {
+	File *models.File `json:"file,omitempty"`
+	Job  *models.Job  `json:"job,omitempty"`
+}
+
+//CopyFile 复制文件到newPFID文件夹中，文件夹会递归复制所有子文件，复制得到的文件与原文件共享内容以及标签和元数据，
+//文件数量超过配置的阈值时在后台复制，后台复制期间一直持有owner的锁
+func (f *FileService) CopyFile(owner string, fid string, newPFID string) (*CopyResult, error) {
+	if owner == "" {
+		return nil, invalidArgument("FileService", "owner", "CopyFile")
+	}
+
+	if fid == "" {
+		return nil, invalidArgument("FileService", "fid", "CopyFile")
+	}
+
+	if newPFID == "" {
+		newPFID = owner
+	}
+
+	f.namedLocker.Lock(owner)
+	locked := true
+	defer func() {
+		if locked {
+			f.namedLocker.UnLock(owner)
+		}
+	}()
+
+	fileRepository, err := f.dataContext.File()
+	if err != nil {
+		return nil, err
+	}
+
+	source, directory, err := f.prepareCopy(owner, fid, newPFID, fileRepository)
+	if err != nil {
+		return nil, err
+	}
+
+	count, size, err := f.countFiles(source, fileRepository)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.checkQuota("copy", owner, source.Filename, size); err != nil {
+		return nil, err
+	}
+
+	if count <= int64(f.config().FileService.Copy.AsyncThreshold) {
+		file, err := f.copyFileTree(source, newPFID, directory, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &CopyResult{File: file}, nil
+	}
+
+	jobRepository, err := f.dataContext.Job()
+	if err != nil {
+		return nil, err
+	}
+
+	id := f.uuid()
+	if id == "" {
+		return nil, errors.New("FileService: cannot create uuid in CopyFile")
+	}
+
+	job := &models.Job{
+		ID:     id,
+		Owner:  owner,
+		Type:   models.JobTypeCopy,
+		Status: models.JobStatusRunning,
+		Total:  count,
+	}
+	if err := jobRepository.CreateJob(job); err != nil {
+		return nil, err
+	}
+
+	result := *job
+	locked = false
+	go func() {
+		defer f.namedLocker.UnLock(owner)
+		f.runCopyJob(job, source, newPFID, directory)
+	}()
+	return &CopyResult{Job: &result}, nil
+}
+
+//prepareCopy 检查源文件、目标文件夹以及同名文件，返回源文件以及复制后所在的路径
+func (f *FileService) prepareCopy(owner string, fid string, newPFID string,
+	repos repository.FileRepository) (*models.File, string, error) {
+	source, err := repos.GetFileByID(owner, fid)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if source == nil {
+		return nil, "", NewPathError("copy", fid, ErrFileNotFound)
+	}
+
+	matchedFile, err := repos.GetFileByPFIDAndName(owner, newPFID, source.Filename)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if matchedFile != nil {
+		return nil, "", NewPathError("copy", source.Filename, ErrFileAlreadyExists)
+	}
+
+	directory := "/"
+	if newPFID != owner {
+		parentFile, err := repos.GetFileByID(owner, newPFID)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if parentFile == nil || !parentFile.IsDir {
+			return nil, "", NewPathError("copy", newPFID, ErrParentNotADirectory)
+		}
+		directory = path.Join(parentFile.Directory, parentFile.Filename)
+	}
+
+	if source.IsDir {
+		sourcePath := path.Join(source.Directory, source.Filename)
+		if directory == sourcePath || strings.HasPrefix(directory, sourcePath+"/") {
+			return nil, "", NewPathError("copy", sourcePath, ErrCopyIntoItself)
+		}
+	}
+	return source, directory, nil
+}
+
+//countFiles 统计文件及其子文件的数量和文件的总大小
+func (f *FileService) countFiles(file *models.File, repos repository.FileRepository) (count int64, size int64, err error) {
+	if !file.IsDir {
+		return 1, file.Size, nil
+	}
+
+	subfiles, err := repos.GetFilesByPFID(file.Owner, file.FID, 0, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	count = 1
+	for _, subfile := range subfiles {
+		subCount, subSize, err := f.countFiles(subfile, repos)
+		if err != nil {
+			return 0, 0, err
+		}
+		count += subCount
+		size += subSize
+	}
+	return count, size, nil
+}
+
+//copyFileTree 在一个事务中复制文件及其子文件，job不为空时记录进度
+func (f *FileService) copyFileTree(source *models.File, pfid string, directory string,
+	job *models.Job) (*models.File, error) {
+	var commited = false
+	UOW, err := f.dataContext.Unit()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if !commited {
+			if err := UOW.Rollback(); err != nil {
+				log.Warn("msg", "rollback failed in FileService.copyFileTree", "error", err.Error())
+			}
+		}
+	}()
+
+	file, err := f.copyFileModel(source, pfid, directory, UOW, job)
+	if err != nil {
+		return nil, err
+	}
+
+	err = f.recordFileActivity(UOW, models.ActivityFileCopied, file, path.Join(source.Directory, source.Filename), "")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.publishFileEvent(UOW, models.EventFileCreated, file, ""); err != nil {
+		return nil, err
+	}
+
+	if err := UOW.Commit(); err != nil {
+		return nil, err
+	}
+	commited = true
+	return file, nil
+}
+
+func (f *FileService) copyFileModel(source *models.File, pfid string, directory string,
+	repos repository.DataRepository, job *models.Job) (*models.File, error) {
+	fid := f.uuid()
+	if fid == "" {
+		return nil, errors.New("FileService: cannot create uuid in copyFileModel")
+	}
+
+	fileRepository, err := repos.File()
+	if err != nil {
+		return nil, err
+	}
+
+	if !source.IsDir {
+		blobRepository, err := repos.Blob()
+		if err != nil {
+			return nil, err
+		}
+
+		exists := false
+		if source.Hash != "" {
+			exists, err = blobRepository.AcquireBlob(source.Hash)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if !exists {
+			return nil, NewPathError("copy", path.Join(source.Directory, source.Filename), ErrFileIsMissing)
+		}
+	}
+
+	file := &models.File{
+		FID:          fid,
+		Owner:        source.Owner,
+		IsDir:        source.IsDir,
+		Directory:    directory,
+		Filename:     source.Filename,
+		Size:         source.Size,
+		StoredSize:   source.StoredSize,
+		Encoding:     source.Encoding,
+		Hash:         source.Hash,
+		MD5:          source.MD5,
+		PFID:         pfid,
+		ContentType:  source.ContentType,
+		HasThumbnail: source.HasThumbnail,
+	}
+	if err := fileRepository.CreateFile(file); err != nil {
+		return nil, err
+	}
+
+	tagRepository, err := repos.Tag()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tagRepository.CopyFileAnnotations(source.Owner, source.FID, fid); err != nil {
+		return nil, err
+	}
+	f.reportJobProgress(job)
+
+	if source.IsDir {
+		subfiles, err := fileRepository.GetFilesByPFID(source.Owner, source.FID, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		subdirectory := path.Join(directory, file.Filename)
+		for _, subfile := range subfiles {
+			if _, err := f.copyFileModel(subfile, fid, subdirectory, repos, job); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return file, nil
+}
+
+func (f *FileService) runCopyJob(job *models.Job, source *models.File, pfid string, directory string) {
+	file, err := f.copyFileTree(source, pfid, directory, job)
+	if err != nil {
+		job.Status = models.JobStatusFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = models.JobStatusSucceeded
+		job.FID = file.FID
+	}
+	f.saveJob(job)
+}
+
+//copyFile 在repos所在的事务中同步复制文件，用于批量操作
+func (f *FileService) copyFile(owner string, fid string, newPFID string,
+	repos repository.DataRepository) (*models.File, error) {
+	fileRepository, err := repos.File()
+	if err != nil {
+		return nil, err
+	}
+
+	source, directory, err := f.prepareCopy(owner, fid, newPFID, fileRepository)
+	if err != nil {
+		return nil, err
+	}
+
+	_, size, err := f.countFiles(source, fileRepository)
+	if err != nil {
+		return nil, err
+	}
+
+	userRepository, err := repos.User()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.checkQuotaIn("copy", owner, source.Filename, size, userRepository); err != nil {
+		return nil, err
+	}
+
+	file, err := f.copyFileModel(source, newPFID, directory, repos, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = f.recordFileActivity(repos, models.ActivityFileCopied, file, path.Join(source.Directory, source.Filename), "")
+	if err != nil {
+		return nil, err
+	}
+	return file, f.publishFileEvent(repos, models.EventFileCreated, file, "")
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/phantom-atom/file-explorer/models"
+)
+
+func TestCopyFileIntoItself(t *testing.T) {
+	env := newTestEnv(t)
+	owner := env.createUser("alice", 0).ID
+	docs := env.mkdir(owner, "", "docs")
+	sub := env.mkdir(owner, docs.FID, "sub")
+	//名称以docs开头的文件夹不是docs的子文件夹
+	other := env.mkdir(owner, "", "docs2")
+
+	for _, target := range []*models.File{docs, sub} {
+		_, err := env.files.CopyFile(owner, docs.FID, target.FID)
+		if causeOf(err) != ErrCopyIntoItself {
+			t.Errorf("copy docs into %s error = %v, expected %v", target.Filename, err, ErrCopyIntoItself)
+		}
+	}
+
+	if _, err := env.files.CopyFile(owner, docs.FID, other.FID); err != nil {
+		t.Errorf("copy docs into docs2 error: %v", err)
+	}
+}
+
+func TestCopyFileNameConflict(t *testing.T) {
+	env := newTestEnv(t)
+	owner := env.createUser("alice", 0).ID
+	file := env.upload(owner, "", "a.txt", "root")
+	backup := env.mkdir(owner, "", "backup")
+	env.upload(owner, backup.FID, "a.txt", "backup")
+
+	for _, target := range []string{"", backup.FID} {
+		_, err := env.files.CopyFile(owner, file.FID, target)
+		if causeOf(err) != ErrFileAlreadyExists {
+			t.Errorf("copy into %q error = %v, expected %v", target, err, ErrFileAlreadyExists)
+		}
+	}
+
+	if n := env.count(&models.File{}, "owner = ? AND filename = ?", owner, "a.txt"); n != 2 {
+		t.Errorf("files named a.txt = %d, expected 2", n)
+	}
+	if refs := env.refCount(file.Hash); refs != 1 {
+		t.Errorf("ref_count after failed copy = %d, expected 1", refs)
+	}
+}
+
+func TestCopyFileReferences(t *testing.T) {
+	env := newTestEnv(t)
+	owner := env.createUser("alice", 0).ID
+	docs := env.mkdir(owner, "", "docs")
+	sub := env.mkdir(owner, docs.FID, "sub")
+	a := env.upload(owner, docs.FID, "a.txt", "same content")
+	b := env.upload(owner, sub.FID, "b.txt", "same content")
+	c := env.upload(owner, sub.FID, "c.txt", "other content")
+	backup := env.mkdir(owner, "", "backup")
+
+	if a.Hash != b.Hash || env.refCount(a.Hash) != 2 || env.refCount(c.Hash) != 1 {
+		t.Fatalf("unexpected ref_count before copy")
+	}
+	used := env.usedBytes(owner)
+
+	result, err := env.files.CopyFile(owner, docs.FID, backup.FID)
+	if err != nil {
+		t.Fatalf("CopyFile error: %v", err)
+	}
+	if result.File == nil || result.File.Directory != "/backup" || result.File.Filename != "docs" {
+		t.Fatalf("copied file = %+v", result.File)
+	}
+
+	//复制的每个文件都引用原来的内容，不复制存储中的对象
+	if refs := env.refCount(a.Hash); refs != 4 {
+		t.Errorf("ref_count of shared content = %d, expected 4", refs)
+	}
+	if refs := env.refCount(c.Hash); refs != 2 {
+		t.Errorf("ref_count of other content = %d, expected 2", refs)
+	}
+
+	if n := env.count(&models.File{}, "owner = ? AND directory = ?", owner, "/backup/docs/sub"); n != 2 {
+		t.Errorf("files in /backup/docs/sub = %d, expected 2", n)
+	}
+	if n := env.count(&models.Activity{}, "owner = ? AND action = ?", owner, models.ActivityFileCopied); n != 1 {
+		t.Errorf("copy activities = %d, expected 1", n)
+	}
+	if expected := used + a.Size + b.Size + c.Size; env.usedBytes(owner) != expected {
+		t.Errorf("used bytes = %d, expected %d", env.usedBytes(owner), expected)
+	}
+}
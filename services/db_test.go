@@ -0,0 +1,189 @@
+package services
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/phantom-atom/file-explorer/config"
+	"github.com/phantom-atom/file-explorer/internal/locker"
+	"github.com/phantom-atom/file-explorer/models"
+	"github.com/phantom-atom/file-explorer/repository/simple"
+	"github.com/phantom-atom/file-explorer/storage"
+	"github.com/phantom-atom/file-explorer/storage/local"
+)
+
+//testPostgresEnv 设置为PostgreSQL连接字符串时使用PostgreSQL测试，数据库中的表会被清空，
+//没有设置时使用临时目录中的SQLite
+const testPostgresEnv = "FILE_EXPLORER_TEST_POSTGRES"
+
+var testModels = []interface{}{
+	&models.File{}, &models.User{}, &models.Share{}, &models.Upload{}, &models.TrashItem{},
+	&models.FileVersion{}, &models.Blob{}, &models.Job{}, &models.FileTag{}, &models.FileMetadata{},
+	&models.DataKey{}, &models.CompressedObject{}, &models.Webhook{}, &models.WebhookDelivery{},
+	&models.Activity{},
+}
+
+//testEnv 使用真实的数据库和本地存储的服务
+type testEnv struct {
+	t       *testing.T
+	db      *gorm.DB
+	conf    *config.Config
+	now     time.Time
+	ids     int
+	storage storage.Backend
+	files   *FileService
+	users   *UserService
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	dir, err := ioutil.TempDir("", "file-explorer-test")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Getwd error: %v", err)
+	}
+
+	//配置中的路径相对于工作目录
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Chdir error: %v", err)
+	}
+
+	env := &testEnv{t: t, now: time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC)}
+	t.Cleanup(func() {
+		if env.files != nil {
+			env.files.Close()
+		}
+		if env.db != nil {
+			env.db.Close()
+		}
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	})
+
+	err = ioutil.WriteFile(filepath.Join(dir, "config.yaml"), []byte("file_service:\n  base_path: files\n"), 0644)
+	if err != nil {
+		t.Fatalf("WriteFile error: %v", err)
+	}
+	env.conf = config.Load([]string{dir}, "config", "yaml")
+	configFunc := func() *config.Config { return env.conf }
+
+	env.db = openTestDB(t, dir)
+	env.storage = local.New(env.conf.FileService.FileAbsolutePath())
+
+	now := func() time.Time { return env.now }
+	dataContext, err := simple.NewContext(env.db, nil, env.storage, configFunc, now)
+	if err != nil {
+		t.Fatalf("NewContext error: %v", err)
+	}
+
+	namedLocker := locker.NewGLocker()
+	env.files = NewFileService(configFunc, env.uuid, now, dataContext, env.storage, namedLocker, nil)
+	env.users = NewUserService(configFunc, env.uuid, now, dataContext, nil, namedLocker, nil)
+	return env
+}
+
+func (env *testEnv) uuid() string {
+	env.ids++
+	return fmt.Sprintf("00000000-0000-4000-8000-%012d", env.ids)
+}
+
+func openTestDB(t *testing.T, dir string) *gorm.DB {
+	var db *gorm.DB
+	var err error
+	if dsn := os.Getenv(testPostgresEnv); dsn != "" {
+		db, err = gorm.Open("postgres", dsn)
+		if err == nil {
+			err = db.DropTableIfExists(testModels...).Error
+		}
+	} else {
+		//WAL模式下事务之外的读取不会被进行中的事务阻塞
+		db, err = gorm.Open("sqlite3", filepath.Join(dir, "test.db")+"?_journal_mode=WAL&_busy_timeout=1000")
+	}
+	if err != nil {
+		t.Fatalf("open database error: %v", err)
+	}
+
+	if err := db.AutoMigrate(testModels...).Error; err != nil {
+		t.Fatalf("AutoMigrate error: %v", err)
+	}
+	return db
+}
+
+//createUser 创建测试用户，用户ID同时是根目录的编号
+func (env *testEnv) createUser(username string, quota int64) *models.User {
+	user := &models.User{
+		ID:       env.uuid(),
+		Username: username,
+		Email:    username + "@example.com",
+		Role:     models.UserRoleUser,
+		Quota:    quota,
+	}
+	if err := env.db.Create(user).Error; err != nil {
+		env.t.Fatalf("create user error: %v", err)
+	}
+	return user
+}
+
+//upload 上传内容为content的文件
+func (env *testEnv) upload(owner string, directoryID string, name string, content string) *models.File {
+	file, err := env.files.CreateFile(owner, directoryID, name, int64(len(content)), strings.NewReader(content), nil)
+	if err != nil {
+		env.t.Fatalf("upload %s error: %v", name, err)
+	}
+	return file
+}
+
+//usedBytes 数据库中记录的用户已使用空间
+func (env *testEnv) usedBytes(owner string) int64 {
+	user := &models.User{}
+	if err := env.db.Where("id = ?", owner).First(user).Error; err != nil {
+		env.t.Fatalf("get user error: %v", err)
+	}
+	return user.UsedBytes
+}
+
+//count 数据库中满足条件的记录数，包括软删除的记录
+func (env *testEnv) count(model interface{}, query string, args ...interface{}) int {
+	var count int
+	if err := env.db.Unscoped().Model(model).Where(query, args...).Count(&count).Error; err != nil {
+		env.t.Fatalf("count error: %v", err)
+	}
+	return count
+}
+
+//causeOf PathError包装的错误
+func causeOf(err error) error {
+	if e, ok := err.(*PathError); ok {
+		return e.Err
+	}
+	return err
+}
+
+//refCount Blob记录的引用计数
+func (env *testEnv) refCount(hash string) int64 {
+	blob := &models.Blob{}
+	if err := env.db.Where("hash = ?", hash).First(blob).Error; err != nil {
+		env.t.Fatalf("get blob %s error: %v", hash, err)
+	}
+	return blob.RefCount
+}
+
+//mkdir 创建文件夹
+func (env *testEnv) mkdir(owner string, directoryID string, name string) *models.File {
+	directory, err := env.files.CreateDirectory(owner, directoryID, name)
+	if err != nil {
+		env.t.Fatalf("CreateDirectory %s error: %v", name, err)
+	}
+	return directory
+}
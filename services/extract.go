@@ -0,0 +1,552 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/phantom-atom/file-explorer/internal/log"
+	"github.com/phantom-atom/file-explorer/models"
+)
+
+const (
+	//ExtractConflictSkip 跳过已经存在同名文件的项目
+	ExtractConflictSkip = "skip"
+	//ExtractConflictRename 存在同名文件时在名称后添加序号
+	ExtractConflictRename = "rename"
+	//ExtractConflictNewVersion 同名文件的原内容保存为历史版本
+	ExtractConflictNewVersion = "new_version"
+)
+
+//解压项目的结果
+const (
+	ExtractStatusCreated  = "created"
+	ExtractStatusExists   = "exists"
+	ExtractStatusRenamed  = "renamed"
+	ExtractStatusReplaced = "replaced"
+	ExtractStatusSkipped  = "skipped"
+	ExtractStatusFailed   = "failed"
+)
+
+const (
+	archiveFormatTar = "tar"
+	//extractRatioMinSize 解压后的总大小超过该值时才检查压缩比，小归档的压缩比可能很高但不会造成危害
+	extractRatioMinSize = 1 << 20
+)
+
+var (
+	//ErrArchiveTooLarge 归档的项目数量或者解压后的大小超过限制
+	ErrArchiveTooLarge = errors.New("归档解压后超过限制")
+	//ErrUnsafeArchivePath 归档中的路径是绝对路径或者包含..
+	ErrUnsafeArchivePath = errors.New("归档中的路径不安全")
+	//ErrArchiveEntryUnsupported 归档中的符号链接、设备文件等项目不能解压
+	ErrArchiveEntryUnsupported = errors.New("不支持的归档项目类型")
+)
+
+//ExtractEntry 归档中一个项目的解压结果，FileID为创建或者更新的文件
+type ExtractEntry struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+	FileID string `json:"file_id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+//ExtractResult 解压结果，同步解压时Entries为每个项目的结果，后台解压时Job为可以查询进度的任务，
+//任务结束后每个项目的结果保存在Job.Result中
+type ExtractResult struct {
+	Entries []*ExtractEntry `json:"entries,omitempty"`
+	Job     *models.Job     `json:"job,omitempty"`
+}
+
+//archiveItem 归档中的一个项目，size为声明的解压后大小，open打开项目的内容
+type archiveItem struct {
+	name    string
+	isDir   bool
+	regular bool
+	size    int64
+	open    func() (io.ReadCloser, error)
+}
+
+//extractor 解压过程的状态，directories为归档中的文件夹路径对应的文件夹
+type extractor struct {
+	f           *FileService
+	owner       string
+	conflict    string
+	root        *models.File
+	directories map[string]*models.File
+	entries     []*ExtractEntry
+	job         *models.Job
+}
+
+//ExtractArchive 将owner的归档文件fid(zip、tar或者tar.gz)解压到directoryID文件夹中，directoryID为空时解压到归档所在的文件夹，
+//归档中的文件夹与已经存在的同名文件夹合并，conflict决定如何处理同名文件，
+//项目数量超过配置的阈值时在后台解压，不安全的路径以及不支持的项目类型在项目结果中报告
+func (f *FileService) ExtractArchive(owner string, fid string, directoryID string, conflict string) (*ExtractResult, error) {
+	if owner == "" {
+		return nil, invalidArgument("FileService", "owner", "ExtractArchive")
+	}
+
+	if fid == "" {
+		return nil, invalidArgument("FileService", "fid", "ExtractArchive")
+	}
+
+	switch conflict {
+	case "":
+		conflict = ExtractConflictSkip
+	case ExtractConflictSkip, ExtractConflictRename, ExtractConflictNewVersion:
+	default:
+		return nil, invalidArgument("FileService", "conflict", "ExtractArchive")
+	}
+
+	content, archive, err := f.Download(owner, fid)
+	if err != nil {
+		return nil, err
+	}
+
+	closeContent := true
+	defer func() {
+		if closeContent {
+			if err := content.Close(); err != nil {
+				log.Error("msg", "occur a error when close file", "error", err.Error())
+			}
+		}
+	}()
+
+	if directoryID == "" {
+		directoryID = archive.PFID
+	}
+
+	fileRepository, err := f.dataContext.File()
+	if err != nil {
+		return nil, err
+	}
+
+	directory, err := f.searchDirectory(owner, directoryID, fileRepository)
+	if err != nil {
+		return nil, err
+	}
+
+	if directory == nil {
+		directory = rootDirectory(owner)
+	}
+
+	format, err := detectArchiveFormat(archive.Filename, content)
+	if err != nil {
+		return nil, err
+	}
+
+	count, size, err := f.scanArchive(archive, format, content)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.checkQuota("extract", owner, archive.Filename, size); err != nil {
+		return nil, err
+	}
+
+	e := &extractor{
+		f:           f,
+		owner:       owner,
+		conflict:    conflict,
+		root:        directory,
+		directories: make(map[string]*models.File),
+		entries:     make([]*ExtractEntry, 0),
+	}
+
+	if count <= int64(f.config().FileService.Extract.AsyncThreshold) {
+		if err := e.extract(content, archive, format); err != nil {
+			return nil, err
+		}
+		return &ExtractResult{Entries: e.entries}, nil
+	}
+
+	jobRepository, err := f.dataContext.Job()
+	if err != nil {
+		return nil, err
+	}
+
+	id := f.uuid()
+	if id == "" {
+		return nil, errors.New("FileService: cannot create uuid in ExtractArchive")
+	}
+
+	e.job = &models.Job{
+		ID:     id,
+		Owner:  owner,
+		Type:   models.JobTypeExtract,
+		Status: models.JobStatusRunning,
+		Total:  count,
+	}
+	if err := jobRepository.CreateJob(e.job); err != nil {
+		return nil, err
+	}
+
+	result := *e.job
+	closeContent = false
+	go func() {
+		defer func() {
+			if err := content.Close(); err != nil {
+				log.Error("msg", "occur a error when close file", "error", err.Error())
+			}
+		}()
+		f.runExtractJob(e, content, archive, format)
+	}()
+	return &ExtractResult{Job: &result}, nil
+}
+
+func (f *FileService) runExtractJob(e *extractor, content File, archive *models.File, format string) {
+	job := e.job
+	err := e.extract(content, archive, format)
+	if err != nil {
+		job.Status = models.JobStatusFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = models.JobStatusSucceeded
+		job.FID = e.root.FID
+	}
+
+	result, err := json.Marshal(e.entries)
+	if err != nil {
+		log.Error("msg", "occur a error when marshal extract result", "id", job.ID, "error", err.Error())
+	} else {
+		job.Result = result
+	}
+	f.saveJob(job)
+}
+
+//scanArchive 统计归档的项目数量以及解压后的总大小，超过配置的限制时返回ErrArchiveTooLarge
+func (f *FileService) scanArchive(archive *models.File, format string, content File) (count int64, size int64, err error) {
+	conf := &f.config().FileService.Extract
+	err = walkArchive(content, archive.Size, format, func(item *archiveItem) error {
+		count++
+		size += item.size
+		if count > int64(conf.MaxEntries) || size > conf.MaxSize {
+			return NewPathError("extract", archive.Filename, ErrArchiveTooLarge)
+		}
+
+		if size > extractRatioMinSize && size/conf.MaxRatio > archive.Size {
+			return NewPathError("extract", archive.Filename, ErrArchiveTooLarge)
+		}
+		return nil
+	})
+	return count, size, err
+}
+
+//detectArchiveFormat 根据内容开头的特征判断归档格式
+func detectArchiveFormat(name string, content io.ReaderAt) (string, error) {
+	head := make([]byte, 512)
+	n, err := content.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return ArchiveFormatZip, nil
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return ArchiveFormatTarGz, nil
+	case len(head) >= 262 && string(head[257:262]) == "ustar":
+		return archiveFormatTar, nil
+	}
+	return "", NewPathError("extract", name, ErrArchiveFormatUnsupported)
+}
+
+//walkArchive 按顺序遍历归档中的项目，tar格式的项目内容只能在fn中读取
+func walkArchive(content File, size int64, format string, fn func(*archiveItem) error) error {
+	if format == ArchiveFormatZip {
+		zipReader, err := zip.NewReader(content, size)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range zipReader.File {
+			//声明的大小超出int64时直接当作超过限制
+			if file.UncompressedSize64 > 1<<62 {
+				return NewPathError("extract", file.Name, ErrArchiveTooLarge)
+			}
+
+			isDir := strings.HasSuffix(file.Name, "/") || file.Mode().IsDir()
+			err := fn(&archiveItem{
+				name:    file.Name,
+				isDir:   isDir,
+				regular: isDir || file.Mode().IsRegular(),
+				size:    int64(file.UncompressedSize64),
+				open:    file.Open,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	var reader io.Reader = content
+	if format == ArchiveFormatTarGz {
+		gzipReader, err := gzip.NewReader(content)
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+
+		err = fn(&archiveItem{
+			name:    header.Name,
+			isDir:   header.Typeflag == tar.TypeDir,
+			regular: header.Typeflag == tar.TypeDir || header.Typeflag == tar.TypeReg,
+			size:    header.Size,
+			open: func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(tarReader), nil
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+//archiveEntryPath 将归档中的路径转换为使用/分隔的相对路径，绝对路径以及包含..的路径返回ErrUnsafeArchivePath，
+//只包含.的路径返回空
+func archiveEntryPath(name string) (string, error) {
+	name = strings.Replace(name, "\\", "/", -1)
+	if strings.HasPrefix(name, "/") || strings.ContainsRune(name, 0) ||
+		(len(name) >= 2 && name[1] == ':') {
+		return "", NewPathError("extract", name, ErrUnsafeArchivePath)
+	}
+
+	parts := make([]string, 0)
+	for _, part := range strings.Split(name, "/") {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			return "", NewPathError("extract", name, ErrUnsafeArchivePath)
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "/"), nil
+}
+
+//extract 依次解压所有项目，每个项目的结果记录在entries中，只有归档本身损坏时返回错误
+func (e *extractor) extract(content File, archive *models.File, format string) error {
+	return walkArchive(content, archive.Size, format, func(item *archiveItem) error {
+		if entry := e.extractItem(item); entry != nil {
+			e.entries = append(e.entries, entry)
+		}
+		e.f.reportJobProgress(e.job)
+		return nil
+	})
+}
+
+func (e *extractor) extractItem(item *archiveItem) *ExtractEntry {
+	entry := &ExtractEntry{Path: item.name}
+	p, err := archiveEntryPath(item.name)
+	if err == nil && p == "" {
+		return nil
+	}
+
+	if err == nil {
+		entry.Path = p
+		if !item.regular {
+			err = NewPathError("extract", p, ErrArchiveEntryUnsupported)
+		}
+	}
+
+	var file *models.File
+	if err == nil {
+		if item.isDir {
+			file, entry.Status, err = e.directory(p)
+		} else {
+			file, entry.Status, err = e.extractFile(p, item)
+		}
+	}
+
+	if err != nil {
+		entry.Status = ExtractStatusFailed
+		entry.Error = err.Error()
+		return entry
+	}
+
+	if file != nil {
+		entry.FileID = file.FID
+	}
+	return entry
+}
+
+//directory 获取归档路径p对应的文件夹，不存在时依次创建，路径被同名文件占用时只有conflict为rename才创建改名的文件夹
+func (e *extractor) directory(p string) (*models.File, string, error) {
+	if p == "." {
+		return e.root, ExtractStatusExists, nil
+	}
+
+	if directory, ok := e.directories[p]; ok {
+		return directory, ExtractStatusExists, nil
+	}
+
+	parent, _, err := e.directory(path.Dir(p))
+	if err != nil {
+		return nil, "", err
+	}
+
+	e.f.namedLocker.Lock(e.owner)
+	defer e.f.namedLocker.UnLock(e.owner)
+
+	fileRepository, err := e.f.dataContext.File()
+	if err != nil {
+		return nil, "", err
+	}
+
+	name := path.Base(p)
+	matchedFile, err := fileRepository.GetFileByPFIDAndName(e.owner, parent.FID, name)
+	if err != nil {
+		return nil, "", err
+	}
+
+	status := ExtractStatusCreated
+	if matchedFile != nil {
+		if matchedFile.IsDir {
+			e.directories[p] = matchedFile
+			return matchedFile, ExtractStatusExists, nil
+		}
+
+		if e.conflict != ExtractConflictRename {
+			return nil, "", NewPathError("extract", path.Join(matchedFile.Directory, matchedFile.Filename), ErrParentNotADirectory)
+		}
+
+		name, err = e.f.availableFilename(&models.File{
+			Owner:    e.owner,
+			PFID:     parent.FID,
+			Filename: name,
+		}, fileRepository)
+		if err != nil {
+			return nil, "", err
+		}
+		status = ExtractStatusRenamed
+	}
+
+	directory, err := e.f.createFileModel(&models.File{
+		Owner:    e.owner,
+		PFID:     parent.FID,
+		Filename: name,
+		IsDir:    true,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	e.directories[p] = directory
+	return directory, status, nil
+}
+
+//extractFile 保存项目内容并创建文件，同名文件按照conflict处理
+func (e *extractor) extractFile(p string, item *archiveItem) (*models.File, string, error) {
+	parent, _, err := e.directory(path.Dir(p))
+	if err != nil {
+		return nil, "", err
+	}
+
+	fileRepository, err := e.f.dataContext.File()
+	if err != nil {
+		return nil, "", err
+	}
+
+	name := path.Base(p)
+	matchedFile, err := fileRepository.GetFileByPFIDAndName(e.owner, parent.FID, name)
+	if err != nil {
+		return nil, "", err
+	}
+
+	status := ExtractStatusCreated
+	newVersion := false
+	if matchedFile != nil {
+		switch e.conflict {
+		case ExtractConflictSkip:
+			return nil, ExtractStatusSkipped, nil
+		case ExtractConflictRename:
+			name, err = e.f.availableFilename(&models.File{
+				Owner:    e.owner,
+				PFID:     parent.FID,
+				Filename: name,
+			}, fileRepository)
+			if err != nil {
+				return nil, "", err
+			}
+			status = ExtractStatusRenamed
+		case ExtractConflictNewVersion:
+			newVersion = true
+			status = ExtractStatusReplaced
+		}
+	}
+
+	body, err := item.open()
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		if err := body.Close(); err != nil {
+			log.Error("msg", "occur a error when close archive entry", "error", err.Error())
+		}
+	}()
+
+	hash, md5Hash, size, err := e.f.saveBlob(name, &entryReader{
+		reader: body,
+		name:   p,
+		remain: item.size,
+	}, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	file, err := e.f.createFileFromBlob(e.owner, parent.FID, name, hash, md5Hash, size, newVersion)
+	if err != nil {
+		return nil, "", err
+	}
+	return file, status, nil
+}
+
+//entryReader 读取归档项目的内容，超过声明的大小时返回ErrArchiveTooLarge，防止声明大小不实的压缩炸弹
+type entryReader struct {
+	reader io.Reader
+	name   string
+	remain int64
+}
+
+func (r *entryReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > r.remain+1 {
+		p = p[:r.remain+1]
+	}
+
+	n, err := r.reader.Read(p)
+	r.remain -= int64(n)
+	if r.remain < 0 {
+		return 0, NewPathError("extract", r.name, ErrArchiveTooLarge)
+	}
+	return n, err
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestArchiveEntryPath(t *testing.T) {
+	cases := []struct {
+		name     string
+		expected string
+		unsafe   bool
+	}{
+		{"a.txt", "a.txt", false},
+		{"docs/a.txt", "docs/a.txt", false},
+		{"./docs//a.txt", "docs/a.txt", false},
+		{"docs/", "docs", false},
+		{"docs\\sub\\a.txt", "docs/sub/a.txt", false},
+		{"./", "", false},
+		{"a..b/c", "a..b/c", false},
+		{"../a.txt", "", true},
+		{"docs/../../a.txt", "", true},
+		{"docs/..", "", true},
+		{"..\\a.txt", "", true},
+		{"docs\\..\\..\\a.txt", "", true},
+		{"/etc/passwd", "", true},
+		{"\\windows\\system32", "", true},
+		{"C:a.txt", "", true},
+		{"C:/windows/a.txt", "", true},
+		{"c:\\windows\\a.txt", "", true},
+		{"a.txt\x00.jpg", "", true},
+		{"docs/\x00", "", true},
+	}
+
+	for _, c := range cases {
+		actual, err := archiveEntryPath(c.name)
+		if c.unsafe {
+			if e, ok := err.(*PathError); !ok || e.Err != ErrUnsafeArchivePath {
+				t.Errorf("archiveEntryPath(%q) error = %v, expected %v", c.name, err, ErrUnsafeArchivePath)
+			}
+			continue
+		}
+
+		if err != nil || actual != c.expected {
+			t.Errorf("archiveEntryPath(%q) = %q, %v, expected %q", c.name, actual, err, c.expected)
+		}
+	}
+}
+
+func TestEntryReader(t *testing.T) {
+	cases := []struct {
+		content  string
+		declared int64
+		tooLarge bool
+	}{
+		{"", 0, false},
+		{"hello", 5, false},
+		{"hello", 10, false},
+		{"hello", 4, true},
+		{"hello", 0, true},
+		{strings.Repeat("x", 100000), 1024, true},
+	}
+
+	for _, c := range cases {
+		data, err := ioutil.ReadAll(&entryReader{
+			reader: strings.NewReader(c.content),
+			name:   "a.txt",
+			remain: c.declared,
+		})
+
+		if c.tooLarge {
+			if e, ok := err.(*PathError); !ok || e.Err != ErrArchiveTooLarge {
+				t.Errorf("entryReader(%d bytes, declared %d) error = %v, expected %v",
+					len(c.content), c.declared, err, ErrArchiveTooLarge)
+			}
+			if int64(len(data)) > c.declared {
+				t.Errorf("entryReader(%d bytes, declared %d) read %d bytes",
+					len(c.content), c.declared, len(data))
+			}
+			continue
+		}
+
+		if err != nil || string(data) != c.content {
+			t.Errorf("entryReader(%d bytes, declared %d) = %d bytes, %v",
+				len(c.content), c.declared, len(data), err)
+		}
+	}
+}
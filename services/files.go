@@ -1,17 +1,18 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"io"
-	"os"
 	"path"
-	"path/filepath"
+	"time"
 
 	"github.com/phantom-atom/file-explorer/internal/locker"
 
 	"github.com/phantom-atom/file-explorer/internal/log"
 	"github.com/phantom-atom/file-explorer/models"
 	"github.com/phantom-atom/file-explorer/repository"
+	"github.com/phantom-atom/file-explorer/storage"
 
 	"github.com/phantom-atom/file-explorer/config"
 )
@@ -27,6 +28,10 @@ var (
 	ErrDirectoryNotFound = errors.New("文件夹不存在")
 	//ErrFileShareInvalid 文件分享码无效
 	ErrFileShareInvalid = errors.New("文件分享码无效")
+	//ErrFileSharePasswordIncorrect 文件分享密码错误
+	ErrFileSharePasswordIncorrect = errors.New("文件分享密码错误")
+	//ErrFileShareLocked 文件分享密码错误次数过多
+	ErrFileShareLocked = errors.New("文件分享密码错误次数过多，请稍后再试")
 	//ErrFileIsMissing 文件丢失
 	ErrFileIsMissing = errors.New("文件丢失")
 	//ErrCannotDownloadDirectory 不能下载文件夹
@@ -66,22 +71,68 @@ type File interface {
 type FileService struct {
 	config      func() *config.Config
 	uuid        func() string
+	now         func() time.Time
 	dataContext repository.DataContext
+	storage     storage.Backend
 	namedLocker locker.NamedLocker
+	webhooks    *WebhookService
+	actor       *Actor
+	locks       *lockService
+	ctx         context.Context
+	cancel      context.CancelFunc
+
+	thumbnailQueue chan *models.File
+	blobReleased   chan struct{}
+	locksConfirmed bool
 }
 
-//NewFileService 创建FileService
+//NewFileService 创建FileService，webhooks为空时不发布事件，调用Start后才启动后台任务
 func NewFileService(
 	configFunc func() *config.Config,
 	uuid func() string,
+	now func() time.Time,
 	dataContext repository.DataContext,
+	backend storage.Backend,
 	namedLocker locker.NamedLocker,
+	webhooks *WebhookService,
 ) *FileService {
-	return &FileService{
+	ctx, cancel := context.WithCancel(context.Background())
+
+	fileService := &FileService{
 		config:      configFunc,
 		uuid:        uuid,
+		now:         now,
 		dataContext: dataContext,
+		storage:     backend,
 		namedLocker: namedLocker,
+		webhooks:    webhooks,
+		locks:       newLockService(),
+		ctx:         ctx,
+		cancel:      cancel,
+
+		blobReleased: make(chan struct{}, 1),
+	}
+	return fileService
+}
+
+//Start 启动清理上传、回收站、历史版本和内容的后台协程，定期检查以及缩略图生成，只在服务中调用，
+//离线命令使用的FileService不启动后台任务，以免与运行中的服务重复执行
+func (f *FileService) Start() {
+	go f.purgeUploads()
+	go f.purgeTrash()
+	go f.purgeVersions()
+	go f.purgeBlobs()
+
+	if f.config().FileService.Fsck.Interval > 0 {
+		go f.scheduleFsck()
+	}
+
+	thumbnailConf := &f.config().FileService.Thumbnail
+	if thumbnailConf.Workers > 0 {
+		f.thumbnailQueue = make(chan *models.File, thumbnailConf.QueueSize)
+		for i := 0; i < thumbnailConf.Workers; i++ {
+			go f.thumbnailWorker()
+		}
 	}
 }
 
@@ -99,46 +150,80 @@ func (f *FileService) createFileModel(file *models.File) (*models.File, error) {
 		file.FID = fid
 	}
 
-	fileRepository, err := f.dataContext.File()
+	var commited = false
+	UOW, err := f.dataContext.Unit()
 	if err != nil {
 		return nil, err
 	}
+	defer func() {
+		if !commited {
+			if err := UOW.Rollback(); err != nil {
+				log.Warn("msg", "rollback failed in FileService.createFileModel", "error", err.Error())
+			}
+		}
+	}()
 
+	fileRepository, err := UOW.File()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.prepareFileModel("create", file, fileRepository); err != nil {
+		return nil, err
+	}
+
+	if err := fileRepository.CreateFile(file); err != nil {
+		return nil, err
+	}
+
+	if err := f.recordFileActivity(UOW, models.ActivityFileCreated, file, "", ""); err != nil {
+		return nil, err
+	}
+
+	if err := f.publishFileEvent(UOW, models.EventFileCreated, file, ""); err != nil {
+		return nil, err
+	}
+
+	if err := UOW.Commit(); err != nil {
+		return nil, err
+	}
+	commited = true
+	return file, nil
+}
+
+//prepareFileModel 检查父文件夹以及同名文件，并设置文件的Directory
+func (f *FileService) prepareFileModel(op string, file *models.File,
+	repos repository.FileRepository) error {
 	directory := "/"
 
 	if file.Owner != file.PFID {
-		directoryMod, err := fileRepository.GetFileByID(file.Owner, file.FID)
-		if err == nil {
-			return nil, err
+		directoryMod, err := repos.GetFileByID(file.Owner, file.PFID)
+		if err != nil {
+			return err
 		}
 
 		if directoryMod == nil {
-			return nil, NewPathError("create", file.PFID, ErrParentNotADirectory)
+			return NewPathError(op, file.PFID, ErrParentNotADirectory)
 		}
 
 		if !directoryMod.IsDir {
-			return nil, NewPathError("create", file.PFID, ErrParentNotADirectory)
+			return NewPathError(op, file.PFID, ErrParentNotADirectory)
 		}
 
 		directory = path.Join(directoryMod.Directory, directoryMod.Filename)
 	}
 
-	sameMod, err := fileRepository.GetFileByPFIDAndName(file.Owner, file.PFID, file.Filename)
+	sameMod, err := repos.GetFileByPFIDAndName(file.Owner, file.PFID, file.Filename)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	if sameMod != nil {
 		absPath := path.Join(sameMod.Directory, sameMod.Filename)
-		return nil, NewPathError("create", absPath, ErrFileAlreadyExists)
+		return NewPathError(op, absPath, ErrFileAlreadyExists)
 	}
 
 	file.Directory = directory
-
-	if err := fileRepository.CreateFile(file); err != nil {
-		return nil, err
-	}
-
-	return file, nil
+	return nil
 }
 
 //CreateDirectory 创建一个文件夹，文件属于owner，存在于directoryID文件夹中
@@ -167,35 +252,15 @@ func (f *FileService) CreateDirectory(owner string, directoryID string, name str
 	return f.createFileModel(file)
 }
 
-func (f *FileService) saveFile(file File, name string) (absolutePath string, err error) {
-	basePath := f.config().FileService.FileAbsolutePath()
-	absolutePath = filepath.Join(basePath, name)
-
-	if err := os.MkdirAll(basePath, 0666); err != nil {
-		return "", err
-	}
-
-	diskFile, err := os.Create(absolutePath)
-	if err != nil {
-		return "", err
-	}
-	defer diskFile.Close()
-
-	if _, err := io.Copy(diskFile, file); err != nil {
-		if e := os.Remove(absolutePath); e != nil {
-			log.Error("msg", "occur a error when delete file", "error", e.Error())
-		}
-		return "", err
-	}
-	return
-}
-
-//CreateFile 创建一个文件，文件属于owner，存在于directoryID文件夹中
+//CreateFile 创建一个文件，文件属于owner，存在于directoryID文件夹中，
+//size只用于写入前检查配额，为-1时大小未知，写入超过剩余空间时返回ErrQuotaExceeded，
+//文件大小为实际写入的字节数，expected不为空时校验内容的摘要
 func (f *FileService) CreateFile(owner string,
 	directoryID string,
 	name string,
 	size int64,
-	file File) (*models.File, error) {
+	file io.Reader,
+	expected *Digest) (*models.File, error) {
 
 	if owner == "" {
 		return nil, invalidArgument("FileService", "owner", "CreateFile")
@@ -213,38 +278,19 @@ func (f *FileService) CreateFile(owner string,
 		directoryID = owner
 	}
 
-	fid := f.uuid()
-	if fid == "" {
-		return nil, errors.New("FileService: cannot create uuid in CreateFile")
-	}
-
-	fileMod := &models.File{
-		Owner:    owner,
-		PFID:     directoryID,
-		Filename: name,
-		IsDir:    false,
-		FID:      fid,
-		Size:     size,
-	}
-
-	absolutePath, err := f.saveFile(file, fid)
+	file, err := f.limitToQuota("upload", owner, name, size, file)
 	if err != nil {
 		return nil, err
 	}
 
-	f.namedLocker.Lock(owner)
-	defer f.namedLocker.UnLock(owner)
-	newFileMod, err := f.createFileModel(fileMod)
+	hash, md5Hash, size, err := f.saveBlob(name, file, expected)
 	if err != nil {
-		if e := os.Remove(absolutePath); e != nil {
-			log.Error("msg", "occur a error when delete file", "error", e.Error())
-		}
 		return nil, err
 	}
-	return newFileMod, nil
+	return f.createFileFromBlob(owner, directoryID, name, hash, md5Hash, size, false)
 }
 
-//DeleteFile 删除文件，文件属于owner
+//DeleteFile 删除文件，文件属于owner，文件及其子文件会被移入回收站
 func (f *FileService) DeleteFile(owner string, fid string) error {
 	if owner == "" {
 		return invalidArgument("FileService", "owner", "DeleteFile")
@@ -269,7 +315,20 @@ func (f *FileService) DeleteFile(owner string, fid string) error {
 		}
 	}()
 
-	fileRepository, err := UOW.File()
+	if err := f.deleteFile(owner, fid, UOW); err != nil {
+		return err
+	}
+
+	if err := UOW.Commit(); err != nil {
+		return err
+	}
+	commited = true
+	return nil
+}
+
+//deleteFile 将文件及其子文件移入回收站
+func (f *FileService) deleteFile(owner string, fid string, repos repository.DataRepository) error {
+	fileRepository, err := repos.File()
 	if err != nil {
 		return err
 	}
@@ -283,15 +342,23 @@ func (f *FileService) DeleteFile(owner string, fid string) error {
 		return NewPathError("delete", fid, ErrFileNotFound)
 	}
 
-	if err := fileRepository.DeleteFile(deleteFile); err != nil {
+	if err := f.checkUnlocked(deleteFile); err != nil {
 		return err
 	}
 
-	if err := UOW.Commit(); err != nil {
+	trashRepository, err := repos.Trash()
+	if err != nil {
 		return err
 	}
-	commited = true
-	return nil
+
+	if err := f.trashFile(deleteFile, trashRepository); err != nil {
+		return err
+	}
+
+	if err := f.recordFileActivity(repos, models.ActivityFileDeleted, deleteFile, "", ""); err != nil {
+		return err
+	}
+	return f.publishFileEvent(repos, models.EventFileDeleted, deleteFile, "")
 }
 
 //Download 下载文件，文件属于owner，编号为fid
@@ -322,20 +389,36 @@ func (f *FileService) Download(owner string, fid string) (File, *models.File, er
 		return nil, nil, NewPathError("download", fid, ErrCannotDownloadDirectory)
 	}
 
-	absolutePath := filepath.Join(f.config().FileService.FileAbsolutePath(), downloadFile.FID)
-	file, err := os.OpenFile(absolutePath, os.O_RDONLY, 0666)
+	file, err := f.openFile("download", downloadFile)
 	if err != nil {
-		if os.IsNotExist(err) {
-			if err := fileRepository.DeleteFile(downloadFile); err != nil {
-				return nil, nil, err
-			}
-			return nil, nil, NewPathError("download", fid, ErrFileIsMissing)
-		}
 		return nil, nil, err
 	}
 	return file, downloadFile, nil
 }
 
+func (f *FileService) openFile(op string, file *models.File) (File, error) {
+	info, err := f.storage.Stat(file.BlobKey())
+	if err != nil {
+		if err == storage.ErrNotFound {
+			//不删除文件记录，由Fsck报告以及修复
+			log.Warn("msg", "file content is missing", "owner", file.Owner, "file_id", file.FID, "key", file.BlobKey())
+			return nil, NewPathError(op, file.FID, ErrFileIsMissing)
+		}
+		return nil, err
+	}
+
+	reader := storage.NewReader(f.storage, file.BlobKey(), info.Size)
+	if backend, ok := f.storage.(storage.EncodedBackend); ok && file.Encoding != "" {
+		return &encodedFile{
+			Reader:   reader,
+			backend:  backend,
+			key:      file.BlobKey(),
+			encoding: file.Encoding,
+		}, nil
+	}
+	return reader, nil
+}
+
 //MoveFile 移动文件位置，文件编号为fid，新文件夹newPFID
 func (f *FileService) MoveFile(owner string, fid string, newPFID string) error {
 	if owner == "" {
@@ -366,7 +449,20 @@ func (f *FileService) MoveFile(owner string, fid string, newPFID string) error {
 		}
 	}()
 
-	fileRepository, err := UOW.File()
+	if err := f.moveFile(owner, fid, newPFID, UOW); err != nil {
+		return err
+	}
+
+	if err := UOW.Commit(); err != nil {
+		return err
+	}
+	commited = true
+	return nil
+}
+
+func (f *FileService) moveFile(owner string, fid string, newPFID string,
+	repos repository.DataRepository) error {
+	fileRepository, err := repos.File()
 	if err != nil {
 		return err
 	}
@@ -384,15 +480,21 @@ func (f *FileService) MoveFile(owner string, fid string, newPFID string) error {
 		return nil
 	}
 
+	if err := f.checkUnlocked(moveFile); err != nil {
+		return err
+	}
+
+	oldDirectory := moveFile.Directory
+	oldPath := path.Join(moveFile.Directory, moveFile.Filename)
 	if err := f.move(moveFile, newPFID, fileRepository); err != nil {
 		return err
 	}
 
-	if err := UOW.Commit(); err != nil {
+	err = f.recordFileActivity(repos, models.ActivityFileMoved, moveFile, oldDirectory, moveFile.Directory)
+	if err != nil {
 		return err
 	}
-	commited = true
-	return nil
+	return f.publishFileEvent(repos, models.EventFileMoved, moveFile, oldPath)
 }
 
 //RenameFile 修改文件名称，文件编号为fid，新文件名称newName
@@ -425,7 +527,20 @@ func (f *FileService) RenameFile(owner string, fid string, newName string) error
 		}
 	}()
 
-	fileRepository, err := UOW.File()
+	if err := f.renameFile(owner, fid, newName, UOW); err != nil {
+		return err
+	}
+
+	if err := UOW.Commit(); err != nil {
+		return err
+	}
+	commited = true
+	return nil
+}
+
+func (f *FileService) renameFile(owner string, fid string, newName string,
+	repos repository.DataRepository) error {
+	fileRepository, err := repos.File()
 	if err != nil {
 		return err
 	}
@@ -443,15 +558,21 @@ func (f *FileService) RenameFile(owner string, fid string, newName string) error
 		return nil
 	}
 
+	if err := f.checkUnlocked(renameFile); err != nil {
+		return err
+	}
+
+	oldName := renameFile.Filename
+	oldPath := path.Join(renameFile.Directory, renameFile.Filename)
 	if err := f.rename(renameFile, newName, fileRepository); err != nil {
 		return err
 	}
 
-	if err := UOW.Commit(); err != nil {
+	err = f.recordFileActivity(repos, models.ActivityFileRenamed, renameFile, oldName, renameFile.Filename)
+	if err != nil {
 		return err
 	}
-	commited = true
-	return nil
+	return f.publishFileEvent(repos, models.EventFileRenamed, renameFile, oldPath)
 }
 
 func (f *FileService) rename(file *models.File, newName string,
@@ -465,6 +586,10 @@ func (f *FileService) rename(file *models.File, newName string,
 		return NewPathError("rename", newName, ErrFileAlreadyExists)
 	}
 
+	if !file.IsDir && !sameExtension(file.Filename, newName) {
+		file.ContentType = f.contentTypeOf(newName, file.BlobKey(), file.Size)
+	}
+
 	file.Filename = newName
 	if file.IsDir {
 		subfiles, err := repos.GetFilesByPFID(file.Owner, file.FID, 0, 0)
@@ -615,5 +740,6 @@ func (f *FileService) adjustFilePath(file *models.File, dir string, frepository
 
 //Close 关闭服务
 func (f *FileService) Close() error {
+	f.cancel()
 	return nil
 }
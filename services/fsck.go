@@ -0,0 +1,716 @@
+package services
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/phantom-atom/file-explorer/internal/log"
+	"github.com/phantom-atom/file-explorer/models"
+	"github.com/phantom-atom/file-explorer/repository"
+	"github.com/phantom-atom/file-explorer/storage"
+)
+
+const (
+	//FsckModeReport 只报告问题
+	FsckModeReport = "report"
+	//FsckModeRepair 修复问题，孤立对象以及内容丢失的记录会被删除
+	FsckModeRepair = "repair"
+	//FsckModeQuarantine 与FsckModeRepair相同，但是孤立对象移动到quarantine/下，内容丢失的文件移入回收站
+	FsckModeQuarantine = "quarantine"
+)
+
+const (
+	//FsckOrphanBlob 存储中的对象没有对应的Blob记录，也没有被任何文件引用
+	FsckOrphanBlob = "orphan_blob"
+	//FsckUntrackedBlob 存储中的对象被文件引用，但是没有对应的Blob记录
+	FsckUntrackedBlob = "untracked_blob"
+	//FsckMissingContent 文件或者历史版本的内容在存储中不存在
+	FsckMissingContent = "missing_content"
+	//FsckSizeMismatch 文件记录的大小与存储中的内容大小不一致
+	FsckSizeMismatch = "size_mismatch"
+	//FsckDanglingParent 文件的父文件夹不存在
+	FsckDanglingParent = "dangling_parent"
+	//FsckPathMismatch 文件的Directory与实际的父文件夹路径不一致
+	FsckPathMismatch = "path_mismatch"
+)
+
+const (
+	fsckBatch            = 100
+	fsckQuarantinePrefix = "quarantine/"
+	fsckLostAndFound     = "/lost+found"
+	fsckLockerScope      = "$file-explorer:fsck$"
+)
+
+//FsckIssue 一致性检查发现的问题，Action为执行的修复操作，修复失败时Error不为空
+type FsckIssue struct {
+	Kind      string `json:"kind"`
+	Owner     string `json:"owner,omitempty"`
+	FID       string `json:"file_id,omitempty"`
+	VersionID string `json:"version_id,omitempty"`
+	Key       string `json:"key,omitempty"`
+	Detail    string `json:"detail,omitempty"`
+	Action    string `json:"action,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+//FsckReport 一致性检查报告
+type FsckReport struct {
+	Mode       string       `json:"mode"`
+	StartedAt  time.Time    `json:"started_at"`
+	FinishedAt time.Time    `json:"finished_at"`
+	Objects    int          `json:"objects"`
+	Files      int          `json:"files"`
+	Versions   int          `json:"versions"`
+	Issues     []*FsckIssue `json:"issues"`
+}
+
+type fsck struct {
+	f      *FileService
+	mode   string
+	report *FsckReport
+}
+
+//Fsck 检查存储与数据库的一致性，mode为FsckModeReport时只报告问题，
+//检查项目包括存储中的孤立对象、内容丢失或大小不一致的文件、父文件夹不存在的文件以及Directory不正确的文件，
+//父文件夹不存在的文件修复时移动到根目录的lost+found文件夹中
+func (f *FileService) Fsck(mode string) (*FsckReport, error) {
+	if mode == "" {
+		mode = FsckModeReport
+	}
+
+	if mode != FsckModeReport && mode != FsckModeRepair && mode != FsckModeQuarantine {
+		return nil, invalidArgument("FileService", "mode", "Fsck")
+	}
+
+	f.namedLocker.Lock(fsckLockerScope)
+	defer f.namedLocker.UnLock(fsckLockerScope)
+
+	c := &fsck{
+		f:    f,
+		mode: mode,
+		report: &FsckReport{
+			Mode:      mode,
+			StartedAt: f.now(),
+			Issues:    make([]*FsckIssue, 0),
+		},
+	}
+
+	checks := []func() error{
+		c.checkObjects,
+		c.checkFiles,
+		c.checkVersions,
+		c.checkDanglingFiles,
+		c.checkMisplacedFiles,
+	}
+
+	for _, check := range checks {
+		if err := check(); err != nil {
+			return nil, err
+		}
+	}
+
+	c.report.FinishedAt = f.now()
+	return c.report, nil
+}
+
+//scheduleFsck 定期执行一致性检查
+func (f *FileService) scheduleFsck() {
+	for {
+		select {
+		case <-f.ctx.Done():
+			return
+		case <-time.After(f.config().FileService.Fsck.Interval):
+		}
+
+		report, err := f.Fsck(f.config().FileService.Fsck.Mode)
+		if err != nil {
+			log.Error("msg", "occur a error when check storage consistency", "error", err.Error())
+			continue
+		}
+		log.Info("msg", "storage consistency check finished", "mode", report.Mode,
+			"objects", report.Objects, "files", report.Files, "versions", report.Versions,
+			"issues", len(report.Issues))
+	}
+}
+
+func (c *fsck) repairing() bool {
+	return c.mode != FsckModeReport
+}
+
+//addIssue 记录问题，repair不为空并且不是只报告时执行修复
+func (c *fsck) addIssue(issue *FsckIssue, action string, repair func() error) {
+	if repair != nil && c.repairing() {
+		issue.Action = action
+		if err := repair(); err != nil {
+			issue.Error = err.Error()
+		}
+	}
+
+	c.report.Issues = append(c.report.Issues, issue)
+	if issue.Error != "" {
+		log.Error("msg", "fsck failed to repair an issue", "kind", issue.Kind, "owner", issue.Owner,
+			"file_id", issue.FID, "version_id", issue.VersionID, "key", issue.Key, "error", issue.Error)
+		return
+	}
+	log.Warn("msg", "fsck found an issue", "kind", issue.Kind, "owner", issue.Owner,
+		"file_id", issue.FID, "version_id", issue.VersionID, "key", issue.Key,
+		"detail", issue.Detail, "action", issue.Action)
+}
+
+//checkObjects 检查存储中的Blob以及缩略图是否有对应的记录，GracePeriod之内写入的对象可能还没有创建记录，不做检查
+func (c *fsck) checkObjects() error {
+	before := c.f.now().Add(-c.f.config().FileService.Fsck.GracePeriod)
+
+	blobRepository, err := c.f.dataContext.Blob()
+	if err != nil {
+		return err
+	}
+
+	return c.f.storage.List("blobs/", func(info *storage.ObjectInfo) error {
+		c.report.Objects++
+		if info.ModTime.After(before) {
+			return nil
+		}
+
+		hash := path.Base(info.Key)
+		thumbnail := false
+		if i := strings.Index(hash, ".thumb-"); i >= 0 {
+			hash = hash[:i]
+			thumbnail = true
+		}
+
+		blob, err := blobRepository.GetBlob(hash)
+		if err != nil {
+			return err
+		}
+
+		if blob != nil {
+			return nil
+		}
+
+		references, err := blobRepository.CountBlobReferences(hash)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case references == 0:
+			action := "deleted"
+			if c.mode == FsckModeQuarantine {
+				action = "quarantined"
+			}
+			c.addIssue(&FsckIssue{
+				Kind: FsckOrphanBlob,
+				Key:  info.Key,
+			}, action, func() error {
+				return c.removeObject(hash, info.Key)
+			})
+		case !thumbnail:
+			c.addIssue(&FsckIssue{
+				Kind:   FsckUntrackedBlob,
+				Key:    info.Key,
+				Detail: "referenced by files or versions without a blob record",
+			}, "recreated", func() error {
+				return c.recreateBlob(hash, info)
+			})
+		}
+		return nil
+	})
+}
+
+//removeObject 删除或者隔离孤立对象，删除前在Blob的锁中再次确认没有被引用
+func (c *fsck) removeObject(hash string, key string) error {
+	c.f.namedLocker.Lock(blobLockerScope + hash)
+	defer c.f.namedLocker.UnLock(blobLockerScope + hash)
+
+	blobRepository, err := c.f.dataContext.Blob()
+	if err != nil {
+		return err
+	}
+
+	blob, err := blobRepository.GetBlob(hash)
+	if err != nil {
+		return err
+	}
+
+	references, err := blobRepository.CountBlobReferences(hash)
+	if err != nil {
+		return err
+	}
+
+	if blob != nil || references > 0 {
+		return nil
+	}
+
+	if c.mode == FsckModeQuarantine {
+		if err := c.copyObject(key, fsckQuarantinePrefix+key); err != nil {
+			return err
+		}
+	}
+	return c.f.storage.Delete(key)
+}
+
+func (c *fsck) copyObject(key string, newKey string) error {
+	body, err := c.f.storage.Get(key, 0, -1)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := body.Close(); err != nil {
+			log.Error("msg", "occur a error when close file", "error", err.Error())
+		}
+	}()
+	return c.f.storage.Put(newKey, body, -1)
+}
+
+//recreateBlob 根据存储中的内容以及引用数量重新创建Blob记录
+func (c *fsck) recreateBlob(hash string, info *storage.ObjectInfo) error {
+	c.f.namedLocker.Lock(blobLockerScope + hash)
+	defer c.f.namedLocker.UnLock(blobLockerScope + hash)
+
+	blobRepository, err := c.f.dataContext.Blob()
+	if err != nil {
+		return err
+	}
+
+	blob, err := blobRepository.GetBlob(hash)
+	if err != nil || blob != nil {
+		return err
+	}
+
+	references, err := blobRepository.CountBlobReferences(hash)
+	if err != nil || references == 0 {
+		return err
+	}
+
+	body, err := c.f.storage.Get(info.Key, 0, -1)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := body.Close(); err != nil {
+			log.Error("msg", "occur a error when close file", "error", err.Error())
+		}
+	}()
+
+	md5Hasher := md5.New()
+	size, err := io.Copy(md5Hasher, body)
+	if err != nil {
+		return err
+	}
+
+	return blobRepository.CreateBlob(&models.Blob{
+		Hash:     hash,
+		MD5:      hex.EncodeToString(md5Hasher.Sum(nil)),
+		Size:     size,
+		RefCount: references,
+	})
+}
+
+//checkFiles 检查文件(包括回收站中的文件)的内容是否存在以及大小是否一致
+func (c *fsck) checkFiles() error {
+	fileRepository, err := c.f.dataContext.File()
+	if err != nil {
+		return err
+	}
+
+	var lastID uint
+	for {
+		files, err := fileRepository.GetFilesAfterID(lastID, fsckBatch)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			lastID = file.ID
+			c.report.Files++
+			if file.IsDir {
+				continue
+			}
+
+			if err := c.checkFileContent(file); err != nil {
+				return err
+			}
+		}
+
+		if len(files) < fsckBatch {
+			return nil
+		}
+	}
+}
+
+func (c *fsck) checkFileContent(file *models.File) error {
+	info, err := c.f.storage.Stat(file.BlobKey())
+	if err != nil && err != storage.ErrNotFound {
+		return err
+	}
+
+	if err == storage.ErrNotFound {
+		issue := &FsckIssue{
+			Kind:  FsckMissingContent,
+			Owner: file.Owner,
+			FID:   file.FID,
+			Key:   file.BlobKey(),
+		}
+
+		if c.mode == FsckModeQuarantine {
+			//已经在回收站中的文件不再处理
+			if file.DeletedAt != nil {
+				c.addIssue(issue, "", nil)
+				return nil
+			}
+
+			c.addIssue(issue, "trashed", func() error {
+				return c.repairFileContent(file, func(current *models.File, info *storage.ObjectInfo,
+					repos repository.DataRepository) error {
+					if info != nil || current.DeletedAt != nil {
+						return nil
+					}
+					return c.f.deleteFile(current.Owner, current.FID, repos)
+				})
+			})
+			return nil
+		}
+
+		c.addIssue(issue, "deleted", func() error {
+			return c.repairFileContent(file, func(current *models.File, info *storage.ObjectInfo,
+				repos repository.DataRepository) error {
+				if info != nil {
+					return nil
+				}
+
+				fileRepository, err := repos.File()
+				if err != nil {
+					return err
+				}
+				return fileRepository.DeleteFile(current)
+			})
+		})
+		return nil
+	}
+
+	if info.Size != file.Size {
+		c.addIssue(&FsckIssue{
+			Kind:   FsckSizeMismatch,
+			Owner:  file.Owner,
+			FID:    file.FID,
+			Key:    file.BlobKey(),
+			Detail: "recorded " + strconv.FormatInt(file.Size, 10) + ", stored " + strconv.FormatInt(info.Size, 10),
+		}, "fixed", func() error {
+			return c.repairFileContent(file, func(current *models.File, info *storage.ObjectInfo,
+				repos repository.DataRepository) error {
+				if info == nil || info.Size == current.Size {
+					return nil
+				}
+
+				fileRepository, err := repos.File()
+				if err != nil {
+					return err
+				}
+				return fileRepository.SetFileSize(current, info.Size)
+			})
+		})
+	}
+	return nil
+}
+
+//repairFileContent 在owner的锁中重新读取文件以及存储中的内容再修复，检查之后文件已经被删除或者内容已经被替换时不做修改，
+//内容不存在时info为空
+func (c *fsck) repairFileContent(file *models.File,
+	repair func(current *models.File, info *storage.ObjectInfo, repos repository.DataRepository) error) error {
+	return c.f.repairFile(file.Owner, func(repos repository.DataRepository) error {
+		fileRepository, err := repos.File()
+		if err != nil {
+			return err
+		}
+
+		current, err := fileRepository.GetTrashedOrFileByID(file.Owner, file.FID)
+		if err != nil {
+			return err
+		}
+
+		if current == nil || current.ID != file.ID || current.BlobKey() != file.BlobKey() || current.Size != file.Size {
+			return nil
+		}
+
+		info, err := c.f.storage.Stat(current.BlobKey())
+		if err == storage.ErrNotFound {
+			info, err = nil, nil
+		}
+		if err != nil {
+			return err
+		}
+		return repair(current, info, repos)
+	})
+}
+
+//checkVersions 检查历史版本的内容是否存在，隔离模式下不删除历史版本
+func (c *fsck) checkVersions() error {
+	versionRepository, err := c.f.dataContext.Version()
+	if err != nil {
+		return err
+	}
+
+	var lastID string
+	for {
+		versions, err := versionRepository.GetFileVersionsAfterID(lastID, fsckBatch)
+		if err != nil {
+			return err
+		}
+
+		for _, version := range versions {
+			lastID = version.ID
+			c.report.Versions++
+
+			_, err := c.f.storage.Stat(version.BlobKey())
+			if err == nil {
+				continue
+			}
+
+			if err != storage.ErrNotFound {
+				return err
+			}
+
+			issue := &FsckIssue{
+				Kind:      FsckMissingContent,
+				Owner:     version.Owner,
+				FID:       version.FID,
+				VersionID: version.ID,
+				Key:       version.BlobKey(),
+			}
+
+			if c.mode == FsckModeQuarantine {
+				c.addIssue(issue, "", nil)
+				continue
+			}
+
+			version := version
+			c.addIssue(issue, "deleted", func() error {
+				return c.f.repairFile(version.Owner, func(repos repository.DataRepository) error {
+					versionRepository, err := repos.Version()
+					if err != nil {
+						return err
+					}
+
+					//检查之后版本已经被删除、恢复或者内容已经存在时不做修改
+					current, err := versionRepository.GetFileVersion(version.Owner, version.FID, version.ID)
+					if err != nil || current == nil || current.BlobKey() != version.BlobKey() {
+						return err
+					}
+
+					_, err = c.f.storage.Stat(current.BlobKey())
+					if err != storage.ErrNotFound {
+						return err
+					}
+					return versionRepository.DeleteFileVersion(current)
+				})
+			})
+		}
+
+		if len(versions) < fsckBatch {
+			return nil
+		}
+	}
+}
+
+//checkDanglingFiles 检查父文件夹不存在的文件，修复时移动到lost+found文件夹
+func (c *fsck) checkDanglingFiles() error {
+	fileRepository, err := c.f.dataContext.File()
+	if err != nil {
+		return err
+	}
+
+	var lastID uint
+	for {
+		files, err := fileRepository.GetDanglingFiles(lastID, fsckBatch)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			lastID = file.ID
+			c.addIssue(&FsckIssue{
+				Kind:   FsckDanglingParent,
+				Owner:  file.Owner,
+				FID:    file.FID,
+				Detail: "parent " + file.PFID + " does not exist",
+			}, "moved to "+fsckLostAndFound, func() error {
+				return c.f.moveToLostAndFound(file.Owner, file.FID)
+			})
+		}
+
+		if len(files) < fsckBatch {
+			return nil
+		}
+	}
+}
+
+//checkMisplacedFiles 检查Directory与父文件夹路径不一致的文件，修复时同时修正所有子文件的路径，
+//父文件夹形成循环的文件无法到达根目录，修复时移动到lost+found文件夹
+func (c *fsck) checkMisplacedFiles() error {
+	fileRepository, err := c.f.dataContext.File()
+	if err != nil {
+		return err
+	}
+
+	var lastID uint
+	for {
+		files, err := fileRepository.GetMisplacedFiles(lastID, fsckBatch)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			lastID = file.ID
+			file := file
+			c.addIssue(&FsckIssue{
+				Kind:   FsckPathMismatch,
+				Owner:  file.Owner,
+				FID:    file.FID,
+				Detail: "directory " + file.Directory,
+			}, "fixed", func() error {
+				return c.f.fixFilePath(file.Owner, file.FID)
+			})
+		}
+
+		if len(files) < fsckBatch {
+			return nil
+		}
+	}
+}
+
+//repairFile 在owner的锁和事务中执行修复
+func (f *FileService) repairFile(owner string, repair func(repos repository.DataRepository) error) error {
+	f.namedLocker.Lock(owner)
+	defer f.namedLocker.UnLock(owner)
+
+	var commited = false
+	UOW, err := f.dataContext.Unit()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if !commited {
+			if err := UOW.Rollback(); err != nil {
+				log.Warn("msg", "rollback failed in FileService.repairFile", "error", err.Error())
+			}
+		}
+	}()
+
+	if err := repair(UOW); err != nil {
+		return err
+	}
+
+	if err := UOW.Commit(); err != nil {
+		return err
+	}
+	commited = true
+	f.notifyBlobReleased()
+	return nil
+}
+
+//moveToLostAndFound 将文件移动到owner根目录的lost+found文件夹中，存在同名文件时添加序号
+func (f *FileService) moveToLostAndFound(owner string, fid string) error {
+	lostAndFound, err := f.MakeDirectories(owner, fsckLostAndFound)
+	if err != nil {
+		return err
+	}
+
+	return f.repairFile(owner, func(repos repository.DataRepository) error {
+		fileRepository, err := repos.File()
+		if err != nil {
+			return err
+		}
+
+		file, err := fileRepository.GetFileByID(owner, fid)
+		if err != nil {
+			return err
+		}
+
+		if file == nil {
+			return NewPathError("fsck", fid, ErrFileNotFound)
+		}
+
+		file.PFID = lostAndFound.FID
+		file.Filename, err = f.availableFilename(file, fileRepository)
+		if err != nil {
+			return err
+		}
+
+		//先保存新的父文件夹以断开可能存在的循环，再修正子文件的路径
+		if err := fileRepository.UpdateFile(file); err != nil {
+			return err
+		}
+		return f.adjustFilePath(file, path.Join(lostAndFound.Directory, lostAndFound.Filename), fileRepository)
+	})
+}
+
+//fixFilePath 根据父文件夹链修正文件以及子文件的路径，父文件夹链无法到达根目录时移动到lost+found文件夹
+func (f *FileService) fixFilePath(owner string, fid string) error {
+	reachable := true
+	err := f.repairFile(owner, func(repos repository.DataRepository) error {
+		fileRepository, err := repos.File()
+		if err != nil {
+			return err
+		}
+
+		file, err := fileRepository.GetFileByID(owner, fid)
+		if err != nil {
+			return err
+		}
+
+		if file == nil {
+			return NewPathError("fsck", fid, ErrFileNotFound)
+		}
+
+		var directory string
+		directory, reachable, err = ancestorDirectory(file, fileRepository)
+		if err != nil || !reachable || directory == file.Directory {
+			return err
+		}
+		return f.adjustFilePath(file, directory, fileRepository)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if !reachable {
+		return f.moveToLostAndFound(owner, fid)
+	}
+	return nil
+}
+
+//ancestorDirectory 沿着父文件夹链计算文件的路径，父文件夹不存在或者形成循环时返回false
+func ancestorDirectory(file *models.File, repos repository.FileRepository) (string, bool, error) {
+	names := make([]string, 0)
+	visited := map[string]bool{file.FID: true}
+	for pfid := file.PFID; pfid != file.Owner; {
+		if visited[pfid] {
+			return "", false, nil
+		}
+		visited[pfid] = true
+
+		parent, err := repos.GetFileByID(file.Owner, pfid)
+		if err != nil {
+			return "", false, err
+		}
+
+		if parent == nil || !parent.IsDir {
+			return "", false, nil
+		}
+
+		names = append(names, parent.Filename)
+		pfid = parent.PFID
+	}
+
+	for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+		names[i], names[j] = names[j], names[i]
+	}
+	return path.Join(append([]string{"/"}, names...)...), true, nil
+}
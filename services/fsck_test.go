@@ -0,0 +1,174 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phantom-atom/file-explorer/models"
+	"github.com/phantom-atom/file-explorer/storage"
+)
+
+//putObject 在存储中写入对象，修改时间为modTime
+func (env *testEnv) putObject(key string, content string, modTime time.Time) {
+	if err := env.storage.Put(key, strings.NewReader(content), int64(len(content))); err != nil {
+		env.t.Fatalf("Put %s error: %v", key, err)
+	}
+	env.touchObject(key, modTime)
+}
+
+func (env *testEnv) touchObject(key string, modTime time.Time) {
+	p := filepath.Join(env.conf.FileService.FileAbsolutePath(), filepath.FromSlash(key))
+	if err := os.Chtimes(p, modTime, modTime); err != nil {
+		env.t.Fatalf("Chtimes %s error: %v", key, err)
+	}
+}
+
+func (env *testEnv) objectExists(key string) bool {
+	_, err := env.storage.Stat(key)
+	if err != nil && err != storage.ErrNotFound {
+		env.t.Fatalf("Stat %s error: %v", key, err)
+	}
+	return err == nil
+}
+
+func hashOf(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func blobKeyOf(content string) string {
+	return models.BlobKey(hashOf(content))
+}
+
+func findIssue(report *FsckReport, kind string, key string) *FsckIssue {
+	for _, issue := range report.Issues {
+		if issue.Kind == kind && issue.Key == key {
+			return issue
+		}
+	}
+	return nil
+}
+
+func TestFsckOrphanBlob(t *testing.T) {
+	for _, mode := range []string{FsckModeRepair, FsckModeQuarantine} {
+		mode := mode
+		t.Run(mode, func(t *testing.T) {
+			env := newTestEnv(t)
+			env.now = time.Now()
+			grace := env.conf.FileService.Fsck.GracePeriod
+
+			oldKey := blobKeyOf("old orphan")
+			env.putObject(oldKey, "old orphan", env.now.Add(-2*grace))
+			//宽限期之内的对象可能是正在上传的内容，还没有创建记录
+			newKey := blobKeyOf("new orphan")
+			env.putObject(newKey, "new orphan", env.now.Add(-grace/2))
+
+			report, err := env.files.Fsck(mode)
+			if err != nil {
+				t.Fatalf("Fsck error: %v", err)
+			}
+
+			if issue := findIssue(report, FsckOrphanBlob, oldKey); issue == nil || issue.Error != "" {
+				t.Errorf("orphan issue = %+v", issue)
+			}
+			if env.objectExists(oldKey) {
+				t.Errorf("orphan blob older than grace period is not removed")
+			}
+			if quarantined := env.objectExists(fsckQuarantinePrefix + oldKey); quarantined != (mode == FsckModeQuarantine) {
+				t.Errorf("quarantined = %v", quarantined)
+			}
+
+			if findIssue(report, FsckOrphanBlob, newKey) != nil || !env.objectExists(newKey) {
+				t.Errorf("orphan blob within grace period is touched")
+			}
+		})
+	}
+}
+
+func TestFsckQuarantineMissingContent(t *testing.T) {
+	env := newTestEnv(t)
+	owner := env.createUser("alice", 0).ID
+	file := env.upload(owner, "", "lost.txt", "lost content")
+
+	if err := env.storage.Delete(file.BlobKey()); err != nil {
+		t.Fatalf("Delete error: %v", err)
+	}
+
+	report, err := env.files.Fsck(FsckModeQuarantine)
+	if err != nil {
+		t.Fatalf("Fsck error: %v", err)
+	}
+
+	issue := findIssue(report, FsckMissingContent, file.BlobKey())
+	if issue == nil || issue.Action != "trashed" || issue.Error != "" {
+		t.Fatalf("missing content issue = %+v", issue)
+	}
+
+	//隔离模式下文件移入回收站，记录仍然保留
+	current := &models.File{}
+	if err := env.db.Unscoped().Where("fid = ?", file.FID).First(current).Error; err != nil {
+		t.Fatalf("file row is deleted: %v", err)
+	}
+	if current.DeletedAt == nil {
+		t.Errorf("file with missing content is not trashed")
+	}
+	if n := env.count(&models.TrashItem{}, "fid = ?", file.FID); n != 1 {
+		t.Errorf("trash items = %d, expected 1", n)
+	}
+}
+
+func TestFsckKeepsVersionBlob(t *testing.T) {
+	env := newTestEnv(t)
+	env.now = time.Now()
+	owner := env.createUser("alice", 0).ID
+
+	env.upload(owner, "", "a.txt", "version 1")
+	if _, err := env.files.CreateFileVersion(owner, "", "a.txt", 9, strings.NewReader("version 2"), nil); err != nil {
+		t.Fatalf("CreateFileVersion error: %v", err)
+	}
+
+	versionKey := blobKeyOf("version 1")
+	if n := env.count(&models.FileVersion{}, "owner = ?", owner); n != 1 {
+		t.Fatalf("versions = %d, expected 1", n)
+	}
+	env.touchObject(versionKey, env.now.Add(-2*env.conf.FileService.Fsck.GracePeriod))
+
+	//Blob记录丢失时只根据版本的引用重建记录，不能当作孤立对象删除
+	hash := filepath.Base(versionKey)
+	for _, lost := range []bool{false, true} {
+		if lost {
+			if err := env.db.Where("hash = ?", hash).Delete(&models.Blob{}).Error; err != nil {
+				t.Fatalf("delete blob error: %v", err)
+			}
+		}
+
+		report, err := env.files.Fsck(FsckModeRepair)
+		if err != nil {
+			t.Fatalf("Fsck error: %v", err)
+		}
+
+		if issue := findIssue(report, FsckOrphanBlob, versionKey); issue != nil {
+			t.Errorf("lost record %v: version blob reported as orphan: %+v", lost, issue)
+		}
+		if !env.objectExists(versionKey) {
+			t.Fatalf("lost record %v: version blob is removed", lost)
+		}
+
+		blob := &models.Blob{}
+		if err := env.db.Where("hash = ?", hash).First(blob).Error; err != nil {
+			t.Fatalf("lost record %v: blob record error: %v", lost, err)
+		}
+		if blob.RefCount != 1 {
+			t.Errorf("lost record %v: blob ref_count = %d, expected 1", lost, blob.RefCount)
+		}
+
+		if n := env.count(&models.FileVersion{}, "owner = ?", owner); n != 1 {
+			t.Errorf("lost record %v: versions = %d, expected 1", lost, n)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/phantom-atom/file-explorer/internal/log"
+	"github.com/phantom-atom/file-explorer/models"
+)
+
+var (
+	//ErrJobNotFound 任务不存在
+	ErrJobNotFound = errors.New("任务不存在")
+)
+
+//GetJob 获取后台任务，任务属于owner
+func (f *FileService) GetJob(owner string, id string) (*models.Job, error) {
+	if owner == "" {
+		return nil, invalidArgument("FileService", "owner", "GetJob")
+	}
+
+	if id == "" {
+		return nil, invalidArgument("FileService", "id", "GetJob")
+	}
+
+	jobRepository, err := f.dataContext.Job()
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := jobRepository.GetJob(owner, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if job == nil {
+		return nil, NewPathError("job", id, ErrJobNotFound)
+	}
+	return job, nil
+}
+
+//FailInterruptedJobs 将服务停止时还在运行的任务标记为失败
+func (f *FileService) FailInterruptedJobs() error {
+	jobRepository, err := f.dataContext.Job()
+	if err != nil {
+		return err
+	}
+	return jobRepository.FailRunningJobs("服务重启，任务被中断")
+}
+
+//reportJobProgress 增加任务已经处理的数量，每处理copyProgressInterval个文件保存一次进度
+func (f *FileService) reportJobProgress(job *models.Job) {
+	if job == nil {
+		return
+	}
+
+	job.Done++
+	if job.Done%copyProgressInterval == 0 {
+		f.saveJob(job)
+	}
+}
+
+//saveJob 在事务之外保存任务，使进度可以被立即查询
+func (f *FileService) saveJob(job *models.Job) {
+	jobRepository, err := f.dataContext.Job()
+	if err == nil {
+		err = jobRepository.UpdateJob(job)
+	}
+
+	if err != nil {
+		log.Error("msg", "occur a error when save job", "id", job.ID, "error", err.Error())
+	}
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/phantom-atom/file-explorer/models"
+	"github.com/phantom-atom/file-explorer/repository"
+)
+
+const (
+	//FileTypeFile 只列出文件
+	FileTypeFile = "file"
+	//FileTypeDirectory 只列出文件夹
+	FileTypeDirectory = "directory"
+)
+
+var (
+	//ErrInvalidCursor 分页游标无效
+	ErrInvalidCursor = errors.New("分页游标无效")
+)
+
+//FileListParams 文件夹列表参数，ParentID为空时列出根目录，
+//Cursor不为空时忽略Offset，Sort、Desc和DirsFirst必须与生成游标时相同
+type FileListParams struct {
+	ParentID  string
+	Type      string
+	Extension string
+	Category  string
+	Tag       string
+	Sort      string
+	Desc      bool
+	DirsFirst bool
+	Cursor    string
+	Limit     int
+	Offset    int
+}
+
+//FileList 文件夹列表，Total为符合条件的文件总数，NextCursor为空时没有下一页
+type FileList struct {
+	Files      []*models.File `json:"files"`
+	Total      int64          `json:"total"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+//fileCursor 序列化后的分页游标，包含排序参数以检查游标是否与请求匹配
+type fileCursor struct {
+	Sort      string          `json:"s"`
+	Desc      bool            `json:"o"`
+	DirsFirst bool            `json:"f"`
+	IsDir     bool            `json:"d"`
+	Value     json.RawMessage `json:"v"`
+	ID        uint            `json:"i"`
+}
+
+//ListFiles 列出owner文件夹中的文件，按照Sort排序，排序字段相同时按照创建顺序排序，
+//Limit不大于0时不限制数量
+func (f *FileService) ListFiles(owner string, params *FileListParams) (*FileList, error) {
+	if owner == "" {
+		return nil, invalidArgument("FileService", "owner", "ListFiles")
+	}
+
+	if params == nil {
+		return nil, invalidArgument("FileService", "params", "ListFiles")
+	}
+
+	parentID := params.ParentID
+	if parentID == "" {
+		parentID = owner
+	}
+
+	sort := params.Sort
+	if sort == "" {
+		sort = repository.FileSortName
+	}
+
+	fileRepository, err := f.dataContext.File()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := f.searchDirectory(owner, parentID, fileRepository); err != nil {
+		return nil, err
+	}
+
+	opts := &repository.FileSearchOptions{
+		Owner:     owner,
+		PFID:      parentID,
+		Extension: params.Extension,
+		Category:  params.Category,
+		Tag:       params.Tag,
+		Sort:      sort,
+		Desc:      params.Desc,
+		DirsFirst: params.DirsFirst,
+	}
+
+	switch params.Type {
+	case "":
+	case FileTypeFile:
+		isDir := false
+		opts.IsDir = &isDir
+	case FileTypeDirectory:
+		isDir := true
+		opts.IsDir = &isDir
+	default:
+		return nil, invalidArgument("FileService", "type", "ListFiles")
+	}
+
+	total, err := fileRepository.CountFiles(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.Cursor != "" {
+		opts.After, err = decodeFileCursor(params.Cursor, sort, params.Desc, params.DirsFirst)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		opts.Offset = params.Offset
+	}
+
+	//多查询一个文件用于判断是否还有下一页
+	if params.Limit > 0 {
+		opts.Limit = params.Limit + 1
+	}
+
+	files, err := fileRepository.SearchFiles(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &FileList{
+		Files: files,
+		Total: total,
+	}
+
+	if params.Limit > 0 && len(files) > params.Limit {
+		list.Files = files[:params.Limit]
+		list.NextCursor, err = encodeFileCursor(list.Files[params.Limit-1], sort, params.Desc, params.DirsFirst)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+
+//encodeFileCursor 将文件在排序中的位置编码为不透明的游标
+func encodeFileCursor(file *models.File, sort string, desc bool, dirsFirst bool) (string, error) {
+	var value interface{}
+	switch sort {
+	case repository.FileSortSize:
+		value = file.Size
+	case repository.FileSortCreatedAt:
+		value = file.CreatedAt
+	case repository.FileSortUpdatedAt:
+		value = file.UpdatedAt
+	default:
+		value = file.Filename
+	}
+
+	rawValue, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(&fileCursor{
+		Sort:      sort,
+		Desc:      desc,
+		DirsFirst: dirsFirst,
+		IsDir:     file.IsDir,
+		Value:     rawValue,
+		ID:        file.ID,
+	})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+//decodeFileCursor 解析游标，游标的排序参数与请求不一致时返回ErrInvalidCursor
+func decodeFileCursor(s string, sort string, desc bool, dirsFirst bool) (*repository.FileCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, NewPathError("list", s, ErrInvalidCursor)
+	}
+
+	cursor := &fileCursor{}
+	if err := json.Unmarshal(data, cursor); err != nil {
+		return nil, NewPathError("list", s, ErrInvalidCursor)
+	}
+
+	if cursor.Sort != sort || cursor.Desc != desc || cursor.DirsFirst != dirsFirst {
+		return nil, NewPathError("list", s, ErrInvalidCursor)
+	}
+
+	var value interface{}
+	switch sort {
+	case repository.FileSortSize:
+		var size int64
+		err = json.Unmarshal(cursor.Value, &size)
+		value = size
+	case repository.FileSortCreatedAt, repository.FileSortUpdatedAt:
+		var t time.Time
+		err = json.Unmarshal(cursor.Value, &t)
+		value = t
+	default:
+		var name string
+		err = json.Unmarshal(cursor.Value, &name)
+		value = name
+	}
+
+	if err != nil {
+		return nil, NewPathError("list", s, ErrInvalidCursor)
+	}
+
+	return &repository.FileCursor{
+		IsDir: cursor.IsDir,
+		Value: value,
+		ID:    cursor.ID,
+	}, nil
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/phantom-atom/file-explorer/repository"
+)
+
+//listAll 使用游标逐页列出文件夹，返回每一页的文件名
+func (env *testEnv) listAll(owner string, params FileListParams) [][]string {
+	pages := make([][]string, 0)
+	for {
+		list, err := env.files.ListFiles(owner, &params)
+		if err != nil {
+			env.t.Fatalf("ListFiles error: %v", err)
+		}
+
+		page := make([]string, 0, len(list.Files))
+		for _, file := range list.Files {
+			page = append(page, file.Filename)
+		}
+		pages = append(pages, page)
+
+		if list.NextCursor == "" {
+			return pages
+		}
+		if len(pages) > 100 {
+			env.t.Fatalf("ListFiles does not stop paging")
+		}
+		params.Cursor = list.NextCursor
+	}
+}
+
+func TestListFilesCursorEqualKeys(t *testing.T) {
+	env := newTestEnv(t)
+	owner := env.createUser("alice", 0).ID
+
+	//所有文件的大小和创建时间都相同，只能依靠id区分顺序
+	expected := make([]string, 0)
+	for i := 0; i < 7; i++ {
+		name := fmt.Sprintf("file-%d.txt", i)
+		env.upload(owner, "", name, "same")
+		expected = append(expected, name)
+	}
+	env.mkdir(owner, "", "dir-a")
+	env.mkdir(owner, "", "dir-b")
+
+	cases := []struct {
+		sort      string
+		desc      bool
+		dirsFirst bool
+	}{
+		{repository.FileSortSize, false, false},
+		{repository.FileSortSize, true, false},
+		{repository.FileSortCreatedAt, false, false},
+		{repository.FileSortCreatedAt, true, true},
+		{repository.FileSortUpdatedAt, false, true},
+	}
+
+	for _, c := range cases {
+		params := FileListParams{Type: FileTypeFile, Sort: c.sort, Desc: c.desc, DirsFirst: c.dirsFirst, Limit: 3}
+		pages := env.listAll(owner, params)
+
+		names := make([]string, 0)
+		for _, page := range pages {
+			names = append(names, page...)
+		}
+
+		order := expected
+		if c.desc {
+			order = make([]string, 0, len(expected))
+			for i := len(expected) - 1; i >= 0; i-- {
+				order = append(order, expected[i])
+			}
+		}
+
+		if len(pages) != 3 || fmt.Sprint(names) != fmt.Sprint(order) {
+			t.Errorf("sort %s desc %v: pages = %v, expected %v in 3 pages", c.sort, c.desc, pages, order)
+		}
+	}
+
+	//文件夹优先时文件夹和文件的分界处也不能重复或者遗漏
+	pages := env.listAll(owner, FileListParams{Sort: repository.FileSortSize, DirsFirst: true, Limit: 2})
+	names := make([]string, 0)
+	for _, page := range pages {
+		names = append(names, page...)
+	}
+	if fmt.Sprint(names) != fmt.Sprint(append([]string{"dir-a", "dir-b"}, expected...)) {
+		t.Errorf("dirs first pages = %v", pages)
+	}
+}
+
+func TestListFilesCursorMismatch(t *testing.T) {
+	env := newTestEnv(t)
+	owner := env.createUser("alice", 0).ID
+	env.upload(owner, "", "a.txt", "a")
+	env.upload(owner, "", "b.txt", "b")
+
+	list, err := env.files.ListFiles(owner, &FileListParams{Sort: repository.FileSortSize, Limit: 1})
+	if err != nil || list.NextCursor == "" {
+		t.Fatalf("ListFiles = %+v, %v", list, err)
+	}
+
+	//游标只能用于生成它的排序方式
+	_, err = env.files.ListFiles(owner, &FileListParams{Sort: repository.FileSortName, Limit: 1, Cursor: list.NextCursor})
+	if causeOf(err) != ErrInvalidCursor {
+		t.Errorf("ListFiles with cursor of other sort error = %v, expected %v", err, ErrInvalidCursor)
+	}
+
+	_, err = env.files.ListFiles(owner, &FileListParams{Sort: repository.FileSortSize, Limit: 1, Cursor: "not a cursor"})
+	if causeOf(err) != ErrInvalidCursor {
+		t.Errorf("ListFiles with malformed cursor error = %v, expected %v", err, ErrInvalidCursor)
+	}
+}
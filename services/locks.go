@@ -0,0 +1,183 @@
+package services
+
+import (
+	"errors"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/phantom-atom/file-explorer/models"
+	"golang.org/x/net/webdav"
+)
+
+const (
+	//lockIdleTimeout 没有有效锁并且超过这个时间没有使用的锁表会被回收
+	lockIdleTimeout = 10 * time.Minute
+	//lockInfiniteTimeout webdav.LockDetails中表示永不过期的Duration
+	lockInfiniteTimeout = -1
+)
+
+var (
+	//ErrFileLocked 文件被WebDAV客户端锁定
+	ErrFileLocked = errors.New("文件已被锁定")
+)
+
+//lockService 所有用户的WebDAV锁表，WebDAV处理器通过FileService.LockSystem使用，
+//REST API修改文件之前检查文件是否被锁定，长时间不用的锁表被回收
+type lockService struct {
+	mux       sync.Mutex
+	tables    map[string]*lockTable
+	lastSweep time.Time
+}
+
+func newLockService() *lockService {
+	return &lockService{
+		tables: make(map[string]*lockTable),
+	}
+}
+
+//lockTable 一个用户的锁表，记录有效的锁以便判断锁表是否为空
+type lockTable struct {
+	webdav.LockSystem
+
+	mux      sync.Mutex
+	expires  map[string]time.Time
+	lastUsed time.Time
+}
+
+//table 获取owner的锁表，同时回收其它空闲的锁表
+func (l *lockService) table(owner string, now time.Time) *lockTable {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if now.Sub(l.lastSweep) > lockIdleTimeout {
+		l.lastSweep = now
+		for key, table := range l.tables {
+			if key != owner && table.idle(now) {
+				delete(l.tables, key)
+			}
+		}
+	}
+
+	table, ok := l.tables[owner]
+	if !ok {
+		table = &lockTable{
+			LockSystem: webdav.NewMemLS(),
+			expires:    make(map[string]time.Time),
+		}
+		l.tables[owner] = table
+	}
+
+	table.mux.Lock()
+	table.lastUsed = now
+	table.mux.Unlock()
+	return table
+}
+
+//check 检查owner的文件p是否被锁定，recursive为true时同时检查子文件，锁表为空时不创建锁表
+func (l *lockService) check(owner string, p string, recursive bool, now time.Time) error {
+	l.mux.Lock()
+	table, ok := l.tables[owner]
+	l.mux.Unlock()
+
+	if !ok || !table.locked(now) {
+		return nil
+	}
+
+	//与webdav.Handler确认没有If请求头的请求的方式相同，创建一个临时锁，创建失败说明已经被锁定
+	token, err := table.Create(now, webdav.LockDetails{
+		Root:      p,
+		Duration:  lockInfiniteTimeout,
+		ZeroDepth: !recursive,
+	})
+	if err == webdav.ErrLocked {
+		return NewPathError("lock", p, ErrFileLocked)
+	}
+	if err != nil {
+		return err
+	}
+	return table.Unlock(now, token)
+}
+
+func (t *lockTable) Create(now time.Time, details webdav.LockDetails) (string, error) {
+	token, err := t.LockSystem.Create(now, details)
+	if err == nil {
+		t.mux.Lock()
+		t.expires[token] = lockExpiry(now, details.Duration)
+		t.mux.Unlock()
+	}
+	return token, err
+}
+
+func (t *lockTable) Refresh(now time.Time, token string, duration time.Duration) (webdav.LockDetails, error) {
+	details, err := t.LockSystem.Refresh(now, token, duration)
+	if err == nil {
+		t.mux.Lock()
+		t.expires[token] = lockExpiry(now, duration)
+		t.mux.Unlock()
+	}
+	return details, err
+}
+
+func (t *lockTable) Unlock(now time.Time, token string) error {
+	err := t.LockSystem.Unlock(now, token)
+	if err == nil || err == webdav.ErrNoSuchLock {
+		t.mux.Lock()
+		delete(t.expires, token)
+		t.mux.Unlock()
+	}
+	return err
+}
+
+//locked 是否还有没有过期的锁
+func (t *lockTable) locked(now time.Time) bool {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	for token, expiry := range t.expires {
+		if expiry.IsZero() || expiry.After(now) {
+			return true
+		}
+		delete(t.expires, token)
+	}
+	return false
+}
+
+func (t *lockTable) idle(now time.Time) bool {
+	if t.locked(now) {
+		return false
+	}
+
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	return now.Sub(t.lastUsed) > lockIdleTimeout
+}
+
+//lockExpiry 锁的过期时间，永不过期时为零值
+func lockExpiry(now time.Time, duration time.Duration) time.Time {
+	if duration < 0 {
+		return time.Time{}
+	}
+	return now.Add(duration)
+}
+
+//LockSystem 获取owner的WebDAV锁表，REST API修改被锁定的文件时返回ErrFileLocked
+func (f *FileService) LockSystem(owner string) webdav.LockSystem {
+	return f.locks.table(owner, f.now())
+}
+
+//WithLocksConfirmed 返回不检查WebDAV锁的FileService，用于已经由webdav.Handler根据If请求头确认过锁的请求，
+//其它状态与f共享
+func (f *FileService) WithLocksConfirmed() *FileService {
+	service := *f
+	service.locksConfirmed = true
+	return &service
+}
+
+//checkUnlocked 检查文件没有被WebDAV客户端锁定，文件夹同时检查子文件
+func (f *FileService) checkUnlocked(file *models.File) error {
+	if f.locksConfirmed || f.locks == nil {
+		return nil
+	}
+	return f.locks.check(file.Owner, path.Join(file.Directory, file.Filename), file.IsDir, f.now())
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestLockServiceCheck(t *testing.T) {
+	locks := newLockService()
+	now := time.Unix(1600000000, 0)
+
+	if err := locks.check("owner", "/docs/a.txt", false, now); err != nil {
+		t.Fatalf("check without locks error: %v", err)
+	}
+
+	table := locks.table("owner", now)
+	token, err := table.Create(now, webdav.LockDetails{
+		Root:     "/docs/a.txt",
+		Duration: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("Create error: %v", err)
+	}
+
+	cases := []struct {
+		owner     string
+		path      string
+		recursive bool
+		locked    bool
+	}{
+		{"owner", "/docs/a.txt", false, true},
+		{"owner", "/docs", true, true},
+		{"owner", "/docs", false, false},
+		{"owner", "/docs/b.txt", false, false},
+		{"other", "/docs/a.txt", false, false},
+	}
+
+	for _, c := range cases {
+		err := locks.check(c.owner, c.path, c.recursive, now)
+		if locked := isFileLocked(err); locked != c.locked {
+			t.Errorf("check(%s, %s, %v) = %v, expected locked %v", c.owner, c.path, c.recursive, err, c.locked)
+		}
+	}
+
+	if err := locks.check("owner", "/docs/a.txt", false, now.Add(2*time.Minute)); err != nil {
+		t.Errorf("check after expiry error: %v", err)
+	}
+
+	if err := table.Unlock(now, token); err != nil && err != webdav.ErrNoSuchLock {
+		t.Fatalf("Unlock error: %v", err)
+	}
+	if err := locks.check("owner", "/docs/a.txt", false, now); err != nil {
+		t.Errorf("check after unlock error: %v", err)
+	}
+}
+
+func TestLockServiceEvictsIdleTables(t *testing.T) {
+	locks := newLockService()
+	now := time.Unix(1600000000, 0)
+
+	locks.table("idle", now)
+	held := locks.table("held", now)
+	if _, err := held.Create(now, webdav.LockDetails{Root: "/a", Duration: -1}); err != nil {
+		t.Fatalf("Create error: %v", err)
+	}
+
+	locks.table("owner", now.Add(2*lockIdleTimeout))
+	if _, ok := locks.tables["idle"]; ok {
+		t.Error("idle lock table was not evicted")
+	}
+	if _, ok := locks.tables["held"]; !ok {
+		t.Error("lock table with an active lock was evicted")
+	}
+}
+
+func isFileLocked(err error) bool {
+	pathErr, ok := err.(*PathError)
+	return ok && pathErr.Err == ErrFileLocked
+}
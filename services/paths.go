@@ -0,0 +1,297 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/phantom-atom/file-explorer/internal/log"
+	"github.com/phantom-atom/file-explorer/models"
+	"github.com/phantom-atom/file-explorer/repository"
+)
+
+var (
+	//ErrRootDirectory 不能对根目录执行该操作
+	ErrRootDirectory = errors.New("不能对根目录执行该操作")
+	//ErrMoveIntoItself 文件夹不能移动到自身或者子文件夹中
+	ErrMoveIntoItself = errors.New("不能移动到自身或子文件夹中")
+)
+
+//cleanPath 将请求中的路径转换为以/开头、不包含.和..的绝对路径
+func cleanPath(p string) string {
+	return path.Clean("/" + p)
+}
+
+//rootDirectory 表示owner根目录的文件夹，根目录没有对应的记录，FID为owner
+func rootDirectory(owner string) *models.File {
+	return &models.File{
+		FID:       owner,
+		Owner:     owner,
+		IsDir:     true,
+		Directory: "/",
+	}
+}
+
+//GetFileByPath 根据路径获取文件，文件属于owner，路径为/时返回根目录
+func (f *FileService) GetFileByPath(owner string, p string) (*models.File, error) {
+	if owner == "" {
+		return nil, invalidArgument("FileService", "owner", "GetFileByPath")
+	}
+
+	fileRepository, err := f.dataContext.File()
+	if err != nil {
+		return nil, err
+	}
+
+	p = cleanPath(p)
+	file, err := f.getFileByPath(owner, p, fileRepository)
+	if err != nil {
+		return nil, err
+	}
+
+	if file == nil {
+		return nil, NewPathError("stat", p, ErrFileNotFound)
+	}
+	return file, nil
+}
+
+//getFileByPath 使用一次查询获取路径对应的文件，p需要是cleanPath处理后的路径
+func (f *FileService) getFileByPath(owner string, p string,
+	repos repository.FileRepository) (*models.File, error) {
+	if p == "/" {
+		return rootDirectory(owner), nil
+	}
+	return repos.GetFileByPath(owner, path.Dir(p), path.Base(p))
+}
+
+//CreateFileByPath 上传文件到路径，父文件夹需要已经存在，存在同名文件时原内容保存为历史版本
+func (f *FileService) CreateFileByPath(owner string, p string, size int64,
+	file io.Reader, expected *Digest) (*models.File, error) {
+	if owner == "" {
+		return nil, invalidArgument("FileService", "owner", "CreateFileByPath")
+	}
+
+	p = cleanPath(p)
+	if p == "/" {
+		return nil, NewPathError("upload", p, ErrRootDirectory)
+	}
+
+	parent, err := f.GetFileByPath(owner, path.Dir(p))
+	if err != nil {
+		if pathErr, ok := err.(*PathError); ok && pathErr.Err == ErrFileNotFound {
+			return nil, NewPathError("upload", path.Dir(p), ErrDirectoryNotFound)
+		}
+		return nil, err
+	}
+
+	if !parent.IsDir {
+		return nil, NewPathError("upload", path.Dir(p), ErrParentNotADirectory)
+	}
+	return f.CreateFileVersion(owner, parent.FID, path.Base(p), size, file, expected)
+}
+
+//MakeDirectories 创建路径中所有不存在的文件夹，返回路径对应的文件夹
+func (f *FileService) MakeDirectories(owner string, p string) (*models.File, error) {
+	if owner == "" {
+		return nil, invalidArgument("FileService", "owner", "MakeDirectories")
+	}
+
+	p = cleanPath(p)
+	if p == "/" {
+		return rootDirectory(owner), nil
+	}
+
+	f.namedLocker.Lock(owner)
+	defer f.namedLocker.UnLock(owner)
+
+	var commited = false
+	UOW, err := f.dataContext.Unit()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if !commited {
+			if err := UOW.Rollback(); err != nil {
+				log.Warn("msg", "rollback failed in FileService.MakeDirectories", "error", err.Error())
+			}
+		}
+	}()
+
+	fileRepository, err := UOW.File()
+	if err != nil {
+		return nil, err
+	}
+
+	//文件夹已经存在时只需要一次查询
+	directory, err := f.getFileByPath(owner, p, fileRepository)
+	if err != nil {
+		return nil, err
+	}
+
+	if directory != nil {
+		if !directory.IsDir {
+			return nil, NewPathError("mkdir", p, ErrParentNotADirectory)
+		}
+		return directory, nil
+	}
+
+	directory = rootDirectory(owner)
+	for _, name := range strings.Split(strings.TrimPrefix(p, "/"), "/") {
+		file, err := fileRepository.GetFileByPFIDAndName(owner, directory.FID, name)
+		if err != nil {
+			return nil, err
+		}
+
+		if file == nil {
+			fid := f.uuid()
+			if fid == "" {
+				return nil, errors.New("FileService: cannot create uuid in MakeDirectories")
+			}
+
+			file = &models.File{
+				FID:       fid,
+				Owner:     owner,
+				IsDir:     true,
+				Directory: path.Join(directory.Directory, directory.Filename),
+				Filename:  name,
+				PFID:      directory.FID,
+			}
+			if err := fileRepository.CreateFile(file); err != nil {
+				return nil, err
+			}
+
+			if err := f.recordFileActivity(UOW, models.ActivityFileCreated, file, "", ""); err != nil {
+				return nil, err
+			}
+
+			if err := f.publishFileEvent(UOW, models.EventFileCreated, file, ""); err != nil {
+				return nil, err
+			}
+		} else if !file.IsDir {
+			return nil, NewPathError("mkdir", path.Join(file.Directory, file.Filename), ErrParentNotADirectory)
+		}
+		directory = file
+	}
+
+	if err := UOW.Commit(); err != nil {
+		return nil, err
+	}
+	commited = true
+	return directory, nil
+}
+
+//DeleteFileByPath 删除路径对应的文件，文件及其子文件会被移入回收站
+func (f *FileService) DeleteFileByPath(owner string, p string) error {
+	if owner == "" {
+		return invalidArgument("FileService", "owner", "DeleteFileByPath")
+	}
+
+	p = cleanPath(p)
+	if p == "/" {
+		return NewPathError("delete", p, ErrRootDirectory)
+	}
+
+	file, err := f.GetFileByPath(owner, p)
+	if err != nil {
+		return err
+	}
+	return f.DeleteFile(owner, file.FID)
+}
+
+//RenameFileByPath 将文件移动到newPath，可以同时修改所在文件夹和名称，newPath的父文件夹需要已经存在
+func (f *FileService) RenameFileByPath(owner string, oldPath string, newPath string) error {
+	if owner == "" {
+		return invalidArgument("FileService", "owner", "RenameFileByPath")
+	}
+
+	oldPath = cleanPath(oldPath)
+	newPath = cleanPath(newPath)
+	if oldPath == "/" || newPath == "/" {
+		return NewPathError("move", "/", ErrRootDirectory)
+	}
+
+	if oldPath == newPath {
+		return nil
+	}
+
+	if strings.HasPrefix(newPath, oldPath+"/") {
+		return NewPathError("move", oldPath, ErrMoveIntoItself)
+	}
+
+	f.namedLocker.Lock(owner)
+	defer f.namedLocker.UnLock(owner)
+
+	var commited = false
+	UOW, err := f.dataContext.Unit()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if !commited {
+			if err := UOW.Rollback(); err != nil {
+				log.Warn("msg", "rollback failed in FileService.RenameFileByPath", "error", err.Error())
+			}
+		}
+	}()
+
+	fileRepository, err := UOW.File()
+	if err != nil {
+		return err
+	}
+
+	file, err := f.getFileByPath(owner, oldPath, fileRepository)
+	if err != nil {
+		return err
+	}
+
+	if file == nil {
+		return NewPathError("move", oldPath, ErrFileNotFound)
+	}
+
+	if err := f.checkUnlocked(file); err != nil {
+		return err
+	}
+
+	parent, err := f.getFileByPath(owner, path.Dir(newPath), fileRepository)
+	if err != nil {
+		return err
+	}
+
+	if parent == nil || !parent.IsDir {
+		return NewPathError("move", path.Dir(newPath), ErrParentNotADirectory)
+	}
+
+	newName := path.Base(newPath)
+	event := models.EventFileMoved
+	oldValue, newValue := oldPath, newPath
+	if parent.FID == file.PFID {
+		event = models.EventFileRenamed
+		oldValue, newValue = file.Filename, newName
+		err = f.rename(file, newName, fileRepository)
+	} else {
+		if !file.IsDir && !sameExtension(file.Filename, newName) {
+			file.ContentType = f.contentTypeOf(newName, file.BlobKey(), file.Size)
+		}
+		file.Filename = newName
+		err = f.move(file, parent.FID, fileRepository)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := f.recordFileActivity(UOW, event, file, oldValue, newValue); err != nil {
+		return err
+	}
+
+	if err := f.publishFileEvent(UOW, event, file, oldPath); err != nil {
+		return err
+	}
+
+	if err := UOW.Commit(); err != nil {
+		return err
+	}
+	commited = true
+	return nil
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"errors"
+	"io"
+
+	"github.com/phantom-atom/file-explorer/models"
+	"github.com/phantom-atom/file-explorer/repository"
+)
+
+var (
+	//ErrQuotaExceeded 存储空间不足
+	ErrQuotaExceeded = errors.New("存储空间不足")
+)
+
+//Usage 用户存储空间使用情况，Total为0时不限制
+type Usage struct {
+	Used  int64 `json:"used"`
+	Total int64 `json:"total"`
+}
+
+//GetUsage 获取用户已使用的存储空间以及配额
+func (f *FileService) GetUsage(owner string) (*Usage, error) {
+	if owner == "" {
+		return nil, invalidArgument("FileService", "owner", "GetUsage")
+	}
+
+	userRepository, err := f.dataContext.User()
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := userRepository.GetUser(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, NewUserError("usage", ErrUserNotFound)
+	}
+
+	return &Usage{
+		Used:  user.UsedBytes,
+		Total: f.userQuota(user),
+	}, nil
+}
+
+//userQuota 用户的配额，用户未设置时使用全局默认配额，0为不限制
+func (f *FileService) userQuota(user *models.User) int64 {
+	if user.Quota > 0 {
+		return user.Quota
+	}
+	return f.config().FileService.DefaultQuota
+}
+
+//checkQuota 检查owner是否还有size大小的存储空间
+func (f *FileService) checkQuota(op string, owner string, name string, size int64) error {
+	userRepository, err := f.dataContext.User()
+	if err != nil {
+		return err
+	}
+	return f.checkQuotaIn(op, owner, name, size, userRepository)
+}
+
+//limitToQuota 写入内容之前检查配额，size为-1时大小未知，返回的Reader读取超过剩余空间时返回ErrQuotaExceeded，
+//使大小未知或者与声明不符的上传在写入磁盘的过程中被拒绝
+func (f *FileService) limitToQuota(op string, owner string, name string, size int64, r io.Reader) (io.Reader, error) {
+	userRepository, err := f.dataContext.User()
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := userRepository.GetUser(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return r, nil
+	}
+
+	quota := f.userQuota(user)
+	if quota <= 0 {
+		return r, nil
+	}
+
+	remaining := quota - user.UsedBytes
+	if remaining < 0 || size > remaining {
+		return nil, NewPathError(op, name, ErrQuotaExceeded)
+	}
+
+	return &quotaReader{
+		r:         r,
+		remaining: remaining,
+		err:       NewPathError(op, name, ErrQuotaExceeded),
+	}, nil
+}
+
+//quotaReader 读取的字节数超过remaining时返回err
+type quotaReader struct {
+	r         io.Reader
+	remaining int64
+	exceeded  bool
+	err       error
+}
+
+func (q *quotaReader) Read(p []byte) (int, error) {
+	if q.exceeded {
+		return 0, q.err
+	}
+
+	//多读取一个字节用于判断是否超出
+	if int64(len(p)) > q.remaining+1 {
+		p = p[:q.remaining+1]
+	}
+
+	n, err := q.r.Read(p)
+	if int64(n) > q.remaining {
+		q.exceeded = true
+		return 0, q.err
+	}
+	q.remaining -= int64(n)
+	return n, err
+}
+
+//checkQuotaIn 与checkQuota相同，使用事务中的仓库时可以包含事务中已经增加的用量
+func (f *FileService) checkQuotaIn(op string, owner string, name string, size int64,
+	repos repository.UserRepository) error {
+	user, err := repos.GetUser(owner)
+	if err != nil {
+		return err
+	}
+
+	if user == nil {
+		return nil
+	}
+
+	quota := f.userQuota(user)
+	if quota > 0 && user.UsedBytes+size > quota {
+		return NewPathError(op, name, ErrQuotaExceeded)
+	}
+	return nil
+}
+
+//RecountUsage 重新统计所有用户已使用的存储空间，用于初始化以及修正计数，
+//会覆盖并发修改的计数，只能在没有其它实例运行时调用
+func (f *FileService) RecountUsage() error {
+	userRepository, err := f.dataContext.User()
+	if err != nil {
+		return err
+	}
+	return userRepository.RecountUsedBytes()
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUsageAccounting(t *testing.T) {
+	env := newTestEnv(t)
+	owner := env.createUser("alice", 0).ID
+
+	expectUsed := func(step string, expected int64) {
+		t.Helper()
+		if used := env.usedBytes(owner); used != expected {
+			t.Fatalf("%s: used_bytes = %d, expected %d", step, used, expected)
+		}
+	}
+
+	file := env.upload(owner, "", "a.txt", "0123456789")
+	env.upload(owner, "", "b.txt", "01234")
+	expectUsed("upload", 15)
+
+	//回收站中的文件仍然占用空间
+	if err := env.files.DeleteFile(owner, file.FID); err != nil {
+		t.Fatalf("DeleteFile error: %v", err)
+	}
+	expectUsed("trash", 15)
+
+	items, err := env.files.GetTrashItems(owner, 0, 0)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("GetTrashItems = %d items, %v", len(items), err)
+	}
+	if _, err := env.files.RestoreTrashItem(owner, items[0].ID); err != nil {
+		t.Fatalf("RestoreTrashItem error: %v", err)
+	}
+	expectUsed("restore", 15)
+
+	//新版本占用新内容的空间，旧内容作为历史版本继续占用空间
+	if _, err := env.files.CreateFileVersion(owner, "", "a.txt", 3, strings.NewReader("abc"), nil); err != nil {
+		t.Fatalf("CreateFileVersion error: %v", err)
+	}
+	expectUsed("create version", 18)
+
+	versions, err := env.files.GetFileVersions(owner, file.FID)
+	if err != nil || len(versions) != 1 {
+		t.Fatalf("GetFileVersions = %d versions, %v", len(versions), err)
+	}
+	if err := env.files.DeleteFileVersion(owner, file.FID, versions[0].ID); err != nil {
+		t.Fatalf("DeleteFileVersion error: %v", err)
+	}
+	expectUsed("delete version", 8)
+
+	if err := env.files.DeleteFile(owner, file.FID); err != nil {
+		t.Fatalf("DeleteFile error: %v", err)
+	}
+	items, err = env.files.GetTrashItems(owner, 0, 0)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("GetTrashItems = %d items, %v", len(items), err)
+	}
+	if err := env.files.DeleteTrashItem(owner, items[0].ID); err != nil {
+		t.Fatalf("DeleteTrashItem error: %v", err)
+	}
+	expectUsed("purge", 5)
+
+	//增量维护的结果应当和重新统计的结果一致
+	if err := env.files.RecountUsage(); err != nil {
+		t.Fatalf("RecountUsage error: %v", err)
+	}
+	expectUsed("recount", 5)
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"path"
+	"time"
+
+	"github.com/phantom-atom/file-explorer/models"
+	"github.com/phantom-atom/file-explorer/repository"
+)
+
+const searchDefaultLimit = 100
+
+//FileSearchParams 文件搜索参数，零值的条件不生效
+type FileSearchParams struct {
+	Keyword       string
+	Match         string
+	DirectoryID   string
+	ParentID      string
+	IsDir         *bool
+	MinSize       int64
+	MaxSize       int64
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+	Extension     string
+	Category      string
+	Tag           string
+	Sort          string
+	Desc          bool
+	Limit         int
+	Offset        int
+}
+
+//SearchFiles 在owner的文件中搜索，DirectoryID不为空时只搜索该文件夹及其子文件夹，
+//ParentID不为空时只搜索该文件夹中的文件，不指定数量时只有按照ParentID列出文件时不限制数量
+func (f *FileService) SearchFiles(owner string, params *FileSearchParams) ([]*models.File, error) {
+	if owner == "" {
+		return nil, invalidArgument("FileService", "owner", "SearchFiles")
+	}
+
+	if params == nil {
+		return nil, invalidArgument("FileService", "params", "SearchFiles")
+	}
+
+	fileRepository, err := f.dataContext.File()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &repository.FileSearchOptions{
+		Owner:         owner,
+		Keyword:       params.Keyword,
+		Match:         params.Match,
+		IsDir:         params.IsDir,
+		MinSize:       params.MinSize,
+		MaxSize:       params.MaxSize,
+		CreatedAfter:  params.CreatedAfter,
+		CreatedBefore: params.CreatedBefore,
+		UpdatedAfter:  params.UpdatedAfter,
+		UpdatedBefore: params.UpdatedBefore,
+		Extension:     params.Extension,
+		Category:      params.Category,
+		Tag:           params.Tag,
+		Sort:          params.Sort,
+		Desc:          params.Desc,
+		Limit:         params.Limit,
+		Offset:        params.Offset,
+	}
+
+	if opts.Limit <= 0 && params.ParentID == "" {
+		opts.Limit = searchDefaultLimit
+	}
+
+	if params.ParentID != "" {
+		if _, err := f.searchDirectory(owner, params.ParentID, fileRepository); err != nil {
+			return nil, err
+		}
+		opts.PFID = params.ParentID
+	}
+
+	if params.DirectoryID != "" {
+		directory, err := f.searchDirectory(owner, params.DirectoryID, fileRepository)
+		if err != nil {
+			return nil, err
+		}
+
+		if directory != nil {
+			opts.Directory = path.Join(directory.Directory, directory.Filename)
+		}
+	}
+
+	return fileRepository.SearchFiles(opts)
+}
+
+//searchDirectory 获取owner的文件夹，id为owner时是根目录，返回nil
+func (f *FileService) searchDirectory(owner string, id string,
+	repos repository.FileRepository) (*models.File, error) {
+	if id == owner {
+		return nil, nil
+	}
+
+	directory, err := repos.GetFileByID(owner, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if directory == nil {
+		return nil, NewPathError("search", id, ErrDirectoryNotFound)
+	}
+
+	if !directory.IsDir {
+		return nil, NewPathError("search", id, ErrParentNotADirectory)
+	}
+	return directory, nil
+}
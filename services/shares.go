@@ -0,0 +1,409 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/phantom-atom/file-explorer/internal/log"
+	"github.com/phantom-atom/file-explorer/internal/utils/password"
+	"github.com/phantom-atom/file-explorer/internal/utils/random"
+	"github.com/phantom-atom/file-explorer/models"
+	"github.com/phantom-atom/file-explorer/repository"
+)
+
+const shareCodeLength = 8
+
+//ShareParams 文件分享参数
+type ShareParams struct {
+	Password     string        `json:"password"`      //访问密码，空为不需要密码
+	Expiration   time.Duration `json:"expiration"`    //有效时长，0为永久有效
+	MaxDownloads int           `json:"max_downloads"` //最大下载次数，0为不限制
+}
+
+//CreateShare 为文件或文件夹创建分享码，文件属于owner，编号为fid
+func (f *FileService) CreateShare(owner string, fid string, params *ShareParams) (*models.Share, error) {
+	if owner == "" {
+		return nil, invalidArgument("FileService", "owner", "CreateShare")
+	}
+
+	if fid == "" {
+		return nil, invalidArgument("FileService", "fid", "CreateShare")
+	}
+
+	if params == nil {
+		params = &ShareParams{}
+	}
+
+	if params.Expiration < 0 || params.MaxDownloads < 0 {
+		return nil, invalidArgument("FileService", "params", "CreateShare")
+	}
+
+	fileRepository, err := f.dataContext.File()
+	if err != nil {
+		return nil, err
+	}
+
+	shareRepository, err := f.dataContext.Share()
+	if err != nil {
+		return nil, err
+	}
+
+	sharedFile, err := fileRepository.GetFileByID(owner, fid)
+	if err != nil {
+		return nil, err
+	}
+
+	if sharedFile == nil {
+		return nil, NewPathError("share", fid, ErrFileNotFound)
+	}
+
+	code := random.AlphanumericString(shareCodeLength)
+	if code == "" {
+		return nil, errors.New("FileService: cannot create share code in CreateShare")
+	}
+
+	share := &models.Share{
+		Code:         code,
+		Owner:        owner,
+		FID:          fid,
+		MaxDownloads: params.MaxDownloads,
+	}
+
+	if params.Password != "" {
+		share.Password = password.CreateHashPassword(params.Password)
+		share.HasPassword = true
+	}
+
+	if params.Expiration > 0 {
+		expiresAt := f.now().Add(params.Expiration)
+		share.ExpiresAt = &expiresAt
+	}
+
+	var commited = false
+	UOW, err := f.dataContext.Unit()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if !commited {
+			if err := UOW.Rollback(); err != nil {
+				log.Warn("msg", "rollback failed in FileService.CreateShare", "error", err.Error())
+			}
+		}
+	}()
+
+	shareRepository, err = UOW.Share()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := shareRepository.CreateShare(share); err != nil {
+		return nil, err
+	}
+
+	if err := f.recordFileActivity(UOW, models.ActivityShareCreated, sharedFile, "", share.Code); err != nil {
+		return nil, err
+	}
+
+	if err := UOW.Commit(); err != nil {
+		return nil, err
+	}
+	commited = true
+	return share, nil
+}
+
+//GetSharesByFID 获取文件的所有分享码，文件属于owner，编号为fid
+func (f *FileService) GetSharesByFID(owner string, fid string) ([]*models.Share, error) {
+	if owner == "" {
+		return nil, invalidArgument("FileService", "owner", "GetSharesByFID")
+	}
+
+	if fid == "" {
+		return nil, invalidArgument("FileService", "fid", "GetSharesByFID")
+	}
+
+	shareRepository, err := f.dataContext.Share()
+	if err != nil {
+		return nil, err
+	}
+
+	return shareRepository.GetSharesByFID(owner, fid)
+}
+
+//RevokeShare 撤销分享码，分享属于owner
+func (f *FileService) RevokeShare(owner string, code string) error {
+	if owner == "" {
+		return invalidArgument("FileService", "owner", "RevokeShare")
+	}
+
+	if code == "" {
+		return invalidArgument("FileService", "code", "RevokeShare")
+	}
+
+	shareRepository, err := f.dataContext.Share()
+	if err != nil {
+		return err
+	}
+
+	share, err := shareRepository.GetShareByCode(code)
+	if err != nil {
+		return err
+	}
+
+	if share == nil || share.Owner != owner {
+		return NewPathError("revoke", code, ErrFileShareInvalid)
+	}
+
+	var commited = false
+	UOW, err := f.dataContext.Unit()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if !commited {
+			if err := UOW.Rollback(); err != nil {
+				log.Warn("msg", "rollback failed in FileService.RevokeShare", "error", err.Error())
+			}
+		}
+	}()
+
+	shareRepository, err = UOW.Share()
+	if err != nil {
+		return err
+	}
+
+	if err := shareRepository.DeleteShare(share); err != nil {
+		return err
+	}
+
+	err = recordActivity(UOW, f.actor, &models.Activity{
+		CreatedAt: f.now(),
+		Owner:     owner,
+		Action:    models.ActivityShareRevoked,
+		FID:       share.FID,
+		OldValue:  share.Code,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := UOW.Commit(); err != nil {
+		return err
+	}
+	commited = true
+	return nil
+}
+
+//GetShare 获取分享信息以及分享的文件，分享码为code，访问密码为pwd
+func (f *FileService) GetShare(code string, pwd string) (*models.Share, *models.File, error) {
+	if code == "" {
+		return nil, nil, invalidArgument("FileService", "code", "GetShare")
+	}
+
+	fileRepository, err := f.dataContext.File()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	shareRepository, err := f.dataContext.Share()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return f.verifyShare(code, pwd, shareRepository, fileRepository)
+}
+
+//GetSharedFileList 获取分享文件夹中的文件列表，fid为分享文件夹中的子文件夹，空为分享的文件夹
+func (f *FileService) GetSharedFileList(code string, pwd string, fid string, limit int, offset int) ([]*models.File, error) {
+	if code == "" {
+		return nil, invalidArgument("FileService", "code", "GetSharedFileList")
+	}
+
+	fileRepository, err := f.dataContext.File()
+	if err != nil {
+		return nil, err
+	}
+
+	shareRepository, err := f.dataContext.Share()
+	if err != nil {
+		return nil, err
+	}
+
+	share, sharedFile, err := f.verifyShare(code, pwd, shareRepository, fileRepository)
+	if err != nil {
+		return nil, err
+	}
+
+	directory, err := f.resolveSharedFile(share, sharedFile, fid, fileRepository)
+	if err != nil {
+		return nil, err
+	}
+
+	if !directory.IsDir {
+		return nil, NewPathError("list", directory.FID, ErrParentNotADirectory)
+	}
+
+	return fileRepository.GetFilesByPFID(share.Owner, directory.FID, limit, offset)
+}
+
+//DownloadShare 下载分享的文件，fid为分享文件夹中的文件，空为分享的文件，
+//count为false时不计入下载次数，用于同一次下载中的后续Range请求
+func (f *FileService) DownloadShare(code string, pwd string, fid string, count bool) (File, *models.File, error) {
+	if code == "" {
+		return nil, nil, invalidArgument("FileService", "code", "DownloadShare")
+	}
+
+	lockName := "$file-explorer:share$" + code
+	f.namedLocker.Lock(lockName)
+	defer f.namedLocker.UnLock(lockName)
+
+	fileRepository, err := f.dataContext.File()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	shareRepository, err := f.dataContext.Share()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	share, sharedFile, err := f.verifyShare(code, pwd, shareRepository, fileRepository)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	downloadFile, err := f.resolveSharedFile(share, sharedFile, fid, fileRepository)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if downloadFile.IsDir {
+		return nil, nil, NewPathError("download", downloadFile.FID, ErrCannotDownloadDirectory)
+	}
+
+	file, err := f.openFile("download", downloadFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !count {
+		return file, downloadFile, nil
+	}
+
+	share.Downloads++
+	if err := shareRepository.UpdateShare(share); err != nil {
+		if e := file.Close(); e != nil {
+			log.Error("msg", "occur a error when close file", "error", e.Error())
+		}
+		return nil, nil, err
+	}
+	return file, downloadFile, nil
+}
+
+func (f *FileService) verifyShare(code string, pwd string,
+	shareRepos repository.ShareRepository,
+	fileRepos repository.FileRepository) (*models.Share, *models.File, error) {
+	share, err := shareRepos.GetShareByCode(code)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if share == nil {
+		return nil, nil, NewPathError("share", code, ErrFileShareInvalid)
+	}
+
+	if err := checkShare(share, pwd, f.now()); err != nil {
+		if err == ErrFileSharePasswordIncorrect {
+			f.recordSharePasswordFailure(code, shareRepos)
+		}
+		return nil, nil, NewPathError("share", code, err)
+	}
+
+	if share.FailedAttempts > 0 {
+		if err := shareRepos.ResetShareFailedAttempts(code); err != nil {
+			log.Error("msg", "occur a error when reset share failed attempts", "code", code, "error", err.Error())
+		}
+	}
+
+	sharedFile, err := fileRepos.GetFileByID(share.Owner, share.FID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if sharedFile == nil {
+		return nil, nil, NewPathError("share", code, ErrFileShareInvalid)
+	}
+	return share, sharedFile, nil
+}
+
+//checkShare 检查分享在now时是否可以使用密码pwd访问
+func checkShare(share *models.Share, pwd string, now time.Time) error {
+	if share.ExpiresAt != nil && !now.Before(*share.ExpiresAt) {
+		return ErrFileShareInvalid
+	}
+
+	if share.MaxDownloads > 0 && share.Downloads >= share.MaxDownloads {
+		return ErrFileShareInvalid
+	}
+
+	if share.LockedUntil != nil && now.Before(*share.LockedUntil) {
+		return ErrFileShareLocked
+	}
+
+	if share.Password != "" && !password.CompareHashPassword(pwd, share.Password) {
+		return ErrFileSharePasswordIncorrect
+	}
+	return nil
+}
+
+//recordSharePasswordFailure 记录一次输错密码，达到上限后锁定分享
+func (f *FileService) recordSharePasswordFailure(code string, repos repository.ShareRepository) {
+	attempts, err := repos.AddShareFailedAttempt(code)
+	if err != nil {
+		log.Error("msg", "occur a error when record share failed attempt", "code", code, "error", err.Error())
+		return
+	}
+
+	shareConfig := f.config().FileService.Share
+	if attempts < shareConfig.MaxPasswordAttempts {
+		return
+	}
+
+	if err := repos.LockShare(code, f.now().Add(shareConfig.LockoutDuration)); err != nil {
+		log.Error("msg", "occur a error when lock share", "code", code, "error", err.Error())
+	}
+}
+
+//resolveSharedFile 获取分享中编号为fid的文件，文件必须为分享文件本身或其子孙
+func (f *FileService) resolveSharedFile(share *models.Share, sharedFile *models.File, fid string,
+	repos repository.FileRepository) (*models.File, error) {
+	if fid == "" || fid == sharedFile.FID {
+		return sharedFile, nil
+	}
+
+	file, err := repos.GetFileByID(share.Owner, fid)
+	if err != nil {
+		return nil, err
+	}
+
+	if file == nil {
+		return nil, NewPathError("share", fid, ErrFileNotFound)
+	}
+
+	current := file
+	for current.PFID != sharedFile.FID {
+		if current.PFID == share.Owner {
+			return nil, NewPathError("share", fid, ErrFileNotFound)
+		}
+
+		current, err = repos.GetFileByID(share.Owner, current.PFID)
+		if err != nil {
+			return nil, err
+		}
+
+		if current == nil {
+			return nil, NewPathError("share", fid, ErrFileNotFound)
+		}
+	}
+	return file, nil
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/phantom-atom/file-explorer/config"
+	"github.com/phantom-atom/file-explorer/internal/utils/password"
+	"github.com/phantom-atom/file-explorer/models"
+	"github.com/phantom-atom/file-explorer/repository"
+)
+
+func TestCheckShare(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	before := now.Add(-time.Minute)
+	after := now.Add(time.Minute)
+	hash := password.CreateHashPassword("secret")
+
+	cases := []struct {
+		name  string
+		share models.Share
+		pwd   string
+		err   error
+	}{
+		{"no limits", models.Share{}, "", nil},
+		{"not expired", models.Share{ExpiresAt: &after}, "", nil},
+		{"expired", models.Share{ExpiresAt: &before}, "", ErrFileShareInvalid},
+		{"expires now", models.Share{ExpiresAt: &now}, "", ErrFileShareInvalid},
+		{"downloads left", models.Share{MaxDownloads: 2, Downloads: 1}, "", nil},
+		{"downloads used up", models.Share{MaxDownloads: 2, Downloads: 2}, "", ErrFileShareInvalid},
+		{"correct password", models.Share{Password: hash}, "secret", nil},
+		{"wrong password", models.Share{Password: hash}, "Secret", ErrFileSharePasswordIncorrect},
+		{"missing password", models.Share{Password: hash}, "", ErrFileSharePasswordIncorrect},
+		{"locked", models.Share{Password: hash, LockedUntil: &after}, "secret", ErrFileShareLocked},
+		{"lock expired", models.Share{Password: hash, LockedUntil: &before}, "secret", nil},
+		{"expired before locked", models.Share{ExpiresAt: &before, LockedUntil: &after}, "", ErrFileShareInvalid},
+	}
+
+	for _, c := range cases {
+		share := c.share
+		if err := checkShare(&share, c.pwd, now); err != c.err {
+			t.Errorf("%s: checkShare() = %v, want %v", c.name, err, c.err)
+		}
+	}
+}
+
+type fakeShareRepository struct {
+	repository.ShareRepository
+	attempts    int
+	lockedUntil *time.Time
+}
+
+func (r *fakeShareRepository) AddShareFailedAttempt(code string) (int, error) {
+	r.attempts++
+	return r.attempts, nil
+}
+
+func (r *fakeShareRepository) LockShare(code string, until time.Time) error {
+	r.attempts = 0
+	r.lockedUntil = &until
+	return nil
+}
+
+func TestRecordSharePasswordFailure(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	conf := &config.Config{}
+	conf.FileService.Share.MaxPasswordAttempts = 3
+	conf.FileService.Share.LockoutDuration = time.Minute
+
+	f := &FileService{
+		config: func() *config.Config { return conf },
+		now:    func() time.Time { return now },
+	}
+	repos := &fakeShareRepository{}
+
+	for i := 1; i < 3; i++ {
+		f.recordSharePasswordFailure("code", repos)
+		if repos.lockedUntil != nil {
+			t.Fatalf("share locked after %d failures", i)
+		}
+	}
+
+	f.recordSharePasswordFailure("code", repos)
+	if repos.lockedUntil == nil || !repos.lockedUntil.Equal(now.Add(time.Minute)) {
+		t.Fatalf("share lockedUntil = %v, want %v", repos.lockedUntil, now.Add(time.Minute))
+	}
+
+	if repos.attempts != 0 {
+		t.Errorf("attempts after lock = %d, want 0", repos.attempts)
+	}
+}
+
+func TestDownloadShareCount(t *testing.T) {
+	env := newTestEnv(t)
+	owner := env.createUser("alice", 0).ID
+	file := env.upload(owner, "", "movie.mp4", "0123456789")
+
+	share, err := env.files.CreateShare(owner, file.FID, &ShareParams{MaxDownloads: 1})
+	if err != nil {
+		t.Fatalf("CreateShare error: %v", err)
+	}
+
+	download := func(count bool) error {
+		content, _, err := env.files.DownloadShare(share.Code, "", "", count)
+		if err == nil {
+			content.Close()
+		}
+		return err
+	}
+
+	//同一次播放中的后续Range请求不计入下载次数
+	for i := 0; i < 3; i++ {
+		if err := download(false); err != nil {
+			t.Fatalf("range download %d error: %v", i, err)
+		}
+	}
+
+	if err := download(true); err != nil {
+		t.Fatalf("download error: %v", err)
+	}
+
+	stored := &models.Share{}
+	if err := env.db.Where("code = ?", share.Code).First(stored).Error; err != nil {
+		t.Fatalf("get share error: %v", err)
+	}
+	if stored.Downloads != 1 {
+		t.Errorf("downloads = %d, want 1", stored.Downloads)
+	}
+
+	if err := download(false); causeOf(err) != ErrFileShareInvalid {
+		t.Errorf("download after max downloads error = %v, want %v", err, ErrFileShareInvalid)
+	}
+}
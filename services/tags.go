@@ -0,0 +1,343 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/phantom-atom/file-explorer/internal/log"
+	"github.com/phantom-atom/file-explorer/models"
+	"github.com/phantom-atom/file-explorer/repository"
+)
+
+const (
+	maxTagLength           = 64
+	maxTagsPerFile         = 100
+	maxMetadataKeyLength   = 128
+	maxMetadataValueLength = 4096
+	maxMetadataPerFile     = 100
+)
+
+var (
+	//ErrTagInvalid 标签为空或者过长
+	ErrTagInvalid = errors.New("标签无效")
+	//ErrMetadataInvalid 元数据的键为空或者键、值过长
+	ErrMetadataInvalid = errors.New("元数据无效")
+	//ErrAnnotationLimitExceeded 文件的标签或元数据数量超过限制
+	ErrAnnotationLimitExceeded = errors.New("标签或元数据数量超过限制")
+)
+
+//normalizeTags 去除标签两端的空白并去重，标签不能为空且不能超过maxTagLength个字符
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || utf8.RuneCountInString(tag) > maxTagLength {
+			return nil, NewPathError("tag", tag, ErrTagInvalid)
+		}
+
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+//checkMetadata 检查元数据的键和值
+func checkMetadata(metadata map[string]string) error {
+	for key, value := range metadata {
+		if key == "" || utf8.RuneCountInString(key) > maxMetadataKeyLength ||
+			utf8.RuneCountInString(value) > maxMetadataValueLength {
+			return NewPathError("metadata", key, ErrMetadataInvalid)
+		}
+	}
+	return nil
+}
+
+//updateFileAnnotations 在owner的锁和事务中修改文件的标签或元数据，文件不存在时返回ErrFileNotFound，
+//修改前后的值记录在操作日志中
+func (f *FileService) updateFileAnnotations(op string, owner string, fid string,
+	update func(repos repository.TagRepository) error) error {
+	f.namedLocker.Lock(owner)
+	defer f.namedLocker.UnLock(owner)
+
+	var commited = false
+	UOW, err := f.dataContext.Unit()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if !commited {
+			if err := UOW.Rollback(); err != nil {
+				log.Warn("msg", "rollback failed in FileService.updateFileAnnotations", "error", err.Error())
+			}
+		}
+	}()
+
+	fileRepository, err := UOW.File()
+	if err != nil {
+		return err
+	}
+
+	file, err := fileRepository.GetFileByID(owner, fid)
+	if err != nil {
+		return err
+	}
+
+	if file == nil {
+		return NewPathError(op, fid, ErrFileNotFound)
+	}
+
+	tagRepository, err := UOW.Tag()
+	if err != nil {
+		return err
+	}
+
+	oldValue, err := annotationSnapshot(op, owner, fid, tagRepository)
+	if err != nil {
+		return err
+	}
+
+	if err := update(tagRepository); err != nil {
+		return err
+	}
+
+	newValue, err := annotationSnapshot(op, owner, fid, tagRepository)
+	if err != nil {
+		return err
+	}
+
+	action := models.ActivityFileTagsUpdated
+	if op == "metadata" {
+		action = models.ActivityFileMetadataUpdated
+	}
+
+	if err := f.recordFileActivity(UOW, action, file, oldValue, newValue); err != nil {
+		return err
+	}
+
+	if err := UOW.Commit(); err != nil {
+		return err
+	}
+	commited = true
+	return nil
+}
+
+//annotationSnapshot 文件标签(以","连接)或者元数据(JSON)的当前值
+func annotationSnapshot(op string, owner string, fid string, repos repository.TagRepository) (string, error) {
+	if op != "metadata" {
+		tags, err := repos.GetFileTags(owner, fid)
+		if err != nil {
+			return "", err
+		}
+		return strings.Join(tags, ","), nil
+	}
+
+	metadata, err := fileMetadataMap(owner, fid, repos)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+//checkFile 检查文件是否存在，用于读取标签和元数据之前
+func (f *FileService) checkFile(op string, owner string, fid string) error {
+	fileRepository, err := f.dataContext.File()
+	if err != nil {
+		return err
+	}
+
+	file, err := fileRepository.GetFileByID(owner, fid)
+	if err != nil {
+		return err
+	}
+
+	if file == nil {
+		return NewPathError(op, fid, ErrFileNotFound)
+	}
+	return nil
+}
+
+//GetFileTags 获取文件的标签，按字母顺序排列
+func (f *FileService) GetFileTags(owner string, fid string) ([]string, error) {
+	if owner == "" {
+		return nil, invalidArgument("FileService", "owner", "GetFileTags")
+	}
+
+	if fid == "" {
+		return nil, invalidArgument("FileService", "fid", "GetFileTags")
+	}
+
+	if err := f.checkFile("tag", owner, fid); err != nil {
+		return nil, err
+	}
+
+	tagRepository, err := f.dataContext.Tag()
+	if err != nil {
+		return nil, err
+	}
+	return tagRepository.GetFileTags(owner, fid)
+}
+
+//UpdateFileTags 为文件添加add中的标签并删除remove中的标签，replace为true时先删除文件的所有标签，
+//返回修改后的标签
+func (f *FileService) UpdateFileTags(owner string, fid string,
+	add []string, remove []string, replace bool) ([]string, error) {
+	if owner == "" {
+		return nil, invalidArgument("FileService", "owner", "UpdateFileTags")
+	}
+
+	if fid == "" {
+		return nil, invalidArgument("FileService", "fid", "UpdateFileTags")
+	}
+
+	add, err := normalizeTags(add)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range remove {
+		remove[i] = strings.TrimSpace(remove[i])
+	}
+
+	var tags []string
+	err = f.updateFileAnnotations("tag", owner, fid, func(repos repository.TagRepository) error {
+		if replace {
+			if err := repos.ClearFileTags(owner, fid); err != nil {
+				return err
+			}
+		}
+
+		if err := repos.AddFileTags(owner, fid, add); err != nil {
+			return err
+		}
+
+		if err := repos.RemoveFileTags(owner, fid, remove); err != nil {
+			return err
+		}
+
+		var err error
+		tags, err = repos.GetFileTags(owner, fid)
+		if err != nil {
+			return err
+		}
+
+		if len(tags) > maxTagsPerFile {
+			return NewPathError("tag", fid, ErrAnnotationLimitExceeded)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+//GetTags 获取owner的所有标签以及使用该标签的文件数量，回收站中的文件不计算在内
+func (f *FileService) GetTags(owner string) ([]*models.TagCount, error) {
+	if owner == "" {
+		return nil, invalidArgument("FileService", "owner", "GetTags")
+	}
+
+	tagRepository, err := f.dataContext.Tag()
+	if err != nil {
+		return nil, err
+	}
+	return tagRepository.GetTagCounts(owner)
+}
+
+//GetFileMetadata 获取文件的自定义元数据
+func (f *FileService) GetFileMetadata(owner string, fid string) (map[string]string, error) {
+	if owner == "" {
+		return nil, invalidArgument("FileService", "owner", "GetFileMetadata")
+	}
+
+	if fid == "" {
+		return nil, invalidArgument("FileService", "fid", "GetFileMetadata")
+	}
+
+	if err := f.checkFile("metadata", owner, fid); err != nil {
+		return nil, err
+	}
+
+	tagRepository, err := f.dataContext.Tag()
+	if err != nil {
+		return nil, err
+	}
+	return fileMetadataMap(owner, fid, tagRepository)
+}
+
+func fileMetadataMap(owner string, fid string, repos repository.TagRepository) (map[string]string, error) {
+	items, err := repos.GetFileMetadata(owner, fid)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := make(map[string]string, len(items))
+	for _, item := range items {
+		metadata[item.Key] = item.Value
+	}
+	return metadata, nil
+}
+
+//UpdateFileMetadata 设置文件的元数据并删除remove中的键，replace为true时先删除文件的所有元数据，
+//返回修改后的元数据
+func (f *FileService) UpdateFileMetadata(owner string, fid string,
+	metadata map[string]string, remove []string, replace bool) (map[string]string, error) {
+	if owner == "" {
+		return nil, invalidArgument("FileService", "owner", "UpdateFileMetadata")
+	}
+
+	if fid == "" {
+		return nil, invalidArgument("FileService", "fid", "UpdateFileMetadata")
+	}
+
+	if err := checkMetadata(metadata); err != nil {
+		return nil, err
+	}
+
+	var result map[string]string
+	err := f.updateFileAnnotations("metadata", owner, fid, func(repos repository.TagRepository) error {
+		if replace {
+			if err := repos.ClearFileMetadata(owner, fid); err != nil {
+				return err
+			}
+		}
+
+		for key, value := range metadata {
+			if err := repos.SetFileMetadata(owner, fid, key, value); err != nil {
+				return err
+			}
+		}
+
+		if err := repos.RemoveFileMetadata(owner, fid, remove); err != nil {
+			return err
+		}
+
+		var err error
+		result, err = fileMetadataMap(owner, fid, repos)
+		if err != nil {
+			return err
+		}
+
+		if len(result) > maxMetadataPerFile {
+			return NewPathError("metadata", fid, ErrAnnotationLimitExceeded)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/phantom-atom/file-explorer/models"
+)
+
+//tag 替换文件的标签
+func (env *testEnv) tag(owner string, fid string, tags ...string) {
+	if _, err := env.files.UpdateFileTags(owner, fid, tags, nil, true); err != nil {
+		env.t.Fatalf("UpdateFileTags error: %v", err)
+	}
+}
+
+//filenames 按字母顺序排列的文件名，以","连接
+func filenames(files []*models.File) string {
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, file.Filename)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func TestTagFilters(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser("alice", 0).ID
+	bob := env.createUser("bob", 0).ID
+
+	docs := env.mkdir(alice, "", "docs")
+	plan := env.upload(alice, docs.FID, "plan.txt", "plan")
+	notes := env.upload(alice, docs.FID, "notes.txt", "notes")
+	env.upload(alice, docs.FID, "todo.txt", "todo")
+	photo := env.upload(alice, "", "photo.jpg", "photo")
+	other := env.upload(bob, "", "bob.txt", "bob")
+
+	//标签两端的空白被去除
+	env.tag(alice, plan.FID, " work ", "urgent")
+	env.tag(alice, notes.FID, "work")
+	env.tag(alice, photo.FID, "work")
+	env.tag(bob, other.FID, "work")
+
+	search := func(tag string) string {
+		files, err := env.files.SearchFiles(alice, &FileSearchParams{Tag: tag})
+		if err != nil {
+			t.Fatalf("SearchFiles tag %q error: %v", tag, err)
+		}
+		return filenames(files)
+	}
+
+	//其它用户相同的标签不影响结果
+	cases := map[string]string{
+		"work":   "notes.txt,photo.jpg,plan.txt",
+		"urgent": "plan.txt",
+		"Work":   "",
+		"home":   "",
+	}
+	for tag, expected := range cases {
+		if actual := search(tag); actual != expected {
+			t.Errorf("SearchFiles tag %q = %q, expected %q", tag, actual, expected)
+		}
+	}
+
+	list, err := env.files.ListFiles(alice, &FileListParams{ParentID: docs.FID, Tag: "work"})
+	if err != nil {
+		t.Fatalf("ListFiles error: %v", err)
+	}
+	if names := filenames(list.Files); names != "notes.txt,plan.txt" || list.Total != 2 {
+		t.Errorf("ListFiles tag work = %q, total %d, expected notes.txt,plan.txt, total 2", names, list.Total)
+	}
+
+	//回收站中的文件不出现在过滤结果和标签统计中，恢复后标签仍然保留
+	item := env.trashOne(alice, notes.FID)
+	if actual := search("work"); actual != "photo.jpg,plan.txt" {
+		t.Errorf("SearchFiles tag work after trash = %q", actual)
+	}
+
+	counts, err := env.files.GetTags(alice)
+	if err != nil {
+		t.Fatalf("GetTags error: %v", err)
+	}
+	var workCount int64
+	for _, count := range counts {
+		if count.Tag == "work" {
+			workCount = count.Count
+		}
+	}
+	if workCount != 2 {
+		t.Errorf("work count = %d, expected 2", workCount)
+	}
+
+	if _, err := env.files.RestoreTrashItem(alice, item.ID); err != nil {
+		t.Fatalf("RestoreTrashItem error: %v", err)
+	}
+	if actual := search("work"); actual != "notes.txt,photo.jpg,plan.txt" {
+		t.Errorf("SearchFiles tag work after restore = %q", actual)
+	}
+}
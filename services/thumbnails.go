@@ -0,0 +1,248 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"path"
+	"strings"
+
+	//注册缩略图支持的图片格式
+	_ "image/gif"
+	_ "image/png"
+
+	_ "golang.org/x/image/webp"
+
+	"golang.org/x/image/draw"
+
+	"github.com/phantom-atom/file-explorer/internal/log"
+	"github.com/phantom-atom/file-explorer/models"
+	"github.com/phantom-atom/file-explorer/storage"
+)
+
+const (
+	thumbnailLockerScope = "$file-explorer:thumbnail$"
+	thumbnailQuality     = 80
+)
+
+var (
+	//ErrThumbnailUnavailable 文件没有缩略图
+	ErrThumbnailUnavailable = errors.New("文件没有缩略图")
+
+	thumbnailExtensions = map[string]bool{
+		".jpg":  true,
+		".jpeg": true,
+		".png":  true,
+		".gif":  true,
+		".webp": true,
+	}
+)
+
+//thumbnailSupported 根据扩展名判断是否可以生成缩略图
+func thumbnailSupported(file *models.File) bool {
+	if file.IsDir || file.Hash == "" {
+		return false
+	}
+	return thumbnailExtensions[strings.ToLower(path.Ext(file.Filename))]
+}
+
+//scheduleThumbnail 将文件加入后台缩略图生成队列，队列已满时放弃，请求缩略图时会再次生成
+func (f *FileService) scheduleThumbnail(file *models.File) {
+	if f.thumbnailQueue == nil || !thumbnailSupported(file) {
+		return
+	}
+
+	task := *file
+	select {
+	case f.thumbnailQueue <- &task:
+	default:
+		log.Warn("msg", "thumbnail queue is full", "fid", file.FID)
+	}
+}
+
+//thumbnailWorker 后台生成缩略图
+func (f *FileService) thumbnailWorker() {
+	for {
+		select {
+		case <-f.ctx.Done():
+			return
+		case file := <-f.thumbnailQueue:
+			if err := f.generateThumbnails(file); err != nil {
+				log.Warn("msg", "occur a error when generate thumbnail", "fid", file.FID, "error", err.Error())
+			}
+		}
+	}
+}
+
+//generateThumbnails 生成文件所有尺寸的缩略图，缩略图以内容的hash命名，相同内容的文件共享缩略图
+func (f *FileService) generateThumbnails(file *models.File) error {
+	f.namedLocker.Lock(thumbnailLockerScope + file.Hash)
+	defer f.namedLocker.UnLock(thumbnailLockerScope + file.Hash)
+
+	if _, err := f.storage.Stat(models.ThumbnailKey(file.Hash, models.ThumbnailSmall)); err != nil {
+		if err != storage.ErrNotFound {
+			return err
+		}
+
+		if err := f.renderThumbnails(file.Hash); err != nil {
+			return err
+		}
+	}
+
+	fileRepository, err := f.dataContext.File()
+	if err != nil {
+		return err
+	}
+
+	if err := fileRepository.SetFileThumbnail(file); err != nil {
+		return err
+	}
+	file.HasThumbnail = true
+	return nil
+}
+
+//renderThumbnails 解码图片并从大到小依次缩放，最小的缩略图最后写入，以它是否存在判断是否已经生成
+func (f *FileService) renderThumbnails(hash string) error {
+	thumbnailConf := &f.config().FileService.Thumbnail
+	key := models.BlobKey(hash)
+
+	info, err := f.storage.Stat(key)
+	if err != nil {
+		return err
+	}
+
+	if thumbnailConf.MaxSourceSize > 0 && info.Size > thumbnailConf.MaxSourceSize {
+		return NewPathError("thumbnail", hash, ErrThumbnailUnavailable)
+	}
+
+	reader := storage.NewReader(f.storage, key, info.Size)
+	defer func() {
+		if err := reader.Close(); err != nil {
+			log.Error("msg", "occur a error when close file", "error", err.Error())
+		}
+	}()
+
+	//先读取图片尺寸，避免解码超大图片耗尽内存
+	config, _, err := image.DecodeConfig(bufio.NewReader(reader))
+	if err != nil {
+		return err
+	}
+
+	if thumbnailConf.MaxPixels > 0 && int64(config.Width)*int64(config.Height) > thumbnailConf.MaxPixels {
+		return NewPathError("thumbnail", hash, ErrThumbnailUnavailable)
+	}
+
+	if _, err := reader.Seek(0, 0); err != nil {
+		return err
+	}
+
+	img, _, err := image.Decode(bufio.NewReader(reader))
+	if err != nil {
+		return err
+	}
+
+	for _, size := range models.ThumbnailSizes {
+		img = resizeImage(img, size.MaxEdge)
+
+		buffer := &bytes.Buffer{}
+		if err := jpeg.Encode(buffer, img, &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+			return err
+		}
+
+		if err := f.storage.Put(models.ThumbnailKey(hash, size.Name), buffer, int64(buffer.Len())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//resizeImage 等比缩放图片使最长边不超过maxEdge，透明部分使用白色填充
+func resizeImage(src image.Image, maxEdge int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	if width > maxEdge || height > maxEdge {
+		if width >= height {
+			height = height * maxEdge / width
+			width = maxEdge
+		} else {
+			width = width * maxEdge / height
+			height = maxEdge
+		}
+	}
+
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+	return dst
+}
+
+//GetThumbnail 获取文件的缩略图，文件属于owner，编号为fid，缩略图还未生成时立即生成
+func (f *FileService) GetThumbnail(owner string, fid string, size string) (File, *models.File, error) {
+	if owner == "" {
+		return nil, nil, invalidArgument("FileService", "owner", "GetThumbnail")
+	}
+
+	if fid == "" {
+		return nil, nil, invalidArgument("FileService", "fid", "GetThumbnail")
+	}
+
+	if size == "" {
+		size = models.ThumbnailMedium
+	}
+
+	fileRepository, err := f.dataContext.File()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := fileRepository.GetFileByID(owner, fid)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if file == nil {
+		return nil, nil, NewPathError("thumbnail", fid, ErrFileNotFound)
+	}
+
+	if !thumbnailSupported(file) {
+		return nil, nil, NewPathError("thumbnail", fid, ErrThumbnailUnavailable)
+	}
+
+	if !file.HasThumbnail {
+		if err := f.generateThumbnails(file); err != nil {
+			log.Warn("msg", "occur a error when generate thumbnail", "fid", file.FID, "error", err.Error())
+			return nil, nil, NewPathError("thumbnail", fid, ErrThumbnailUnavailable)
+		}
+	}
+
+	key := models.ThumbnailKey(file.Hash, size)
+	info, err := f.storage.Stat(key)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			return nil, nil, NewPathError("thumbnail", fid, ErrThumbnailUnavailable)
+		}
+		return nil, nil, err
+	}
+
+	name := strings.TrimSuffix(file.Filename, path.Ext(file.Filename))
+	return storage.NewReader(f.storage, key, info.Size), &models.File{
+		UpdatedAt:   file.UpdatedAt,
+		FID:         file.FID + "-" + size,
+		Owner:       file.Owner,
+		Directory:   file.Directory,
+		Filename:    name + "-" + size + ".jpg",
+		ContentType: "image/jpeg",
+		Size:        info.Size,
+		PFID:        file.PFID,
+	}, nil
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/phantom-atom/file-explorer/internal/utils/httputil"
+	"github.com/phantom-atom/file-explorer/models"
+)
+
+func TestGetThumbnail(t *testing.T) {
+	env := newTestEnv(t)
+	owner := env.createUser("alice", 0).ID
+
+	img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	for x := 0; x < 64; x++ {
+		img.Set(x, x%48, color.RGBA{R: 255, A: 255})
+	}
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, img); err != nil {
+		t.Fatalf("png.Encode error: %v", err)
+	}
+	file := env.upload(owner, "", "photo.png", buf.String())
+
+	content, info, err := env.files.GetThumbnail(owner, file.FID, models.ThumbnailSmall)
+	if err != nil {
+		t.Fatalf("GetThumbnail error: %v", err)
+	}
+	defer content.Close()
+
+	//缩略图需要以inline方式返回才能在<img>中显示
+	if info.ContentType != "image/jpeg" || !httputil.InlineSafe(info.ContentType) {
+		t.Errorf("thumbnail content type = %q, expected inline safe image/jpeg", info.ContentType)
+	}
+
+	if _, _, err := image.Decode(content); err != nil {
+		t.Errorf("decode thumbnail error: %v", err)
+	}
+}
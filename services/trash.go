@@ -0,0 +1,313 @@
+package services
+
+import (
+	"errors"
+	"path"
+	"time"
+
+	"github.com/phantom-atom/file-explorer/internal/log"
+	"github.com/phantom-atom/file-explorer/models"
+	"github.com/phantom-atom/file-explorer/repository"
+)
+
+const trashPurgeBatch = 100
+
+func (f *FileService) trashFile(file *models.File, repos repository.TrashRepository) error {
+	id := f.uuid()
+	if id == "" {
+		return errors.New("FileService: cannot create uuid in trashFile")
+	}
+
+	return repos.TrashFile(file, &models.TrashItem{
+		ID:        id,
+		TrashedAt: f.now(),
+		Owner:     file.Owner,
+		FID:       file.FID,
+		PFID:      file.PFID,
+		Directory: file.Directory,
+		Filename:  file.Filename,
+		IsDir:     file.IsDir,
+		Size:      file.Size,
+	})
+}
+
+//GetTrashItems 获取回收站中的项目，回收站属于owner
+func (f *FileService) GetTrashItems(owner string, limit int, offset int) ([]*models.TrashItem, error) {
+	if owner == "" {
+		return nil, invalidArgument("FileService", "owner", "GetTrashItems")
+	}
+
+	trashRepository, err := f.dataContext.Trash()
+	if err != nil {
+		return nil, err
+	}
+
+	return trashRepository.GetTrashItems(owner, limit, offset)
+}
+
+//RestoreTrashItem 恢复回收站项目到原来的文件夹，原文件夹不存在时恢复到根目录，存在同名文件时自动重命名
+func (f *FileService) RestoreTrashItem(owner string, id string) (*models.File, error) {
+	if owner == "" {
+		return nil, invalidArgument("FileService", "owner", "RestoreTrashItem")
+	}
+
+	if id == "" {
+		return nil, invalidArgument("FileService", "id", "RestoreTrashItem")
+	}
+
+	f.namedLocker.Lock(owner)
+	defer f.namedLocker.UnLock(owner)
+
+	var commited = false
+	UOW, err := f.dataContext.Unit()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if !commited {
+			if err := UOW.Rollback(); err != nil {
+				log.Warn("msg", "rollback failed in FileService.RestoreTrashItem", "error", err.Error())
+			}
+		}
+	}()
+
+	trashRepository, err := UOW.Trash()
+	if err != nil {
+		return nil, err
+	}
+
+	fileRepository, err := UOW.File()
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := trashRepository.GetTrashItem(owner, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if item == nil {
+		return nil, NewPathError("restore", id, ErrFileNotFound)
+	}
+
+	parentFile := &models.File{
+		Directory: "/",
+		Filename:  "",
+	}
+	pfid := owner
+
+	if item.PFID != owner {
+		originalParent, err := fileRepository.GetFileByID(owner, item.PFID)
+		if err != nil {
+			return nil, err
+		}
+
+		if originalParent != nil && originalParent.IsDir {
+			parentFile = originalParent
+			pfid = originalParent.FID
+		}
+	}
+
+	//恢复之前文件仍处于删除状态，查找同名文件时不会匹配到文件自身
+	filename, err := f.availableFilename(&models.File{
+		Owner:    owner,
+		FID:      item.FID,
+		PFID:     pfid,
+		Filename: item.Filename,
+	}, fileRepository)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := trashRepository.RestoreTrashItem(item); err != nil {
+		return nil, err
+	}
+
+	restoreFile, err := fileRepository.GetFileByID(owner, item.FID)
+	if err != nil {
+		return nil, err
+	}
+
+	if restoreFile == nil {
+		return nil, NewPathError("restore", item.FID, ErrFileIsMissing)
+	}
+	restoreFile.PFID = pfid
+	restoreFile.Filename = filename
+
+	directory := path.Join(parentFile.Directory, parentFile.Filename)
+	if err := f.adjustFilePath(restoreFile, directory, fileRepository); err != nil {
+		return nil, err
+	}
+
+	if err := f.recordFileActivity(UOW, models.ActivityFileRestored, restoreFile, "", ""); err != nil {
+		return nil, err
+	}
+
+	if err := f.publishFileEvent(UOW, models.EventFileRestored, restoreFile, ""); err != nil {
+		return nil, err
+	}
+
+	if err := UOW.Commit(); err != nil {
+		return nil, err
+	}
+	commited = true
+	return restoreFile, nil
+}
+
+//DeleteTrashItem 永久删除回收站项目，回收站属于owner
+func (f *FileService) DeleteTrashItem(owner string, id string) error {
+	if owner == "" {
+		return invalidArgument("FileService", "owner", "DeleteTrashItem")
+	}
+
+	if id == "" {
+		return invalidArgument("FileService", "id", "DeleteTrashItem")
+	}
+
+	f.namedLocker.Lock(owner)
+	defer f.namedLocker.UnLock(owner)
+
+	trashRepository, err := f.dataContext.Trash()
+	if err != nil {
+		return err
+	}
+
+	item, err := trashRepository.GetTrashItem(owner, id)
+	if err != nil {
+		return err
+	}
+
+	if item == nil {
+		return NewPathError("delete", id, ErrFileNotFound)
+	}
+
+	return f.deleteTrashItem(item)
+}
+
+//EmptyTrash 清空回收站，回收站属于owner
+func (f *FileService) EmptyTrash(owner string) error {
+	if owner == "" {
+		return invalidArgument("FileService", "owner", "EmptyTrash")
+	}
+
+	f.namedLocker.Lock(owner)
+	defer f.namedLocker.UnLock(owner)
+
+	trashRepository, err := f.dataContext.Trash()
+	if err != nil {
+		return err
+	}
+
+	items, err := trashRepository.GetTrashItems(owner, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if err := f.deleteTrashItem(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *FileService) deleteTrashItem(item *models.TrashItem) error {
+	var commited = false
+	UOW, err := f.dataContext.Unit()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if !commited {
+			if err := UOW.Rollback(); err != nil {
+				log.Warn("msg", "rollback failed in FileService.deleteTrashItem", "error", err.Error())
+			}
+		}
+	}()
+
+	trashRepository, err := UOW.Trash()
+	if err != nil {
+		return err
+	}
+
+	if err := trashRepository.DeleteTrashItem(item); err != nil {
+		return err
+	}
+
+	err = f.recordFileActivity(UOW, models.ActivityFilePurged, &models.File{
+		Owner:     item.Owner,
+		FID:       item.FID,
+		Directory: item.Directory,
+		Filename:  item.Filename,
+	}, "", "")
+	if err != nil {
+		return err
+	}
+
+	if err := UOW.Commit(); err != nil {
+		return err
+	}
+	commited = true
+	f.notifyBlobReleased()
+	return nil
+}
+
+//availableFilename 获取文件在其父文件夹中可用的名称，存在同名文件时添加序号
+func (f *FileService) availableFilename(file *models.File, repos repository.FileRepository) (string, error) {
+	name := file.Filename
+	for i := 1; ; i++ {
+		matchedFile, err := repos.GetFileByPFIDAndName(file.Owner, file.PFID, name)
+		if err != nil {
+			return "", err
+		}
+
+		if matchedFile == nil || matchedFile.FID == file.FID {
+			return name, nil
+		}
+
+		name = numberedFilename(file.Filename, i)
+	}
+}
+
+//purgeTrash 定期永久删除超过保留时间的回收站项目
+func (f *FileService) purgeTrash() {
+	for {
+		select {
+		case <-f.ctx.Done():
+			return
+		case <-time.After(f.config().FileService.Trash.PurgeInterval):
+		}
+
+		if err := f.purgeExpiredTrash(); err != nil {
+			log.Error("msg", "occur a error when purge expired trash", "error", err.Error())
+		}
+	}
+}
+
+func (f *FileService) purgeExpiredTrash() error {
+	trashRepository, err := f.dataContext.Trash()
+	if err != nil {
+		return err
+	}
+
+	before := f.now().Add(-f.config().FileService.Trash.Retention)
+	for {
+		items, err := trashRepository.GetExpiredTrashItems(before, trashPurgeBatch)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			f.namedLocker.Lock(item.Owner)
+			err := f.deleteTrashItem(item)
+			f.namedLocker.UnLock(item.Owner)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(items) < trashPurgeBatch {
+			return nil
+		}
+	}
+}
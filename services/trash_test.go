@@ -0,0 +1,82 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/phantom-atom/file-explorer/models"
+)
+
+//trashOne 删除文件并返回对应的回收站项目
+func (env *testEnv) trashOne(owner string, fid string) *models.TrashItem {
+	if err := env.files.DeleteFile(owner, fid); err != nil {
+		env.t.Fatalf("DeleteFile error: %v", err)
+	}
+
+	items, err := env.files.GetTrashItems(owner, 0, 0)
+	if err != nil {
+		env.t.Fatalf("GetTrashItems error: %v", err)
+	}
+	for _, item := range items {
+		if item.FID == fid {
+			return item
+		}
+	}
+	env.t.Fatalf("trash item of %s not found", fid)
+	return nil
+}
+
+func TestRestoreTrashItemNameTaken(t *testing.T) {
+	env := newTestEnv(t)
+	owner := env.createUser("alice", 0).ID
+	docs := env.mkdir(owner, "", "docs")
+
+	trashed := env.upload(owner, docs.FID, "report.txt", "old report")
+	item := env.trashOne(owner, trashed.FID)
+	taken := env.upload(owner, docs.FID, "report.txt", "new report")
+	env.upload(owner, docs.FID, "report (1).txt", "copy")
+
+	restored, err := env.files.RestoreTrashItem(owner, item.ID)
+	if err != nil {
+		t.Fatalf("RestoreTrashItem error: %v", err)
+	}
+
+	if restored.FID != trashed.FID || restored.PFID != docs.FID {
+		t.Errorf("restored file = %s in %s, expected %s in %s", restored.FID, restored.PFID, trashed.FID, docs.FID)
+	}
+	if restored.Directory != "/docs" || restored.Filename != "report (2).txt" {
+		t.Errorf("restored path = %s/%s, expected /docs/report (2).txt", restored.Directory, restored.Filename)
+	}
+
+	//同名文件保持不变
+	current := &models.File{}
+	if err := env.db.Where("fid = ?", taken.FID).First(current).Error; err != nil {
+		t.Fatalf("get file error: %v", err)
+	}
+	if current.Filename != "report.txt" {
+		t.Errorf("existing file renamed to %s", current.Filename)
+	}
+
+	if n := env.count(&models.TrashItem{}, "owner = ?", owner); n != 0 {
+		t.Errorf("trash items = %d, expected 0", n)
+	}
+}
+
+func TestRestoreTrashItemParentGone(t *testing.T) {
+	env := newTestEnv(t)
+	owner := env.createUser("alice", 0).ID
+	docs := env.mkdir(owner, "", "docs")
+
+	trashed := env.upload(owner, docs.FID, "report.txt", "old report")
+	item := env.trashOne(owner, trashed.FID)
+	env.trashOne(owner, docs.FID)
+	env.upload(owner, "", "report.txt", "root report")
+
+	//原文件夹不在原来的位置时恢复到根目录
+	restored, err := env.files.RestoreTrashItem(owner, item.ID)
+	if err != nil {
+		t.Fatalf("RestoreTrashItem error: %v", err)
+	}
+	if restored.PFID != owner || restored.Directory != "/" || restored.Filename != "report (1).txt" {
+		t.Errorf("restored = %s %s/%s, expected root /report (1).txt", restored.PFID, restored.Directory, restored.Filename)
+	}
+}
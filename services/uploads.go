@@ -0,0 +1,363 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/phantom-atom/file-explorer/internal/log"
+	"github.com/phantom-atom/file-explorer/models"
+	"github.com/phantom-atom/file-explorer/repository"
+)
+
+const (
+	uploadDirectory   = "tus"
+	uploadPurgeBatch  = 100
+	uploadLockerScope = "$file-explorer:upload$"
+)
+
+var (
+	//ErrUploadOffsetMismatch 上传偏移量不匹配
+	ErrUploadOffsetMismatch = errors.New("上传偏移量不匹配")
+	//ErrUploadTooLarge 上传文件过大
+	ErrUploadTooLarge = errors.New("上传文件过大")
+	//ErrUploadExpired 上传已过期
+	ErrUploadExpired = errors.New("上传已过期")
+)
+
+//UploadParams 断点续传上传参数
+type UploadParams struct {
+	DirectoryID string `json:"directory_id"` //父目录ID，空为根目录
+	Filename    string `json:"filename"`     //文件名称
+	Length      int64  `json:"length"`       //文件总长度
+	Metadata    string `json:"metadata"`     //客户端附带的原始元数据
+}
+
+//CreateUpload 创建一个断点续传上传，文件属于owner
+func (f *FileService) CreateUpload(owner string, params *UploadParams) (*models.Upload, error) {
+	if owner == "" {
+		return nil, invalidArgument("FileService", "owner", "CreateUpload")
+	}
+
+	if params == nil {
+		return nil, invalidArgument("FileService", "params", "CreateUpload")
+	}
+
+	if params.Filename == "" {
+		return nil, invalidArgument("FileService", "params.Filename", "CreateUpload")
+	}
+
+	if params.Length < 0 {
+		return nil, invalidArgument("FileService", "params.Length", "CreateUpload")
+	}
+
+	if params.DirectoryID == "" {
+		params.DirectoryID = owner
+	}
+
+	uploadConf := &f.config().FileService.Upload
+	if uploadConf.MaxSize > 0 && params.Length > uploadConf.MaxSize {
+		return nil, NewPathError("upload", params.Filename, ErrUploadTooLarge)
+	}
+
+	if err := f.checkQuota("upload", owner, params.Filename, params.Length); err != nil {
+		return nil, err
+	}
+
+	fileRepository, err := f.dataContext.File()
+	if err != nil {
+		return nil, err
+	}
+
+	uploadRepository, err := f.dataContext.Upload()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.prepareFileModel("upload", &models.File{
+		Owner:    owner,
+		PFID:     params.DirectoryID,
+		Filename: params.Filename,
+	}, fileRepository); err != nil {
+		return nil, err
+	}
+
+	id := f.uuid()
+	if id == "" {
+		return nil, errors.New("FileService: cannot create uuid in CreateUpload")
+	}
+
+	if err := os.MkdirAll(f.uploadAbsolutePath(), 0755); err != nil {
+		return nil, err
+	}
+
+	partialPath := filepath.Join(f.uploadAbsolutePath(), id)
+	partialFile, err := os.Create(partialPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := partialFile.Close(); err != nil {
+		log.Error("msg", "occur a error when close file", "error", err.Error())
+	}
+
+	upload := &models.Upload{
+		ID:        id,
+		ExpiresAt: f.now().Add(uploadConf.Expiration),
+		Owner:     owner,
+		PFID:      params.DirectoryID,
+		Filename:  params.Filename,
+		Length:    params.Length,
+		Metadata:  params.Metadata,
+	}
+
+	if err := uploadRepository.CreateUpload(upload); err != nil {
+		if e := os.Remove(partialPath); e != nil {
+			log.Error("msg", "occur a error when delete file", "error", e.Error())
+		}
+		return nil, err
+	}
+
+	if upload.Length == 0 {
+		f.namedLocker.Lock(uploadLockerScope + id)
+		defer f.namedLocker.UnLock(uploadLockerScope + id)
+		if err := f.finishUpload(upload, uploadRepository); err != nil {
+			return nil, err
+		}
+	}
+	return upload, nil
+}
+
+//GetUpload 获取断点续传上传信息，上传属于owner，编号为id
+func (f *FileService) GetUpload(owner string, id string) (*models.Upload, error) {
+	if owner == "" {
+		return nil, invalidArgument("FileService", "owner", "GetUpload")
+	}
+
+	if id == "" {
+		return nil, invalidArgument("FileService", "id", "GetUpload")
+	}
+
+	uploadRepository, err := f.dataContext.Upload()
+	if err != nil {
+		return nil, err
+	}
+
+	return f.getUpload("head", owner, id, uploadRepository)
+}
+
+//WriteUpload 从offset处写入上传数据，数据写满时创建文件
+func (f *FileService) WriteUpload(owner string, id string, offset int64, r io.Reader) (*models.Upload, error) {
+	if owner == "" {
+		return nil, invalidArgument("FileService", "owner", "WriteUpload")
+	}
+
+	if id == "" {
+		return nil, invalidArgument("FileService", "id", "WriteUpload")
+	}
+
+	if r == nil {
+		return nil, invalidArgument("FileService", "r", "WriteUpload")
+	}
+
+	f.namedLocker.Lock(uploadLockerScope + id)
+	defer f.namedLocker.UnLock(uploadLockerScope + id)
+
+	uploadRepository, err := f.dataContext.Upload()
+	if err != nil {
+		return nil, err
+	}
+
+	upload, err := f.getUpload("patch", owner, id, uploadRepository)
+	if err != nil {
+		return nil, err
+	}
+
+	if offset != upload.Offset {
+		return nil, NewPathError("patch", id, ErrUploadOffsetMismatch)
+	}
+
+	if upload.Finished() {
+		return upload, nil
+	}
+
+	if upload.Offset < upload.Length {
+		written, err := f.appendUpload(upload, r)
+		upload.Offset += written
+		upload.ExpiresAt = f.now().Add(f.config().FileService.Upload.Expiration)
+		if e := uploadRepository.UpdateUpload(upload); e != nil {
+			return nil, e
+		}
+
+		if err != nil {
+			return upload, err
+		}
+	}
+
+	if upload.Offset == upload.Length {
+		if err := f.finishUpload(upload, uploadRepository); err != nil {
+			return nil, err
+		}
+	}
+	return upload, nil
+}
+
+//DeleteUpload 终止并删除断点续传上传，上传属于owner，编号为id
+func (f *FileService) DeleteUpload(owner string, id string) error {
+	if owner == "" {
+		return invalidArgument("FileService", "owner", "DeleteUpload")
+	}
+
+	if id == "" {
+		return invalidArgument("FileService", "id", "DeleteUpload")
+	}
+
+	f.namedLocker.Lock(uploadLockerScope + id)
+	defer f.namedLocker.UnLock(uploadLockerScope + id)
+
+	uploadRepository, err := f.dataContext.Upload()
+	if err != nil {
+		return err
+	}
+
+	upload, err := uploadRepository.GetUpload(owner, id)
+	if err != nil {
+		return err
+	}
+
+	if upload == nil {
+		return NewPathError("delete", id, ErrFileNotFound)
+	}
+
+	return f.removeUpload(upload, uploadRepository)
+}
+
+func (f *FileService) uploadAbsolutePath() string {
+	return filepath.Join(f.config().FileService.FileAbsolutePath(), uploadDirectory)
+}
+
+func (f *FileService) getUpload(op string, owner string, id string,
+	repos repository.UploadRepository) (*models.Upload, error) {
+	upload, err := repos.GetUpload(owner, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if upload == nil {
+		return nil, NewPathError(op, id, ErrFileNotFound)
+	}
+
+	if !f.now().Before(upload.ExpiresAt) {
+		return nil, NewPathError(op, id, ErrUploadExpired)
+	}
+	return upload, nil
+}
+
+//appendUpload 将数据写入到上传的临时文件中，返回写入的字节数
+func (f *FileService) appendUpload(upload *models.Upload, r io.Reader) (int64, error) {
+	partialPath := filepath.Join(f.uploadAbsolutePath(), upload.ID)
+	partialFile, err := os.OpenFile(partialPath, os.O_WRONLY, 0666)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, NewPathError("patch", upload.ID, ErrFileIsMissing)
+		}
+		return 0, err
+	}
+	defer func() {
+		if err := partialFile.Close(); err != nil {
+			log.Error("msg", "occur a error when close file", "error", err.Error())
+		}
+	}()
+
+	//丢弃上次写入但未记录的数据
+	if err := partialFile.Truncate(upload.Offset); err != nil {
+		return 0, err
+	}
+
+	if _, err := partialFile.Seek(upload.Offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	return io.Copy(partialFile, io.LimitReader(r, upload.Length-upload.Offset))
+}
+
+func (f *FileService) finishUpload(upload *models.Upload, repos repository.UploadRepository) error {
+	partialPath := filepath.Join(f.uploadAbsolutePath(), upload.ID)
+	hash, md5Hash, size, err := hashFile(partialPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return NewPathError("patch", upload.ID, ErrFileIsMissing)
+		}
+		return err
+	}
+
+	if err := f.storeBlob(upload.Filename, partialPath, hash, md5Hash, size); err != nil {
+		return err
+	}
+
+	//创建文件失败时保留已上传的数据，客户端可以再次提交以完成上传
+	fileMod, err := f.createFileFromBlob(upload.Owner, upload.PFID, upload.Filename, hash, md5Hash, size, false)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(partialPath); err != nil {
+		log.Error("msg", "occur a error when delete file", "error", err.Error())
+	}
+
+	upload.FID = fileMod.FID
+	return repos.UpdateUpload(upload)
+}
+
+func (f *FileService) removeUpload(upload *models.Upload, repos repository.UploadRepository) error {
+	if !upload.Finished() {
+		partialPath := filepath.Join(f.uploadAbsolutePath(), upload.ID)
+		if err := os.Remove(partialPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return repos.DeleteUpload(upload)
+}
+
+//purgeUploads 定期清理过期的上传
+func (f *FileService) purgeUploads() {
+	for {
+		select {
+		case <-f.ctx.Done():
+			return
+		case <-time.After(f.config().FileService.Upload.PurgeInterval):
+		}
+
+		if err := f.purgeExpiredUploads(); err != nil {
+			log.Error("msg", "occur a error when purge expired uploads", "error", err.Error())
+		}
+	}
+}
+
+func (f *FileService) purgeExpiredUploads() error {
+	uploadRepository, err := f.dataContext.Upload()
+	if err != nil {
+		return err
+	}
+
+	for {
+		uploads, err := uploadRepository.GetExpiredUploads(f.now(), uploadPurgeBatch)
+		if err != nil {
+			return err
+		}
+
+		for _, upload := range uploads {
+			f.namedLocker.Lock(uploadLockerScope + upload.ID)
+			err := f.removeUpload(upload, uploadRepository)
+			f.namedLocker.UnLock(uploadLockerScope + upload.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(uploads) < uploadPurgeBatch {
+			return nil
+		}
+	}
+}
@@ -66,16 +66,19 @@ type UserService struct {
 	dataContext repository.DataContext
 	mailer      *mailer.Mailer
 	namedLocker locker.NamedLocker
+	webhooks    *WebhookService
+	actor       *Actor
 }
 
-//NewUserService 创建用户服务
+//NewUserService 创建用户服务，webhooks为空时不发布事件
 func NewUserService(
 	configFunc func() *config.Config,
 	uuid func() string,
 	now func() time.Time,
 	dataContext repository.DataContext,
 	mailer *mailer.Mailer,
-	namedLocker locker.NamedLocker) *UserService {
+	namedLocker locker.NamedLocker,
+	webhooks *WebhookService) *UserService {
 	return &UserService{
 		config:      configFunc,
 		uuid:        uuid,
@@ -83,6 +86,7 @@ func NewUserService(
 		dataContext: dataContext,
 		mailer:      mailer,
 		namedLocker: namedLocker,
+		webhooks:    webhooks,
 	}
 }
 
@@ -194,9 +198,37 @@ func (us *UserService) ResetPassword(params *UserResetPasswordParams) error {
 	}
 
 	user.Password = password.CreateHashPassword(params.Password)
+
+	var commited = false
+	UOW, err := us.dataContext.Unit()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if !commited {
+			if err := UOW.Rollback(); err != nil {
+				log.Warn("msg", "rollback failed in UserService.ResetPassword", "error", err.Error())
+			}
+		}
+	}()
+
+	userRepository, err = UOW.User()
+	if err != nil {
+		return err
+	}
+
 	if err := userRepository.UpdateUser(user); err != nil {
 		return err
 	}
+
+	if err := us.recordUserActivity(UOW, models.ActivityUserPasswordReset, user); err != nil {
+		return err
+	}
+
+	if err := UOW.Commit(); err != nil {
+		return err
+	}
+	commited = true
 	return nil
 }
 
@@ -289,9 +321,42 @@ func (us *UserService) RegisterUser(params *UserRegisterParams) (*models.User, e
 
 	newUser.Password = password.CreateHashPassword(params.Password)
 	newUser.Role = params.Role
+
+	var commited = false
+	UOW, err := us.dataContext.Unit()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if !commited {
+			if err := UOW.Rollback(); err != nil {
+				log.Warn("msg", "rollback failed in UserService.RegisterUser", "error", err.Error())
+			}
+		}
+	}()
+
+	userRepository, err = UOW.User()
+	if err != nil {
+		return nil, err
+	}
+
 	if err := userRepository.CreateUser(newUser); err != nil {
 		return nil, err
 	}
+
+	if err := us.recordUserActivity(UOW, models.ActivityUserRegistered, newUser); err != nil {
+		return nil, err
+	}
+
+	err = us.webhooks.publish(UOW, newUser.ID, models.EventUserRegistered, &userEvent{User: newUser})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := UOW.Commit(); err != nil {
+		return nil, err
+	}
+	commited = true
 	return newUser, nil
 }
 
@@ -301,18 +366,51 @@ type UserLoginParams struct {
 	Certificate string `json:"certificate"` //密码
 }
 
-//LoginUser 用户登录
+//LoginUser 用户登录，登录成功以及已有账号的密码错误都会记录在操作日志中
 func (us *UserService) LoginUser(params *UserLoginParams) (*models.Token, error) {
+	matchedUser, err := us.AuthenticateUser(params)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := us.generateUserToken(matchedUser)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := us.recordUserActivity(us.dataContext, models.ActivityUserLogin, matchedUser); err != nil {
+		log.Error("msg", "occur a error when record activity", "user_id", matchedUser.ID, "error", err.Error())
+	}
+	return token, nil
+}
+
+//AuthenticateUser 校验用户名(或邮箱)和密码，成功时返回用户，用于登录以及HTTP Basic认证，
+//已有账号的密码错误会记录在操作日志中
+func (us *UserService) AuthenticateUser(params *UserLoginParams) (*models.User, error) {
+	matchedUser, err := us.authenticateUser(params)
+	if err != nil {
+		if matchedUser != nil {
+			if err := us.recordUserActivity(us.dataContext, models.ActivityUserLoginFailed, matchedUser); err != nil {
+				log.Error("msg", "occur a error when record activity", "user_id", matchedUser.ID, "error", err.Error())
+			}
+		}
+		return nil, err
+	}
+	return matchedUser, nil
+}
+
+//authenticateUser 校验用户名(或邮箱)和密码，密码错误时同时返回匹配的用户
+func (us *UserService) authenticateUser(params *UserLoginParams) (*models.User, error) {
 	if params == nil {
-		return nil, invalidArgument("UserService", "params", "LoginUser")
+		return nil, invalidArgument("UserService", "params", "AuthenticateUser")
 	}
 
 	if params.Identity == "" {
-		return nil, invalidArgument("UserService", "params.Username", "LoginUser")
+		return nil, invalidArgument("UserService", "params.Username", "AuthenticateUser")
 	}
 
 	if params.Certificate == "" {
-		return nil, invalidArgument("UserService", "params.Password", "LoginUser")
+		return nil, invalidArgument("UserService", "params.Password", "AuthenticateUser")
 	}
 
 	userRepository, err := us.dataContext.User()
@@ -339,10 +437,9 @@ func (us *UserService) LoginUser(params *UserLoginParams) (*models.Token, error)
 	}
 
 	if !password.CompareHashPassword(params.Certificate, matchedUser.Password) {
-		return nil, NewUserError("login", ErrIncorrectUnameOrPWD)
+		return matchedUser, NewUserError("login", ErrIncorrectUnameOrPWD)
 	}
-
-	return us.generateUserToken(matchedUser)
+	return matchedUser, nil
 }
 
 //GetUserByID 通过ID获取用户信息
@@ -1,7 +1,17 @@
 package services
 
-import "fmt"
+import (
+	"fmt"
+	"path"
+	"strconv"
+)
 
 func invalidArgument(service, arg, method string) error {
 	return fmt.Errorf("%s: invalid argument '%s' in %s", service, arg, method)
-}
\ No newline at end of file
+}
+
+//numberedFilename 为文件名添加序号，如a.txt变为a (1).txt
+func numberedFilename(name string, n int) string {
+	ext := path.Ext(name)
+	return name[:len(name)-len(ext)] + " (" + strconv.Itoa(n) + ")" + ext
+}
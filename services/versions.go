@@ -0,0 +1,513 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"path"
+	"time"
+
+	"github.com/phantom-atom/file-explorer/internal/log"
+	"github.com/phantom-atom/file-explorer/models"
+	"github.com/phantom-atom/file-explorer/repository"
+	"github.com/phantom-atom/file-explorer/storage"
+)
+
+const versionPurgeBatch = 100
+
+//CreateFileVersion 上传文件的新版本，文件属于owner，存在于directoryID文件夹中，
+//同名文件不存在时创建新文件，存在时将原内容保存为历史版本，size与expected同CreateFile
+func (f *FileService) CreateFileVersion(owner string,
+	directoryID string,
+	name string,
+	size int64,
+	file io.Reader,
+	expected *Digest) (*models.File, error) {
+
+	if owner == "" {
+		return nil, invalidArgument("FileService", "owner", "CreateFileVersion")
+	}
+
+	if name == "" {
+		return nil, invalidArgument("FileService", "name", "CreateFileVersion")
+	}
+
+	if file == nil {
+		return nil, invalidArgument("FileService", "file", "CreateFileVersion")
+	}
+
+	if directoryID == "" {
+		directoryID = owner
+	}
+
+	file, err := f.limitToQuota("upload", owner, name, size, file)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, md5Hash, size, err := f.saveBlob(name, file, expected)
+	if err != nil {
+		return nil, err
+	}
+	return f.createFileFromBlob(owner, directoryID, name, hash, md5Hash, size, true)
+}
+
+//replaceFileContent 使用hash的内容作为同名文件的当前内容，同名文件不存在时创建文件
+func (f *FileService) replaceFileContent(owner string, directoryID string, name string,
+	hash string, md5Hash string, size int64) (*models.File, error) {
+	fileRepository, err := f.dataContext.File()
+	if err != nil {
+		return nil, err
+	}
+
+	currentFile, err := fileRepository.GetFileByPFIDAndName(owner, directoryID, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if currentFile == nil {
+		return f.createBlobFileModel(owner, directoryID, name, hash, md5Hash, size)
+	}
+
+	if currentFile.IsDir {
+		absPath := path.Join(currentFile.Directory, currentFile.Filename)
+		return nil, NewPathError("upload", absPath, ErrFileAlreadyExists)
+	}
+
+	var commited = false
+	UOW, err := f.dataContext.Unit()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if !commited {
+			if err := UOW.Rollback(); err != nil {
+				log.Warn("msg", "rollback failed in FileService.replaceFileContent", "error", err.Error())
+			}
+		}
+	}()
+
+	if err := f.swapFileVersion(currentFile, hash, md5Hash, size, UOW); err != nil {
+		return nil, err
+	}
+
+	if err := UOW.Commit(); err != nil {
+		return nil, err
+	}
+	commited = true
+	return currentFile, nil
+}
+
+//swapFileVersion 将文件的当前内容保存为新的历史版本，并使用hash的内容替换，
+//原内容的引用转移给历史版本，调用者需要已经获取hash的引用
+func (f *FileService) swapFileVersion(file *models.File, hash string, md5Hash string, size int64,
+	repos repository.DataRepository) error {
+	if err := f.checkUnlocked(file); err != nil {
+		return err
+	}
+
+	versionID := f.uuid()
+	if versionID == "" {
+		return errors.New("FileService: cannot create uuid in swapFileVersion")
+	}
+
+	fileRepository, err := repos.File()
+	if err != nil {
+		return err
+	}
+
+	versionRepository, err := repos.Version()
+	if err != nil {
+		return err
+	}
+
+	userRepository, err := repos.User()
+	if err != nil {
+		return err
+	}
+
+	blobRepository, err := repos.Blob()
+	if err != nil {
+		return err
+	}
+
+	oldHash := file.Hash
+	err = versionRepository.CreateFileVersion(&models.FileVersion{
+		ID:         versionID,
+		CreatedAt:  f.now(),
+		Owner:      file.Owner,
+		FID:        file.FID,
+		Size:       file.Size,
+		Hash:       file.Hash,
+		MD5:        file.MD5,
+		ModifiedAt: file.UpdatedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	//原内容的大小已经随历史版本计入，这里只计入新旧内容的差值
+	if err := userRepository.AddUsedBytes(file.Owner, size-file.Size); err != nil {
+		return err
+	}
+
+	file.Hash = hash
+	file.MD5 = md5Hash
+	file.Size = size
+	file.ContentType = f.contentTypeOf(file.Filename, models.BlobKey(hash), size)
+	file.HasThumbnail = false
+	if err := setStoredContent(file, blobRepository); err != nil {
+		return err
+	}
+
+	if err := fileRepository.UpdateFile(file); err != nil {
+		return err
+	}
+
+	if err := f.recordFileActivity(repos, models.ActivityFileUpdated, file, oldHash, hash); err != nil {
+		return err
+	}
+	return f.publishFileEvent(repos, models.EventFileUpdated, file, "")
+}
+
+//GetFileVersions 获取文件的历史版本，新版本在前，文件属于owner，编号为fid
+func (f *FileService) GetFileVersions(owner string, fid string) ([]*models.FileVersion, error) {
+	if owner == "" {
+		return nil, invalidArgument("FileService", "owner", "GetFileVersions")
+	}
+
+	if fid == "" {
+		return nil, invalidArgument("FileService", "fid", "GetFileVersions")
+	}
+
+	fileRepository, err := f.dataContext.File()
+	if err != nil {
+		return nil, err
+	}
+
+	versionRepository, err := f.dataContext.Version()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := fileRepository.GetFileByID(owner, fid)
+	if err != nil {
+		return nil, err
+	}
+
+	if file == nil {
+		return nil, NewPathError("versions", fid, ErrFileNotFound)
+	}
+
+	return versionRepository.GetFileVersions(owner, fid)
+}
+
+//DownloadFileVersion 下载文件的历史版本，返回的文件信息中FID为版本ID，修改时间为该版本的修改时间
+func (f *FileService) DownloadFileVersion(owner string, fid string, versionID string) (File, *models.File, error) {
+	if owner == "" {
+		return nil, nil, invalidArgument("FileService", "owner", "DownloadFileVersion")
+	}
+
+	if fid == "" {
+		return nil, nil, invalidArgument("FileService", "fid", "DownloadFileVersion")
+	}
+
+	if versionID == "" {
+		return nil, nil, invalidArgument("FileService", "versionID", "DownloadFileVersion")
+	}
+
+	fileRepository, err := f.dataContext.File()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	versionRepository, err := f.dataContext.Version()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := fileRepository.GetFileByID(owner, fid)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if file == nil {
+		return nil, nil, NewPathError("download", fid, ErrFileNotFound)
+	}
+
+	version, err := versionRepository.GetFileVersion(owner, fid, versionID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if version == nil {
+		return nil, nil, NewPathError("download", versionID, ErrFileNotFound)
+	}
+
+	info, err := f.storage.Stat(version.BlobKey())
+	if err != nil {
+		if err == storage.ErrNotFound {
+			log.Warn("msg", "file version content is missing", "owner", owner, "version_id", versionID, "key", version.BlobKey())
+			return nil, nil, NewPathError("download", versionID, ErrFileIsMissing)
+		}
+		return nil, nil, err
+	}
+
+	return storage.NewReader(f.storage, version.BlobKey(), info.Size), &models.File{
+		UpdatedAt: version.ModifiedAt,
+		FID:       version.ID,
+		Owner:     file.Owner,
+		Directory: file.Directory,
+		Filename:  file.Filename,
+		Size:      version.Size,
+		Hash:      version.Hash,
+		MD5:       version.MD5,
+		PFID:      file.PFID,
+	}, nil
+}
+
+//RestoreFileVersion 将历史版本恢复为文件的当前内容，当前内容保存为新的历史版本
+func (f *FileService) RestoreFileVersion(owner string, fid string, versionID string) (*models.File, error) {
+	if owner == "" {
+		return nil, invalidArgument("FileService", "owner", "RestoreFileVersion")
+	}
+
+	if fid == "" {
+		return nil, invalidArgument("FileService", "fid", "RestoreFileVersion")
+	}
+
+	if versionID == "" {
+		return nil, invalidArgument("FileService", "versionID", "RestoreFileVersion")
+	}
+
+	f.namedLocker.Lock(owner)
+	defer f.namedLocker.UnLock(owner)
+
+	var commited = false
+	UOW, err := f.dataContext.Unit()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if !commited {
+			if err := UOW.Rollback(); err != nil {
+				log.Warn("msg", "rollback failed in FileService.RestoreFileVersion", "error", err.Error())
+			}
+		}
+	}()
+
+	fileRepository, err := UOW.File()
+	if err != nil {
+		return nil, err
+	}
+
+	versionRepository, err := UOW.Version()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := fileRepository.GetFileByID(owner, fid)
+	if err != nil {
+		return nil, err
+	}
+
+	if file == nil {
+		return nil, NewPathError("restore", fid, ErrFileNotFound)
+	}
+
+	version, err := versionRepository.GetFileVersion(owner, fid, versionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if version == nil {
+		return nil, NewPathError("restore", versionID, ErrFileNotFound)
+	}
+
+	blobRepository, err := UOW.Blob()
+	if err != nil {
+		return nil, err
+	}
+
+	//文件引用历史版本的内容，随后删除历史版本时释放版本的引用
+	exists := false
+	if version.Hash != "" {
+		exists, err = blobRepository.AcquireBlob(version.Hash)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !exists {
+		return nil, NewPathError("restore", versionID, ErrFileIsMissing)
+	}
+
+	if err := f.swapFileVersion(file, version.Hash, version.MD5, version.Size, UOW); err != nil {
+		return nil, err
+	}
+
+	if err := versionRepository.DeleteFileVersion(version); err != nil {
+		return nil, err
+	}
+
+	if err := UOW.Commit(); err != nil {
+		return nil, err
+	}
+	commited = true
+	f.notifyBlobReleased()
+
+	if err := f.pruneFileVersions(file); err != nil {
+		log.Error("msg", "occur a error when prune file versions", "error", err.Error())
+	}
+
+	f.scheduleThumbnail(file)
+	return file, nil
+}
+
+//DeleteFileVersion 删除文件的历史版本，文件属于owner，编号为fid
+func (f *FileService) DeleteFileVersion(owner string, fid string, versionID string) error {
+	if owner == "" {
+		return invalidArgument("FileService", "owner", "DeleteFileVersion")
+	}
+
+	if fid == "" {
+		return invalidArgument("FileService", "fid", "DeleteFileVersion")
+	}
+
+	if versionID == "" {
+		return invalidArgument("FileService", "versionID", "DeleteFileVersion")
+	}
+
+	f.namedLocker.Lock(owner)
+	defer f.namedLocker.UnLock(owner)
+
+	var commited = false
+	UOW, err := f.dataContext.Unit()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if !commited {
+			if err := UOW.Rollback(); err != nil {
+				log.Warn("msg", "rollback failed in FileService.DeleteFileVersion", "error", err.Error())
+			}
+		}
+	}()
+
+	versionRepository, err := UOW.Version()
+	if err != nil {
+		return err
+	}
+
+	version, err := versionRepository.GetFileVersion(owner, fid, versionID)
+	if err != nil {
+		return err
+	}
+
+	if version == nil {
+		return NewPathError("delete", versionID, ErrFileNotFound)
+	}
+
+	if err := versionRepository.DeleteFileVersion(version); err != nil {
+		return err
+	}
+
+	err = recordActivity(UOW, f.actor, &models.Activity{
+		CreatedAt: f.now(),
+		Owner:     owner,
+		Action:    models.ActivityVersionDeleted,
+		FID:       fid,
+		OldValue:  versionID,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := UOW.Commit(); err != nil {
+		return err
+	}
+	commited = true
+	f.notifyBlobReleased()
+	return nil
+}
+
+//pruneFileVersions 删除超出数量限制或者超过保留时间的历史版本
+func (f *FileService) pruneFileVersions(file *models.File) error {
+	versionConf := &f.config().FileService.Version
+	if versionConf.MaxCount <= 0 && versionConf.MaxAge <= 0 {
+		return nil
+	}
+
+	versionRepository, err := f.dataContext.Version()
+	if err != nil {
+		return err
+	}
+
+	versions, err := versionRepository.GetFileVersions(file.Owner, file.FID)
+	if err != nil {
+		return err
+	}
+
+	before := f.now().Add(-versionConf.MaxAge)
+	for i, version := range versions {
+		exceeded := versionConf.MaxCount > 0 && i >= versionConf.MaxCount
+		expired := versionConf.MaxAge > 0 && version.CreatedAt.Before(before)
+		if !exceeded && !expired {
+			continue
+		}
+
+		if err := versionRepository.DeleteFileVersion(version); err != nil {
+			return err
+		}
+		f.notifyBlobReleased()
+	}
+	return nil
+}
+
+//purgeVersions 定期删除超过保留时间的历史版本
+func (f *FileService) purgeVersions() {
+	for {
+		select {
+		case <-f.ctx.Done():
+			return
+		case <-time.After(f.config().FileService.Version.PurgeInterval):
+		}
+
+		if err := f.purgeExpiredVersions(); err != nil {
+			log.Error("msg", "occur a error when purge expired file versions", "error", err.Error())
+		}
+	}
+}
+
+func (f *FileService) purgeExpiredVersions() error {
+	maxAge := f.config().FileService.Version.MaxAge
+	if maxAge <= 0 {
+		return nil
+	}
+
+	versionRepository, err := f.dataContext.Version()
+	if err != nil {
+		return err
+	}
+
+	before := f.now().Add(-maxAge)
+	for {
+		versions, err := versionRepository.GetExpiredFileVersions(before, versionPurgeBatch)
+		if err != nil {
+			return err
+		}
+
+		for _, version := range versions {
+			f.namedLocker.Lock(version.Owner)
+			err := versionRepository.DeleteFileVersion(version)
+			f.namedLocker.UnLock(version.Owner)
+			if err != nil {
+				return err
+			}
+			f.notifyBlobReleased()
+		}
+
+		if len(versions) < versionPurgeBatch {
+			return nil
+		}
+	}
+}
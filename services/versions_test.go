@@ -0,0 +1,94 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phantom-atom/file-explorer/models"
+)
+
+//newVersion 上传同名文件的新内容，原内容保存为历史版本
+func (env *testEnv) newVersion(owner string, name string, content string) *models.File {
+	file, err := env.files.CreateFileVersion(owner, "", name, int64(len(content)), strings.NewReader(content), nil)
+	if err != nil {
+		env.t.Fatalf("CreateFileVersion %s error: %v", name, err)
+	}
+	return file
+}
+
+//versionHashes 文件的历史版本内容，从新到旧
+func (env *testEnv) versionHashes(owner string, fid string) []string {
+	versions, err := env.files.GetFileVersions(owner, fid)
+	if err != nil {
+		env.t.Fatalf("GetFileVersions error: %v", err)
+	}
+
+	hashes := make([]string, 0, len(versions))
+	for _, version := range versions {
+		hashes = append(hashes, version.Hash)
+	}
+	return hashes
+}
+
+func TestPruneFileVersionsMaxCount(t *testing.T) {
+	env := newTestEnv(t)
+	env.conf.FileService.Version.MaxCount = 2
+	owner := env.createUser("alice", 0).ID
+
+	file := env.upload(owner, "", "a.txt", "v1")
+	for _, content := range []string{"v2", "v3", "v4"} {
+		env.now = env.now.Add(time.Minute)
+		env.newVersion(owner, "a.txt", content)
+	}
+
+	//只保留最新的MaxCount个历史版本
+	hashes := env.versionHashes(owner, file.FID)
+	if len(hashes) != 2 || hashes[0] != hashOf("v3") || hashes[1] != hashOf("v2") {
+		t.Fatalf("versions = %v, expected v3, v2", hashes)
+	}
+
+	if used := env.usedBytes(owner); used != 6 {
+		t.Errorf("used_bytes = %d, expected 6", used)
+	}
+	if n := env.count(&models.Blob{}, "hash = ? AND ref_count > 0", hashOf("v1")); n != 0 {
+		t.Errorf("pruned version blob is still referenced")
+	}
+}
+
+func TestPruneFileVersionsMaxAge(t *testing.T) {
+	env := newTestEnv(t)
+	env.conf.FileService.Version.MaxAge = time.Hour
+	owner := env.createUser("alice", 0).ID
+
+	file := env.upload(owner, "", "a.txt", "v1")
+	env.newVersion(owner, "a.txt", "v2")
+	env.now = env.now.Add(30 * time.Minute)
+	env.newVersion(owner, "a.txt", "v3")
+
+	if hashes := env.versionHashes(owner, file.FID); len(hashes) != 2 {
+		t.Fatalf("versions = %v, expected 2 versions within max age", hashes)
+	}
+
+	//定期清理删除超过保留时间的版本，保留时间之内的版本不受影响
+	env.now = env.now.Add(45 * time.Minute)
+	if err := env.files.purgeExpiredVersions(); err != nil {
+		t.Fatalf("purgeExpiredVersions error: %v", err)
+	}
+	hashes := env.versionHashes(owner, file.FID)
+	if len(hashes) != 1 || hashes[0] != hashOf("v2") {
+		t.Fatalf("versions after purge = %v, expected v2", hashes)
+	}
+
+	//创建新版本时同样清理过期的版本
+	env.now = env.now.Add(time.Hour)
+	env.newVersion(owner, "a.txt", "v4")
+	hashes = env.versionHashes(owner, file.FID)
+	if len(hashes) != 1 || hashes[0] != hashOf("v3") {
+		t.Fatalf("versions after create = %v, expected v3", hashes)
+	}
+
+	if used := env.usedBytes(owner); used != 4 {
+		t.Errorf("used_bytes = %d, expected 4", used)
+	}
+}
@@ -0,0 +1,476 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/phantom-atom/file-explorer/config"
+	"github.com/phantom-atom/file-explorer/internal/log"
+	"github.com/phantom-atom/file-explorer/internal/utils/random"
+	"github.com/phantom-atom/file-explorer/models"
+	"github.com/phantom-atom/file-explorer/repository"
+	"github.com/phantom-atom/file-explorer/webhook"
+)
+
+const (
+	webhookSecretLength  = 32
+	webhookDeliveryBatch = 100
+	webhookPurgeInterval = time.Hour
+)
+
+var (
+	//ErrWebhookNotFound webhook不存在
+	ErrWebhookNotFound = errors.New("webhook不存在")
+	//ErrWebhookInvalid webhook地址或者事件无效
+	ErrWebhookInvalid = errors.New("webhook地址或者事件无效")
+)
+
+//WebhookService webhook服务，事件在产生事件的事务中写入投递记录，事务提交后由后台协程投递，
+//失败后按指数退避重试
+type WebhookService struct {
+	config      func() *config.Config
+	uuid        func() string
+	now         func() time.Time
+	dataContext repository.DataContext
+	client      *webhook.Client
+	ctx         context.Context
+	cancel      context.CancelFunc
+	wakeup      chan struct{}
+}
+
+//NewWebhookService 创建WebhookService，client为发送投递请求使用的客户端，调用Start后才开始投递
+func NewWebhookService(
+	configFunc func() *config.Config,
+	uuid func() string,
+	now func() time.Time,
+	dataContext repository.DataContext,
+	client *http.Client,
+) *WebhookService {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	webhookService := &WebhookService{
+		config:      configFunc,
+		uuid:        uuid,
+		now:         now,
+		dataContext: dataContext,
+		client:      webhook.NewClient(client),
+		ctx:         ctx,
+		cancel:      cancel,
+		wakeup:      make(chan struct{}, 1),
+	}
+	return webhookService
+}
+
+//Start 启动后台投递协程，只在服务中调用，投递没有行级认领，多个投递协程会重复发送
+func (ws *WebhookService) Start() {
+	go ws.dispatch()
+}
+
+//WebhookParams webhook参数，更新时为空的字段不修改，Secret为空时创建随机的密钥
+type WebhookParams struct {
+	URL     string
+	Events  []string
+	Secret  string
+	Enabled *bool
+}
+
+//CreateWebhook 创建webhook，owner为空时创建接收所有用户事件的全局webhook，返回的Secret只在创建时可见
+func (ws *WebhookService) CreateWebhook(owner string, params *WebhookParams) (*models.Webhook, error) {
+	if params == nil {
+		return nil, invalidArgument("WebhookService", "params", "CreateWebhook")
+	}
+
+	if err := validateWebhookURL(params.URL); err != nil {
+		return nil, err
+	}
+
+	events, err := validateWebhookEvents(params.Events)
+	if err != nil {
+		return nil, err
+	}
+
+	id := ws.uuid()
+	if id == "" {
+		return nil, errors.New("WebhookService: cannot create uuid in CreateWebhook")
+	}
+
+	secret := params.Secret
+	if secret == "" {
+		secret = random.AlphanumericString(webhookSecretLength)
+		if secret == "" {
+			return nil, errors.New("WebhookService: cannot create secret in CreateWebhook")
+		}
+	}
+
+	hook := &models.Webhook{
+		ID:      id,
+		Owner:   owner,
+		URL:     params.URL,
+		Events:  events,
+		Secret:  secret,
+		Enabled: params.Enabled == nil || *params.Enabled,
+	}
+
+	webhookRepository, err := ws.dataContext.Webhook()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := webhookRepository.CreateWebhook(hook); err != nil {
+		return nil, err
+	}
+	return hook, nil
+}
+
+//UpdateWebhook 修改webhook的地址、事件、密钥或者启用状态
+func (ws *WebhookService) UpdateWebhook(owner string, id string, params *WebhookParams) (*models.Webhook, error) {
+	if params == nil {
+		return nil, invalidArgument("WebhookService", "params", "UpdateWebhook")
+	}
+
+	webhookRepository, err := ws.dataContext.Webhook()
+	if err != nil {
+		return nil, err
+	}
+
+	hook, err := ws.getWebhook(owner, id, webhookRepository)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.URL != "" {
+		if err := validateWebhookURL(params.URL); err != nil {
+			return nil, err
+		}
+		hook.URL = params.URL
+	}
+
+	if len(params.Events) > 0 {
+		events, err := validateWebhookEvents(params.Events)
+		if err != nil {
+			return nil, err
+		}
+		hook.Events = events
+	}
+
+	if params.Secret != "" {
+		hook.Secret = params.Secret
+	}
+
+	if params.Enabled != nil {
+		hook.Enabled = *params.Enabled
+	}
+
+	if err := webhookRepository.UpdateWebhook(hook); err != nil {
+		return nil, err
+	}
+	return hook, nil
+}
+
+//DeleteWebhook 删除webhook以及它的投递记录，未完成的投递不再发送
+func (ws *WebhookService) DeleteWebhook(owner string, id string) error {
+	webhookRepository, err := ws.dataContext.Webhook()
+	if err != nil {
+		return err
+	}
+
+	hook, err := ws.getWebhook(owner, id, webhookRepository)
+	if err != nil {
+		return err
+	}
+	return webhookRepository.DeleteWebhook(hook)
+}
+
+//GetWebhooks 获取owner创建的webhook，owner为空时获取全局webhook
+func (ws *WebhookService) GetWebhooks(owner string) ([]*models.Webhook, error) {
+	webhookRepository, err := ws.dataContext.Webhook()
+	if err != nil {
+		return nil, err
+	}
+	return webhookRepository.GetWebhooks(owner)
+}
+
+//GetWebhookDeliveries 获取webhook的投递记录，最新的在前
+func (ws *WebhookService) GetWebhookDeliveries(owner string, id string,
+	limit int, offset int) ([]*models.WebhookDelivery, error) {
+	webhookRepository, err := ws.dataContext.Webhook()
+	if err != nil {
+		return nil, err
+	}
+
+	hook, err := ws.getWebhook(owner, id, webhookRepository)
+	if err != nil {
+		return nil, err
+	}
+	return webhookRepository.GetWebhookDeliveries(hook.ID, limit, offset)
+}
+
+func (ws *WebhookService) getWebhook(owner string, id string,
+	repos repository.WebhookRepository) (*models.Webhook, error) {
+	hook, err := repos.GetWebhook(owner, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if hook == nil {
+		return nil, NewPathError("webhook", id, ErrWebhookNotFound)
+	}
+	return hook, nil
+}
+
+func validateWebhookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return NewPathError("webhook", rawURL, ErrWebhookInvalid)
+	}
+	return nil
+}
+
+//validateWebhookEvents 检查事件类型并去掉重复的事件
+func validateWebhookEvents(events []string) (models.EventList, error) {
+	if len(events) == 0 {
+		return nil, NewPathError("webhook", "events", ErrWebhookInvalid)
+	}
+
+	list := make(models.EventList, 0, len(events))
+	for _, event := range events {
+		if event != models.EventAll && !containsString(models.EventTypes, event) {
+			return nil, NewPathError("webhook", event, ErrWebhookInvalid)
+		}
+
+		if !containsString(list, event) {
+			list = append(list, event)
+		}
+	}
+	return list, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+//publish 在repos所在的事务中为订阅了event的webhook写入投递记录，事务回滚时事件不会发送，
+//ws为空时不发布事件
+func (ws *WebhookService) publish(repos repository.DataRepository, owner string, event string, data interface{}) error {
+	if ws == nil {
+		return nil
+	}
+
+	webhookRepository, err := repos.Webhook()
+	if err != nil {
+		return err
+	}
+
+	hooks, err := webhookRepository.GetSubscribedWebhooks(owner, event)
+	if err != nil {
+		return err
+	}
+
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	eventID := ws.uuid()
+	if eventID == "" {
+		return errors.New("WebhookService: cannot create uuid in publish")
+	}
+
+	now := ws.now()
+	payload, err := json.Marshal(&webhook.Event{
+		ID:        eventID,
+		Type:      event,
+		CreatedAt: now,
+		Owner:     owner,
+		Data:      data,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, hook := range hooks {
+		id := ws.uuid()
+		if id == "" {
+			return errors.New("WebhookService: cannot create uuid in publish")
+		}
+
+		err := webhookRepository.CreateWebhookDelivery(&models.WebhookDelivery{
+			ID:          id,
+			WebhookID:   hook.ID,
+			EventID:     eventID,
+			Event:       event,
+			Payload:     payload,
+			Status:      models.DeliveryStatusPending,
+			NextAttempt: now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	ws.notify()
+	return nil
+}
+
+//notify 唤醒投递协程，事务还没有提交时本次唤醒看不到新的记录，由下一次轮询投递
+func (ws *WebhookService) notify() {
+	select {
+	case ws.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (ws *WebhookService) dispatch() {
+	ticker := time.NewTicker(ws.config().Webhook.PollInterval)
+	defer ticker.Stop()
+
+	var lastPurge time.Time
+	for {
+		select {
+		case <-ws.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-ws.wakeup:
+		}
+
+		if err := ws.deliverDue(); err != nil {
+			log.Error("msg", "occur a error when deliver webhooks", "error", err.Error())
+		}
+
+		if ws.now().Sub(lastPurge) >= webhookPurgeInterval {
+			lastPurge = ws.now()
+			if err := ws.purgeDeliveries(); err != nil {
+				log.Error("msg", "occur a error when purge webhook deliveries", "error", err.Error())
+			}
+		}
+	}
+}
+
+//deliverDue 投递所有已经到达投递时间的记录
+func (ws *WebhookService) deliverDue() error {
+	webhookRepository, err := ws.dataContext.Webhook()
+	if err != nil {
+		return err
+	}
+
+	for {
+		deliveries, err := webhookRepository.GetDueWebhookDeliveries(ws.now(), webhookDeliveryBatch)
+		if err != nil {
+			return err
+		}
+
+		for _, delivery := range deliveries {
+			if ws.ctx.Err() != nil {
+				return nil
+			}
+
+			if err := ws.deliver(delivery, webhookRepository); err != nil {
+				return err
+			}
+		}
+
+		if len(deliveries) < webhookDeliveryBatch {
+			return nil
+		}
+	}
+}
+
+//deliver 发送一次投递并记录结果，失败时按指数退避安排下一次投递，超过最大次数后标记为失败
+func (ws *WebhookService) deliver(delivery *models.WebhookDelivery, repos repository.WebhookRepository) error {
+	conf := &ws.config().Webhook
+
+	hook, err := repos.GetWebhookByID(delivery.WebhookID)
+	if err != nil {
+		return err
+	}
+
+	if hook == nil || !hook.Enabled {
+		delivery.Status = models.DeliveryStatusFailed
+		delivery.Error = "webhook is disabled"
+		return repos.UpdateWebhookDelivery(delivery)
+	}
+
+	ctx, cancel := context.WithTimeout(ws.ctx, conf.Timeout)
+	code, err := ws.client.Deliver(ctx, &webhook.Request{
+		URL:       hook.URL,
+		Secret:    hook.Secret,
+		Event:     delivery.Event,
+		Delivery:  delivery.ID,
+		Timestamp: ws.now(),
+		Body:      delivery.Payload,
+	})
+	cancel()
+
+	//服务关闭时中断的投递不计入次数
+	if ws.ctx.Err() != nil {
+		return nil
+	}
+
+	now := ws.now()
+	delivery.Attempts++
+	delivery.ResponseCode = code
+	if err == nil {
+		delivery.Status = models.DeliveryStatusSucceeded
+		delivery.Error = ""
+		delivery.DeliveredAt = &now
+	} else {
+		delivery.Error = err.Error()
+		if delivery.Attempts >= conf.MaxAttempts {
+			delivery.Status = models.DeliveryStatusFailed
+		} else {
+			delivery.NextAttempt = now.Add(webhook.Backoff(delivery.Attempts, conf.RetryDelay, conf.MaxRetryDelay))
+		}
+	}
+	return repos.UpdateWebhookDelivery(delivery)
+}
+
+func (ws *WebhookService) purgeDeliveries() error {
+	webhookRepository, err := ws.dataContext.Webhook()
+	if err != nil {
+		return err
+	}
+
+	count, err := webhookRepository.DeleteWebhookDeliveries(ws.now().Add(-ws.config().Webhook.Retention))
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		log.Info("msg", "purge webhook deliveries finished", "count", count)
+	}
+	return nil
+}
+
+//Close 关闭服务，停止投递
+func (ws *WebhookService) Close() error {
+	ws.cancel()
+	return nil
+}
+
+//fileEvent 文件事件的数据，OldPath为移动或者重命名之前的路径
+type fileEvent struct {
+	File    *models.File `json:"file"`
+	OldPath string       `json:"old_path,omitempty"`
+}
+
+//userEvent 用户事件的数据
+type userEvent struct {
+	User *models.User `json:"user"`
+}
+
+//publishFileEvent 在repos所在的事务中发布文件事件
+func (f *FileService) publishFileEvent(repos repository.DataRepository, event string,
+	file *models.File, oldPath string) error {
+	return f.webhooks.publish(repos, file.Owner, event, &fileEvent{
+		File:    file,
+		OldPath: oldPath,
+	})
+}
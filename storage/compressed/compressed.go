@@ -0,0 +1,438 @@
+package compressed
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/phantom-atom/file-explorer/internal/log"
+	"github.com/phantom-atom/file-explorer/models"
+	"github.com/phantom-atom/file-explorer/storage"
+)
+
+const (
+	//EncodingGzip gzip压缩，与HTTP的Content-Encoding相同
+	EncodingGzip = "gzip"
+	//EncodingZstd zstd压缩，与HTTP的Content-Encoding相同
+	EncodingZstd = "zstd"
+
+	defaultFrameSize = 1 << 20
+	frameEntrySize   = 8
+)
+
+var (
+	errUnsupportedEncoding = errors.New("compressed_storage: unsupported encoding")
+	errSizeMismatch        = errors.New("compressed_storage: size mismatch")
+	errCorrupted           = errors.New("compressed_storage: object does not match the frame table")
+)
+
+//MetadataStore 压缩对象信息存储，repository.CompressedObjectRepository实现了该接口
+type MetadataStore interface {
+	GetCompressedObject(key string) (*models.CompressedObject, error)
+	SaveCompressedObject(*models.CompressedObject) error
+	DeleteCompressedObject(key string) error
+}
+
+//Backend 压缩存储，PutEncoded将内容按frameSize分帧，每一帧独立压缩后写入backend，分帧表保存在MetadataStore中，
+//范围读取时只解压范围内的分帧。每一帧都是完整的gzip成员或者zstd帧，整个对象可以直接作为HTTP的压缩内容返回，
+//Put写入的对象以及没有压缩信息的对象按原样读写，List返回的大小为存储中的大小
+type Backend struct {
+	backend     storage.Backend
+	objects     func() (MetadataStore, error)
+	frameSize   int
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+}
+
+//New 创建压缩存储，objects在每次访问压缩对象信息时调用
+func New(backend storage.Backend, objects func() (MetadataStore, error)) (*Backend, error) {
+	zstdEncoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	zstdDecoder, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Backend{
+		backend:     backend,
+		objects:     objects,
+		frameSize:   defaultFrameSize,
+		zstdEncoder: zstdEncoder,
+		zstdDecoder: zstdDecoder,
+	}, nil
+}
+
+//SupportedEncoding 是否支持encoding
+func SupportedEncoding(encoding string) bool {
+	return encoding == EncodingGzip || encoding == EncodingZstd
+}
+
+//frame 分帧表中的一项
+type frame struct {
+	storedSize int64
+	size       int64
+}
+
+//Put 按原样写入对象，并删除对象原来的压缩信息
+func (b *Backend) Put(key string, r io.Reader, size int64) error {
+	objects, err := b.objects()
+	if err != nil {
+		return err
+	}
+
+	if err := objects.DeleteCompressedObject(key); err != nil {
+		return err
+	}
+	return b.backend.Put(key, r, size)
+}
+
+//PutEncoded 以encoding压缩后写入对象，size为-1时表示长度未知，返回压缩后的大小
+func (b *Backend) PutEncoded(key string, r io.Reader, size int64, encoding string) (int64, error) {
+	if !SupportedEncoding(encoding) {
+		return 0, errUnsupportedEncoding
+	}
+
+	objects, err := b.objects()
+	if err != nil {
+		return 0, err
+	}
+
+	reader := &compressReader{
+		source:    r,
+		compress:  b.compressor(encoding),
+		frameSize: b.frameSize,
+		frames:    make([]byte, 0),
+	}
+
+	if err := b.backend.Put(key, reader, -1); err != nil {
+		return 0, err
+	}
+
+	if size >= 0 && reader.size != size {
+		err = errSizeMismatch
+	} else {
+		err = objects.SaveCompressedObject(&models.CompressedObject{
+			Key:        key,
+			Encoding:   encoding,
+			Size:       reader.size,
+			StoredSize: reader.storedSize,
+			Frames:     reader.frames,
+		})
+	}
+
+	if err != nil {
+		if e := b.backend.Delete(key); e != nil {
+			log.Error("msg", "occur a error when delete object", "key", key, "error", e.Error())
+		}
+		return 0, err
+	}
+	return reader.storedSize, nil
+}
+
+//Get 读取对象从offset开始的length个字节，压缩对象只读取并解压范围内的分帧
+func (b *Backend) Get(key string, offset int64, length int64) (io.ReadCloser, error) {
+	obj, err := b.object(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if obj == nil {
+		return b.backend.Get(key, offset, length)
+	}
+
+	if offset >= obj.Size || length == 0 {
+		return ioutil.NopCloser(bytes.NewReader(nil)), nil
+	}
+
+	if length < 0 || offset+length > obj.Size {
+		length = obj.Size - offset
+	}
+
+	frames, err := parseFrames(obj.Frames)
+	if err != nil {
+		return nil, err
+	}
+
+	first, last := -1, -1
+	var position, skip, start, end int64
+	for i, fr := range frames {
+		if first < 0 && position+fr.size > offset {
+			first = i
+			skip = offset - position
+			start = end
+		}
+
+		position += fr.size
+		end += fr.storedSize
+		if first >= 0 && position >= offset+length {
+			last = i
+			break
+		}
+	}
+
+	if first < 0 || last < 0 {
+		return nil, errCorrupted
+	}
+
+	body, err := b.backend.Get(key, start, end-start)
+	if err != nil {
+		return nil, err
+	}
+
+	return &decompressReader{
+		body:       body,
+		decompress: b.decompressor(obj.Encoding),
+		frames:     frames[first : last+1],
+		skip:       skip,
+		remain:     length,
+	}, nil
+}
+
+//GetEncoded 读取压缩后的对象内容以及大小，对象没有以encoding压缩时返回storage.ErrNotEncoded
+func (b *Backend) GetEncoded(key string, encoding string) (io.ReadCloser, int64, error) {
+	obj, err := b.object(key)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if obj == nil || obj.Encoding != encoding {
+		return nil, 0, storage.ErrNotEncoded
+	}
+
+	body, err := b.backend.Get(key, 0, -1)
+	if err != nil {
+		return nil, 0, err
+	}
+	return body, obj.StoredSize, nil
+}
+
+//Stat 获取对象信息，压缩对象的大小为解压后的大小
+func (b *Backend) Stat(key string) (*storage.ObjectInfo, error) {
+	info, err := b.backend.Stat(key)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := b.object(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if obj != nil {
+		info.Size = obj.Size
+	}
+	return info, nil
+}
+
+//Delete 删除对象以及对象的压缩信息
+func (b *Backend) Delete(key string) error {
+	if err := b.backend.Delete(key); err != nil {
+		return err
+	}
+
+	objects, err := b.objects()
+	if err != nil {
+		return err
+	}
+	return objects.DeleteCompressedObject(key)
+}
+
+//List 遍历以prefix开头的对象
+func (b *Backend) List(prefix string, fn func(*storage.ObjectInfo) error) error {
+	return b.backend.List(prefix, fn)
+}
+
+func (b *Backend) object(key string) (*models.CompressedObject, error) {
+	objects, err := b.objects()
+	if err != nil {
+		return nil, err
+	}
+	return objects.GetCompressedObject(key)
+}
+
+func (b *Backend) compressor(encoding string) func([]byte) ([]byte, error) {
+	if encoding == EncodingZstd {
+		return func(data []byte) ([]byte, error) {
+			return b.zstdEncoder.EncodeAll(data, nil), nil
+		}
+	}
+
+	return func(data []byte) ([]byte, error) {
+		buffer := &bytes.Buffer{}
+		writer := gzip.NewWriter(buffer)
+		if _, err := writer.Write(data); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		return buffer.Bytes(), nil
+	}
+}
+
+//decompressor 返回解压一帧的函数，size为这一帧解压后的大小
+func (b *Backend) decompressor(encoding string) func([]byte, int64) ([]byte, error) {
+	if encoding == EncodingZstd {
+		return func(data []byte, size int64) ([]byte, error) {
+			return b.zstdDecoder.DecodeAll(data, make([]byte, 0, size))
+		}
+	}
+
+	return func(data []byte, size int64) ([]byte, error) {
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		reader.Multistream(false)
+
+		plain := make([]byte, size)
+		if _, err := io.ReadFull(reader, plain); err != nil {
+			return nil, err
+		}
+		return plain, reader.Close()
+	}
+}
+
+func parseFrames(table []byte) ([]frame, error) {
+	if len(table)%frameEntrySize != 0 {
+		return nil, errCorrupted
+	}
+
+	frames := make([]frame, 0, len(table)/frameEntrySize)
+	for i := 0; i < len(table); i += frameEntrySize {
+		frames = append(frames, frame{
+			storedSize: int64(binary.LittleEndian.Uint32(table[i : i+4])),
+			size:       int64(binary.LittleEndian.Uint32(table[i+4 : i+8])),
+		})
+	}
+	return frames, nil
+}
+
+//compressReader 读取时逐帧压缩source并记录分帧表，buffer中是还没有被读取的压缩内容
+type compressReader struct {
+	source     io.Reader
+	compress   func([]byte) ([]byte, error)
+	frameSize  int
+	frames     []byte
+	size       int64
+	storedSize int64
+	buffer     []byte
+	done       bool
+}
+
+func (c *compressReader) Read(p []byte) (int, error) {
+	for len(c.buffer) == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+
+		if err := c.compressFrame(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, c.buffer)
+	c.buffer = c.buffer[n:]
+	return n, nil
+}
+
+func (c *compressReader) compressFrame() error {
+	plain := make([]byte, c.frameSize)
+	n, err := io.ReadFull(c.source, plain)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		c.done = true
+	} else if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return nil
+	}
+
+	compressed, err := c.compress(plain[:n])
+	if err != nil {
+		return err
+	}
+
+	entry := make([]byte, frameEntrySize)
+	binary.LittleEndian.PutUint32(entry[:4], uint32(len(compressed)))
+	binary.LittleEndian.PutUint32(entry[4:], uint32(n))
+	c.frames = append(c.frames, entry...)
+	c.size += int64(n)
+	c.storedSize += int64(len(compressed))
+	c.buffer = compressed
+	return nil
+}
+
+//decompressReader 从body中逐帧读取并解压，跳过第一帧中skip之前的内容，最多返回remain个字节
+type decompressReader struct {
+	body       io.ReadCloser
+	decompress func([]byte, int64) ([]byte, error)
+	frames     []frame
+	skip       int64
+	remain     int64
+	buffer     []byte
+}
+
+func (d *decompressReader) Read(p []byte) (int, error) {
+	if d.remain <= 0 {
+		return 0, io.EOF
+	}
+
+	for len(d.buffer) == 0 {
+		if err := d.nextFrame(); err != nil {
+			return 0, err
+		}
+	}
+
+	if int64(len(p)) > d.remain {
+		p = p[:d.remain]
+	}
+
+	n := copy(p, d.buffer)
+	d.buffer = d.buffer[n:]
+	d.remain -= int64(n)
+	return n, nil
+}
+
+func (d *decompressReader) nextFrame() error {
+	if len(d.frames) == 0 {
+		return errCorrupted
+	}
+
+	fr := d.frames[0]
+	d.frames = d.frames[1:]
+
+	compressed := make([]byte, fr.storedSize)
+	if _, err := io.ReadFull(d.body, compressed); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return errCorrupted
+		}
+		return err
+	}
+
+	plain, err := d.decompress(compressed, fr.size)
+	if err != nil {
+		return err
+	}
+
+	if int64(len(plain)) != fr.size {
+		return errCorrupted
+	}
+
+	d.buffer = plain[d.skip:]
+	d.skip = 0
+	return nil
+}
+
+func (d *decompressReader) Close() error {
+	return d.body.Close()
+}
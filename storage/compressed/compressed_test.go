@@ -0,0 +1,179 @@
+package compressed
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/phantom-atom/file-explorer/models"
+	"github.com/phantom-atom/file-explorer/storage"
+	"github.com/phantom-atom/file-explorer/storage/local"
+	"github.com/phantom-atom/file-explorer/storage/storagetest"
+)
+
+type memoryMetadataStore map[string]*models.CompressedObject
+
+func (m memoryMetadataStore) GetCompressedObject(key string) (*models.CompressedObject, error) {
+	return m[key], nil
+}
+
+func (m memoryMetadataStore) SaveCompressedObject(object *models.CompressedObject) error {
+	m[object.Key] = object
+	return nil
+}
+
+func (m memoryMetadataStore) DeleteCompressedObject(key string) error {
+	delete(m, key)
+	return nil
+}
+
+func newTestBackend(t *testing.T, frameSize int) (*Backend, storage.Backend, memoryMetadataStore) {
+	root, err := ioutil.TempDir("", "file-explorer-compressed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	raw := local.New(root)
+	store := make(memoryMetadataStore)
+	backend, err := New(raw, func() (MetadataStore, error) { return store, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.frameSize = frameSize
+	return backend, raw, store
+}
+
+func TestCompressedBackend(t *testing.T) {
+	backend, _, _ := newTestBackend(t, defaultFrameSize)
+	storagetest.TestBackend(t, backend)
+}
+
+func TestPutEncoded(t *testing.T) {
+	content := []byte(strings.Repeat("2020-01-01 00:00:00 INFO request handled\n", 20))
+	for _, encoding := range []string{EncodingGzip, EncodingZstd} {
+		backend, raw, store := newTestBackend(t, 300)
+		storedSize, err := backend.PutEncoded("blobs/aa/log", bytes.NewReader(content), int64(len(content)), encoding)
+		if err != nil {
+			t.Fatalf("PutEncoded(%s) error: %v", encoding, err)
+		}
+
+		stored := readAll(t, raw, "blobs/aa/log")
+		if int64(len(stored)) != storedSize || storedSize >= int64(len(content)) {
+			t.Errorf("%s: stored size = %d, object size = %d, content size = %d", encoding, storedSize, len(stored), len(content))
+		}
+
+		info, err := backend.Stat("blobs/aa/log")
+		if err != nil || info.Size != int64(len(content)) {
+			t.Errorf("%s: Stat = %v, %v, want size %d", encoding, info, err, len(content))
+		}
+
+		//范围跨越多个分帧以及从分帧中间开始
+		ranges := [][2]int64{{0, -1}, {0, 100}, {150, 250}, {299, 2}, {799, -1}, {int64(len(content)) - 1, 10}}
+		for _, r := range ranges {
+			body, err := backend.Get("blobs/aa/log", r[0], r[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadAll(body)
+			body.Close()
+
+			end := int64(len(content))
+			if r[1] >= 0 && r[0]+r[1] < end {
+				end = r[0] + r[1]
+			}
+			if err != nil || !bytes.Equal(got, content[r[0]:end]) {
+				t.Errorf("%s: Get(%d, %d) = %q, %v", encoding, r[0], r[1], got, err)
+			}
+		}
+
+		//压缩后的内容是完整的gzip或者zstd流
+		encoded, size, err := backend.GetEncoded("blobs/aa/log", encoding)
+		if err != nil || size != storedSize {
+			t.Fatalf("%s: GetEncoded = %d, %v", encoding, size, err)
+		}
+		encodedContent, err := ioutil.ReadAll(encoded)
+		encoded.Close()
+		if err != nil || !bytes.Equal(encodedContent, stored) {
+			t.Errorf("%s: GetEncoded content does not match the stored object", encoding)
+		}
+		if got := decode(t, encoding, encodedContent); !bytes.Equal(got, content) {
+			t.Errorf("%s: decoded content does not match", encoding)
+		}
+
+		if _, _, err := backend.GetEncoded("blobs/aa/log", "br"); err != storage.ErrNotEncoded {
+			t.Errorf("%s: GetEncoded(br) error = %v, want ErrNotEncoded", encoding, err)
+		}
+
+		//按原样写入后不再是压缩对象
+		if err := backend.Put("blobs/aa/log", bytes.NewReader(content[:10]), 10); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := store["blobs/aa/log"]; ok {
+			t.Errorf("%s: Put did not delete the compressed object", encoding)
+		}
+		if got := readAll(t, backend, "blobs/aa/log"); !bytes.Equal(got, content[:10]) {
+			t.Errorf("%s: read after Put = %q", encoding, got)
+		}
+	}
+}
+
+func TestPutEncodedSizeMismatch(t *testing.T) {
+	backend, raw, store := newTestBackend(t, 4)
+	if _, err := backend.PutEncoded("key", strings.NewReader("content"), 100, EncodingZstd); err == nil {
+		t.Fatal("PutEncoded with wrong size succeeded")
+	}
+
+	if _, err := raw.Stat("key"); err != storage.ErrNotFound {
+		t.Errorf("Stat after failed PutEncoded error = %v, want ErrNotFound", err)
+	}
+	if len(store) != 0 {
+		t.Errorf("compressed objects after failed PutEncoded = %v", store)
+	}
+}
+
+func decode(t *testing.T, encoding string, body []byte) []byte {
+	t.Helper()
+	var data []byte
+	var err error
+	if encoding == EncodingZstd {
+		var decoder *zstd.Decoder
+		decoder, err = zstd.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer decoder.Close()
+		data, err = ioutil.ReadAll(decoder)
+	} else {
+		var reader *gzip.Reader
+		reader, err = gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err = ioutil.ReadAll(reader)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func readAll(t *testing.T, b storage.Backend, key string) []byte {
+	body, err := b.Get(key, 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,526 @@
+package encrypted
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"github.com/phantom-atom/file-explorer/config"
+	"github.com/phantom-atom/file-explorer/models"
+	"github.com/phantom-atom/file-explorer/storage"
+)
+
+//对象格式：16字节的头部(magic、分帧大小、nonce前缀、保留字段)之后是AES-256-GCM加密的分帧，
+//每一帧的明文最多为frameSize字节，nonce为前缀加上帧序号，最后一帧的附加数据为1，防止对象被截断
+const (
+	headerSize       = 16
+	defaultFrameSize = 64 << 10
+	maxFrameSize     = 16 << 20
+	dataKeySize      = 32
+	noncePrefixSize  = 4
+	rotateBatch      = 100
+)
+
+var (
+	magic = []byte("FXE1")
+
+	errInvalidHeader = errors.New("encrypted_storage: invalid object header")
+	errTruncated     = errors.New("encrypted_storage: object is truncated")
+)
+
+//KeyStore 数据密钥存储，repository.DataKeyRepository实现了该接口
+type KeyStore interface {
+	GetDataKey(key string) (*models.DataKey, error)
+	SaveDataKey(*models.DataKey) error
+	DeleteDataKey(key string) error
+	GetDataKeys(afterKey string, limit int) ([]*models.DataKey, error)
+}
+
+//Backend 加密存储，每个对象使用随机的数据密钥加密后写入backend，数据密钥使用主密钥加密后保存在KeyStore中，
+//没有数据密钥的对象作为明文读取，因此可以在已有的存储上启用，
+//List返回的大小为存储中的大小
+type Backend struct {
+	backend   storage.Backend
+	keyring   *Keyring
+	keys      func() (KeyStore, error)
+	frameSize int
+}
+
+//NewBackend 根据配置创建加密存储，keys在每次访问数据密钥时调用
+func NewBackend(configFunc func() *config.Config, backend storage.Backend,
+	keys func() (KeyStore, error)) (*Backend, error) {
+	conf := &configFunc().Storage.Encryption
+
+	masterKeys := make(map[string][]byte)
+	if err := ParseMasterKeys(conf.MasterKeys, masterKeys); err != nil {
+		return nil, err
+	}
+
+	if conf.KeyFile != "" {
+		if err := ReadMasterKeyFile(conf.KeyFile, masterKeys); err != nil {
+			return nil, err
+		}
+	}
+
+	keyring, err := NewKeyring(conf.KeyID, masterKeys)
+	if err != nil {
+		return nil, err
+	}
+	return New(backend, keyring, keys), nil
+}
+
+//New 创建加密存储
+func New(backend storage.Backend, keyring *Keyring, keys func() (KeyStore, error)) *Backend {
+	return &Backend{
+		backend:   backend,
+		keyring:   keyring,
+		keys:      keys,
+		frameSize: defaultFrameSize,
+	}
+}
+
+//object 已加密对象的信息
+type object struct {
+	aead        cipher.AEAD
+	noncePrefix []byte
+	frameSize   int64
+	size        int64
+	frames      int64
+}
+
+//Put 加密并写入对象，对象已经有数据密钥时继续使用原来的数据密钥，只更换nonce前缀
+func (b *Backend) Put(key string, r io.Reader, size int64) error {
+	dataKey, err := b.dataKey(key, true)
+	if err != nil {
+		return err
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, headerSize)
+	copy(header, magic)
+	binary.BigEndian.PutUint32(header[4:8], uint32(b.frameSize))
+	if _, err := io.ReadFull(rand.Reader, header[8:8+noncePrefixSize]); err != nil {
+		return err
+	}
+
+	encryptedSize := int64(-1)
+	if size >= 0 {
+		encryptedSize = headerSize + size + frameCount(size, int64(b.frameSize))*int64(aead.Overhead())
+	}
+
+	return b.backend.Put(key, &encryptReader{
+		source:      bufio.NewReader(r),
+		aead:        aead,
+		noncePrefix: header[8 : 8+noncePrefixSize],
+		frameSize:   b.frameSize,
+		buffer:      header,
+	}, encryptedSize)
+}
+
+//Get 读取对象从offset开始的length个字节，只读取并解密范围内的分帧
+func (b *Backend) Get(key string, offset int64, length int64) (io.ReadCloser, error) {
+	obj, err := b.open(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if obj == nil {
+		return b.backend.Get(key, offset, length)
+	}
+
+	if offset >= obj.size || length == 0 {
+		return ioutil.NopCloser(bytes.NewReader(nil)), nil
+	}
+
+	if length < 0 || offset+length > obj.size {
+		length = obj.size - offset
+	}
+
+	encryptedFrameSize := obj.frameSize + int64(obj.aead.Overhead())
+	first := offset / obj.frameSize
+	last := (offset + length - 1) / obj.frameSize
+	start := headerSize + first*encryptedFrameSize
+	end := headerSize + obj.size + obj.frames*int64(obj.aead.Overhead())
+	if last+1 < obj.frames {
+		end = headerSize + (last+1)*encryptedFrameSize
+	}
+
+	body, err := b.backend.Get(key, start, end-start)
+	if err != nil {
+		return nil, err
+	}
+
+	return &decryptReader{
+		body:   body,
+		object: obj,
+		frame:  first,
+		skip:   offset - first*obj.frameSize,
+		remain: length,
+	}, nil
+}
+
+//Stat 获取对象信息，加密对象的大小为明文大小
+func (b *Backend) Stat(key string) (*storage.ObjectInfo, error) {
+	info, err := b.backend.Stat(key)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := b.openInfo(key, info, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if obj != nil {
+		info.Size = obj.size
+	}
+	return info, nil
+}
+
+//Delete 删除对象以及对象的数据密钥
+func (b *Backend) Delete(key string) error {
+	if err := b.backend.Delete(key); err != nil {
+		return err
+	}
+
+	keys, err := b.keys()
+	if err != nil {
+		return err
+	}
+	return keys.DeleteDataKey(key)
+}
+
+//List 遍历以prefix开头的对象
+func (b *Backend) List(prefix string, fn func(*storage.ObjectInfo) error) error {
+	return b.backend.List(prefix, fn)
+}
+
+//EncryptObjects 将以prefix开头的明文对象原地加密，返回加密的对象数量，已经加密的对象不做处理，
+//数据密钥在写入对象之前保存，中断时已经有数据密钥的明文对象不能读取，需要再次运行EncryptObjects
+func (b *Backend) EncryptObjects(prefix string) (int, error) {
+	count := 0
+	err := b.backend.List(prefix, func(info *storage.ObjectInfo) error {
+		obj, err := b.openInfo(info.Key, info, true)
+		if err != nil || obj != nil {
+			return err
+		}
+
+		body, err := b.backend.Get(info.Key, 0, -1)
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+
+		if err := b.Put(info.Key, body, info.Size); err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	return count, err
+}
+
+//RotateKeys 使用当前主密钥重新加密所有使用其他主密钥加密的数据密钥，对象内容不需要重新加密，返回轮换的数量
+func (b *Backend) RotateKeys() (int, error) {
+	keys, err := b.keys()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	lastKey := ""
+	for {
+		dataKeys, err := keys.GetDataKeys(lastKey, rotateBatch)
+		if err != nil {
+			return count, err
+		}
+
+		for _, dataKey := range dataKeys {
+			lastKey = dataKey.Key
+			if dataKey.KeyID == b.keyring.CurrentKeyID() {
+				continue
+			}
+
+			plainKey, err := b.keyring.unwrap(dataKey.KeyID, dataKey.WrappedKey, dataKey.Key)
+			if err != nil {
+				return count, err
+			}
+
+			dataKey.KeyID, dataKey.WrappedKey, err = b.keyring.wrap(plainKey, dataKey.Key)
+			if err != nil {
+				return count, err
+			}
+
+			if err := keys.SaveDataKey(dataKey); err != nil {
+				return count, err
+			}
+			count++
+		}
+
+		if len(dataKeys) < rotateBatch {
+			return count, nil
+		}
+	}
+}
+
+//CurrentKeyID 加密新数据密钥使用的主密钥
+func (b *Backend) CurrentKeyID() string {
+	return b.keyring.CurrentKeyID()
+}
+
+//dataKey 获取对象的数据密钥，不存在并且create为true时创建，否则返回nil
+func (b *Backend) dataKey(key string, create bool) ([]byte, error) {
+	keys, err := b.keys()
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := keys.GetDataKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if dataKey != nil {
+		return b.keyring.unwrap(dataKey.KeyID, dataKey.WrappedKey, key)
+	}
+
+	if !create {
+		return nil, nil
+	}
+
+	plainKey := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, plainKey); err != nil {
+		return nil, err
+	}
+
+	keyID, wrapped, err := b.keyring.wrap(plainKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	//先保存数据密钥再写入对象，写入失败时对象不存在或者仍然是明文，仍然是明文的对象由EncryptObjects重新加密
+	err = keys.SaveDataKey(&models.DataKey{
+		Key:        key,
+		KeyID:      keyID,
+		WrappedKey: wrapped,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return plainKey, nil
+}
+
+func (b *Backend) open(key string) (*object, error) {
+	info, err := b.backend.Stat(key)
+	if err != nil {
+		return nil, err
+	}
+	return b.openInfo(key, info, false)
+}
+
+//openInfo 读取对象的加密头部，没有数据密钥的对象是明文，返回nil；
+//有数据密钥但是没有加密头部的对象可能被替换过，返回errInvalidHeader，以免未经认证的内容被当作明文返回，
+//只有allowPlaintext为true时(EncryptObjects中断之后重新加密)作为明文处理
+func (b *Backend) openInfo(key string, info *storage.ObjectInfo, allowPlaintext bool) (*object, error) {
+	dataKey, err := b.dataKey(key, false)
+	if err != nil || dataKey == nil {
+		return nil, err
+	}
+
+	if info.Size < headerSize {
+		if allowPlaintext {
+			return nil, nil
+		}
+		return nil, errInvalidHeader
+	}
+
+	body, err := b.backend.Get(key, 0, headerSize)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(body, header); err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(header[:len(magic)], magic) {
+		if allowPlaintext {
+			return nil, nil
+		}
+		return nil, errInvalidHeader
+	}
+
+	frameSize := int64(binary.BigEndian.Uint32(header[4:8]))
+	if frameSize <= 0 || frameSize > maxFrameSize {
+		return nil, errInvalidHeader
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	//每一帧都有认证标签，最后一帧可以为空
+	encryptedFrameSize := frameSize + int64(aead.Overhead())
+	payload := info.Size - headerSize
+	frames := (payload + encryptedFrameSize - 1) / encryptedFrameSize
+	size := payload - frames*int64(aead.Overhead())
+	if frames == 0 || size < 0 {
+		return nil, errTruncated
+	}
+
+	return &object{
+		aead:        aead,
+		noncePrefix: header[8 : 8+noncePrefixSize],
+		frameSize:   frameSize,
+		size:        size,
+		frames:      frames,
+	}, nil
+}
+
+//frameCount 明文大小为size时的分帧数量，空对象有一个空的分帧
+func frameCount(size int64, frameSize int64) int64 {
+	if size == 0 {
+		return 1
+	}
+	return (size + frameSize - 1) / frameSize
+}
+
+func frameNonce(prefix []byte, frame int64) []byte {
+	nonce := make([]byte, noncePrefixSize+8)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint64(nonce[noncePrefixSize:], uint64(frame))
+	return nonce
+}
+
+func frameAdditionalData(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+//encryptReader 读取时加密source，buffer中是还没有被读取的密文
+type encryptReader struct {
+	source      *bufio.Reader
+	aead        cipher.AEAD
+	noncePrefix []byte
+	frameSize   int
+	frame       int64
+	buffer      []byte
+	done        bool
+}
+
+func (e *encryptReader) Read(p []byte) (int, error) {
+	for len(e.buffer) == 0 {
+		if e.done {
+			return 0, io.EOF
+		}
+
+		if err := e.sealFrame(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, e.buffer)
+	e.buffer = e.buffer[n:]
+	return n, nil
+}
+
+func (e *encryptReader) sealFrame() error {
+	plaintext := make([]byte, e.frameSize)
+	n, err := io.ReadFull(e.source, plaintext)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	//读满一帧时检查后面是否还有数据，没有数据时这一帧就是最后一帧
+	last := n < e.frameSize
+	if !last {
+		if _, err := e.source.Peek(1); err != nil {
+			if err != io.EOF {
+				return err
+			}
+			last = true
+		}
+	}
+
+	e.buffer = e.aead.Seal(nil, frameNonce(e.noncePrefix, e.frame), plaintext[:n], frameAdditionalData(last))
+	e.frame++
+	e.done = last
+	return nil
+}
+
+//decryptReader 从body中逐帧读取并解密，跳过第一帧中skip之前的内容，最多返回remain个字节
+type decryptReader struct {
+	body   io.ReadCloser
+	object *object
+	frame  int64
+	skip   int64
+	remain int64
+	buffer []byte
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	if d.remain <= 0 {
+		return 0, io.EOF
+	}
+
+	for len(d.buffer) == 0 {
+		if err := d.openFrame(); err != nil {
+			return 0, err
+		}
+	}
+
+	if int64(len(p)) > d.remain {
+		p = p[:d.remain]
+	}
+
+	n := copy(p, d.buffer)
+	d.buffer = d.buffer[n:]
+	d.remain -= int64(n)
+	return n, nil
+}
+
+func (d *decryptReader) openFrame() error {
+	obj := d.object
+	last := d.frame == obj.frames-1
+
+	length := obj.frameSize
+	if last {
+		length = obj.size - d.frame*obj.frameSize
+	}
+
+	ciphertext := make([]byte, length+int64(obj.aead.Overhead()))
+	if _, err := io.ReadFull(d.body, ciphertext); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return errTruncated
+		}
+		return err
+	}
+
+	plaintext, err := obj.aead.Open(ciphertext[:0], frameNonce(obj.noncePrefix, d.frame), ciphertext, frameAdditionalData(last))
+	if err != nil {
+		return err
+	}
+
+	d.buffer = plaintext[d.skip:]
+	d.skip = 0
+	d.frame++
+	return nil
+}
+
+func (d *decryptReader) Close() error {
+	return d.body.Close()
+}
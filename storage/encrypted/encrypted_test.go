@@ -0,0 +1,202 @@
+package encrypted
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/phantom-atom/file-explorer/models"
+	"github.com/phantom-atom/file-explorer/storage"
+	"github.com/phantom-atom/file-explorer/storage/local"
+	"github.com/phantom-atom/file-explorer/storage/storagetest"
+)
+
+type memoryKeyStore map[string]*models.DataKey
+
+func (m memoryKeyStore) GetDataKey(key string) (*models.DataKey, error) {
+	return m[key], nil
+}
+
+func (m memoryKeyStore) SaveDataKey(dataKey *models.DataKey) error {
+	m[dataKey.Key] = dataKey
+	return nil
+}
+
+func (m memoryKeyStore) DeleteDataKey(key string) error {
+	delete(m, key)
+	return nil
+}
+
+func (m memoryKeyStore) GetDataKeys(afterKey string, limit int) ([]*models.DataKey, error) {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		if key > afterKey {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+
+	dataKeys := make([]*models.DataKey, 0, len(keys))
+	for _, key := range keys {
+		dataKeys = append(dataKeys, m[key])
+	}
+	return dataKeys, nil
+}
+
+func newTestBackend(t *testing.T, frameSize int, masterKeys ...string) (*Backend, storage.Backend, memoryKeyStore) {
+	root, err := ioutil.TempDir("", "file-explorer-encrypted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	keys := make(map[string][]byte)
+	if err := ParseMasterKeys(masterKeys, keys); err != nil {
+		t.Fatal(err)
+	}
+
+	current := strings.SplitN(masterKeys[len(masterKeys)-1], ":", 2)[0]
+	keyring, err := NewKeyring(current, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw := local.New(root)
+	store := make(memoryKeyStore)
+	backend := New(raw, keyring, func() (KeyStore, error) { return store, nil })
+	backend.frameSize = frameSize
+	return backend, raw, store
+}
+
+const (
+	testKey1 = "one:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="
+	testKey2 = "two:AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE="
+)
+
+func TestEncryptedBackend(t *testing.T) {
+	backend, _, _ := newTestBackend(t, defaultFrameSize, testKey1)
+	storagetest.TestBackend(t, backend)
+
+	//分帧小于内容时范围读取需要跨越多个分帧
+	backend, _, _ = newTestBackend(t, 5, testKey1)
+	storagetest.TestBackend(t, backend)
+}
+
+func TestEncryptedBackendCiphertext(t *testing.T) {
+	backend, raw, _ := newTestBackend(t, 4, testKey1)
+	content := []byte("secret content")
+	if err := backend.Put("blobs/aa/key", bytes.NewReader(content), int64(len(content))); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := readAll(t, raw, "blobs/aa/key")
+	if bytes.Contains(stored, []byte("secret")) {
+		t.Errorf("stored object contains plaintext")
+	}
+
+	//截断最后一帧后读取失败
+	if err := raw.Put("blobs/aa/key", bytes.NewReader(stored[:len(stored)-20]), -1); err != nil {
+		t.Fatal(err)
+	}
+	body, err := backend.Get("blobs/aa/key", 0, -1)
+	if err == nil {
+		_, err = ioutil.ReadAll(body)
+		body.Close()
+	}
+	if err == nil {
+		t.Errorf("read truncated object succeeded")
+	}
+}
+
+func TestEncryptedBackendRejectsReplacedPlaintext(t *testing.T) {
+	backend, raw, _ := newTestBackend(t, 4, testKey1)
+	content := []byte("secret content")
+	if err := backend.Put("blobs/aa/key", bytes.NewReader(content), int64(len(content))); err != nil {
+		t.Fatal(err)
+	}
+
+	//有数据密钥的对象被替换为明文后不能读取
+	for _, replaced := range [][]byte{[]byte("replaced plaintext content"), []byte("short")} {
+		if err := raw.Put("blobs/aa/key", bytes.NewReader(replaced), -1); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := backend.Get("blobs/aa/key", 0, -1); err != errInvalidHeader {
+			t.Errorf("Get replaced object %q error = %v, want errInvalidHeader", replaced, err)
+		}
+		if _, err := backend.Stat("blobs/aa/key"); err != errInvalidHeader {
+			t.Errorf("Stat replaced object %q error = %v, want errInvalidHeader", replaced, err)
+		}
+	}
+
+	//EncryptObjects中断后留下的明文对象可以重新加密
+	count, err := backend.EncryptObjects("blobs/")
+	if err != nil || count != 1 {
+		t.Fatalf("EncryptObjects = %d, %v, want 1", count, err)
+	}
+	if got := readAll(t, backend, "blobs/aa/key"); !bytes.Equal(got, []byte("short")) {
+		t.Errorf("read after EncryptObjects = %q, want %q", got, "short")
+	}
+}
+
+func TestEncryptObjectsAndRotateKeys(t *testing.T) {
+	backend, raw, store := newTestBackend(t, 4, testKey1)
+	content := []byte("plaintext before encryption")
+	if err := raw.Put("blobs/aa/legacy", bytes.NewReader(content), int64(len(content))); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readAll(t, backend, "blobs/aa/legacy"); !bytes.Equal(got, content) {
+		t.Fatalf("read plaintext object = %q, want %q", got, content)
+	}
+
+	count, err := backend.EncryptObjects("blobs/")
+	if err != nil || count != 1 {
+		t.Fatalf("EncryptObjects = %d, %v, want 1", count, err)
+	}
+	if count, err := backend.EncryptObjects("blobs/"); err != nil || count != 0 {
+		t.Errorf("EncryptObjects again = %d, %v, want 0", count, err)
+	}
+	if bytes.Contains(readAll(t, raw, "blobs/aa/legacy"), content[:9]) {
+		t.Errorf("stored object contains plaintext after EncryptObjects")
+	}
+
+	stored := readAll(t, raw, "blobs/aa/legacy")
+	rotated, _, _ := newTestBackend(t, 4, testKey1, testKey2)
+	rotated.backend = raw
+	rotated.keys = backend.keys
+
+	count, err = rotated.RotateKeys()
+	if err != nil || count != 1 {
+		t.Fatalf("RotateKeys = %d, %v, want 1", count, err)
+	}
+	if store["blobs/aa/legacy"].KeyID != "two" {
+		t.Errorf("KeyID after RotateKeys = %q, want %q", store["blobs/aa/legacy"].KeyID, "two")
+	}
+	if !bytes.Equal(readAll(t, raw, "blobs/aa/legacy"), stored) {
+		t.Errorf("RotateKeys changed the stored object")
+	}
+	if got := readAll(t, rotated, "blobs/aa/legacy"); !bytes.Equal(got, content) {
+		t.Errorf("read after RotateKeys = %q, want %q", got, content)
+	}
+}
+
+func readAll(t *testing.T, b storage.Backend, key string) []byte {
+	body, err := b.Get(key, 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
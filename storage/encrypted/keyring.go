@@ -0,0 +1,143 @@
+package encrypted
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+const masterKeySize = 32
+
+var (
+	//ErrUnknownMasterKey 数据密钥使用的主密钥不在配置中
+	ErrUnknownMasterKey = errors.New("encrypted_storage: unknown master key")
+	errInvalidMasterKey = errors.New("encrypted_storage: master key must be \"id:base64\" of 32 bytes")
+	errWrappedKey       = errors.New("encrypted_storage: wrapped key is too short")
+)
+
+//Keyring 主密钥集合，新的数据密钥使用current对应的主密钥加密，其余主密钥只用于解密以及轮换
+type Keyring struct {
+	current string
+	keys    map[string][]byte
+}
+
+//NewKeyring 创建主密钥集合，keys中的密钥必须为32字节，current为空时keys只能包含一个密钥
+func NewKeyring(current string, keys map[string][]byte) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("encrypted_storage: no master key")
+	}
+
+	for id, key := range keys {
+		if id == "" || len(key) != masterKeySize {
+			return nil, errInvalidMasterKey
+		}
+
+		if current == "" && len(keys) == 1 {
+			current = id
+		}
+	}
+
+	if _, ok := keys[current]; !ok {
+		return nil, errors.New("encrypted_storage: key_id is not one of the master keys")
+	}
+
+	return &Keyring{
+		current: current,
+		keys:    keys,
+	}, nil
+}
+
+//ParseMasterKeys 解析"id:base64"格式的主密钥，忽略空行以及#开头的注释
+func ParseMasterKeys(lines []string, keys map[string][]byte) error {
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		i := strings.Index(line, ":")
+		if i <= 0 {
+			return errInvalidMasterKey
+		}
+
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(line[i+1:]))
+		if err != nil || len(key) != masterKeySize {
+			return errInvalidMasterKey
+		}
+		keys[strings.TrimSpace(line[:i])] = key
+	}
+	return nil
+}
+
+//ReadMasterKeyFile 读取每行一个主密钥的文件
+func ReadMasterKeyFile(filename string, keys map[string][]byte) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return ParseMasterKeys(lines, keys)
+}
+
+//CurrentKeyID 加密新数据密钥使用的主密钥
+func (k *Keyring) CurrentKeyID() string {
+	return k.current
+}
+
+//wrap 使用当前主密钥加密数据密钥，objectKey作为附加数据，数据密钥不能用于其他对象
+func (k *Keyring) wrap(dataKey []byte, objectKey string) (string, []byte, error) {
+	aead, err := newAEAD(k.keys[k.current])
+	if err != nil {
+		return "", nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", nil, err
+	}
+	return k.current, aead.Seal(nonce, nonce, dataKey, []byte(objectKey)), nil
+}
+
+//unwrap 使用keyID对应的主密钥解密数据密钥
+func (k *Keyring) unwrap(keyID string, wrapped []byte, objectKey string) ([]byte, error) {
+	masterKey, ok := k.keys[keyID]
+	if !ok {
+		return nil, ErrUnknownMasterKey
+	}
+
+	aead, err := newAEAD(masterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errWrappedKey
+	}
+
+	nonce := wrapped[:aead.NonceSize()]
+	return aead.Open(nil, nonce, wrapped[aead.NonceSize():], []byte(objectKey))
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,170 @@
+package local
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/phantom-atom/file-explorer/config"
+	"github.com/phantom-atom/file-explorer/internal/log"
+	"github.com/phantom-atom/file-explorer/storage"
+)
+
+//写入过程中的临时文件前缀，List时跳过
+const tempPrefix = ".put-"
+
+var errShortWrite = errors.New("local_storage: written size mismatch")
+
+type localBackend struct {
+	root string
+}
+
+//NewBackend 根据配置创建本地文件系统存储
+func NewBackend(configFunc func() *config.Config) (storage.Backend, error) {
+	root := configFunc().Storage.Local.AbsolutePath()
+	if root == "" {
+		return nil, errors.New("local_storage: basepath is empty")
+	}
+	return New(root), nil
+}
+
+//New 创建以root为根目录的本地文件系统存储
+func New(root string) storage.Backend {
+	return &localBackend{
+		root: root,
+	}
+}
+
+//absolutePath key经过清理，不会访问root以外的文件
+func (l *localBackend) absolutePath(key string) string {
+	return filepath.Join(l.root, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+//Put 先写入同目录下的临时文件再重命名，读取者不会看到写了一半的内容
+func (l *localBackend) Put(key string, r io.Reader, size int64) error {
+	absolutePath := l.absolutePath(key)
+	dir := filepath.Dir(absolutePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tempFile, err := ioutil.TempFile(dir, tempPrefix)
+	if err != nil {
+		return err
+	}
+
+	written, err := io.Copy(tempFile, r)
+	if err == nil && size >= 0 && written != size {
+		err = errShortWrite
+	}
+	if e := tempFile.Close(); e != nil && err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(tempFile.Name(), absolutePath)
+	}
+
+	if err != nil {
+		if e := os.Remove(tempFile.Name()); e != nil {
+			log.Error("msg", "occur a error when delete file", "error", e.Error())
+		}
+		return err
+	}
+	return nil
+}
+
+type limitedFile struct {
+	io.Reader
+	io.Closer
+}
+
+func (l *localBackend) Get(key string, offset int64, length int64) (io.ReadCloser, error) {
+	file, err := os.Open(l.absolutePath(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, err
+	}
+
+	if offset > 0 {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	if length < 0 {
+		return file, nil
+	}
+
+	return &limitedFile{
+		Reader: io.LimitReader(file, length),
+		Closer: file,
+	}, nil
+}
+
+func (l *localBackend) Stat(key string) (*storage.ObjectInfo, error) {
+	info, err := os.Stat(l.absolutePath(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return nil, storage.ErrNotFound
+	}
+
+	return &storage.ObjectInfo{
+		Key:     key,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}, nil
+}
+
+func (l *localBackend) Delete(key string) error {
+	if err := os.Remove(l.absolutePath(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (l *localBackend) List(prefix string, fn func(*storage.ObjectInfo) error) error {
+	//只遍历prefix所在的目录
+	walkRoot := l.absolutePath(path.Dir(prefix))
+	if _, err := os.Stat(walkRoot); os.IsNotExist(err) {
+		return nil
+	}
+
+	return filepath.Walk(walkRoot, func(absolutePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || strings.HasPrefix(info.Name(), tempPrefix) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(l.root, absolutePath)
+		if err != nil {
+			return err
+		}
+
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		return fn(&storage.ObjectInfo{
+			Key:     key,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	})
+}
@@ -0,0 +1,19 @@
+package local
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/phantom-atom/file-explorer/storage/storagetest"
+)
+
+func TestLocalBackend(t *testing.T) {
+	root, err := ioutil.TempDir("", "file-explorer-storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	storagetest.TestBackend(t, New(root))
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"errors"
+	"io"
+)
+
+var errNegativeOffset = errors.New("storage: negative offset")
+
+//Reader 基于Backend.Get的随机读取器，只在读取时才向后端发起请求，
+//实现了io.Reader、io.ReaderAt、io.Seeker以及io.Closer
+type Reader struct {
+	backend Backend
+	key     string
+	size    int64
+	offset  int64
+	body    io.ReadCloser
+}
+
+//NewReader 创建Reader，size为对象的长度
+func NewReader(backend Backend, key string, size int64) *Reader {
+	return &Reader{
+		backend: backend,
+		key:     key,
+		size:    size,
+	}
+}
+
+//Read io.Reader实现
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.body == nil {
+		body, err := r.backend.Get(r.key, r.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+//Seek io.Seeker实现，偏移量改变时下次读取重新请求
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	}
+
+	if offset < 0 {
+		return 0, errNegativeOffset
+	}
+
+	if offset != r.offset {
+		if err := r.closeBody(); err != nil {
+			return 0, err
+		}
+		r.offset = offset
+	}
+	return offset, nil
+}
+
+//ReadAt io.ReaderAt实现
+func (r *Reader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errNegativeOffset
+	}
+
+	if off >= r.size {
+		return 0, io.EOF
+	}
+
+	length := int64(len(p))
+	if remain := r.size - off; length > remain {
+		length = remain
+	}
+
+	body, err := r.backend.Get(r.key, off, length)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+
+	n, err := io.ReadFull(body, p[:length])
+	if err == nil && length < int64(len(p)) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+//Close io.Closer实现
+func (r *Reader) Close() error {
+	return r.closeBody()
+}
+
+func (r *Reader) closeBody() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
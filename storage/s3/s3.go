@@ -0,0 +1,156 @@
+package s3
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/minio/minio-go"
+	"github.com/phantom-atom/file-explorer/config"
+	"github.com/phantom-atom/file-explorer/storage"
+)
+
+type s3Backend struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+//NewBackend 根据配置创建S3兼容存储，bucket不存在时自动创建
+func NewBackend(configFunc func() *config.Config) (storage.Backend, error) {
+	s3Conf := &configFunc().Storage.S3
+
+	if s3Conf.Endpoint == "" {
+		return nil, errors.New("s3_storage: endpoint is empty")
+	}
+
+	if s3Conf.Bucket == "" {
+		return nil, errors.New("s3_storage: bucket is empty")
+	}
+
+	client, err := minio.NewWithRegion(s3Conf.Endpoint,
+		s3Conf.AccessKeyID,
+		s3Conf.SecretAccessKey,
+		s3Conf.SSL,
+		s3Conf.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := client.BucketExists(s3Conf.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		if err := client.MakeBucket(s3Conf.Bucket, s3Conf.Region); err != nil {
+			return nil, err
+		}
+	}
+
+	return &s3Backend{
+		client: client,
+		bucket: s3Conf.Bucket,
+		prefix: strings.Trim(s3Conf.Prefix, "/"),
+	}, nil
+}
+
+func (s *s3Backend) objectName(key string) string {
+	if s.prefix == "" {
+		return key
+	}
+	return s.prefix + "/" + key
+}
+
+func (s *s3Backend) key(objectName string) string {
+	if s.prefix == "" {
+		return objectName
+	}
+	return strings.TrimPrefix(objectName, s.prefix+"/")
+}
+
+//convertError 转换对象不存在的错误
+func convertError(err error) error {
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NotFound":
+		return storage.ErrNotFound
+	default:
+		return err
+	}
+}
+
+func (s *s3Backend) Put(key string, r io.Reader, size int64) error {
+	_, err := s.client.PutObject(s.bucket, s.objectName(key), r, size, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+	})
+	return err
+}
+
+func (s *s3Backend) Get(key string, offset int64, length int64) (io.ReadCloser, error) {
+	opts := minio.GetObjectOptions{}
+	switch {
+	case length == 0:
+		return ioutil.NopCloser(bytes.NewReader(nil)), nil
+	case length > 0:
+		if err := opts.SetRange(offset, offset+length-1); err != nil {
+			return nil, err
+		}
+	case offset > 0:
+		if err := opts.SetRange(offset, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	//Client.GetObject在Stat时会去掉Range，这里使用Core直接发起请求
+	core := minio.Core{Client: s.client}
+	body, _, err := core.GetObject(s.bucket, s.objectName(key), opts)
+	if err != nil {
+		return nil, convertError(err)
+	}
+	return body, nil
+}
+
+func (s *s3Backend) Stat(key string) (*storage.ObjectInfo, error) {
+	info, err := s.client.StatObject(s.bucket, s.objectName(key), minio.StatObjectOptions{})
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	return &storage.ObjectInfo{
+		Key:     key,
+		Size:    info.Size,
+		ModTime: info.LastModified,
+	}, nil
+}
+
+func (s *s3Backend) Delete(key string) error {
+	if err := s.client.RemoveObject(s.bucket, s.objectName(key)); err != nil {
+		if err := convertError(err); err != storage.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *s3Backend) List(prefix string, fn func(*storage.ObjectInfo) error) error {
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+
+	for info := range s.client.ListObjectsV2(s.bucket, s.objectName(prefix), true, doneCh) {
+		if info.Err != nil {
+			return info.Err
+		}
+
+		err := fn(&storage.ObjectInfo{
+			Key:     s.key(info.Key),
+			Size:    info.Size,
+			ModTime: info.LastModified,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
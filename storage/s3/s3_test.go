@@ -0,0 +1,146 @@
+package s3
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/phantom-atom/file-explorer/config"
+	"github.com/phantom-atom/file-explorer/storage/storagetest"
+)
+
+//fakeS3 只实现了驱动用到的S3接口，使用匿名请求，不校验签名
+type fakeS3 struct {
+	mu      sync.Mutex
+	buckets map[string]map[string][]byte
+	modTime time.Time
+}
+
+type fakeListResult struct {
+	XMLName     xml.Name `xml:"ListBucketResult"`
+	Name        string
+	Prefix      string
+	KeyCount    int
+	MaxKeys     int
+	IsTruncated bool
+	Contents    []fakeListContent
+}
+
+type fakeListContent struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int
+	StorageClass string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	bucketName := parts[0]
+	bucket, bucketExists := f.buckets[bucketName]
+
+	if len(parts) == 1 || parts[1] == "" {
+		switch {
+		case r.Method == http.MethodPut:
+			f.buckets[bucketName] = make(map[string][]byte)
+		case !bucketExists:
+			fakeError(w, http.StatusNotFound, "NoSuchBucket")
+		case r.Method == http.MethodGet:
+			f.list(w, bucketName, bucket, r.URL.Query())
+		}
+		return
+	}
+
+	key := parts[1]
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := ioutil.ReadAll(r.Body)
+		bucket[key] = data
+		w.Header().Set("ETag", `"etag"`)
+	case http.MethodGet, http.MethodHead:
+		data, ok := bucket[key]
+		if !ok {
+			fakeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeContent(w, r, key, f.modTime, bytes.NewReader(data))
+	case http.MethodDelete:
+		delete(bucket, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, name string, bucket map[string][]byte, query url.Values) {
+	prefix := query.Get("prefix")
+	result := &fakeListResult{
+		Name:    name,
+		Prefix:  prefix,
+		MaxKeys: 1000,
+	}
+
+	keys := make([]string, 0, len(bucket))
+	for key := range bucket {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		result.Contents = append(result.Contents, fakeListContent{
+			Key:          key,
+			LastModified: f.modTime.Format("2006-01-02T15:04:05.000Z"),
+			ETag:         `"etag"`,
+			Size:         len(bucket[key]),
+			StorageClass: "STANDARD",
+		})
+	}
+	result.KeyCount = len(result.Contents)
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+func fakeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write([]byte("<Error><Code>" + code + "</Code><Message>" + code + "</Message></Error>"))
+}
+
+func TestS3Backend(t *testing.T) {
+	server := httptest.NewServer(&fakeS3{
+		buckets: make(map[string]map[string][]byte),
+		modTime: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+	defer server.Close()
+
+	conf := &config.Config{}
+	conf.Storage.S3 = config.S3StorageConfig{
+		Endpoint: strings.TrimPrefix(server.URL, "http://"),
+		Region:   "us-east-1",
+		Bucket:   "file-explorer",
+		Prefix:   "data",
+	}
+
+	backend, err := NewBackend(func() *config.Config {
+		return conf
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storagetest.TestBackend(t, backend)
+}
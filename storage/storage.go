@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	//ErrNotFound 对象不存在
+	ErrNotFound = errors.New("not found")
+	//ErrNotEncoded 对象没有以指定的编码存储
+	ErrNotEncoded = errors.New("not encoded")
+)
+
+//ObjectInfo 对象信息
+type ObjectInfo struct {
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+//Backend 文件内容存储后端接口，key使用/分隔
+type Backend interface {
+	//Put 写入对象，size为-1时表示长度未知
+	Put(key string, r io.Reader, size int64) error
+	//Get 读取对象从offset开始的length个字节，length为-1时读取到结尾
+	Get(key string, offset int64, length int64) (io.ReadCloser, error)
+	Stat(key string) (*ObjectInfo, error)
+	//Delete 删除对象，对象不存在时不返回错误
+	Delete(key string) error
+	//List 遍历以prefix开头的对象，fn返回错误时停止遍历
+	List(prefix string, fn func(*ObjectInfo) error) error
+}
+
+//EncodedBackend 支持压缩存储的后端，Get、Stat返回解压后的内容和大小
+type EncodedBackend interface {
+	Backend
+	//PutEncoded 以encoding压缩后写入对象，返回压缩后的大小
+	PutEncoded(key string, r io.Reader, size int64, encoding string) (int64, error)
+	//GetEncoded 读取压缩后的对象内容以及大小，对象没有以encoding压缩时返回ErrNotEncoded
+	GetEncoded(key string, encoding string) (io.ReadCloser, int64, error)
+}
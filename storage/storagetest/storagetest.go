@@ -0,0 +1,107 @@
+package storagetest
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sort"
+	"testing"
+
+	"github.com/phantom-atom/file-explorer/storage"
+)
+
+//TestBackend 检查Backend实现是否符合storage.Backend的约定
+func TestBackend(t *testing.T, b storage.Backend) {
+	content := []byte("0123456789abcdef")
+	keys := []string{"blobs/aa/first", "blobs/ab/second", "legacy"}
+	for _, key := range keys {
+		if err := b.Put(key, bytes.NewReader(content), int64(len(content))); err != nil {
+			t.Fatalf("Put(%q) error: %v", key, err)
+		}
+	}
+
+	ranges := []struct {
+		offset int64
+		length int64
+		want   string
+	}{
+		{0, -1, "0123456789abcdef"},
+		{3, 4, "3456"},
+		{10, -1, "abcdef"},
+		{5, 0, ""},
+	}
+	for _, r := range ranges {
+		if got := readObject(t, b, keys[0], r.offset, r.length); got != r.want {
+			t.Errorf("Get(%d, %d) = %q, want %q", r.offset, r.length, got, r.want)
+		}
+	}
+
+	info, err := b.Stat(keys[0])
+	if err != nil {
+		t.Fatalf("Stat error: %v", err)
+	}
+	if info.Size != int64(len(content)) {
+		t.Errorf("Stat size = %d, want %d", info.Size, len(content))
+	}
+
+	if _, err := b.Stat("missing"); err != storage.ErrNotFound {
+		t.Errorf("Stat missing error = %v, want %v", err, storage.ErrNotFound)
+	}
+	if _, err := b.Get("missing", 0, -1); err != storage.ErrNotFound {
+		t.Errorf("Get missing error = %v, want %v", err, storage.ErrNotFound)
+	}
+
+	listed := make([]string, 0)
+	err = b.List("blobs/", func(info *storage.ObjectInfo) error {
+		listed = append(listed, info.Key)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("List error: %v", err)
+	}
+	sort.Strings(listed)
+	if len(listed) != 2 || listed[0] != keys[0] || listed[1] != keys[1] {
+		t.Errorf("List = %v, want %v", listed, keys[:2])
+	}
+
+	reader := storage.NewReader(b, keys[0], int64(len(content)))
+	if _, err := reader.Seek(-4, io.SeekEnd); err != nil {
+		t.Fatalf("Seek error: %v", err)
+	}
+	if got, err := ioutil.ReadAll(reader); err != nil || string(got) != "cdef" {
+		t.Errorf("read after Seek = %q, %v, want %q", got, err, "cdef")
+	}
+	buf := make([]byte, 4)
+	if n, err := reader.ReadAt(buf, 14); n != 2 || err != io.EOF || string(buf[:n]) != "ef" {
+		t.Errorf("ReadAt = %d %q %v, want 2 %q %v", n, buf[:n], err, "ef", io.EOF)
+	}
+	if err := reader.Close(); err != nil {
+		t.Errorf("Close error: %v", err)
+	}
+
+	for _, key := range keys {
+		if err := b.Delete(key); err != nil {
+			t.Errorf("Delete(%q) error: %v", key, err)
+		}
+	}
+	if err := b.Delete(keys[0]); err != nil {
+		t.Errorf("Delete deleted object error: %v", err)
+	}
+	if _, err := b.Stat(keys[0]); err != storage.ErrNotFound {
+		t.Errorf("Stat deleted object error = %v, want %v", err, storage.ErrNotFound)
+	}
+}
+
+func readObject(t *testing.T, b storage.Backend, key string, offset int64, length int64) string {
+	body, err := b.Get(key, offset, length)
+	if err != nil {
+		t.Fatalf("Get(%d, %d) error: %v", offset, length, err)
+	}
+	defer body.Close()
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatalf("Get(%d, %d) read error: %v", offset, length, err)
+	}
+	return string(data)
+}
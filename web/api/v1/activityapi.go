@@ -0,0 +1,55 @@
+package v1
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phantom-atom/file-explorer/services"
+	"github.com/phantom-atom/file-explorer/web/forms"
+)
+
+//activityParams 将查询表单转换为查询参数，未指定的时间不作为条件
+func activityParams(owner string, form *forms.ActivityQuery) *services.ActivityParams {
+	params := &services.ActivityParams{
+		Owner:   owner,
+		Actor:   form.Actor,
+		FID:     form.FileID,
+		Actions: form.Actions,
+		Cursor:  form.Cursor,
+		Limit:   form.Limit,
+	}
+
+	if !form.Since.IsZero() {
+		params.Since = timePtr(form.Since)
+	}
+	if !form.Until.IsZero() {
+		params.Until = timePtr(form.Until)
+	}
+	return params
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+//ActivityList 获取当前用户的操作日志API
+//GET /api/v1/activity
+func (api *API) ActivityList(c *gin.Context, form *forms.ActivityQuery) *APIResult {
+	owner := c.GetString("userID")
+
+	list, err := api.fileServ.GetActivities(activityParams(owner, form))
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(list, nil)
+}
+
+//AdminActivityList 获取所有用户的操作日志API
+//GET /api/v1/admin/activity
+func (api *API) AdminActivityList(c *gin.Context, form *forms.AdminActivityQuery) *APIResult {
+	list, err := api.fileServ.GetActivities(activityParams(form.Owner, &form.ActivityQuery))
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(list, nil)
+}
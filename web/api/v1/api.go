@@ -25,6 +25,8 @@ const (
 	ErrInvalidArgument    ErrorType = 5
 	ErrPermissionDenied   ErrorType = 6
 	ErrNotFound           ErrorType = 7
+	ErrResourceExhausted  ErrorType = 8
+	ErrLocked             ErrorType = 9
 )
 
 var errorName = []string{
@@ -36,11 +38,13 @@ var errorName = []string{
 	"invalid_argument",
 	"permisttion_denied",
 	"not_found",
+	"resource_exhausted",
+	"locked",
 }
 
 //ErrorTypeToName 转换错误码为字符串
 func ErrorTypeToName(e ErrorType) string {
-	if e > ErrNotFound {
+	if e > ErrLocked {
 		return "unknow"
 	}
 	return errorName[e]
@@ -76,22 +80,44 @@ type GinFunc func(*gin.Context) *APIResult
 
 //API API接口
 type API struct {
-	config   func() *config.Config
-	fileServ *services.FileService
-	userServ *services.UserService
+	config      func() *config.Config
+	fileServ    *services.FileService
+	userServ    *services.UserService
+	webhookServ *services.WebhookService
 }
 
 //NewAPI 创建API
 func NewAPI(configFunc func() *config.Config,
 	fileServ *services.FileService,
-	userServ *services.UserService) *API {
+	userServ *services.UserService,
+	webhookServ *services.WebhookService) *API {
 	return &API{
-		config:   configFunc,
-		fileServ: fileServ,
-		userServ: userServ,
+		config:      configFunc,
+		fileServ:    fileServ,
+		userServ:    userServ,
+		webhookServ: webhookServ,
 	}
 }
 
+//actorOf 请求的操作者以及来源，记录在操作日志中
+func actorOf(c *gin.Context) *services.Actor {
+	return &services.Actor{
+		UserID:    c.GetString("userID"),
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+}
+
+//fileService 以请求的操作者执行操作的FileService
+func (api *API) fileService(c *gin.Context) *services.FileService {
+	return api.fileServ.WithActor(actorOf(c))
+}
+
+//userService 以请求的操作者执行操作的UserService
+func (api *API) userService(c *gin.Context) *services.UserService {
+	return api.userServ.WithActor(actorOf(c))
+}
+
 //Gin 转换为gin使用的函数
 func (api *API) Gin(f GinFunc) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -133,6 +159,10 @@ func (api *API) respond(c *gin.Context, data interface{}) {
 }
 
 func (api *API) respondError(c *gin.Context, e *APIError, data interface{}) {
+	c.JSON(api.errorTypeToHTTPStatusCode(e.Code), api.errorResponse(e, data))
+}
+
+func (api *API) errorResponse(e *APIError, data interface{}) *response {
 	resp := &response{
 		Status: "error",
 		Data:   data,
@@ -152,8 +182,7 @@ func (api *API) respondError(c *gin.Context, e *APIError, data interface{}) {
 		}
 		log.Error("msg", "occur an error when request", "error", e.Err.Error())
 	}
-
-	c.JSON(statusCode, resp)
+	return resp
 }
 
 func (api *API) errorTypeToHTTPStatusCode(e ErrorType) int {
@@ -170,6 +199,10 @@ func (api *API) errorTypeToHTTPStatusCode(e ErrorType) int {
 		return http.StatusNotFound
 	case ErrPermissionDenied:
 		return http.StatusForbidden
+	case ErrResourceExhausted:
+		return http.StatusRequestEntityTooLarge
+	case ErrLocked:
+		return http.StatusLocked
 	case ErrInternal:
 		return http.StatusInternalServerError
 	default:
@@ -261,3 +294,25 @@ func NotFound(err error, data interface{}) *APIResult {
 		},
 	}
 }
+
+//ResourceExhausted ResourceExhausted
+func ResourceExhausted(err error, data interface{}) *APIResult {
+	return &APIResult{
+		Data: data,
+		Error: &APIError{
+			Code: ErrResourceExhausted,
+			Err:  err,
+		},
+	}
+}
+
+//Locked Locked
+func Locked(err error, data interface{}) *APIResult {
+	return &APIResult{
+		Data: data,
+		Error: &APIError{
+			Code: ErrLocked,
+			Err:  err,
+		},
+	}
+}
@@ -1,13 +1,21 @@
 package v1
 
 import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/phantom-atom/file-explorer/internal/log"
+	"github.com/phantom-atom/file-explorer/internal/utils/httputil"
 
 	"github.com/gin-gonic/gin"
+	"github.com/phantom-atom/file-explorer/models"
 	"github.com/phantom-atom/file-explorer/services"
+	"github.com/phantom-atom/file-explorer/storage"
 	"github.com/phantom-atom/file-explorer/web/forms"
 )
 
@@ -18,22 +26,41 @@ func fileErrorToAPIResult(err error) *APIResult {
 	}
 
 	switch pathErr.Err {
-	case services.ErrParentNotADirectory, services.ErrFileIsMissing, services.ErrCannotDownloadDirectory:
+	case services.ErrParentNotADirectory, services.ErrFileIsMissing, services.ErrCannotDownloadDirectory,
+		services.ErrBatchAborted, services.ErrRootDirectory, services.ErrArchiveTooLarge:
 		return FailedPrecondition(err, nil)
-	case services.ErrFileNotFound, services.ErrDirectoryNotFound:
+	case services.ErrFileNotFound, services.ErrDirectoryNotFound, services.ErrFileShareInvalid,
+		services.ErrBlobNotFound, services.ErrThumbnailUnavailable, services.ErrJobNotFound,
+		services.ErrWebhookNotFound:
 		return NotFound(err, nil)
+	case services.ErrFileSharePasswordIncorrect, services.ErrFileShareLocked:
+		return PermissionDenied(err, nil)
 	case services.ErrFileAlreadyExists:
 		return AlreadyExists(err, nil)
+	case services.ErrArchiveFormatUnsupported, services.ErrDigestMismatch, services.ErrCopyIntoItself,
+		services.ErrBatchOperationInvalid, services.ErrTagInvalid, services.ErrMetadataInvalid,
+		services.ErrAnnotationLimitExceeded, services.ErrInvalidCursor, services.ErrWebhookInvalid,
+		services.ErrActivityFilterInvalid:
+		return InvalidArgument(err, nil)
+	case services.ErrQuotaExceeded:
+		return ResourceExhausted(err, nil)
+	case services.ErrFileLocked:
+		return Locked(err, nil)
 	default:
 		return Internal(err, nil)
 	}
 }
 
-//FileUpload 上传文件API
-//POST /api/v1/file/upload
+//FileUpload 上传文件API，mode为new_version时同名文件的原内容保存为历史版本
+//POST /api/v1/file/upload?mode=new_version
 func (api *API) FileUpload(c *gin.Context, form *forms.FileUpload) *APIResult {
 	owner := c.GetString("userID")
 
+	uploadMode := &forms.FileUploadMode{}
+	if err := c.ShouldBindQuery(uploadMode); err != nil {
+		return InvalidArgument(err, nil)
+	}
+
 	multipartFile, err := form.File.Open()
 	if err != nil {
 		return InvalidArgument(err, nil)
@@ -43,11 +70,20 @@ func (api *API) FileUpload(c *gin.Context, form *forms.FileUpload) *APIResult {
 		form.DirectoryID = owner
 	}
 
-	createdFile, err := api.fileServ.CreateFile(owner,
+	createFile := api.fileService(c).CreateFile
+	if uploadMode.Mode == forms.UploadModeNewVersion {
+		createFile = api.fileService(c).CreateFileVersion
+	}
+
+	createdFile, err := createFile(owner,
 		form.DirectoryID,
 		form.File.Filename,
 		form.File.Size,
-		multipartFile)
+		multipartFile,
+		&services.Digest{
+			SHA256: form.SHA256,
+			MD5:    form.MD5,
+		})
 
 	if err != nil {
 		return fileErrorToAPIResult(err)
@@ -55,43 +91,260 @@ func (api *API) FileUpload(c *gin.Context, form *forms.FileUpload) *APIResult {
 	return OK(createdFile, nil)
 }
 
-//FileDownload 下载文件API
-//GET /api/v1/file/{id}
+//FileInstantUpload 秒传文件API，服务器已经存在相同内容时直接创建文件，不存在时返回not_found，
+//客户端需要改用/upload上传内容
+//POST /api/v1/file/instant?mode=new_version
+func (api *API) FileInstantUpload(c *gin.Context, form *forms.FileInstantUpload) *APIResult {
+	owner := c.GetString("userID")
+
+	uploadMode := &forms.FileUploadMode{}
+	if err := c.ShouldBindQuery(uploadMode); err != nil {
+		return InvalidArgument(err, nil)
+	}
+
+	if form.DirectoryID == "" {
+		form.DirectoryID = owner
+	}
+
+	createdFile, err := api.fileService(c).CreateFileByHash(owner,
+		form.DirectoryID,
+		form.Filename,
+		form.Hash,
+		form.Size,
+		uploadMode.Mode == forms.UploadModeNewVersion)
+
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(createdFile, nil)
+}
+
+//FileDownload 下载文件API，支持Range以及条件请求
+//GET,HEAD /api/v1/file/{id}
 func (api *API) FileDownload(c *gin.Context, form *forms.FileDownload) *APIResult {
 	owner := c.GetString("userID")
 
-	file, fileInfo, err := api.fileServ.Download(owner, form.ID)
+	file, fileInfo, err := api.fileService(c).Download(owner, form.ID)
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+
+	return OK(nil, fileResponder(file, fileInfo, form.Inline))
+}
+
+//FileThumbnail 获取图片文件的缩略图API
+//GET /api/v1/file/{id}/thumbnail?size=small|medium|large
+func (api *API) FileThumbnail(c *gin.Context, form *forms.FileThumbnail) *APIResult {
+	owner := c.GetString("userID")
+
+	file, fileInfo, err := api.fileService(c).GetThumbnail(owner, form.ID, form.Size)
 	if err != nil {
 		return fileErrorToAPIResult(err)
 	}
 
-	return OK(nil, func(c *gin.Context, data interface{}) error {
+	return OK(nil, fileResponder(file, fileInfo, true))
+}
+
+//fileDigest 生成RFC 3230的Digest响应头，摘要为完整文件内容的摘要，与Range无关
+func fileDigest(fileInfo *models.File) string {
+	digests := make([]string, 0, 2)
+	if sum, err := hex.DecodeString(fileInfo.Hash); err == nil && len(sum) > 0 {
+		digests = append(digests, "sha-256="+base64.StdEncoding.EncodeToString(sum))
+	}
+	if sum, err := hex.DecodeString(fileInfo.MD5); err == nil && len(sum) > 0 {
+		digests = append(digests, "md5="+base64.StdEncoding.EncodeToString(sum))
+	}
+	return strings.Join(digests, ",")
+}
+
+func fileResponder(file services.File, fileInfo *models.File, inline bool) func(c *gin.Context, data interface{}) error {
+	return func(c *gin.Context, data interface{}) error {
 		defer func() {
 			if err := file.Close(); err != nil {
 				log.Error("msg", "occur a error when close file", "error", err.Error())
 			}
 		}()
 
-		c.Header("Content-Type", "application/octet-stream")
-		c.Header("Content-Disposition", "attachment; filename="+fileInfo.Filename)
-		if _, err := io.Copy(c.Writer, file); err != nil {
-			return err
+		//只有不能执行脚本的类型才以inline方式返回，其它类型即使请求inline也作为附件下载，
+		//禁止浏览器猜测类型，附件沙箱化，以免上传的HTML或者SVG在站点的源中执行；
+		//inline的类型不沙箱化，浏览器不会在沙箱文档中显示PDF
+		disposition := "attachment"
+		if inline && httputil.InlineSafe(fileInfo.ContentType) {
+			disposition = "inline"
 		}
-		c.Status(http.StatusOK)
+
+		c.Header("Content-Disposition", httputil.ContentDisposition(disposition, fileInfo.Filename))
+		c.Header("X-Content-Type-Options", "nosniff")
+		if disposition == "attachment" {
+			c.Header("Content-Security-Policy", "sandbox")
+		}
+		c.Header("ETag", fileInfo.ETag())
+		if fileInfo.ContentType != "" {
+			c.Header("Content-Type", fileInfo.ContentType)
+		}
+		if digest := fileDigest(fileInfo); digest != "" {
+			c.Header("Digest", digest)
+		}
+
+		if encoded, ok := file.(services.EncodedFile); ok {
+			c.Header("Vary", "Accept-Encoding")
+			//Range请求的范围是解压后的内容，只有完整下载时才直接返回压缩内容
+			if c.GetHeader("Range") == "" && httputil.AcceptsEncoding(c.GetHeader("Accept-Encoding"), encoded.Encoding()) {
+				served, err := serveEncoded(c, encoded, fileInfo)
+				if served || err != nil {
+					return err
+				}
+			}
+		}
+
+		//没有设置Content-Type时ServeContent根据扩展名或内容设置，并处理Range、If-None-Match、If-Range等请求头
+		http.ServeContent(c.Writer, c.Request, fileInfo.Filename, fileInfo.UpdatedAt, file)
 		return nil
+	}
+}
+
+//serveEncoded 直接返回压缩存储的内容，压缩后的内容是另一种表示，使用不同的ETag，
+//压缩信息不存在时返回false，由调用者返回解压后的内容
+func serveEncoded(c *gin.Context, file services.EncodedFile, fileInfo *models.File) (bool, error) {
+	body, size, err := file.OpenEncoded()
+	if err != nil {
+		if err == storage.ErrNotEncoded {
+			return false, nil
+		}
+		return false, err
+	}
+	defer func() {
+		if err := body.Close(); err != nil {
+			log.Error("msg", "occur a error when close file", "error", err.Error())
+		}
+	}()
+
+	c.Header("ETag", strings.TrimSuffix(fileInfo.ETag(), `"`)+"-"+file.Encoding()+`"`)
+	c.Header("Content-Encoding", file.Encoding())
+	//设置了Content-Encoding时ServeContent不设置Content-Length
+	c.Header("Content-Length", strconv.FormatInt(size, 10))
+	http.ServeContent(c.Writer, c.Request, fileInfo.Filename, fileInfo.UpdatedAt, &encodedContent{
+		body: body,
+		size: size,
 	})
+	return true, nil
+}
+
+//encodedContent 压缩后的内容，只支持ServeContent获取大小时的Seek，没有Range请求时不需要其他Seek
+type encodedContent struct {
+	body io.Reader
+	size int64
+}
+
+func (e *encodedContent) Read(p []byte) (int, error) {
+	return e.body.Read(p)
 }
 
-//FileGetRootList 获取文件信息
+func (e *encodedContent) Seek(offset int64, whence int) (int64, error) {
+	switch {
+	case offset == 0 && whence == io.SeekStart:
+		return 0, nil
+	case offset == 0 && whence == io.SeekEnd:
+		return e.size, nil
+	}
+	return 0, errors.New("encodedContent: seek is not supported")
+}
+
+//FileArchive 以归档方式下载文件夹API
+//GET /api/v1/file/{id}/archive
+func (api *API) FileArchive(c *gin.Context, form *forms.FileArchive) *APIResult {
+	owner := c.GetString("userID")
+
+	archive, err := api.fileService(c).CreateArchive(owner, []string{form.ID}, form.Format)
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(nil, archiveResponder(archive))
+}
+
+//FileArchiveBatch 以归档方式下载多个文件API
+//POST /api/v1/file/archive
+func (api *API) FileArchiveBatch(c *gin.Context, form *forms.FileArchiveBatch) *APIResult {
+	owner := c.GetString("userID")
+
+	archive, err := api.fileService(c).CreateArchive(owner, form.FileIDs, form.Format)
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(nil, archiveResponder(archive))
+}
+
+//FileBatch 在同一个事务中批量删除、移动、重命名、复制文件API，返回与operations一一对应的结果
+//POST /api/v1/file/batch
+func (api *API) FileBatch(c *gin.Context, form *forms.FileBatch) *APIResult {
+	owner := c.GetString("userID")
+
+	operations := make([]*services.BatchOperation, len(form.Operations))
+	for i, operation := range form.Operations {
+		if operation.DirectoryID == "@" {
+			operation.DirectoryID = owner
+		}
+
+		operations[i] = &services.BatchOperation{
+			Op:          operation.Op,
+			FID:         operation.FileID,
+			DirectoryID: operation.DirectoryID,
+			NewName:     operation.NewName,
+		}
+	}
+
+	atomic := form.Mode != forms.BatchModeBestEffort
+	results, err := api.fileService(c).BatchFiles(owner, operations, atomic)
+	if results == nil {
+		return fileErrorToAPIResult(err)
+	}
+
+	items := make([]*response, len(results))
+	for i, result := range results {
+		if result.Err != nil {
+			items[i] = api.errorResponse(fileErrorToAPIResult(result.Err).Error, nil)
+			continue
+		}
+
+		items[i] = &response{
+			Status: "success",
+		}
+		if result.File != nil {
+			items[i].Data = result.File
+		}
+	}
+
+	if err != nil {
+		apiResult := fileErrorToAPIResult(err)
+		apiResult.Data = items
+		return apiResult
+	}
+	return OK(items, nil)
+}
+
+func archiveResponder(archive *services.Archive) func(c *gin.Context, data interface{}) error {
+	return func(c *gin.Context, data interface{}) error {
+		c.Header("Content-Type", archive.ContentType())
+		c.Header("Content-Disposition", httputil.ContentDisposition("attachment", archive.Name))
+		c.Status(http.StatusOK)
+		if err := archive.Stream(c.Writer); err != nil {
+			//响应头已经发送，只能记录错误，客户端会得到不完整的归档
+			log.Error("msg", "occur a error when stream archive", "name", archive.Name, "error", err.Error())
+		}
+		return nil
+	}
+}
+
+//FileGetRootList 获取根目录文件列表
 //GET /api/v1/file
-func (api *API) FileGetRootList(c *gin.Context) *APIResult {
+func (api *API) FileGetRootList(c *gin.Context, form *forms.FileListQuery) *APIResult {
 	owner := c.GetString("userID")
 
-	file, err := api.fileServ.GetFileByPID(owner, owner, 0, 0)
+	list, err := api.fileService(c).ListFiles(owner, fileListParams(owner, form))
 	if err != nil {
 		return fileErrorToAPIResult(err)
 	}
-	return OK(file, nil)
+	return OK(list, nil)
 }
 
 //FileGetInfo 获取文件信息
@@ -99,19 +352,66 @@ func (api *API) FileGetRootList(c *gin.Context) *APIResult {
 func (api *API) FileGetInfo(c *gin.Context, form *forms.FileID) *APIResult {
 	owner := c.GetString("userID")
 
-	file, err := api.fileServ.GetFileByID(owner, form.ID)
+	file, err := api.fileService(c).GetFileByID(owner, form.ID)
 	if err != nil {
 		return fileErrorToAPIResult(err)
 	}
 	return OK(file, nil)
 }
 
-//FileGetList 获取文件夹文件列表
+//FileGetList 获取文件夹文件列表，可以排序，按照类型、扩展名、MIME分类以及标签过滤，
+//返回的next_cursor用于获取下一页
 //GET /api/v1/file/{id}/list
 func (api *API) FileGetList(c *gin.Context, form *forms.FileQuery) *APIResult {
 	owner := c.GetString("userID")
 
-	files, err := api.fileServ.GetFileByPID(owner, form.ID, form.Limit, form.Offset)
+	list, err := api.fileService(c).ListFiles(owner, fileListParams(form.ID, &form.FileListQuery))
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(list, nil)
+}
+
+func fileListParams(parentID string, form *forms.FileListQuery) *services.FileListParams {
+	return &services.FileListParams{
+		ParentID:  parentID,
+		Type:      form.Type,
+		Extension: form.Extension,
+		Category:  form.Category,
+		Tag:       form.Tag,
+		Sort:      form.Sort,
+		Desc:      form.Order == "desc",
+		DirsFirst: form.DirsFirst,
+		Cursor:    form.Cursor,
+		Limit:     form.Limit,
+		Offset:    form.Offset,
+	}
+}
+
+//FileSearch 搜索文件API，按文件名和路径匹配关键字
+//GET /api/v1/search
+func (api *API) FileSearch(c *gin.Context, form *forms.FileSearch) *APIResult {
+	owner := c.GetString("userID")
+
+	files, err := api.fileService(c).SearchFiles(owner, &services.FileSearchParams{
+		Keyword:       form.Keyword,
+		Match:         form.Match,
+		DirectoryID:   form.DirectoryID,
+		IsDir:         form.IsDir,
+		MinSize:       form.MinSize,
+		MaxSize:       form.MaxSize,
+		CreatedAfter:  form.CreatedAfter,
+		CreatedBefore: form.CreatedBefore,
+		UpdatedAfter:  form.UpdatedAfter,
+		UpdatedBefore: form.UpdatedBefore,
+		Extension:     form.Extension,
+		Category:      form.Category,
+		Tag:           form.Tag,
+		Sort:          form.Sort,
+		Desc:          form.Order == "desc",
+		Limit:         form.Limit,
+		Offset:        form.Offset,
+	})
 	if err != nil {
 		return fileErrorToAPIResult(err)
 	}
@@ -123,7 +423,7 @@ func (api *API) FileGetList(c *gin.Context, form *forms.FileQuery) *APIResult {
 func (api *API) FileDelete(c *gin.Context, form *forms.FileID) *APIResult {
 	owner := c.GetString("userID")
 
-	err := api.fileServ.DeleteFile(owner, form.ID)
+	err := api.fileService(c).DeleteFile(owner, form.ID)
 	if err != nil {
 		return fileErrorToAPIResult(err)
 	}
@@ -139,7 +439,7 @@ func (api *API) FileMkdir(c *gin.Context, form *forms.FileMkdir) *APIResult {
 		form.DirectoryID = owner
 	}
 
-	createdDir, err := api.fileServ.CreateDirectory(owner,
+	createdDir, err := api.fileService(c).CreateDirectory(owner,
 		form.DirectoryID, form.Name)
 
 	if err != nil {
@@ -157,19 +457,47 @@ func (api *API) FileMove(c *gin.Context, form *forms.FileMove) *APIResult {
 		form.DirectoryID = owner
 	}
 
-	err := api.fileServ.MoveFile(owner, form.ID, form.DirectoryID)
+	err := api.fileService(c).MoveFile(owner, form.ID, form.DirectoryID)
 	if err != nil {
 		return fileErrorToAPIResult(err)
 	}
 	return OK(nil, nil)
 }
 
+//FileCopy 复制文件API，文件数量较多时在后台复制并返回任务
+//PUT /api/v1/file/{id}/copy
+func (api *API) FileCopy(c *gin.Context, form *forms.FileCopy) *APIResult {
+	owner := c.GetString("userID")
+
+	if form.DirectoryID == "@" {
+		form.DirectoryID = owner
+	}
+
+	result, err := api.fileService(c).CopyFile(owner, form.ID, form.DirectoryID)
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(result, nil)
+}
+
+//FileExtract 将zip、tar或tar.gz归档解压到文件夹API，项目较多时返回后台任务
+//PUT /api/v1/file/{id}/extract
+func (api *API) FileExtract(c *gin.Context, form *forms.FileExtract) *APIResult {
+	owner := c.GetString("userID")
+
+	result, err := api.fileService(c).ExtractArchive(owner, form.ID, form.DirectoryID, form.Conflict)
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(result, nil)
+}
+
 //FileRename 修改文件名称API
 //PUT /api/v1/file/{id}/rename
 func (api *API) FileRename(c *gin.Context, form *forms.FileRename) *APIResult {
 	owner := c.GetString("userID")
 
-	err := api.fileServ.RenameFile(owner, form.ID, form.NewName)
+	err := api.fileService(c).RenameFile(owner, form.ID, form.NewName)
 	if err != nil {
 		return fileErrorToAPIResult(err)
 	}
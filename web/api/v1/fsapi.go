@@ -0,0 +1,86 @@
+package v1
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/phantom-atom/file-explorer/services"
+	"github.com/phantom-atom/file-explorer/web/forms"
+)
+
+//FSGet 按路径获取文件API，info为true时返回文件信息，否则文件夹返回文件列表，文件返回内容
+//GET,HEAD /api/v1/fs/{path}
+func (api *API) FSGet(c *gin.Context, form *forms.FSGet) *APIResult {
+	owner := c.GetString("userID")
+
+	file, err := api.fileService(c).GetFileByPath(owner, form.Path)
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+
+	if form.Info {
+		return OK(file, nil)
+	}
+
+	if file.IsDir {
+		files, err := api.fileService(c).GetFileByPID(owner, file.FID, form.Limit, form.Offset)
+		if err != nil {
+			return fileErrorToAPIResult(err)
+		}
+		return OK(files, nil)
+	}
+
+	content, fileInfo, err := api.fileService(c).Download(owner, file.FID)
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(nil, fileResponder(content, fileInfo, form.Inline))
+}
+
+//FSPut 按路径上传文件API，请求体为文件内容，父文件夹需要已经存在，同名文件的原内容保存为历史版本
+//PUT /api/v1/fs/{path}
+func (api *API) FSPut(c *gin.Context) *APIResult {
+	owner := c.GetString("userID")
+
+	//请求体为文件内容，只绑定路径和查询参数
+	form := &forms.FSPut{}
+	if err := c.ShouldBindUri(form); err != nil {
+		return InvalidArgument(err, nil)
+	}
+
+	if err := c.ShouldBindQuery(form); err != nil {
+		return InvalidArgument(err, nil)
+	}
+
+	//chunked请求的ContentLength为-1，上传时按照剩余空间限制写入的字节数
+	file, err := api.fileService(c).CreateFileByPath(owner, form.Path, c.Request.ContentLength, c.Request.Body,
+		&services.Digest{
+			SHA256: form.SHA256,
+			MD5:    form.MD5,
+		})
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(file, nil)
+}
+
+//FSDelete 按路径删除文件API
+//DELETE /api/v1/fs/{path}
+func (api *API) FSDelete(c *gin.Context, form *forms.FSPath) *APIResult {
+	owner := c.GetString("userID")
+
+	if err := api.fileService(c).DeleteFileByPath(owner, form.Path); err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(nil, nil)
+}
+
+//FSMkcol 按路径创建文件夹API，会创建路径中所有不存在的文件夹
+//MKCOL /api/v1/fs/{path}
+func (api *API) FSMkcol(c *gin.Context, form *forms.FSPath) *APIResult {
+	owner := c.GetString("userID")
+
+	directory, err := api.fileService(c).MakeDirectories(owner, form.Path)
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(directory, nil)
+}
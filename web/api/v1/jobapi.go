@@ -0,0 +1,18 @@
+package v1
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/phantom-atom/file-explorer/web/forms"
+)
+
+//JobGet 获取后台任务状态以及进度API
+//GET /api/v1/job/{id}
+func (api *API) JobGet(c *gin.Context, form *forms.JobID) *APIResult {
+	owner := c.GetString("userID")
+
+	job, err := api.fileService(c).GetJob(owner, form.ID)
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(job, nil)
+}
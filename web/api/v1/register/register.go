@@ -1,11 +1,14 @@
 package register
 
 import (
+	"strings"
+
 	"github.com/gin-gonic/gin"
 	"github.com/phantom-atom/file-explorer/internal/utils/httputil"
 	"github.com/phantom-atom/file-explorer/middleware"
 	"github.com/phantom-atom/file-explorer/models"
 	v1 "github.com/phantom-atom/file-explorer/web/api/v1"
+	"github.com/phantom-atom/file-explorer/web/dav"
 )
 
 //APIGINRegister 注册gin路由
@@ -23,7 +26,10 @@ func APIGINRegister(
 		c.Next()
 	})
 
-	router.OPTIONS("/*path", api.Gin(func(c *gin.Context) *v1.APIResult {
+	router.OPTIONS("/api/*path", api.Gin(func(c *gin.Context) *v1.APIResult {
+		if strings.HasPrefix(c.Request.URL.Path, "/api/v1/tus") {
+			return api.TusOptions(c)
+		}
 		return v1.OK(nil, nil)
 	}))
 
@@ -36,16 +42,109 @@ func APIGINRegister(
 	userRouter.POST("/password/reset_code", ginAPIFunc(api.UserResetPasswordCode))
 	userRouter.POST("/password/reset", ginAPIFunc(api.UserResetPassword))
 	userRouter.GET("/current", authAPIMiddleware, api.Gin(api.UserCurrentInfo))
+	userRouter.GET("/usage", authAPIMiddleware, api.Gin(api.UserUsage))
 
 	fileRouter := apiRouter.Group("/file")
 	fileRouter.Use(authAPIMiddleware)
 	fileRouter.POST("/upload", ginAPIFunc(api.FileUpload))
+	fileRouter.POST("/instant", ginAPIFunc(api.FileInstantUpload))
 	fileRouter.POST("/mkdir", ginAPIFunc(api.FileMkdir))
+	fileRouter.POST("/archive", ginAPIFunc(api.FileArchiveBatch))
+	fileRouter.POST("/batch", ginAPIFunc(api.FileBatch))
 	fileRouter.PUT("/:id/rename", ginAPIFunc(api.FileRename))
 	fileRouter.PUT("/:id/move", ginAPIFunc(api.FileMove))
-	fileRouter.GET("/", api.Gin(api.FileGetRootList))
+	fileRouter.PUT("/:id/copy", ginAPIFunc(api.FileCopy))
+	//gin不允许POST /:id/extract与POST /upload等静态路径并列，与move、copy一样使用PUT
+	fileRouter.PUT("/:id/extract", ginAPIFunc(api.FileExtract))
+	fileRouter.GET("/", ginAPIFunc(api.FileGetRootList))
 	fileRouter.GET("/:id", ginAPIFunc(api.FileDownload))
+	fileRouter.HEAD("/:id", ginAPIFunc(api.FileDownload))
 	fileRouter.GET("/:id/info", ginAPIFunc(api.FileGetInfo))
 	fileRouter.GET("/:id/list", ginAPIFunc(api.FileGetList))
+	fileRouter.GET("/:id/archive", ginAPIFunc(api.FileArchive))
+	fileRouter.GET("/:id/thumbnail", ginAPIFunc(api.FileThumbnail))
 	fileRouter.DELETE("/:id", ginAPIFunc(api.FileDelete))
+	fileRouter.GET("/:id/shares", ginAPIFunc(api.FileShareList))
+	fileRouter.GET("/:id/versions", ginAPIFunc(api.FileVersionList))
+	fileRouter.GET("/:id/versions/:vid", ginAPIFunc(api.FileVersionDownload))
+	fileRouter.PUT("/:id/versions/:vid/restore", ginAPIFunc(api.FileVersionRestore))
+	fileRouter.DELETE("/:id/versions/:vid", ginAPIFunc(api.FileVersionDelete))
+	fileRouter.GET("/:id/tags", ginAPIFunc(api.FileTagList))
+	fileRouter.PUT("/:id/tags", ginAPIFunc(api.FileTagSet))
+	fileRouter.PATCH("/:id/tags", ginAPIFunc(api.FileTagUpdate))
+	fileRouter.DELETE("/:id/tags/:tag", ginAPIFunc(api.FileTagDelete))
+	fileRouter.GET("/:id/metadata", ginAPIFunc(api.FileMetadataGet))
+	fileRouter.PUT("/:id/metadata", ginAPIFunc(api.FileMetadataSet))
+	fileRouter.PATCH("/:id/metadata", ginAPIFunc(api.FileMetadataUpdate))
+	fileRouter.DELETE("/:id/metadata/:key", ginAPIFunc(api.FileMetadataDelete))
+
+	//gin不允许静态路径与/file/:id并列，搜索使用独立的路径
+	apiRouter.GET("/search", authAPIMiddleware, ginAPIFunc(api.FileSearch))
+	apiRouter.GET("/tags", authAPIMiddleware, api.Gin(api.TagList))
+
+	fsRouter := apiRouter.Group("/fs")
+	fsRouter.Use(authAPIMiddleware)
+	fsRouter.GET("/*path", ginAPIFunc(api.FSGet))
+	fsRouter.HEAD("/*path", ginAPIFunc(api.FSGet))
+	fsRouter.PUT("/*path", api.Gin(api.FSPut))
+	fsRouter.DELETE("/*path", ginAPIFunc(api.FSDelete))
+	fsRouter.Handle("MKCOL", "/*path", ginAPIFunc(api.FSMkcol))
+
+	jobRouter := apiRouter.Group("/job")
+	jobRouter.Use(authAPIMiddleware)
+	jobRouter.GET("/:id", ginAPIFunc(api.JobGet))
+
+	trashRouter := apiRouter.Group("/trash")
+	trashRouter.Use(authAPIMiddleware)
+	trashRouter.GET("", ginAPIFunc(api.TrashGetList))
+	trashRouter.PUT("/:id/restore", ginAPIFunc(api.TrashRestore))
+	trashRouter.DELETE("/:id", ginAPIFunc(api.TrashDelete))
+	trashRouter.DELETE("", api.Gin(api.TrashEmpty))
+
+	tusRouter := apiRouter.Group("/tus")
+	tusRouter.Use(api.Gin(api.TusResumable), authAPIMiddleware)
+	tusRouter.POST("", api.Gin(api.TusCreate))
+	tusRouter.HEAD("/:id", ginAPIFunc(api.TusHead))
+	tusRouter.PATCH("/:id", ginAPIFunc(api.TusPatch))
+	tusRouter.DELETE("/:id", ginAPIFunc(api.TusDelete))
+
+	webhookRouter := apiRouter.Group("/webhooks")
+	webhookRouter.Use(authAPIMiddleware)
+	registerWebhookRoutes(webhookRouter, api, ginAPIFunc)
+
+	apiRouter.GET("/activity", authAPIMiddleware, ginAPIFunc(api.ActivityList))
+
+	//全局webhook和所有用户的操作日志只有管理员可以访问
+	adminRouter := apiRouter.Group("/admin")
+	adminRouter.Use(api.Gin(authMiddleware.HandlerFunc(models.UserRoleAdmin)))
+	registerWebhookRoutes(adminRouter.Group("/webhooks"), api, ginAPIFunc)
+	adminRouter.GET("/activity", ginAPIFunc(api.AdminActivityList))
+
+	shareRouter := apiRouter.Group("/share")
+	shareRouter.POST("", authAPIMiddleware, ginAPIFunc(api.ShareCreate))
+	shareRouter.GET("/:code", ginAPIFunc(api.ShareInfo))
+	shareRouter.GET("/:code/list", ginAPIFunc(api.ShareFileList))
+	shareRouter.GET("/:code/download", ginAPIFunc(api.ShareDownload))
+	shareRouter.POST("/:code/download", ginAPIFunc(api.ShareDownload))
+	shareRouter.DELETE("/:code", authAPIMiddleware, ginAPIFunc(api.ShareRevoke))
+}
+
+func registerWebhookRoutes(router *gin.RouterGroup, api *v1.API, ginAPIFunc func(interface{}) gin.HandlerFunc) {
+	router.POST("", ginAPIFunc(api.WebhookCreate))
+	router.GET("", api.Gin(api.WebhookList))
+	router.PATCH("/:id", ginAPIFunc(api.WebhookUpdate))
+	router.DELETE("/:id", ginAPIFunc(api.WebhookDelete))
+	router.GET("/:id/deliveries", ginAPIFunc(api.WebhookDeliveryList))
+}
+
+//DAVGINRegister 注册WebDAV路由，挂载在/dav/，支持HTTP Basic认证以及token认证
+func DAVGINRegister(
+	handler *dav.Handler,
+	router *gin.RouterGroup,
+	authMiddleware *middleware.Authorization,
+) {
+	davAuthMiddleware := authMiddleware.BasicHandlerFunc(models.UserRoleUser)
+	for _, method := range dav.Methods {
+		router.Handle(method, "/dav/*path", davAuthMiddleware, handler.HandlerFunc)
+	}
 }
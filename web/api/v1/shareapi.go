@@ -0,0 +1,121 @@
+package v1
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phantom-atom/file-explorer/models"
+	"github.com/phantom-atom/file-explorer/services"
+	"github.com/phantom-atom/file-explorer/web/forms"
+)
+
+//sharePasswordHeader 分享访问密码请求头
+const sharePasswordHeader = "X-Share-Password"
+
+//sharePassword 获取分享访问密码，密码只从请求头或POST表单中读取，
+//放在查询参数中会被记录到访问日志、浏览器历史以及Referer中
+func sharePassword(c *gin.Context) string {
+	if pwd := c.GetHeader(sharePasswordHeader); pwd != "" {
+		return pwd
+	}
+
+	if c.Request.Method == http.MethodPost {
+		return c.PostForm("password")
+	}
+	return ""
+}
+
+//countsAsDownload 判断请求是否计入分享的下载次数，视频播放器和分段下载工具对同一个文件发出多个Range请求，
+//只有完整下载或者从第一个字节开始的Range请求才计数
+func countsAsDownload(rangeHeader string) bool {
+	rangeHeader = strings.TrimSpace(rangeHeader)
+	if rangeHeader == "" {
+		return true
+	}
+
+	if !strings.HasPrefix(rangeHeader, "bytes=") {
+		return true
+	}
+
+	spec := strings.TrimSpace(strings.SplitN(rangeHeader[len("bytes="):], ",", 2)[0])
+	return strings.TrimSpace(strings.SplitN(spec, "-", 2)[0]) == "0"
+}
+
+//ShareCreate 创建文件分享API
+//POST /api/v1/share
+func (api *API) ShareCreate(c *gin.Context, form *forms.FileShare) *APIResult {
+	owner := c.GetString("userID")
+
+	share, err := api.fileService(c).CreateShare(owner, form.FileID, &services.ShareParams{
+		Password:     form.Password,
+		Expiration:   time.Duration(form.Expiration) * time.Second,
+		MaxDownloads: form.MaxDownloads,
+	})
+
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(share, nil)
+}
+
+//FileShareList 获取文件分享列表API
+//GET /api/v1/file/{id}/shares
+func (api *API) FileShareList(c *gin.Context, form *forms.FileID) *APIResult {
+	owner := c.GetString("userID")
+
+	shares, err := api.fileService(c).GetSharesByFID(owner, form.ID)
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(shares, nil)
+}
+
+//ShareRevoke 撤销文件分享API
+//DELETE /api/v1/share/{code}
+func (api *API) ShareRevoke(c *gin.Context, form *forms.ShareCode) *APIResult {
+	owner := c.GetString("userID")
+
+	err := api.fileService(c).RevokeShare(owner, form.Code)
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(nil, nil)
+}
+
+//ShareInfo 获取分享信息API
+//GET /api/v1/share/{code}
+func (api *API) ShareInfo(c *gin.Context, form *forms.ShareAccess) *APIResult {
+	share, file, err := api.fileService(c).GetShare(form.Code, sharePassword(c))
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+
+	return OK(&struct {
+		*models.Share
+		File *models.File `json:"file"`
+	}{share, file}, nil)
+}
+
+//ShareFileList 获取分享文件夹文件列表API
+//GET /api/v1/share/{code}/list
+func (api *API) ShareFileList(c *gin.Context, form *forms.ShareQuery) *APIResult {
+	files, err := api.fileService(c).GetSharedFileList(form.Code, sharePassword(c),
+		form.FileID, form.Limit, form.Offset)
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(files, nil)
+}
+
+//ShareDownload 下载分享文件API
+//GET/POST /api/v1/share/{code}/download
+func (api *API) ShareDownload(c *gin.Context, form *forms.ShareDownload) *APIResult {
+	file, fileInfo, err := api.fileService(c).DownloadShare(form.Code, sharePassword(c), form.FileID,
+		countsAsDownload(c.GetHeader("Range")))
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(nil, fileResponder(file, fileInfo, form.Inline))
+}
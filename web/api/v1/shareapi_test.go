@@ -0,0 +1,67 @@
+package v1
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSharePassword(t *testing.T) {
+	cases := []struct {
+		method string
+		target string
+		header string
+		body   string
+		want   string
+	}{
+		{http.MethodGet, "/share/code", "", "", ""},
+		{http.MethodGet, "/share/code", "secret", "", "secret"},
+		{http.MethodGet, "/share/code?password=secret", "", "", ""},
+		{http.MethodPost, "/share/code/download", "", "password=secret", "secret"},
+		{http.MethodPost, "/share/code/download", "header", "password=body", "header"},
+		{http.MethodPost, "/share/code/download?password=secret", "", "", ""},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.target, strings.NewReader(c.body))
+		if c.body != "" {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		if c.header != "" {
+			req.Header.Set(sharePasswordHeader, c.header)
+		}
+
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = req
+
+		if got := sharePassword(ctx); got != c.want {
+			t.Errorf("%s %s: sharePassword() = %q, want %q", c.method, c.target, got, c.want)
+		}
+	}
+}
+
+func TestCountsAsDownload(t *testing.T) {
+	cases := []struct {
+		header   string
+		expected bool
+	}{
+		{"", true},
+		{"bytes=0-", true},
+		{"bytes=0-1023", true},
+		{"bytes= 0-1023, 2048-", true},
+		{"bytes=1024-", false},
+		{"bytes=1024-2047", false},
+		{"bytes=-500", false},
+		{"bytes=1024-2047, 0-10", false},
+		{"items=1-2", true},
+	}
+
+	for _, c := range cases {
+		if actual := countsAsDownload(c.header); actual != c.expected {
+			t.Errorf("countsAsDownload(%q) = %v, expected %v", c.header, actual, c.expected)
+		}
+	}
+}
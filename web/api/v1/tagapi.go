@@ -0,0 +1,114 @@
+package v1
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/phantom-atom/file-explorer/web/forms"
+)
+
+//TagList 获取当前用户的所有标签以及使用该标签的文件数量API
+//GET /api/v1/tags
+func (api *API) TagList(c *gin.Context) *APIResult {
+	owner := c.GetString("userID")
+
+	tags, err := api.fileService(c).GetTags(owner)
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(tags, nil)
+}
+
+//FileTagList 获取文件标签API
+//GET /api/v1/file/{id}/tags
+func (api *API) FileTagList(c *gin.Context, form *forms.FileID) *APIResult {
+	owner := c.GetString("userID")
+
+	tags, err := api.fileService(c).GetFileTags(owner, form.ID)
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(tags, nil)
+}
+
+//FileTagSet 替换文件的所有标签API
+//PUT /api/v1/file/{id}/tags
+func (api *API) FileTagSet(c *gin.Context, form *forms.FileTags) *APIResult {
+	owner := c.GetString("userID")
+
+	tags, err := api.fileService(c).UpdateFileTags(owner, form.ID, form.Tags, nil, true)
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(tags, nil)
+}
+
+//FileTagUpdate 添加或删除文件标签API
+//PATCH /api/v1/file/{id}/tags
+func (api *API) FileTagUpdate(c *gin.Context, form *forms.FileTagsUpdate) *APIResult {
+	owner := c.GetString("userID")
+
+	tags, err := api.fileService(c).UpdateFileTags(owner, form.ID, form.Add, form.Remove, false)
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(tags, nil)
+}
+
+//FileTagDelete 删除文件的一个标签API
+//DELETE /api/v1/file/{id}/tags/{tag}
+func (api *API) FileTagDelete(c *gin.Context, form *forms.FileTag) *APIResult {
+	owner := c.GetString("userID")
+
+	tags, err := api.fileService(c).UpdateFileTags(owner, form.ID, nil, []string{form.Tag}, false)
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(tags, nil)
+}
+
+//FileMetadataGet 获取文件元数据API
+//GET /api/v1/file/{id}/metadata
+func (api *API) FileMetadataGet(c *gin.Context, form *forms.FileID) *APIResult {
+	owner := c.GetString("userID")
+
+	metadata, err := api.fileService(c).GetFileMetadata(owner, form.ID)
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(metadata, nil)
+}
+
+//FileMetadataSet 替换文件的所有元数据API
+//PUT /api/v1/file/{id}/metadata
+func (api *API) FileMetadataSet(c *gin.Context, form *forms.FileMetadata) *APIResult {
+	owner := c.GetString("userID")
+
+	metadata, err := api.fileService(c).UpdateFileMetadata(owner, form.ID, form.Metadata, nil, true)
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(metadata, nil)
+}
+
+//FileMetadataUpdate 设置文件的部分元数据API，未包含的键保持不变
+//PATCH /api/v1/file/{id}/metadata
+func (api *API) FileMetadataUpdate(c *gin.Context, form *forms.FileMetadata) *APIResult {
+	owner := c.GetString("userID")
+
+	metadata, err := api.fileService(c).UpdateFileMetadata(owner, form.ID, form.Metadata, nil, false)
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(metadata, nil)
+}
+
+//FileMetadataDelete 删除文件的一个元数据API
+//DELETE /api/v1/file/{id}/metadata/{key}
+func (api *API) FileMetadataDelete(c *gin.Context, form *forms.FileMetadataKey) *APIResult {
+	owner := c.GetString("userID")
+
+	metadata, err := api.fileService(c).UpdateFileMetadata(owner, form.ID, nil, []string{form.Key}, false)
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(metadata, nil)
+}
@@ -0,0 +1,52 @@
+package v1
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/phantom-atom/file-explorer/web/forms"
+)
+
+//TrashGetList 获取回收站项目列表API
+//GET /api/v1/trash
+func (api *API) TrashGetList(c *gin.Context, form *forms.TrashQuery) *APIResult {
+	owner := c.GetString("userID")
+
+	items, err := api.fileService(c).GetTrashItems(owner, form.Limit, form.Offset)
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(items, nil)
+}
+
+//TrashRestore 恢复回收站项目API
+//PUT /api/v1/trash/{id}/restore
+func (api *API) TrashRestore(c *gin.Context, form *forms.TrashID) *APIResult {
+	owner := c.GetString("userID")
+
+	file, err := api.fileService(c).RestoreTrashItem(owner, form.ID)
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(file, nil)
+}
+
+//TrashDelete 永久删除回收站项目API
+//DELETE /api/v1/trash/{id}
+func (api *API) TrashDelete(c *gin.Context, form *forms.TrashID) *APIResult {
+	owner := c.GetString("userID")
+
+	if err := api.fileService(c).DeleteTrashItem(owner, form.ID); err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(nil, nil)
+}
+
+//TrashEmpty 清空回收站API
+//DELETE /api/v1/trash
+func (api *API) TrashEmpty(c *gin.Context) *APIResult {
+	owner := c.GetString("userID")
+
+	if err := api.fileService(c).EmptyTrash(owner); err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(nil, nil)
+}
@@ -0,0 +1,198 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phantom-atom/file-explorer/internal/utils/httputil"
+	"github.com/phantom-atom/file-explorer/models"
+	"github.com/phantom-atom/file-explorer/services"
+	"github.com/phantom-atom/file-explorer/web/forms"
+)
+
+const (
+	tusVersion     = "1.0.0"
+	tusExtension   = "creation,termination,expiration"
+	tusContentType = "application/offset+octet-stream"
+)
+
+var (
+	errTusVersionUnsupported = errors.New("unsupported tus version")
+	errTusInvalidLength      = errors.New("invalid Upload-Length")
+	errTusInvalidOffset      = errors.New("invalid Upload-Offset")
+	errTusInvalidContentType = errors.New("invalid Content-Type")
+	errTusMissingFilename    = errors.New("missing filename in Upload-Metadata")
+)
+
+//tusErrorToAPIResult 转换为tus协议要求的状态码
+func tusErrorToAPIResult(err error) *APIResult {
+	pathErr, ok := err.(*services.PathError)
+	if !ok {
+		return fileErrorToAPIResult(err)
+	}
+
+	switch pathErr.Err {
+	case services.ErrUploadOffsetMismatch:
+		return tusStatus(http.StatusConflict, err)
+	case services.ErrUploadTooLarge, services.ErrQuotaExceeded:
+		return tusStatus(http.StatusRequestEntityTooLarge, err)
+	case services.ErrUploadExpired:
+		return tusStatus(http.StatusGone, err)
+	default:
+		return fileErrorToAPIResult(err)
+	}
+}
+
+func tusStatus(code int, err error) *APIResult {
+	return OK(nil, func(c *gin.Context, data interface{}) error {
+		c.String(code, err.Error())
+		return nil
+	})
+}
+
+func tusUploadHeaders(c *gin.Context, upload *models.Upload) {
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	if upload.Finished() {
+		c.Header("X-File-ID", upload.FID)
+	}
+}
+
+//TusResumable tus协议版本检查中间件
+func (api *API) TusResumable(c *gin.Context) *APIResult {
+	c.Header("Tus-Resumable", tusVersion)
+	if c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		return tusStatus(http.StatusPreconditionFailed, errTusVersionUnsupported)
+	}
+	c.Next()
+	return nil
+}
+
+//TusOptions tus协议信息API
+//OPTIONS /api/v1/tus
+func (api *API) TusOptions(c *gin.Context) *APIResult {
+	return OK(nil, func(c *gin.Context, data interface{}) error {
+		c.Header("Tus-Resumable", tusVersion)
+		c.Header("Tus-Version", tusVersion)
+		c.Header("Tus-Extension", tusExtension)
+		if maxSize := api.config().FileService.Upload.MaxSize; maxSize > 0 {
+			c.Header("Tus-Max-Size", strconv.FormatInt(maxSize, 10))
+		}
+		c.Status(http.StatusNoContent)
+		return nil
+	})
+}
+
+//TusCreate 创建断点续传上传API
+//POST /api/v1/tus
+func (api *API) TusCreate(c *gin.Context) *APIResult {
+	owner := c.GetString("userID")
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		return tusStatus(http.StatusBadRequest, errTusInvalidLength)
+	}
+
+	rawMetadata := c.GetHeader("Upload-Metadata")
+	metadata, err := httputil.ParseTusMetadata(rawMetadata)
+	if err != nil {
+		return tusStatus(http.StatusBadRequest, err)
+	}
+
+	filename := metadata["filename"]
+	if filename == "" {
+		filename = metadata["name"]
+	}
+	if filename == "" {
+		return tusStatus(http.StatusBadRequest, errTusMissingFilename)
+	}
+
+	directoryID := metadata["directory_id"]
+	if directoryID == "" || directoryID == "@" {
+		directoryID = owner
+	}
+
+	upload, err := api.fileService(c).CreateUpload(owner, &services.UploadParams{
+		DirectoryID: directoryID,
+		Filename:    filename,
+		Length:      length,
+		Metadata:    rawMetadata,
+	})
+
+	if err != nil {
+		return tusErrorToAPIResult(err)
+	}
+
+	return OK(upload, func(c *gin.Context, data interface{}) error {
+		tusUploadHeaders(c, upload)
+		c.Header("Location", c.Request.URL.Path+"/"+upload.ID)
+		c.Status(http.StatusCreated)
+		return nil
+	})
+}
+
+//TusHead 获取断点续传上传偏移量API
+//HEAD /api/v1/tus/{id}
+func (api *API) TusHead(c *gin.Context, form *forms.UploadID) *APIResult {
+	owner := c.GetString("userID")
+
+	upload, err := api.fileService(c).GetUpload(owner, form.ID)
+	if err != nil {
+		return tusErrorToAPIResult(err)
+	}
+
+	return OK(upload, func(c *gin.Context, data interface{}) error {
+		tusUploadHeaders(c, upload)
+		c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+		if upload.Metadata != "" {
+			c.Header("Upload-Metadata", upload.Metadata)
+		}
+		c.Header("Cache-Control", "no-store")
+		c.Status(http.StatusOK)
+		return nil
+	})
+}
+
+//TusPatch 追加断点续传上传数据API
+//PATCH /api/v1/tus/{id}
+func (api *API) TusPatch(c *gin.Context, form *forms.UploadID) *APIResult {
+	owner := c.GetString("userID")
+
+	if c.ContentType() != tusContentType {
+		return tusStatus(http.StatusUnsupportedMediaType, errTusInvalidContentType)
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		return tusStatus(http.StatusBadRequest, errTusInvalidOffset)
+	}
+
+	upload, err := api.fileService(c).WriteUpload(owner, form.ID, offset, c.Request.Body)
+	if err != nil {
+		return tusErrorToAPIResult(err)
+	}
+
+	return OK(upload, func(c *gin.Context, data interface{}) error {
+		tusUploadHeaders(c, upload)
+		c.Status(http.StatusNoContent)
+		return nil
+	})
+}
+
+//TusDelete 终止断点续传上传API
+//DELETE /api/v1/tus/{id}
+func (api *API) TusDelete(c *gin.Context, form *forms.UploadID) *APIResult {
+	owner := c.GetString("userID")
+
+	if err := api.fileService(c).DeleteUpload(owner, form.ID); err != nil {
+		return tusErrorToAPIResult(err)
+	}
+
+	return OK(nil, func(c *gin.Context, data interface{}) error {
+		c.Status(http.StatusNoContent)
+		return nil
+	})
+}
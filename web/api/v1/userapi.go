@@ -30,7 +30,7 @@ func userErrorToAPIResult(err error) *APIResult {
 //UserEmailCodeGenerator 用户邮箱验证码生成API
 //POST /api/v1/user/email_code
 func (api *API) UserEmailCodeGenerator(c *gin.Context, form *forms.UserEmailCode) *APIResult {
-	_, err := api.userServ.CreateEmailVerificationCode(&services.UserRegisterCodeParams{
+	_, err := api.userService(c).CreateEmailVerificationCode(&services.UserRegisterCodeParams{
 		Email: form.Email,
 	})
 
@@ -43,7 +43,7 @@ func (api *API) UserEmailCodeGenerator(c *gin.Context, form *forms.UserEmailCode
 //UserRegister 用户注册API
 //POST /api/v1/user/register
 func (api *API) UserRegister(c *gin.Context, form *forms.UserRegister) *APIResult {
-	newUser, err := api.userServ.RegisterUser(&services.UserRegisterParams{
+	newUser, err := api.userService(c).RegisterUser(&services.UserRegisterParams{
 		Username: form.Username,
 		Email:    form.Email,
 		Password: form.Password,
@@ -61,7 +61,7 @@ func (api *API) UserRegister(c *gin.Context, form *forms.UserRegister) *APIResul
 //UserLogin 用户登录API
 //POST /api/v1/user/login
 func (api *API) UserLogin(c *gin.Context, form *forms.UserLogin) *APIResult {
-	token, err := api.userServ.LoginUser(&services.UserLoginParams{
+	token, err := api.userService(c).LoginUser(&services.UserLoginParams{
 		Identity:    form.Username,
 		Certificate: form.Password,
 	})
@@ -76,7 +76,7 @@ func (api *API) UserLogin(c *gin.Context, form *forms.UserLogin) *APIResult {
 //UserResetPasswordCode 用户修改密码验证码请求API
 //POST /api/v1/user/password/reset_code
 func (api *API) UserResetPasswordCode(c *gin.Context, form *forms.UserEmailCode) *APIResult {
-	_, err := api.userServ.CreateResetPWDVerificationCode(&services.UserResetPWDCodeParams{
+	_, err := api.userService(c).CreateResetPWDVerificationCode(&services.UserResetPWDCodeParams{
 		Email: form.Email,
 	})
 
@@ -90,7 +90,7 @@ func (api *API) UserResetPasswordCode(c *gin.Context, form *forms.UserEmailCode)
 //UserResetPassword 用户修改密码请求API
 //POST /api/v1/user/password/reset
 func (api *API) UserResetPassword(c *gin.Context, form *forms.UserResetPassword) *APIResult {
-	err := api.userServ.ResetPassword(&services.UserResetPasswordParams{
+	err := api.userService(c).ResetPassword(&services.UserResetPasswordParams{
 		Email:    form.Email,
 		Code:     form.Code,
 		Password: form.Password,
@@ -107,7 +107,7 @@ func (api *API) UserResetPassword(c *gin.Context, form *forms.UserResetPassword)
 //POST /api/v1/user/current
 func (api *API) UserCurrentInfo(c *gin.Context) *APIResult {
 	userID := c.GetString("userID")
-	user, err := api.userServ.GetUserByID(userID)
+	user, err := api.userService(c).GetUserByID(userID)
 
 	if err != nil {
 		return userErrorToAPIResult(err)
@@ -115,3 +115,16 @@ func (api *API) UserCurrentInfo(c *gin.Context) *APIResult {
 
 	return OK(user, nil)
 }
+
+//UserUsage 当前用户存储空间使用情况API，total为0时不限制
+//GET /api/v1/user/usage
+func (api *API) UserUsage(c *gin.Context) *APIResult {
+	userID := c.GetString("userID")
+	usage, err := api.fileService(c).GetUsage(userID)
+
+	if err != nil {
+		return userErrorToAPIResult(err)
+	}
+
+	return OK(usage, nil)
+}
@@ -0,0 +1,53 @@
+package v1
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/phantom-atom/file-explorer/web/forms"
+)
+
+//FileVersionList 获取文件历史版本列表API
+//GET /api/v1/file/{id}/versions
+func (api *API) FileVersionList(c *gin.Context, form *forms.FileID) *APIResult {
+	owner := c.GetString("userID")
+
+	versions, err := api.fileService(c).GetFileVersions(owner, form.ID)
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(versions, nil)
+}
+
+//FileVersionDownload 下载文件历史版本API，支持Range以及条件请求
+//GET /api/v1/file/{id}/versions/{vid}
+func (api *API) FileVersionDownload(c *gin.Context, form *forms.FileVersionDownload) *APIResult {
+	owner := c.GetString("userID")
+
+	file, fileInfo, err := api.fileService(c).DownloadFileVersion(owner, form.ID, form.VersionID)
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(nil, fileResponder(file, fileInfo, form.Inline))
+}
+
+//FileVersionRestore 恢复文件历史版本API，当前内容会保存为新的历史版本
+//PUT /api/v1/file/{id}/versions/{vid}/restore
+func (api *API) FileVersionRestore(c *gin.Context, form *forms.FileVersionID) *APIResult {
+	owner := c.GetString("userID")
+
+	file, err := api.fileService(c).RestoreFileVersion(owner, form.ID, form.VersionID)
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(file, nil)
+}
+
+//FileVersionDelete 删除文件历史版本API
+//DELETE /api/v1/file/{id}/versions/{vid}
+func (api *API) FileVersionDelete(c *gin.Context, form *forms.FileVersionID) *APIResult {
+	owner := c.GetString("userID")
+
+	if err := api.fileService(c).DeleteFileVersion(owner, form.ID, form.VersionID); err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(nil, nil)
+}
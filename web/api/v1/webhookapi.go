@@ -0,0 +1,88 @@
+package v1
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phantom-atom/file-explorer/models"
+	"github.com/phantom-atom/file-explorer/services"
+	"github.com/phantom-atom/file-explorer/web/forms"
+)
+
+//webhookOwner /api/v1/admin下的接口管理全局webhook，其它接口管理当前用户的webhook
+func webhookOwner(c *gin.Context) string {
+	if strings.HasPrefix(c.FullPath(), "/api/v1/admin/") {
+		return ""
+	}
+	return c.GetString("userID")
+}
+
+//WebhookCreate 创建webhook API，只有创建时返回签名密钥
+//POST /api/v1/webhooks
+//POST /api/v1/admin/webhooks
+func (api *API) WebhookCreate(c *gin.Context, form *forms.WebhookCreate) *APIResult {
+	webhook, err := api.webhookServ.CreateWebhook(webhookOwner(c), &services.WebhookParams{
+		URL:     form.URL,
+		Events:  form.Events,
+		Secret:  form.Secret,
+		Enabled: form.Enabled,
+	})
+
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+
+	return OK(&struct {
+		*models.Webhook
+		Secret string `json:"secret"`
+	}{webhook, webhook.Secret}, nil)
+}
+
+//WebhookList 获取webhook列表API
+//GET /api/v1/webhooks
+//GET /api/v1/admin/webhooks
+func (api *API) WebhookList(c *gin.Context) *APIResult {
+	webhooks, err := api.webhookServ.GetWebhooks(webhookOwner(c))
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(webhooks, nil)
+}
+
+//WebhookUpdate 修改webhook API
+//PATCH /api/v1/webhooks/{id}
+//PATCH /api/v1/admin/webhooks/{id}
+func (api *API) WebhookUpdate(c *gin.Context, form *forms.WebhookUpdate) *APIResult {
+	webhook, err := api.webhookServ.UpdateWebhook(webhookOwner(c), form.ID, &services.WebhookParams{
+		URL:     form.URL,
+		Events:  form.Events,
+		Secret:  form.Secret,
+		Enabled: form.Enabled,
+	})
+
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(webhook, nil)
+}
+
+//WebhookDelete 删除webhook API
+//DELETE /api/v1/webhooks/{id}
+//DELETE /api/v1/admin/webhooks/{id}
+func (api *API) WebhookDelete(c *gin.Context, form *forms.WebhookID) *APIResult {
+	if err := api.webhookServ.DeleteWebhook(webhookOwner(c), form.ID); err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(nil, nil)
+}
+
+//WebhookDeliveryList 获取webhook投递记录API
+//GET /api/v1/webhooks/{id}/deliveries?limit=100&offset=0
+//GET /api/v1/admin/webhooks/{id}/deliveries?limit=100&offset=0
+func (api *API) WebhookDeliveryList(c *gin.Context, form *forms.WebhookDeliveryQuery) *APIResult {
+	deliveries, err := api.webhookServ.GetWebhookDeliveries(webhookOwner(c), form.ID, form.Limit, form.Offset)
+	if err != nil {
+		return fileErrorToAPIResult(err)
+	}
+	return OK(deliveries, nil)
+}
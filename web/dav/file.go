@@ -0,0 +1,230 @@
+package dav
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/phantom-atom/file-explorer/models"
+	"github.com/phantom-atom/file-explorer/services"
+)
+
+//fileInfo os.FileInfo的实现，同时实现webdav.ContentTyper和webdav.ETager，
+//避免webdav.Handler读取文件内容来判断类型和计算ETag
+type fileInfo struct {
+	file *models.File
+}
+
+func (fi *fileInfo) Name() string {
+	if fi.file.Filename == "" {
+		return "/"
+	}
+	return fi.file.Filename
+}
+
+func (fi *fileInfo) Size() int64 {
+	return fi.file.Size
+}
+
+func (fi *fileInfo) Mode() os.FileMode {
+	if fi.file.IsDir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+func (fi *fileInfo) ModTime() time.Time {
+	return fi.file.UpdatedAt
+}
+
+func (fi *fileInfo) IsDir() bool {
+	return fi.file.IsDir
+}
+
+func (fi *fileInfo) Sys() interface{} {
+	return nil
+}
+
+func (fi *fileInfo) ContentType(ctx context.Context) (string, error) {
+	if fi.file.IsDir {
+		return "httpd/unix-directory", nil
+	}
+
+	if fi.file.ContentType == "" {
+		return "application/octet-stream", nil
+	}
+	return fi.file.ContentType, nil
+}
+
+func (fi *fileInfo) ETag(ctx context.Context) (string, error) {
+	return fi.file.ETag(), nil
+}
+
+//readFile 以只读方式打开的文件
+type readFile struct {
+	services.File
+	file *models.File
+}
+
+func (f *readFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, os.ErrInvalid
+}
+
+func (f *readFile) Stat() (os.FileInfo, error) {
+	return &fileInfo{file: f.file}, nil
+}
+
+func (f *readFile) Write(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+//directory 打开的文件夹，子文件在第一次Readdir时读取
+type directory struct {
+	fs      *fileSystem
+	file    *models.File
+	entries []os.FileInfo
+	loaded  bool
+}
+
+func (d *directory) Read(p []byte) (int, error) {
+	return 0, os.ErrInvalid
+}
+
+func (d *directory) Seek(offset int64, whence int) (int64, error) {
+	return 0, os.ErrInvalid
+}
+
+func (d *directory) Write(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+func (d *directory) Close() error {
+	return nil
+}
+
+func (d *directory) Stat() (os.FileInfo, error) {
+	return &fileInfo{file: d.file}, nil
+}
+
+//Readdir 与os.File.Readdir相同，count大于0时最多返回count个，没有更多时返回io.EOF
+func (d *directory) Readdir(count int) ([]os.FileInfo, error) {
+	if !d.loaded {
+		files, err := d.fs.fileServ.GetFileByPID(d.fs.owner, d.file.FID, 0, 0)
+		if err != nil {
+			return nil, toOSError(err)
+		}
+
+		d.entries = make([]os.FileInfo, len(files))
+		for i, file := range files {
+			d.entries[i] = &fileInfo{file: file}
+		}
+		d.loaded = true
+	}
+
+	if count <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	if count > len(d.entries) {
+		count = len(d.entries)
+	}
+	entries := d.entries[:count]
+	d.entries = d.entries[count:]
+	return entries, nil
+}
+
+//writeFile 以写入方式打开的文件，写入的内容通过管道交给FileService.CreateFileByPath保存，
+//同名文件的原内容保存为历史版本
+type writeFile struct {
+	writer *io.PipeWriter
+	done   chan struct{}
+	once   sync.Once
+	file   *models.File
+	err    error
+}
+
+func newWriteFile(fs *fileSystem, name string) *writeFile {
+	reader, writer := io.Pipe()
+	f := &writeFile{
+		writer: writer,
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(f.done)
+		f.file, f.err = fs.fileServ.CreateFileByPath(fs.owner, name, fs.uploadSize, reader, nil)
+		//保存失败时让写入方不再阻塞
+		reader.CloseWithError(f.err)
+	}()
+	return f
+}
+
+func (f *writeFile) Write(p []byte) (int, error) {
+	return f.writer.Write(p)
+}
+
+//ReadFrom 使io.Copy在读取请求体失败时放弃保存，而不是保存不完整的内容
+func (f *writeFile) ReadFrom(r io.Reader) (int64, error) {
+	buf := make([]byte, 32*1024)
+	var written int64
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			m, werr := f.Write(buf[:n])
+			written += int64(m)
+			if werr != nil {
+				return written, werr
+			}
+		}
+
+		if err == io.EOF {
+			return written, nil
+		}
+
+		if err != nil {
+			f.writer.CloseWithError(err)
+			return written, err
+		}
+	}
+}
+
+//finish 结束写入并等待保存完成
+func (f *writeFile) finish() error {
+	f.once.Do(func() {
+		f.writer.Close()
+		<-f.done
+	})
+	return toOSError(f.err)
+}
+
+func (f *writeFile) Read(p []byte) (int, error) {
+	return 0, os.ErrInvalid
+}
+
+func (f *writeFile) Seek(offset int64, whence int) (int64, error) {
+	return 0, os.ErrInvalid
+}
+
+func (f *writeFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, os.ErrInvalid
+}
+
+//Stat 返回保存后的文件信息，webdav.Handler在Close之前调用Stat生成ETag
+func (f *writeFile) Stat() (os.FileInfo, error) {
+	if err := f.finish(); err != nil {
+		return nil, err
+	}
+	return &fileInfo{file: f.file}, nil
+}
+
+func (f *writeFile) Close() error {
+	return f.finish()
+}
@@ -0,0 +1,117 @@
+package dav
+
+import (
+	"context"
+	"os"
+	"path"
+
+	"github.com/phantom-atom/file-explorer/services"
+	"golang.org/x/net/webdav"
+)
+
+//fileSystem webdav.FileSystem的实现，通过FileService访问owner的文件，
+//修改操作与REST API一样在FileService中持有owner的锁，uploadSize为PUT请求的内容大小，未知时为-1
+type fileSystem struct {
+	fileServ   *services.FileService
+	owner      string
+	uploadSize int64
+}
+
+//toOSError 转换FileService的错误为webdav.Handler可以识别的os错误
+func toOSError(err error) error {
+	pathErr, ok := err.(*services.PathError)
+	if !ok {
+		return err
+	}
+
+	switch pathErr.Err {
+	case services.ErrFileNotFound, services.ErrDirectoryNotFound, services.ErrParentNotADirectory:
+		return os.ErrNotExist
+	case services.ErrFileAlreadyExists:
+		return os.ErrExist
+	case services.ErrRootDirectory, services.ErrMoveIntoItself:
+		return os.ErrPermission
+	default:
+		return err
+	}
+}
+
+func (fs *fileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	name = path.Clean("/" + name)
+	if name == "/" {
+		return os.ErrExist
+	}
+
+	parent, err := fs.fileServ.GetFileByPath(fs.owner, path.Dir(name))
+	if err != nil {
+		return toOSError(err)
+	}
+
+	if !parent.IsDir {
+		return os.ErrNotExist
+	}
+
+	_, err = fs.fileServ.CreateDirectory(fs.owner, parent.FID, path.Base(name))
+	return toOSError(err)
+}
+
+func (fs *fileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC) != 0 {
+		return fs.create(name)
+	}
+
+	file, err := fs.fileServ.GetFileByPath(fs.owner, name)
+	if err != nil {
+		return nil, toOSError(err)
+	}
+
+	if file.IsDir {
+		return &directory{
+			fs:   fs,
+			file: file,
+		}, nil
+	}
+
+	content, file, err := fs.fileServ.Download(fs.owner, file.FID)
+	if err != nil {
+		return nil, toOSError(err)
+	}
+	return &readFile{
+		File: content,
+		file: file,
+	}, nil
+}
+
+//create 打开一个用于写入的文件，父文件夹需要已经存在，写入的内容在Close时保存
+func (fs *fileSystem) create(name string) (webdav.File, error) {
+	name = path.Clean("/" + name)
+	if name == "/" {
+		return nil, os.ErrPermission
+	}
+
+	parent, err := fs.fileServ.GetFileByPath(fs.owner, path.Dir(name))
+	if err != nil {
+		return nil, toOSError(err)
+	}
+
+	if !parent.IsDir {
+		return nil, os.ErrNotExist
+	}
+	return newWriteFile(fs, name), nil
+}
+
+func (fs *fileSystem) RemoveAll(ctx context.Context, name string) error {
+	return toOSError(fs.fileServ.DeleteFileByPath(fs.owner, name))
+}
+
+func (fs *fileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	return toOSError(fs.fileServ.RenameFileByPath(fs.owner, oldName, newName))
+}
+
+func (fs *fileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	file, err := fs.fileServ.GetFileByPath(fs.owner, name)
+	if err != nil {
+		return nil, toOSError(err)
+	}
+	return &fileInfo{file: file}, nil
+}
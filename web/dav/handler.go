@@ -0,0 +1,65 @@
+package dav
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phantom-atom/file-explorer/internal/log"
+	"github.com/phantom-atom/file-explorer/services"
+	"golang.org/x/net/webdav"
+)
+
+//Methods WebDAV处理器需要注册的HTTP方法
+var Methods = []string{
+	http.MethodOptions, http.MethodGet, http.MethodHead, http.MethodPost,
+	http.MethodPut, http.MethodDelete, "MKCOL", "COPY", "MOVE",
+	"LOCK", "UNLOCK", "PROPFIND", "PROPPATCH",
+}
+
+//Handler WebDAV处理器，每个用户看到的根目录为自己的根目录，
+//LOCK使用FileService中每个用户的锁表，REST API修改被锁定的文件时返回423，文件修改与REST API共用owner的锁
+type Handler struct {
+	prefix   string
+	fileServ *services.FileService
+}
+
+//NewHandler 创建WebDAV处理器，prefix为挂载的路径前缀
+func NewHandler(prefix string, fileServ *services.FileService) *Handler {
+	return &Handler{
+		prefix:   prefix,
+		fileServ: fileServ,
+	}
+}
+
+//HandlerFunc gin处理函数，需要在认证中间件之后使用
+func (h *Handler) HandlerFunc(c *gin.Context) {
+	owner := c.GetString("userID")
+
+	//PUT的内容大小用于写入前检查配额，COPY等其它请求写入的大小未知
+	uploadSize := int64(-1)
+	if c.Request.Method == http.MethodPut {
+		uploadSize = c.Request.ContentLength
+	}
+
+	handler := &webdav.Handler{
+		Prefix: h.prefix,
+		FileSystem: &fileSystem{
+			//webdav.Handler在修改之前已经根据If请求头确认过锁
+			fileServ: h.fileServ.WithLocksConfirmed().WithActor(&services.Actor{
+				UserID:    owner,
+				IP:        c.ClientIP(),
+				UserAgent: c.Request.UserAgent(),
+			}),
+			owner:      owner,
+			uploadSize: uploadSize,
+		},
+		LockSystem: h.fileServ.LockSystem(owner),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				log.Warn("msg", "webdav request failed", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+			}
+		},
+	}
+	handler.ServeHTTP(c.Writer, c.Request)
+	c.Abort()
+}
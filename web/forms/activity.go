@@ -0,0 +1,20 @@
+package forms
+
+import "time"
+
+//ActivityQuery 操作日志查询表单，action可以重复指定多个
+type ActivityQuery struct {
+	FileID  string    `form:"file_id" binding:"omitempty,uuid"`
+	Actor   string    `form:"actor" binding:"omitempty,uuid"`
+	Actions []string  `form:"action" binding:"omitempty,max=32"`
+	Since   time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00" binding:"omitempty"`
+	Until   time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00" binding:"omitempty"`
+	Cursor  string    `form:"cursor" binding:"omitempty"`
+	Limit   int       `form:"limit" binding:"omitempty,min=0,max=1000"`
+}
+
+//AdminActivityQuery 管理员操作日志查询表单，owner为空时查询所有用户
+type AdminActivityQuery struct {
+	ActivityQuery
+	Owner string `form:"owner" binding:"omitempty,uuid"`
+}
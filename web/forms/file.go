@@ -1,6 +1,15 @@
 package forms
 
-import "mime/multipart"
+import (
+	"mime/multipart"
+	"time"
+)
+
+//UploadModeNewVersion 上传同名文件时保存为新版本
+const UploadModeNewVersion = "new_version"
+
+//BatchModeBestEffort 批量操作中失败的操作不影响其他操作
+const BatchModeBestEffort = "best_effort"
 
 //FileID 文件ID表单
 type FileID struct {
@@ -13,6 +22,19 @@ type FileMove struct {
 	DirectoryID string `json:"directory_id" form:"directory_id" binding:"uuid"`
 }
 
+//FileCopy 文件复制表单
+type FileCopy struct {
+	FileID
+	DirectoryID string `json:"directory_id" form:"directory_id" binding:"uuid"`
+}
+
+//FileExtract 归档解压表单，DirectoryID为空时解压到归档所在的文件夹，Conflict为skip、rename或new_version
+type FileExtract struct {
+	FileID
+	DirectoryID string `json:"directory_id" form:"directory_id" binding:"omitempty,uuid"`
+	Conflict    string `json:"conflict" form:"conflict" binding:"omitempty,oneof=skip rename new_version"`
+}
+
 //FileRename 文件修改名称表单
 type FileRename struct {
 	FileID
@@ -25,20 +47,119 @@ type FileMkdir struct {
 	Name        string `json:"name" form:"name" binding:"required"`
 }
 
+//FileListQuery 文件夹列表查询表单，cursor为上一页返回的next_cursor，使用cursor时忽略offset
+type FileListQuery struct {
+	Limit     int    `json:"limit" form:"limit" binding:"omitempty,min=0,max=1000"`
+	Offset    int    `json:"offset" form:"offset" binding:"omitempty,min=0"`
+	Category  string `json:"category" form:"category" binding:"omitempty,oneof=image video audio document archive text"`
+	Tag       string `json:"tag" form:"tag" binding:"omitempty"`
+	Sort      string `json:"sort" form:"sort" binding:"omitempty,oneof=name size created_at updated_at"`
+	Order     string `json:"order" form:"order" binding:"omitempty,oneof=asc desc"`
+	DirsFirst bool   `json:"dirs_first" form:"dirs_first"`
+	Type      string `json:"type" form:"type" binding:"omitempty,oneof=file directory"`
+	Extension string `json:"ext" form:"ext" binding:"omitempty"`
+	Cursor    string `json:"cursor" form:"cursor" binding:"omitempty"`
+}
+
 //FileQuery 文件查询表单
 type FileQuery struct {
 	FileID
-	Limit  int `json:"limit" form:"limit" binding:"omitempty"`
-	Offset int `json:"offset" form:"offset" binding:"omitempty"`
+	FileListQuery
 }
 
-//FileUpload 文件上传表单
+//FileUpload 文件上传表单，SHA256和MD5为客户端计算的十六进制摘要，内容不一致时拒绝上传
 type FileUpload struct {
 	DirectoryID string                `form:"directory_id" binding:"omitempty,uuid"`
 	File        *multipart.FileHeader `form:"file" binding:"required"`
+	SHA256      string                `form:"sha256" binding:"omitempty,len=64,hexadecimal"`
+	MD5         string                `form:"md5" binding:"omitempty,len=32,hexadecimal"`
+}
+
+//FileInstantUpload 文件秒传表单
+type FileInstantUpload struct {
+	DirectoryID string `json:"directory_id" form:"directory_id" binding:"omitempty,uuid"`
+	Filename    string `json:"filename" form:"filename" binding:"required"`
+	Hash        string `json:"hash" form:"hash" binding:"required,len=64,hexadecimal"`
+	Size        int64  `json:"size" form:"size" binding:"min=0"`
+}
+
+//FileUploadMode 文件上传模式
+type FileUploadMode struct {
+	Mode string `form:"mode" binding:"omitempty,oneof=new_version"`
+}
+
+//FileThumbnail 文件缩略图表单
+type FileThumbnail struct {
+	FileID
+	Size string `form:"size" binding:"omitempty,oneof=small medium large"`
 }
 
 //FileDownload 文件下载
 type FileDownload struct {
+	ID     string `uri:"id" binding:"required,uuid"`
+	Inline bool   `form:"inline" binding:"omitempty"`
+}
+
+//FileArchive 文件夹归档下载表单
+type FileArchive struct {
+	FileID
+	Format string `form:"format" binding:"omitempty,oneof=zip tar.gz"`
+}
+
+//FileArchiveBatch 多文件归档下载表单
+type FileArchiveBatch struct {
+	FileIDs []string `json:"file_ids" form:"file_ids" binding:"required,min=1,dive,uuid"`
+	Format  string   `json:"format" form:"format" binding:"omitempty,oneof=zip tar.gz"`
+}
+
+//FileBatchOperation 批量操作中的一项，directory_id用于move和copy，new_name用于rename
+type FileBatchOperation struct {
+	Op          string `json:"op" binding:"required,oneof=delete move rename copy"`
+	FileID      string `json:"file_id" binding:"required,uuid"`
+	DirectoryID string `json:"directory_id"`
+	NewName     string `json:"new_name"`
+}
+
+//FileBatch 批量操作表单，mode默认为atomic，所有操作全部成功或者全部回滚
+type FileBatch struct {
+	Mode       string                `json:"mode" binding:"omitempty,oneof=atomic best_effort"`
+	Operations []*FileBatchOperation `json:"operations" binding:"required,min=1,max=1000,dive"`
+}
+
+//FileVersionID 文件历史版本ID表单
+type FileVersionID struct {
+	FileID
+	VersionID string `uri:"vid" binding:"required,uuid"`
+}
+
+//FileVersionDownload 文件历史版本下载表单
+type FileVersionDownload struct {
+	FileVersionID
+	Inline bool `form:"inline" binding:"omitempty"`
+}
+
+//UploadID 断点续传上传ID
+type UploadID struct {
 	ID string `uri:"id" binding:"required,uuid"`
 }
+
+//FileSearch 文件搜索表单，时间使用RFC3339格式
+type FileSearch struct {
+	Keyword       string    `form:"q" binding:"omitempty"`
+	Match         string    `form:"match" binding:"omitempty,oneof=substring prefix glob"`
+	DirectoryID   string    `form:"directory_id" binding:"omitempty,uuid"`
+	IsDir         *bool     `form:"isdir" binding:"omitempty"`
+	MinSize       int64     `form:"min_size" binding:"omitempty,min=0"`
+	MaxSize       int64     `form:"max_size" binding:"omitempty,min=0"`
+	CreatedAfter  time.Time `form:"created_after" time_format:"2006-01-02T15:04:05Z07:00" binding:"omitempty"`
+	CreatedBefore time.Time `form:"created_before" time_format:"2006-01-02T15:04:05Z07:00" binding:"omitempty"`
+	UpdatedAfter  time.Time `form:"updated_after" time_format:"2006-01-02T15:04:05Z07:00" binding:"omitempty"`
+	UpdatedBefore time.Time `form:"updated_before" time_format:"2006-01-02T15:04:05Z07:00" binding:"omitempty"`
+	Extension     string    `form:"ext" binding:"omitempty"`
+	Category      string    `form:"category" binding:"omitempty,oneof=image video audio document archive text"`
+	Tag           string    `form:"tag" binding:"omitempty"`
+	Sort          string    `form:"sort" binding:"omitempty,oneof=name size created_at updated_at"`
+	Order         string    `form:"order" binding:"omitempty,oneof=asc desc"`
+	Limit         int       `form:"limit" binding:"omitempty,min=0,max=1000"`
+	Offset        int       `form:"offset" binding:"omitempty,min=0"`
+}
@@ -0,0 +1,22 @@
+package forms
+
+//FSPath 文件路径表单，路径为/api/v1/fs之后的部分
+type FSPath struct {
+	Path string `uri:"path" binding:"required"`
+}
+
+//FSGet 按路径获取文件表单，info为true时返回文件信息，否则文件夹返回文件列表，文件返回内容
+type FSGet struct {
+	FSPath
+	Info   bool `form:"info" binding:"omitempty"`
+	Inline bool `form:"inline" binding:"omitempty"`
+	Limit  int  `form:"limit" binding:"omitempty"`
+	Offset int  `form:"offset" binding:"omitempty"`
+}
+
+//FSPut 按路径上传文件表单，请求体为文件内容，SHA256和MD5为客户端计算的十六进制摘要
+type FSPut struct {
+	FSPath
+	SHA256 string `form:"sha256" binding:"omitempty,len=64,hexadecimal"`
+	MD5    string `form:"md5" binding:"omitempty,len=32,hexadecimal"`
+}
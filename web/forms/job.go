@@ -0,0 +1,6 @@
+package forms
+
+//JobID 后台任务ID表单
+type JobID struct {
+	ID string `uri:"id" binding:"required,uuid"`
+}
@@ -0,0 +1,33 @@
+package forms
+
+//FileShare 文件分享创建表单
+type FileShare struct {
+	FileID       string `json:"file_id" form:"file_id" binding:"required,uuid"`
+	Password     string `json:"password" form:"password" binding:"omitempty,alphanum"`
+	Expiration   int64  `json:"expiration" form:"expiration" binding:"omitempty,min=0"`
+	MaxDownloads int    `json:"max_downloads" form:"max_downloads" binding:"omitempty,min=0"`
+}
+
+//ShareCode 分享码表单
+type ShareCode struct {
+	Code string `uri:"code" binding:"required,alphanum"`
+}
+
+//ShareAccess 分享访问表单，访问密码不放在表单中，见v1.sharePassword
+type ShareAccess struct {
+	ShareCode
+	FileID string `json:"file_id" form:"file_id" binding:"omitempty,uuid"`
+}
+
+//ShareDownload 分享文件下载表单
+type ShareDownload struct {
+	ShareAccess
+	Inline bool `form:"inline" binding:"omitempty"`
+}
+
+//ShareQuery 分享文件夹查询表单
+type ShareQuery struct {
+	ShareAccess
+	Limit  int `json:"limit" form:"limit" binding:"omitempty"`
+	Offset int `json:"offset" form:"offset" binding:"omitempty"`
+}
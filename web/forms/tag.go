@@ -0,0 +1,32 @@
+package forms
+
+//FileTags 文件标签表单，用于替换文件的所有标签
+type FileTags struct {
+	FileID
+	Tags []string `json:"tags" binding:"max=100"`
+}
+
+//FileTagsUpdate 文件标签修改表单，添加add中的标签并删除remove中的标签
+type FileTagsUpdate struct {
+	FileID
+	Add    []string `json:"add" binding:"max=100"`
+	Remove []string `json:"remove" binding:"max=100"`
+}
+
+//FileTag 文件单个标签表单
+type FileTag struct {
+	FileID
+	Tag string `uri:"tag" binding:"required"`
+}
+
+//FileMetadata 文件元数据表单
+type FileMetadata struct {
+	FileID
+	Metadata map[string]string `json:"metadata" binding:"max=100"`
+}
+
+//FileMetadataKey 文件单个元数据表单
+type FileMetadataKey struct {
+	FileID
+	Key string `uri:"key" binding:"required"`
+}
@@ -0,0 +1,12 @@
+package forms
+
+//TrashID 回收站项目ID表单
+type TrashID struct {
+	ID string `uri:"id" binding:"required,uuid"`
+}
+
+//TrashQuery 回收站查询表单
+type TrashQuery struct {
+	Limit  int `json:"limit" form:"limit" binding:"omitempty"`
+	Offset int `json:"offset" form:"offset" binding:"omitempty"`
+}
@@ -0,0 +1,30 @@
+package forms
+
+//WebhookCreate webhook创建表单，secret为空时由服务器生成
+type WebhookCreate struct {
+	URL     string   `json:"url" binding:"required,url"`
+	Events  []string `json:"events" binding:"required,min=1,max=32"`
+	Secret  string   `json:"secret" binding:"omitempty,min=16,max=256"`
+	Enabled *bool    `json:"enabled" binding:"omitempty"`
+}
+
+//WebhookID webhook ID表单
+type WebhookID struct {
+	ID string `uri:"id" binding:"required,uuid"`
+}
+
+//WebhookUpdate webhook修改表单，为空的字段不修改
+type WebhookUpdate struct {
+	WebhookID
+	URL     string   `json:"url" binding:"omitempty,url"`
+	Events  []string `json:"events" binding:"omitempty,max=32"`
+	Secret  string   `json:"secret" binding:"omitempty,min=16,max=256"`
+	Enabled *bool    `json:"enabled" binding:"omitempty"`
+}
+
+//WebhookDeliveryQuery webhook投递记录查询表单
+type WebhookDeliveryQuery struct {
+	WebhookID
+	Limit  int `form:"limit" binding:"omitempty,min=0,max=1000"`
+	Offset int `form:"offset" binding:"omitempty,min=0"`
+}
@@ -0,0 +1,103 @@
+package webhook
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+//ErrAddressNotAllowed 投递地址是本机、内网、链路本地或者保留地址
+var ErrAddressNotAllowed = errors.New("webhook: address is not allowed")
+
+//deniedNetworks 默认禁止投递的网络，包括本机、内网、链路本地(含云服务器元数据地址)、组播以及保留地址
+var deniedNetworks = mustParseNetworks(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"64:ff9b::/96",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+)
+
+func mustParseNetworks(cidrs ...string) []*net.IPNet {
+	networks, err := ParseNetworks(cidrs)
+	if err != nil {
+		panic(err)
+	}
+	return networks
+}
+
+//ParseNetworks 解析CIDR格式的网络列表
+func ParseNetworks(cidrs []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+//AddressAllowed 判断是否允许向ip投递，allowed中的网络总是允许，其它地址不能在deniedNetworks中
+func AddressAllowed(ip net.IP, allowed []*net.IPNet) bool {
+	for _, network := range allowed {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	for _, network := range deniedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+//NewHTTPClient 创建投递使用的http.Client，在DNS解析之后、建立连接之前检查地址，
+//只允许公网地址以及allowed中的网络；不使用环境变量中的代理，也不跟随重定向，重定向的响应作为投递失败处理
+func NewHTTPClient(timeout time.Duration, allowed []*net.IPNet) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			ip := net.ParseIP(host)
+			if ip == nil || !AddressAllowed(ip, allowed) {
+				return ErrAddressNotAllowed
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
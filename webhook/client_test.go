@@ -0,0 +1,95 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAddressAllowed(t *testing.T) {
+	allowed, err := ParseNetworks([]string{"10.1.0.0/16"})
+	if err != nil {
+		t.Fatalf("ParseNetworks error: %v", err)
+	}
+
+	cases := []struct {
+		ip       string
+		expected bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1::1", true},
+		{"127.0.0.1", false},
+		{"10.0.0.1", false},
+		{"10.1.2.3", true},
+		{"172.16.5.4", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+	}
+
+	for _, c := range cases {
+		if actual := AddressAllowed(net.ParseIP(c.ip), allowed); actual != c.expected {
+			t.Errorf("AddressAllowed(%s) = %v, expected %v", c.ip, actual, c.expected)
+		}
+	}
+}
+
+func TestHTTPClientRejectsLoopback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := NewClient(NewHTTPClient(time.Second, nil))
+	_, err := client.Deliver(context.Background(), &Request{
+		URL:       server.URL,
+		Secret:    "secret",
+		Timestamp: time.Now(),
+	})
+	if !errors.Is(err, ErrAddressNotAllowed) {
+		t.Errorf("Deliver to loopback error = %v, expected ErrAddressNotAllowed", err)
+	}
+
+	allowed, _ := ParseNetworks([]string{"127.0.0.0/8"})
+	client = NewClient(NewHTTPClient(time.Second, allowed))
+	code, err := client.Deliver(context.Background(), &Request{
+		URL:       server.URL,
+		Secret:    "secret",
+		Timestamp: time.Now(),
+	})
+	if err != nil || code != http.StatusNoContent {
+		t.Errorf("Deliver to allowed network = %d, %v", code, err)
+	}
+}
+
+func TestHTTPClientRefusesRedirect(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("redirect was followed")
+	}))
+	defer target.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusTemporaryRedirect)
+	}))
+	defer server.Close()
+
+	allowed, _ := ParseNetworks([]string{"127.0.0.0/8"})
+	client := NewClient(NewHTTPClient(time.Second, allowed))
+	code, err := client.Deliver(context.Background(), &Request{
+		URL:       server.URL,
+		Secret:    "secret",
+		Timestamp: time.Now(),
+	})
+	if err == nil || code != http.StatusTemporaryRedirect {
+		t.Errorf("Deliver = %d, %v, expected error with status 307", code, err)
+	}
+}
@@ -0,0 +1,152 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+//投递请求的头部
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+
+	signaturePrefix = "sha256="
+	userAgent       = "file-explorer-webhook/1.0"
+	maxResponseBody = 64 << 10
+)
+
+var (
+	//ErrInvalidSignature 签名无效
+	ErrInvalidSignature = errors.New("webhook: invalid signature")
+	//ErrExpiredTimestamp 请求时间超出允许的范围
+	ErrExpiredTimestamp = errors.New("webhook: timestamp is out of tolerance")
+)
+
+//Event 投递的请求体
+type Event struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Owner     string      `json:"owner"`
+	Data      interface{} `json:"data"`
+}
+
+//Request 一次投递请求
+type Request struct {
+	URL       string
+	Secret    string
+	Event     string
+	Delivery  string
+	Timestamp time.Time
+	Body      []byte
+}
+
+//Sign 计算请求体的签名，签名内容为Unix时间戳、"."以及请求体，结果为"sha256="加十六进制的HMAC-SHA256
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+//Verify 接收方校验请求的签名，请求时间与now相差超过tolerance时返回ErrExpiredTimestamp，tolerance为0时不检查时间
+func Verify(secret string, header http.Header, body []byte, now time.Time, tolerance time.Duration) error {
+	timestamp, err := strconv.ParseInt(header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	expected := Sign(secret, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(header.Get(HeaderSignature))) {
+		return ErrInvalidSignature
+	}
+
+	if tolerance > 0 {
+		diff := now.Sub(time.Unix(timestamp, 0))
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff > tolerance {
+			return ErrExpiredTimestamp
+		}
+	}
+	return nil
+}
+
+//Backoff 第attempt次投递失败后等待的时间，为delay*2^(attempt-1)，不超过maxDelay
+func Backoff(attempt int, delay time.Duration, maxDelay time.Duration) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= maxDelay || delay <= 0 {
+			return maxDelay
+		}
+	}
+
+	if delay > maxDelay {
+		return maxDelay
+	}
+	return delay
+}
+
+//Client webhook投递客户端
+type Client struct {
+	client *http.Client
+}
+
+//NewClient 创建投递客户端，client为空时使用http.DefaultClient
+func NewClient(client *http.Client) *Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Client{
+		client: client,
+	}
+}
+
+//Deliver 以POST发送一次投递，返回响应状态码，状态码不是2xx时返回错误
+func (c *Client) Deliver(ctx context.Context, request *Request) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, request.URL, bytes.NewReader(request.Body))
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+
+	timestamp := request.Timestamp.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set(HeaderEvent, request.Event)
+	req.Header.Set(HeaderDelivery, request.Delivery)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(request.Secret, timestamp, request.Body))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	//读取部分响应以便复用连接
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxResponseBody))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook: unexpected status code %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
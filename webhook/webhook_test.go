@@ -0,0 +1,101 @@
+package webhook
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDeliver(t *testing.T) {
+	timestamp := time.Unix(1600000000, 0)
+	body := []byte(`{"id":"event","type":"file.created"}`)
+
+	received := make(chan error, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, err := ioutil.ReadAll(r.Body)
+		if err == nil {
+			err = Verify("secret", r.Header, payload, timestamp.Add(time.Minute), 5*time.Minute)
+		}
+		if r.Header.Get(HeaderEvent) != "file.created" || r.Header.Get(HeaderDelivery) != "delivery" {
+			t.Errorf("headers = %v", r.Header)
+		}
+		received <- err
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.Client())
+	code, err := client.Deliver(context.Background(), &Request{
+		URL:       server.URL,
+		Secret:    "secret",
+		Event:     "file.created",
+		Delivery:  "delivery",
+		Timestamp: timestamp,
+		Body:      body,
+	})
+	if err != nil || code != http.StatusNoContent {
+		t.Fatalf("Deliver = %d, %v", code, err)
+	}
+	if err := <-received; err != nil {
+		t.Errorf("Verify on receiver error: %v", err)
+	}
+}
+
+func TestDeliverFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.Client())
+	code, err := client.Deliver(context.Background(), &Request{
+		URL:       server.URL,
+		Secret:    "secret",
+		Timestamp: time.Now(),
+	})
+	if err == nil || code != http.StatusServiceUnavailable {
+		t.Errorf("Deliver = %d, %v, want error with status 503", code, err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	body := []byte("body")
+	header := http.Header{}
+	header.Set(HeaderTimestamp, "1600000000")
+	header.Set(HeaderSignature, Sign("secret", now.Unix(), body))
+
+	if err := Verify("secret", header, body, now, time.Minute); err != nil {
+		t.Errorf("Verify error: %v", err)
+	}
+	if err := Verify("other", header, body, now, time.Minute); err != ErrInvalidSignature {
+		t.Errorf("Verify with wrong secret error = %v", err)
+	}
+	if err := Verify("secret", header, []byte("changed"), now, time.Minute); err != ErrInvalidSignature {
+		t.Errorf("Verify with changed body error = %v", err)
+	}
+	if err := Verify("secret", header, body, now.Add(time.Hour), time.Minute); err != ErrExpiredTimestamp {
+		t.Errorf("Verify with old timestamp error = %v", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	cases := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{4, 4 * time.Minute},
+		{10, time.Hour},
+		{100, time.Hour},
+	}
+	for _, c := range cases {
+		if got := Backoff(c.attempt, 30*time.Second, time.Hour); got != c.want {
+			t.Errorf("Backoff(%d) = %v, want %v", c.attempt, got, c.want)
+		}
+	}
+}